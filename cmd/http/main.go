@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"log"
 	"os"
 	"os/signal"
@@ -10,10 +11,19 @@ import (
 
 	"github.com/joho/godotenv"
 	"github.com/reginaldsourn/go-crud/config"
+	"github.com/reginaldsourn/go-crud/internal/adapters/auth"
 	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http"
+	primaryhandlers "github.com/reginaldsourn/go-crud/internal/adapters/primary/http/handlers"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/jobs"
 	dbadapter "github.com/reginaldsourn/go-crud/internal/adapters/secondary/db"
 	"github.com/reginaldsourn/go-crud/internal/adapters/secondary/db/migrations"
+	"github.com/reginaldsourn/go-crud/internal/adapters/secondary/keyfile"
+	"github.com/reginaldsourn/go-crud/internal/adapters/secondary/mailer"
+	"github.com/reginaldsourn/go-crud/internal/adapters/secondary/memory"
 	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+	"github.com/reginaldsourn/go-crud/pkg/password"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -55,19 +65,291 @@ func main() {
 	}
 
 	var usersStore ports.UserStore
+	var deviceStore ports.DeviceStore
+	var passwordResetStore ports.PasswordResetStore
+	var mfaStore ports.MFAStore
+	var apiKeyStore ports.APIKeyStore
+	var identityStore ports.ExternalIdentityStore
+	var sessionStore ports.SessionStore
+	var invitationStore ports.InvitationStore
+	var auditStore ports.AuditStore
 	if db != nil {
 		usersStore = dbadapter.NewGormUserStore(db)
+		deviceStore = dbadapter.NewGormDeviceStore(db)
+		passwordResetStore = dbadapter.NewGormPasswordResetStore(db)
+		mfaStore = dbadapter.NewGormMFAStore(db)
+		apiKeyStore = dbadapter.NewGormAPIKeyStore(db)
+		identityStore = dbadapter.NewGormExternalIdentityStore(db)
+		sessionStore = dbadapter.NewGormSessionStore(db)
+		invitationStore = dbadapter.NewGormInvitationStore(db)
+		auditStore = dbadapter.NewGormAuditStore(db)
 	}
 
-	router := http.NewRouter(http.RouterDependencies{
-		UserStore: usersStore,
-		JWTSecret: []byte(cfg.JWTSecret),
-		JWTTTL:    cfg.JWTTTL,
+	var loginAttempts ports.LoginAttemptStore
+	switch {
+	case cfg.LoginAttemptStore == "memory":
+		loginAttempts = memory.NewLoginAttemptStore()
+	case db != nil:
+		loginAttempts = dbadapter.NewGormLoginAttemptStore(db)
+	case cfg.LoginAttemptStore == "postgres":
+		log.Fatalf("LOGIN_ATTEMPT_STORE=postgres requires DATABASE_URL")
+	default:
+		loginAttempts = memory.NewLoginAttemptStore()
+	}
+	var idempotencyStore ports.IdempotencyStore
+	switch {
+	case cfg.IdempotencyStore == "memory":
+		idempotencyStore = memory.NewIdempotencyStore()
+	case db != nil:
+		// Records outlive the process and are shared between instances, so
+		// their request hashes must not depend on a per-process secret.
+		if cfg.IdempotencySecret == "" {
+			log.Fatalf("IDEMPOTENCY_SECRET is required when idempotency records are kept in postgres")
+		}
+		idempotencyStore = dbadapter.NewGormIdempotencyStore(db)
+	case cfg.IdempotencyStore == "postgres":
+		log.Fatalf("IDEMPOTENCY_STORE=postgres requires DATABASE_URL")
+	default:
+		idempotencyStore = memory.NewIdempotencyStore()
+	}
+	idempotencySecret := []byte(cfg.IdempotencySecret)
+	if len(idempotencySecret) == 0 {
+		idempotencySecret = make([]byte, 32)
+		if _, err := rand.Read(idempotencySecret); err != nil {
+			log.Fatalf("failed to generate idempotency secret: %v", err)
+		}
+	}
+
+	loginThrottle := auth.NewLoginThrottle(loginAttempts, auth.ThrottleOptions{
+		FreeAttempts:    cfg.LoginFreeAttempts,
+		IPFreeAttempts:  cfg.LoginIPFreeAttempts,
+		BaseDelay:       cfg.LoginBackoffBase,
+		MaxDelay:        cfg.LoginBackoffMax,
+		MaxFailures:     cfg.LoginMaxFailures,
+		LockoutDuration: cfg.LoginLockoutDuration,
+		Window:          cfg.LoginAttemptWindow,
 	})
 
+	passwordPolicy := password.Policy{
+		MinLength:        cfg.PasswordMinLength,
+		MaxLength:        cfg.PasswordMaxLength,
+		RequireUpper:     cfg.PasswordRequireUpper,
+		RequireLower:     cfg.PasswordRequireLower,
+		RequireDigit:     cfg.PasswordRequireDigit,
+		RequireSymbol:    cfg.PasswordRequireSymbol,
+		DisallowUsername: true,
+	}
+	if cfg.PasswordBreachList != "" {
+		breached, err := password.LoadHashList(cfg.PasswordBreachList)
+		if err != nil {
+			log.Fatalf("breached password list load failed: %v", err)
+		}
+		passwordPolicy.Breached = breached
+	}
+
+	bcryptHasher := password.NewBcryptHasher(cfg.BcryptCost)
+	argon2Hasher := password.NewArgon2idHasher(password.Argon2idParams{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	})
+	var hasher ports.PasswordHasher = password.NewChain(argon2Hasher, bcryptHasher)
+	if cfg.PasswordHasher == "bcrypt" {
+		hasher = password.NewChain(bcryptHasher, argon2Hasher)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	if cfg.BootstrapAdminUsername != "" {
+		if usersStore == nil {
+			log.Fatalf("BOOTSTRAP_ADMIN_USERNAME requires DATABASE_URL")
+		}
+		users := services.NewUserService(usersStore, hasher, passwordPolicy, false)
+		created, err := users.BootstrapAdmin(ctx, services.NewUser{
+			Username: cfg.BootstrapAdminUsername,
+			Email:    cfg.BootstrapAdminEmail,
+			Password: cfg.BootstrapAdminPassword,
+		})
+		if err != nil {
+			log.Fatalf("bootstrap admin failed: %v", err)
+		}
+		if created {
+			log.Printf("created admin account %q", cfg.BootstrapAdminUsername)
+		}
+	}
+
+	var tokenKeys sharedauth.KeySource
+	var jwks primaryhandlers.JWKSProvider
+	if cfg.JWTSigningAlg == sharedauth.AlgHS256 {
+		tokenKeys, err = sharedauth.NewStaticHMAC([]byte(cfg.JWTSecret))
+		if err != nil {
+			log.Fatalf("token key setup failed: %v", err)
+		}
+	} else {
+		var keyStore ports.SigningKeyStore
+		switch {
+		case cfg.JWTKeyStore == "file":
+			keyStore, err = keyfile.NewStore(cfg.JWTKeysDir)
+		case db != nil:
+			keyStore = dbadapter.NewGormSigningKeyStore(db)
+		case cfg.JWTKeyStore == "postgres":
+			log.Fatalf("JWT_KEY_STORE=postgres requires DATABASE_URL")
+		default:
+			keyStore, err = keyfile.NewStore(cfg.JWTKeysDir)
+		}
+		if err != nil {
+			log.Fatalf("signing key store setup failed: %v", err)
+		}
+
+		keyset := sharedauth.NewKeyset()
+		rotator := auth.NewKeyRotator(keyStore, keyset, auth.KeyRotationOptions{
+			Algorithm: cfg.JWTSigningAlg,
+			Interval:  cfg.JWTKeyRotation,
+			Overlap:   cfg.JWTKeyOverlap,
+		})
+		if err := rotator.RotateIfDue(ctx); err != nil {
+			log.Fatalf("signing key load failed: %v", err)
+		}
+		go jobs.Every(ctx, "signing key rotation", cfg.JWTKeyCheckInterval, rotator.RotateIfDue)
+
+		tokenKeys = keyset
+		jwks = keyset
+	}
+
+	tokens, err := sharedauth.NewTokenService(sharedauth.TokenOptions{
+		Keys:     tokenKeys,
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+		TTL:      cfg.JWTTTL,
+		Leeway:   cfg.JWTLeeway,
+	})
+	if err != nil {
+		log.Fatalf("token service setup failed: %v", err)
+	}
+
+	var oidcClient *auth.OIDCClient
+	if cfg.OIDCIssuer != "" {
+		oidcClient, err = auth.NewOIDCClient(auth.OIDCOptions{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+			Leeway:       cfg.JWTLeeway,
+		})
+		if err != nil {
+			log.Fatalf("oidc setup failed: %v", err)
+		}
+	}
+
+	var mail ports.Mailer = mailer.NewLogMailer()
+	if cfg.SMTPHost != "" {
+		smtpMailer, err := mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+		if err != nil {
+			log.Fatalf("mailer setup failed: %v", err)
+		}
+		mail = smtpMailer
+	} else {
+		log.Printf("SMTP_HOST not set; outgoing mail will be logged")
+	}
+
+	router := http.NewRouter(http.RouterDependencies{
+		TrustedProxies: cfg.TrustedProxies,
+
+		UserStore:   usersStore,
+		DeviceStore: deviceStore,
+		Tokens:      tokens,
+		JWKS:        jwks,
+
+		PasswordResetStore: passwordResetStore,
+		Mailer:             mail,
+		PasswordResetURL:   cfg.PasswordResetURL,
+		PasswordResetTTL:   cfg.PasswordResetTTL,
+
+		InvitationStore:     invitationStore,
+		InvitationURL:       cfg.InvitationURL,
+		InvitationTTL:       cfg.InvitationTTL,
+		DisableRegistration: !cfg.RegistrationEnabled,
+
+		OIDC:                  oidcClient,
+		ExternalIdentityStore: identityStore,
+		OIDCOptions: primaryhandlers.OIDCHandlerOptions{
+			AutoProvision:     cfg.OIDCAutoProvision,
+			LinkByEmail:       cfg.OIDCLinkByEmail,
+			PostLoginRedirect: cfg.OIDCPostLoginRedirect,
+		},
+
+		SessionStore: sessionStore,
+
+		AuditStore: auditStore,
+
+		APIKeyStore: apiKeyStore,
+
+		MFAStore:    mfaStore,
+		MFAIssuer:   cfg.MFAIssuer,
+		MFATokenTTL: cfg.MFATokenTTL,
+
+		LoginThrottle: loginThrottle,
+
+		IdempotencyStore:  idempotencyStore,
+		IdempotencyTTL:    cfg.IdempotencyTTL,
+		IdempotencySecret: idempotencySecret,
+
+		ImpersonationTTL:    cfg.ImpersonationTTL,
+		AccountClosureGrace: cfg.AccountClosureGrace,
+
+		PasswordPolicy: passwordPolicy,
+		PasswordHasher: hasher,
+	})
+	if usersStore != nil {
+		go jobs.Every(ctx, "closed account purge", time.Hour, func(ctx context.Context) error {
+			purged, err := usersStore.PurgeClosed(ctx, time.Now())
+			if purged > 0 {
+				log.Printf("purged %d closed accounts", purged)
+			}
+			return err
+		})
+		go jobs.Every(ctx, "deleted user purge", time.Hour, func(ctx context.Context) error {
+			purged, err := usersStore.PurgeDeleted(ctx, time.Now().Add(-cfg.SoftDeleteRetention))
+			if purged > 0 {
+				log.Printf("purged %d deleted users", purged)
+			}
+			return err
+		})
+	}
+	if deviceStore != nil {
+		go jobs.Every(ctx, "deleted device purge", time.Hour, func(ctx context.Context) error {
+			purged, err := deviceStore.PurgeDeleted(ctx, time.Now().Add(-cfg.SoftDeleteRetention))
+			if purged > 0 {
+				log.Printf("purged %d deleted devices", purged)
+			}
+			return err
+		})
+	}
+	if sessionStore != nil {
+		go jobs.Every(ctx, "session cleanup", time.Hour, func(ctx context.Context) error {
+			return sessionStore.DeleteExpired(ctx, time.Now())
+		})
+	}
+	if invitationStore != nil {
+		go jobs.Every(ctx, "invitation cleanup", time.Hour, func(ctx context.Context) error {
+			_, err := invitationStore.DeleteExpired(ctx, time.Now())
+			return err
+		})
+	}
+
+	go jobs.Every(ctx, "idempotency key cleanup", time.Hour, func(ctx context.Context) error {
+		_, err := idempotencyStore.DeleteExpired(ctx, time.Now())
+		return err
+	})
+
 	addr := ":" + cfg.Port
 	if err := http.Serve(ctx, addr, router); err != nil {
 		log.Printf("server shutdown error: %v", err)
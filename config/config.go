@@ -2,25 +2,246 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Port      string
+	Port string
+	// TrustedProxies lists the proxy IPs and CIDRs whose X-Forwarded-For
+	// is believed when working out a client's IP. Empty trusts none.
+	TrustedProxies []string
+
 	JWTSecret string
 	JWTTTL    time.Duration
+	JWTIssuer string
+	// JWTAudience is parsed from a comma-separated list.
+	JWTAudience []string
+	JWTLeeway   time.Duration
+	// JWTSigningAlg is RS256 or EdDSA for rotating asymmetric keys, or HS256
+	// to keep signing with JWT_SECRET.
+	JWTSigningAlg string
+	// JWTKeyStore selects where signing keys live: "file" (JWTKeysDir) or
+	// "postgres". It defaults to postgres when a database is configured.
+	JWTKeyStore         string
+	JWTKeysDir          string
+	JWTKeyRotation      time.Duration
+	JWTKeyOverlap       time.Duration
+	JWTKeyCheckInterval time.Duration
+
+	PasswordResetURL string
+	PasswordResetTTL time.Duration
+
+	// RegistrationEnabled keeps /register open to the public. When false,
+	// accounts are created by admins or through invitations.
+	RegistrationEnabled bool
+	InvitationURL       string
+	InvitationTTL       time.Duration
+	// BootstrapAdminUsername, when set, creates an admin account with
+	// BootstrapAdminPassword at startup unless an admin already exists.
+	BootstrapAdminUsername string
+	BootstrapAdminEmail    string
+	BootstrapAdminPassword string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+
+	MFAIssuer   string
+	MFATokenTTL time.Duration
+
+	// AccountClosureGrace is how long a closed account can be reopened by
+	// signing in before it is purged.
+	AccountClosureGrace time.Duration
+	// ImpersonationTTL is the lifetime of tokens admins obtain to act as
+	// another user.
+	ImpersonationTTL time.Duration
+	// SoftDeleteRetention is how long deleted users and devices can be
+	// restored before they are purged.
+	SoftDeleteRetention time.Duration
+
+	// OIDCIssuer enables login through an OpenID Connect provider.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	// OIDCAutoProvision creates accounts on first login; OIDCLinkByEmail
+	// attaches the identity to an existing non-admin account with the same
+	// verified email. Linking is off by default: it trusts the provider to
+	// own every address it vouches for.
+	OIDCAutoProvision     bool
+	OIDCLinkByEmail       bool
+	OIDCPostLoginRedirect string
+
+	// LoginAttemptStore selects where failed login counters live: "postgres"
+	// or "memory". It defaults to postgres when a database is configured.
+	LoginAttemptStore    string
+	LoginFreeAttempts    int
+	LoginIPFreeAttempts  int
+	LoginBackoffBase     time.Duration
+	LoginBackoffMax      time.Duration
+	LoginMaxFailures     int
+	LoginLockoutDuration time.Duration
+	LoginAttemptWindow   time.Duration
+
+	// IdempotencyStore selects where Idempotency-Key responses live:
+	// "postgres" or "memory". It defaults to postgres when a database is
+	// configured.
+	IdempotencyStore string
+	IdempotencyTTL   time.Duration
+	// IdempotencySecret keys the request hashes kept with idempotency
+	// records. It is required with the postgres store. The memory store
+	// falls back to a random one, since its records die with the process.
+	IdempotencySecret string
+
+	PasswordMinLength     int
+	PasswordMaxLength     int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+	// PasswordBreachList is an optional path to a file of SHA-1 hashes of
+	// breached passwords.
+	PasswordBreachList string
+
+	// PasswordHasher is the algorithm for new hashes: "argon2id" or
+	// "bcrypt". Hashes made with the other one are upgraded on login.
+	PasswordHasher    string
+	BcryptCost        int
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
 }
 
 func Load() (Config, error) {
 	cfg := Config{
-		Port:      getenvDefault("PORT", "8080"),
+		Port:           getenvDefault("PORT", "8080"),
+		TrustedProxies: parseListDefault("TRUSTED_PROXIES", nil),
+
 		JWTSecret: os.Getenv("JWT_SECRET"),
 		JWTTTL:    parseDurationDefault("JWT_TTL", 24*time.Hour),
+		JWTIssuer: getenvDefault("JWT_ISSUER", "go-crud"),
+
+		JWTAudience: parseListDefault("JWT_AUDIENCE", []string{"go-crud"}),
+		JWTLeeway:   parseDurationDefault("JWT_LEEWAY", 30*time.Second),
+
+		JWTSigningAlg:       getenvDefault("JWT_SIGNING_ALG", "EdDSA"),
+		JWTKeyStore:         os.Getenv("JWT_KEY_STORE"),
+		JWTKeysDir:          getenvDefault("JWT_KEYS_DIR", "keys"),
+		JWTKeyRotation:      parseDurationDefault("JWT_KEY_ROTATION", 30*24*time.Hour),
+		JWTKeyOverlap:       parseDurationDefault("JWT_KEY_OVERLAP", 48*time.Hour),
+		JWTKeyCheckInterval: parseDurationDefault("JWT_KEY_CHECK_INTERVAL", time.Minute),
+
+		PasswordResetURL: getenvDefault("PASSWORD_RESET_URL", "http://localhost:8080/reset-password"),
+		PasswordResetTTL: parseDurationDefault("PASSWORD_RESET_TTL", time.Hour),
+
+		RegistrationEnabled: parseBoolDefault("REGISTRATION_ENABLED", true),
+		InvitationURL:       getenvDefault("INVITATION_URL", "http://localhost:8080/accept-invitation"),
+		InvitationTTL:       parseDurationDefault("INVITATION_TTL", 7*24*time.Hour),
+
+		BootstrapAdminUsername: os.Getenv("BOOTSTRAP_ADMIN_USERNAME"),
+		BootstrapAdminEmail:    os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+		BootstrapAdminPassword: os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"),
+
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     parseIntDefault("SMTP_PORT", 587),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		MailFrom:     getenvDefault("MAIL_FROM", "no-reply@localhost"),
+
+		MFAIssuer:   getenvDefault("MFA_ISSUER", "go-crud"),
+		MFATokenTTL: parseDurationDefault("MFA_TOKEN_TTL", 5*time.Minute),
+
+		AccountClosureGrace: parseDurationDefault("ACCOUNT_CLOSURE_GRACE", 30*24*time.Hour),
+		ImpersonationTTL:    parseDurationDefault("IMPERSONATION_TTL", 15*time.Minute),
+		SoftDeleteRetention: parseDurationDefault("SOFT_DELETE_RETENTION", 90*24*time.Hour),
+
+		OIDCIssuer:            os.Getenv("OIDC_ISSUER"),
+		OIDCClientID:          os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:      os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:       os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes:            parseListDefault("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+		OIDCAutoProvision:     parseBoolDefault("OIDC_AUTO_PROVISION", false),
+		OIDCLinkByEmail:       parseBoolDefault("OIDC_LINK_BY_EMAIL", false),
+		OIDCPostLoginRedirect: os.Getenv("OIDC_POST_LOGIN_REDIRECT"),
+
+		LoginAttemptStore:    os.Getenv("LOGIN_ATTEMPT_STORE"),
+		LoginFreeAttempts:    parseIntDefault("LOGIN_FREE_ATTEMPTS", 3),
+		LoginIPFreeAttempts:  parseIntDefault("LOGIN_IP_FREE_ATTEMPTS", 20),
+		LoginBackoffBase:     parseDurationDefault("LOGIN_BACKOFF_BASE", time.Second),
+		LoginBackoffMax:      parseDurationDefault("LOGIN_BACKOFF_MAX", 5*time.Minute),
+		LoginMaxFailures:     parseIntDefault("LOGIN_MAX_FAILURES", 10),
+		LoginLockoutDuration: parseDurationDefault("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginAttemptWindow:   parseDurationDefault("LOGIN_ATTEMPT_WINDOW", time.Hour),
+
+		IdempotencyStore:  os.Getenv("IDEMPOTENCY_STORE"),
+		IdempotencyTTL:    parseDurationDefault("IDEMPOTENCY_TTL", 24*time.Hour),
+		IdempotencySecret: os.Getenv("IDEMPOTENCY_SECRET"),
+
+		PasswordMinLength:     parseIntDefault("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:     parseIntDefault("PASSWORD_MAX_LENGTH", 72),
+		PasswordRequireUpper:  parseBoolDefault("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireLower:  parseBoolDefault("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireDigit:  parseBoolDefault("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol: parseBoolDefault("PASSWORD_REQUIRE_SYMBOL", false),
+		PasswordBreachList:    os.Getenv("PASSWORD_BREACH_LIST"),
+
+		PasswordHasher:    getenvDefault("PASSWORD_HASHER", "argon2id"),
+		BcryptCost:        parseIntDefault("BCRYPT_COST", 10),
+		Argon2Memory:      parseIntDefault("ARGON2_MEMORY_KIB", 64*1024),
+		Argon2Iterations:  parseIntDefault("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism: parseIntDefault("ARGON2_PARALLELISM", 2),
 	}
 
-	if cfg.JWTSecret == "" {
-		return Config{}, errors.New("JWT_SECRET is required")
+	for _, proxy := range cfg.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return Config{}, fmt.Errorf("TRUSTED_PROXIES must list IPs or CIDRs, got %q", proxy)
+		}
+	}
+	switch cfg.JWTSigningAlg {
+	case "HS256":
+		if cfg.JWTSecret == "" {
+			return Config{}, errors.New("JWT_SECRET is required when JWT_SIGNING_ALG is HS256")
+		}
+	case "RS256", "EdDSA":
+		if cfg.JWTKeyOverlap < cfg.JWTTTL {
+			return Config{}, fmt.Errorf("JWT_KEY_OVERLAP (%s) must be at least JWT_TTL (%s)", cfg.JWTKeyOverlap, cfg.JWTTTL)
+		}
+	default:
+		return Config{}, fmt.Errorf("JWT_SIGNING_ALG must be RS256, EdDSA or HS256, got %q", cfg.JWTSigningAlg)
+	}
+	switch cfg.JWTKeyStore {
+	case "", "file", "postgres":
+	default:
+		return Config{}, fmt.Errorf("JWT_KEY_STORE must be file or postgres, got %q", cfg.JWTKeyStore)
+	}
+	if cfg.OIDCIssuer != "" && (cfg.OIDCClientID == "" || cfg.OIDCRedirectURL == "") {
+		return Config{}, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER is set")
+	}
+	if cfg.BootstrapAdminUsername != "" && cfg.BootstrapAdminPassword == "" {
+		return Config{}, errors.New("BOOTSTRAP_ADMIN_PASSWORD is required when BOOTSTRAP_ADMIN_USERNAME is set")
+	}
+	switch cfg.PasswordHasher {
+	case "argon2id", "bcrypt":
+	default:
+		return Config{}, fmt.Errorf("PASSWORD_HASHER must be argon2id or bcrypt, got %q", cfg.PasswordHasher)
+	}
+	switch cfg.LoginAttemptStore {
+	case "", "postgres", "memory":
+	default:
+		return Config{}, fmt.Errorf("LOGIN_ATTEMPT_STORE must be postgres or memory, got %q", cfg.LoginAttemptStore)
+	}
+	switch cfg.IdempotencyStore {
+	case "", "postgres", "memory":
+	default:
+		return Config{}, fmt.Errorf("IDEMPOTENCY_STORE must be postgres or memory, got %q", cfg.IdempotencyStore)
 	}
 
 	return cfg, nil
@@ -42,3 +263,39 @@ func parseDurationDefault(key string, fallback time.Duration) time.Duration {
 	return fallback
 
 }
+
+func parseIntDefault(key string, fallback int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+func parseListDefault(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return fallback
+	}
+	return items
+}
+
+func parseBoolDefault(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return fallback
+}
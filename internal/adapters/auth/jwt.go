@@ -1,91 +0,0 @@
-package auth
-
-import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"strings"
-	"time"
-
-	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
-)
-
-var (
-	ErrInvalidToken = errors.New("invalid token")
-	ErrExpiredToken = errors.New("token expired")
-)
-
-func GenerateToken(subject string, secret []byte, ttl time.Duration) (string, error) {
-	if len(secret) == 0 {
-		return "", errors.New("secret is required")
-	}
-
-	headerJSON, err := json.Marshal(map[string]string{
-		"alg": "HS256",
-		"typ": "JWT",
-	})
-	if err != nil {
-		return "", fmt.Errorf("encode header: %w", err)
-	}
-
-	now := time.Now().Unix()
-	payload := sharedauth.Claims{
-		Sub: subject,
-		Exp: time.Now().Add(ttl).Unix(),
-		Iat: now,
-	}
-	payloadJSON, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("encode claims: %w", err)
-	}
-
-	header := base64.RawURLEncoding.EncodeToString(headerJSON)
-	body := base64.RawURLEncoding.EncodeToString(payloadJSON)
-	unsigned := header + "." + body
-
-	signature := signHS256(unsigned, secret)
-	return unsigned + "." + signature, nil
-}
-
-func ParseToken(token string, secret []byte) (sharedauth.Claims, error) {
-	if len(secret) == 0 {
-		return sharedauth.Claims{}, errors.New("secret is required")
-	}
-
-	parts := strings.Split(token, ".")
-	if len(parts) != 3 {
-		return sharedauth.Claims{}, ErrInvalidToken
-	}
-
-	unsigned := parts[0] + "." + parts[1]
-	expected := signHS256(unsigned, secret)
-	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
-		return sharedauth.Claims{}, ErrInvalidToken
-	}
-
-	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
-	if err != nil {
-		return sharedauth.Claims{}, ErrInvalidToken
-	}
-
-	var claims sharedauth.Claims
-	if err := json.Unmarshal(payloadJSON, &claims); err != nil {
-		return sharedauth.Claims{}, ErrInvalidToken
-	}
-
-	if time.Now().Unix() > claims.Exp {
-		return sharedauth.Claims{}, ErrExpiredToken
-	}
-
-	return claims, nil
-}
-
-func signHS256(unsigned string, secret []byte) string {
-	mac := hmac.New(sha256.New, secret)
-	mac.Write([]byte(unsigned))
-	sum := mac.Sum(nil)
-	return base64.RawURLEncoding.EncodeToString(sum)
-}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+)
+
+type KeyRotationOptions struct {
+	// Algorithm is used for newly generated keys: RS256 or EdDSA.
+	Algorithm string
+	// Interval is how long a key signs tokens before it is replaced.
+	Interval time.Duration
+	// Overlap is how long a replaced key keeps verifying tokens. It must be at
+	// least the token lifetime or tokens signed just before a rotation fail.
+	Overlap time.Duration
+}
+
+// KeyRotator keeps a Keyset in sync with a SigningKeyStore and replaces the
+// signing key when it becomes due.
+type KeyRotator struct {
+	store ports.SigningKeyStore
+	keys  *sharedauth.Keyset
+	opts  KeyRotationOptions
+	now   func() time.Time
+	mu    sync.Mutex
+}
+
+func NewKeyRotator(store ports.SigningKeyStore, keys *sharedauth.Keyset, opts KeyRotationOptions) *KeyRotator {
+	if opts.Algorithm == "" {
+		opts.Algorithm = sharedauth.AlgEdDSA
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * 24 * time.Hour
+	}
+	if opts.Overlap <= 0 {
+		opts.Overlap = 48 * time.Hour
+	}
+	return &KeyRotator{store: store, keys: keys, opts: opts, now: time.Now}
+}
+
+// Load reads every key from the store into the keyset.
+func (r *KeyRotator) Load(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err := r.load(ctx)
+	return err
+}
+
+// RotateIfDue reloads the keyset, picking up keys rotated by other instances,
+// and rotates when there is no signing key, it is older than the interval, or
+// it uses a different algorithm than configured.
+func (r *KeyRotator) RotateIfDue(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+
+	current, err := r.keys.SigningKey()
+	if err == nil &&
+		current.Method.Alg() == r.opts.Algorithm &&
+		r.now().Before(current.CreatedAt.Add(r.opts.Interval)) {
+		return nil
+	}
+
+	return r.rotate(ctx, stored)
+}
+
+// Rotate unconditionally generates a new signing key and retires the
+// current ones after the overlap window.
+func (r *KeyRotator) Rotate(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	return r.rotate(ctx, stored)
+}
+
+func (r *KeyRotator) rotate(ctx context.Context, stored []domain.SigningKey) error {
+	now := r.now().UTC().Truncate(time.Second)
+
+	id, pemBytes, err := sharedauth.GenerateKeyPEM(r.opts.Algorithm)
+	if err != nil {
+		return fmt.Errorf("generate signing key: %w", err)
+	}
+	if err := r.store.Save(ctx, domain.SigningKey{
+		ID:            id,
+		Algorithm:     r.opts.Algorithm,
+		PrivateKeyPEM: pemBytes,
+		CreatedAt:     now,
+	}); err != nil {
+		return fmt.Errorf("save signing key: %w", err)
+	}
+
+	retireAt := now.Add(r.opts.Overlap)
+	for _, key := range stored {
+		switch {
+		case key.ExpiresAt != nil && !key.ExpiresAt.After(now):
+			if err := r.store.Delete(ctx, key.ID); err != nil {
+				return fmt.Errorf("delete expired key %s: %w", key.ID, err)
+			}
+		case key.ExpiresAt == nil:
+			key.ExpiresAt = &retireAt
+			if err := r.store.Save(ctx, key); err != nil {
+				return fmt.Errorf("retire key %s: %w", key.ID, err)
+			}
+		}
+	}
+
+	_, err = r.load(ctx)
+	return err
+}
+
+func (r *KeyRotator) load(ctx context.Context) ([]domain.SigningKey, error) {
+	stored, err := r.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list signing keys: %w", err)
+	}
+
+	keys := make([]sharedauth.Key, 0, len(stored))
+	for _, s := range stored {
+		key, err := sharedauth.ParseKeyPEM(s.ID, s.Algorithm, s.PrivateKeyPEM, s.CreatedAt, s.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	r.keys.Replace(keys)
+
+	return stored, nil
+}
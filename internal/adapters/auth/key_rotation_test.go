@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+)
+
+type memorySigningKeys struct {
+	keys map[string]domain.SigningKey
+}
+
+func (s *memorySigningKeys) List(ctx context.Context) ([]domain.SigningKey, error) {
+	list := make([]domain.SigningKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *memorySigningKeys) Save(ctx context.Context, key domain.SigningKey) error {
+	s.keys[key.ID] = key
+	return nil
+}
+
+func (s *memorySigningKeys) Delete(ctx context.Context, id string) error {
+	delete(s.keys, id)
+	return nil
+}
+
+func storedKey(t *testing.T, alg string, createdAt time.Time, expiresAt *time.Time) domain.SigningKey {
+	t.Helper()
+	id, pemBytes, err := sharedauth.GenerateKeyPEM(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return domain.SigningKey{ID: id, Algorithm: alg, PrivateKeyPEM: pemBytes, CreatedAt: createdAt, ExpiresAt: expiresAt}
+}
+
+func TestKeyRotatorRotateIfDue(t *testing.T) {
+	// The keyset drops expired keys against the real clock.
+	now := time.Now().UTC().Truncate(time.Second)
+	opts := KeyRotationOptions{Algorithm: sharedauth.AlgEdDSA, Interval: 24 * time.Hour, Overlap: time.Hour}
+	at := func(d time.Duration) *time.Time {
+		v := now.Add(d)
+		return &v
+	}
+
+	fresh := storedKey(t, sharedauth.AlgEdDSA, now.Add(-time.Hour), nil)
+	stale := storedKey(t, sharedauth.AlgEdDSA, now.Add(-25*time.Hour), nil)
+	rsa := storedKey(t, sharedauth.AlgRS256, now.Add(-time.Hour), nil)
+	retiring := storedKey(t, sharedauth.AlgEdDSA, now.Add(-48*time.Hour), at(30*time.Minute))
+	expired := storedKey(t, sharedauth.AlgEdDSA, now.Add(-72*time.Hour), at(-time.Minute))
+
+	tests := []struct {
+		name        string
+		stored      []domain.SigningKey
+		wantRotated bool
+		// wantExpires maps the stored keys expected afterwards to their
+		// expiry; the new key, if any, is checked separately.
+		wantExpires map[string]*time.Time
+	}{
+		{
+			name:        "no keys",
+			wantRotated: true,
+			wantExpires: map[string]*time.Time{},
+		},
+		{
+			name:        "current key is fresh",
+			stored:      []domain.SigningKey{fresh},
+			wantExpires: map[string]*time.Time{fresh.ID: nil},
+		},
+		{
+			name:        "current key is due",
+			stored:      []domain.SigningKey{stale},
+			wantRotated: true,
+			wantExpires: map[string]*time.Time{stale.ID: at(time.Hour)},
+		},
+		{
+			name:        "algorithm changed",
+			stored:      []domain.SigningKey{rsa},
+			wantRotated: true,
+			wantExpires: map[string]*time.Time{rsa.ID: at(time.Hour)},
+		},
+		{
+			name:        "only retiring keys",
+			stored:      []domain.SigningKey{retiring},
+			wantRotated: true,
+			wantExpires: map[string]*time.Time{retiring.ID: retiring.ExpiresAt},
+		},
+		{
+			name:        "expired keys are deleted on rotation",
+			stored:      []domain.SigningKey{expired, stale},
+			wantRotated: true,
+			wantExpires: map[string]*time.Time{stale.ID: at(time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memorySigningKeys{keys: map[string]domain.SigningKey{}}
+			for _, k := range tt.stored {
+				store.keys[k.ID] = k
+			}
+			keys := sharedauth.NewKeyset()
+			rotator := NewKeyRotator(store, keys, opts)
+			rotator.now = func() time.Time { return now }
+
+			if err := rotator.RotateIfDue(context.Background()); err != nil {
+				t.Fatalf("RotateIfDue: %v", err)
+			}
+
+			var added []domain.SigningKey
+			for id, k := range store.keys {
+				want, known := tt.wantExpires[id]
+				if !known {
+					added = append(added, k)
+					continue
+				}
+				if (want == nil) != (k.ExpiresAt == nil) || (want != nil && !want.Equal(*k.ExpiresAt)) {
+					t.Errorf("key %s expires %v, want %v", id, k.ExpiresAt, want)
+				}
+			}
+			for id := range tt.wantExpires {
+				if _, ok := store.keys[id]; !ok {
+					t.Errorf("key %s was deleted", id)
+				}
+			}
+
+			if !tt.wantRotated {
+				if len(added) != 0 {
+					t.Fatalf("added %d keys, want none", len(added))
+				}
+				return
+			}
+			if len(added) != 1 {
+				t.Fatalf("added %d keys, want 1", len(added))
+			}
+			created := added[0]
+			if created.Algorithm != opts.Algorithm || created.ExpiresAt != nil || !created.CreatedAt.Equal(now) {
+				t.Errorf("new key = %s %v expires %v", created.Algorithm, created.CreatedAt, created.ExpiresAt)
+			}
+			signing, err := keys.SigningKey()
+			if err != nil || signing.ID != created.ID {
+				t.Errorf("signing key = %s, %v; want the new key %s", signing.ID, err, created.ID)
+			}
+			for id := range tt.wantExpires {
+				if _, err := keys.VerificationKey(id); err != nil {
+					t.Errorf("retired key %s no longer verifies: %v", id, err)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyRotatorPicksUpOtherInstances(t *testing.T) {
+	store := &memorySigningKeys{keys: map[string]domain.SigningKey{}}
+	opts := KeyRotationOptions{Algorithm: sharedauth.AlgEdDSA, Interval: time.Hour, Overlap: time.Hour}
+	first := NewKeyRotator(store, sharedauth.NewKeyset(), opts)
+	secondKeys := sharedauth.NewKeyset()
+	second := NewKeyRotator(store, secondKeys, opts)
+
+	if err := first.Rotate(context.Background()); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if err := second.RotateIfDue(context.Background()); err != nil {
+		t.Fatalf("RotateIfDue: %v", err)
+	}
+	if len(store.keys) != 1 {
+		t.Fatalf("store has %d keys, want 1: the second instance should reuse the first's key", len(store.keys))
+	}
+
+	want, _ := first.keys.SigningKey()
+	if got, err := secondKeys.SigningKey(); err != nil || got.ID != want.ID {
+		t.Errorf("second instance signs with %s, %v; want %s", got.ID, err, want.ID)
+	}
+}
+
+func TestNewKeyRotatorDefaults(t *testing.T) {
+	r := NewKeyRotator(&memorySigningKeys{}, sharedauth.NewKeyset(), KeyRotationOptions{})
+	want := KeyRotationOptions{Algorithm: sharedauth.AlgEdDSA, Interval: 30 * 24 * time.Hour, Overlap: 48 * time.Hour}
+	if r.opts != want {
+		t.Errorf("opts = %+v, want %+v", r.opts, want)
+	}
+}
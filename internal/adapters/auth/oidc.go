@@ -0,0 +1,330 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+)
+
+var (
+	ErrOIDCDiscovery    = errors.New("oidc discovery failed")
+	ErrOIDCExchange     = errors.New("oidc code exchange failed")
+	ErrInvalidIDToken   = errors.New("invalid id token")
+	ErrOIDCNotAvailable = errors.New("oidc provider not available")
+)
+
+const (
+	// jwksMinRefresh stops tokens with unknown kids from making us hammer
+	// the provider's JWKS endpoint.
+	jwksMinRefresh    = time.Minute
+	maxOIDCResponse   = 1 << 20
+	defaultOIDCLeeway = time.Minute
+)
+
+type OIDCOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// Leeway tolerates clock skew with the provider.
+	Leeway time.Duration
+	// HTTPClient defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// IDTokenClaims are the ID token claims this service relies on.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp,omitempty"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCClient is an OpenID Connect relying party using the authorization code
+// flow with PKCE. Provider metadata is discovered lazily so the service can
+// start while the provider is unreachable.
+type OIDCClient struct {
+	opts OIDCOptions
+	now  func() time.Time
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]sharedauth.JWK
+	keysFetched time.Time
+}
+
+func NewOIDCClient(opts OIDCOptions) (*OIDCClient, error) {
+	if opts.Issuer == "" || opts.ClientID == "" || opts.RedirectURL == "" {
+		return nil, errors.New("issuer, client id and redirect url are required")
+	}
+	if len(opts.Scopes) == 0 {
+		opts.Scopes = []string{"openid", "email", "profile"}
+	}
+	if opts.Leeway <= 0 {
+		opts.Leeway = defaultOIDCLeeway
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	opts.Issuer = strings.TrimSuffix(opts.Issuer, "/")
+	return &OIDCClient{opts: opts, now: time.Now}, nil
+}
+
+// Issuer identifies the provider when linking identities.
+func (o *OIDCClient) Issuer() string {
+	return o.opts.Issuer
+}
+
+// OIDCFlow holds the per-login secrets that must survive the round trip to
+// the provider.
+type OIDCFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+func NewOIDCFlow() (OIDCFlow, error) {
+	var flow OIDCFlow
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return OIDCFlow{}, err
+		}
+		*v = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	return flow, nil
+}
+
+// AuthCodeURL builds the provider URL the browser is sent to.
+func (o *OIDCClient) AuthCodeURL(ctx context.Context, flow OIDCFlow) (string, error) {
+	d, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(flow.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.opts.ClientID},
+		"redirect_uri":          {o.opts.RedirectURL},
+		"scope":                 {strings.Join(o.opts.Scopes, " ")},
+		"state":                 {flow.State},
+		"nonce":                 {flow.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the validated ID token
+// claims.
+func (o *OIDCClient) Exchange(ctx context.Context, code string, flow OIDCFlow) (IDTokenClaims, error) {
+	d, err := o.discover(ctx)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.opts.RedirectURL},
+		"client_id":     {o.opts.ClientID},
+		"code_verifier": {flow.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.opts.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.opts.ClientID), url.QueryEscape(o.opts.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := o.doJSON(req, &tokens); err != nil {
+		return IDTokenClaims{}, fmt.Errorf("%w: %v", ErrOIDCExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return IDTokenClaims{}, fmt.Errorf("%w: response has no id_token", ErrOIDCExchange)
+	}
+
+	return o.VerifyIDToken(ctx, tokens.IDToken, flow.Nonce)
+}
+
+// VerifyIDToken checks the signature against the provider's JWKS and
+// validates iss, aud, azp, exp, iat and nonce.
+func (o *OIDCClient) VerifyIDToken(ctx context.Context, raw, nonce string) (IDTokenClaims, error) {
+	d, err := o.discover(ctx)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+
+	var claims IDTokenClaims
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithoutClaimsValidation(),
+	)
+	_, err = parser.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		jwk, err := o.key(ctx, d, kid)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Algorithm != "" && jwk.Algorithm != t.Method.Alg() {
+			return nil, ErrInvalidIDToken
+		}
+		return jwk.PublicKey()
+	})
+	if err != nil {
+		return IDTokenClaims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	now := o.now()
+	switch {
+	case claims.Issuer != d.Issuer:
+		return IDTokenClaims{}, fmt.Errorf("%w: unexpected issuer", ErrInvalidIDToken)
+	case !claims.VerifyAudience(o.opts.ClientID, true):
+		return IDTokenClaims{}, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != o.opts.ClientID:
+		return IDTokenClaims{}, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	case claims.ExpiresAt == nil || now.After(claims.ExpiresAt.Add(o.opts.Leeway)):
+		return IDTokenClaims{}, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case claims.IssuedAt == nil || now.Add(o.opts.Leeway).Before(claims.IssuedAt.Time):
+		return IDTokenClaims{}, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return IDTokenClaims{}, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	case nonce == "" || claims.Nonce != nonce:
+		return IDTokenClaims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+func (o *OIDCClient) discover(ctx context.Context) (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.opts.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var d oidcDiscovery
+	if err := o.doJSON(req, &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCDiscovery, err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != o.opts.Issuer {
+		return nil, fmt.Errorf("%w: issuer mismatch %q", ErrOIDCDiscovery, d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete provider metadata", ErrOIDCDiscovery)
+	}
+
+	o.discovery = &d
+	return o.discovery, nil
+}
+
+// key returns the provider key for kid, refetching the JWKS when the kid is
+// unknown so provider key rotation is picked up.
+func (o *OIDCClient) key(ctx context.Context, d *oidcDiscovery, kid string) (sharedauth.JWK, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if jwk, ok := o.lookupKey(kid); ok {
+		return jwk, nil
+	}
+	if o.now().Sub(o.keysFetched) < jwksMinRefresh {
+		return sharedauth.JWK{}, ErrInvalidIDToken
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return sharedauth.JWK{}, err
+	}
+	var set sharedauth.JWKS
+	if err := o.doJSON(req, &set); err != nil {
+		return sharedauth.JWK{}, fmt.Errorf("%w: fetch jwks: %v", ErrOIDCNotAvailable, err)
+	}
+
+	o.keys = make(map[string]sharedauth.JWK, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use == "" || k.Use == "sig" {
+			o.keys[k.KeyID] = k
+		}
+	}
+	o.keysFetched = o.now()
+
+	if jwk, ok := o.lookupKey(kid); ok {
+		return jwk, nil
+	}
+	return sharedauth.JWK{}, ErrInvalidIDToken
+}
+
+// lookupKey finds kid; a token without kid is accepted only when the
+// provider publishes a single key.
+func (o *OIDCClient) lookupKey(kid string) (sharedauth.JWK, bool) {
+	if kid == "" {
+		if len(o.keys) == 1 {
+			for _, k := range o.keys {
+				return k, true
+			}
+		}
+		return sharedauth.JWK{}, false
+	}
+	jwk, ok := o.keys[kid]
+	return jwk, ok
+}
+
+func (o *OIDCClient) doJSON(req *http.Request, out any) error {
+	resp, err := o.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOIDCResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: status %d", req.Method, req.URL.Redacted(), resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+)
+
+const testClientID = "client-1"
+
+// fakeProvider is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that enforces PKCE and returns whatever ID token claims the test
+// set.
+type fakeProvider struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    sharedauth.Key
+	keys   *sharedauth.Keyset
+	issuer string
+
+	// challenge is the PKCE challenge from the last authorization URL.
+	challenge string
+	claims    jwt.MapClaims
+	signWith  *sharedauth.Key
+	jwksHits  int
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	p := &fakeProvider{t: t, key: newTestKey(t), keys: sharedauth.NewKeyset()}
+	p.keys.Replace([]sharedauth.Key{p.key})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.issuer,
+			AuthorizationEndpoint: p.srv.URL + "/authorize",
+			TokenEndpoint:         p.srv.URL + "/token",
+			JWKSURI:               p.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.jwksHits++
+		json.NewEncoder(w).Encode(p.keys.PublicJWKS())
+	})
+	mux.HandleFunc("/token", p.token)
+	p.srv = httptest.NewServer(mux)
+	p.issuer = p.srv.URL
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if r.PostForm.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(p.claims)})
+}
+
+func (p *fakeProvider) sign(claims jwt.MapClaims) string {
+	p.t.Helper()
+	key := p.key
+	if p.signWith != nil {
+		key = *p.signWith
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	raw, err := token.SignedString(key.SignKey)
+	if err != nil {
+		p.t.Fatalf("sign id token: %v", err)
+	}
+	return raw
+}
+
+// validClaims are claims the client should accept for nonce.
+func (p *fakeProvider) validClaims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            p.issuer,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"exp":            now.Add(time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "pat@example.com",
+		"email_verified": true,
+	}
+}
+
+func (p *fakeProvider) client(t *testing.T) *OIDCClient {
+	t.Helper()
+	client, err := NewOIDCClient(OIDCOptions{Issuer: p.issuer, ClientID: testClientID, RedirectURL: "https://app.example/callback"})
+	if err != nil {
+		t.Fatalf("NewOIDCClient: %v", err)
+	}
+	return client
+}
+
+// authorize fetches the authorization URL for flow and records its PKCE
+// challenge the way the provider would.
+func (p *fakeProvider) authorize(t *testing.T, client *OIDCClient, flow OIDCFlow) url.Values {
+	t.Helper()
+	target, err := client.AuthCodeURL(context.Background(), flow)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("parse authorization url: %v", err)
+	}
+	if got, want := u.Scheme+"://"+u.Host+u.Path, p.srv.URL+"/authorize"; got != want {
+		t.Fatalf("authorization endpoint = %q, want %q", got, want)
+	}
+	q := u.Query()
+	p.challenge = q.Get("code_challenge")
+	return q
+}
+
+func newTestKey(t *testing.T) sharedauth.Key {
+	t.Helper()
+	id, pemBytes, err := sharedauth.GenerateKeyPEM(sharedauth.AlgEdDSA)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key, err := sharedauth.ParseKeyPEM(id, sharedauth.AlgEdDSA, pemBytes, time.Now(), nil)
+	if err != nil {
+		t.Fatalf("parse key: %v", err)
+	}
+	return key
+}
+
+func newTestFlow(t *testing.T) OIDCFlow {
+	t.Helper()
+	flow, err := NewOIDCFlow()
+	if err != nil {
+		t.Fatalf("NewOIDCFlow: %v", err)
+	}
+	return flow
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	p := newFakeProvider(t)
+	flow := newTestFlow(t)
+	q := p.authorize(t, p.client(t), flow)
+
+	sum := sha256.Sum256([]byte(flow.Verifier))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "https://app.example/callback",
+		"scope":                 "openid email profile",
+		"state":                 flow.State,
+		"nonce":                 flow.Nonce,
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if got := q.Get(k); got != v {
+			t.Errorf("%s = %q, want %q", k, got, v)
+		}
+	}
+	if q.Has("code_verifier") {
+		t.Error("authorization url leaks the PKCE verifier")
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	p := newFakeProvider(t)
+	p.issuer = "https://someone-else.example"
+	client, err := NewOIDCClient(OIDCOptions{Issuer: p.srv.URL, ClientID: testClientID, RedirectURL: "https://app.example/callback"})
+	if err != nil {
+		t.Fatalf("NewOIDCClient: %v", err)
+	}
+
+	_, err = client.AuthCodeURL(context.Background(), newTestFlow(t))
+	if !errors.Is(err, ErrOIDCDiscovery) {
+		t.Fatalf("err = %v, want ErrOIDCDiscovery", err)
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	p := newFakeProvider(t)
+	client := p.client(t)
+	flow := newTestFlow(t)
+	p.authorize(t, client, flow)
+	p.claims = p.validClaims(flow.Nonce)
+
+	claims, err := client.Exchange(context.Background(), "good-code", flow)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "pat@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+	if p.jwksHits != 1 {
+		t.Errorf("jwks fetched %d times, want 1", p.jwksHits)
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	p := newFakeProvider(t)
+	client := p.client(t)
+	flow := newTestFlow(t)
+	p.authorize(t, client, flow)
+	p.claims = p.validClaims(flow.Nonce)
+
+	flow.Verifier = "not-the-verifier"
+	_, err := client.Exchange(context.Background(), "good-code", flow)
+	if !errors.Is(err, ErrOIDCExchange) {
+		t.Fatalf("err = %v, want ErrOIDCExchange", err)
+	}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	p := newFakeProvider(t)
+	otherKey := newTestKey(t)
+	forgedKey := p.key
+	forgedKey.SignKey = otherKey.SignKey
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		key    *sharedauth.Key
+		nonce  string
+	}{
+		{name: "bad nonce", nonce: "other-nonce"},
+		{name: "bad audience", modify: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "extra audience without azp", modify: func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "someone-else"} }},
+		{name: "bad issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "issued in the future", modify: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{name: "missing subject", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "bad signature", key: &forgedKey},
+		{name: "unknown key", key: &otherKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := p.client(t)
+			claims := p.validClaims("nonce-1")
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			nonce := "nonce-1"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			p.signWith = tt.key
+			defer func() { p.signWith = nil }()
+
+			_, err := client.VerifyIDToken(context.Background(), p.sign(claims), nonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		client := p.client(t)
+		if _, err := client.VerifyIDToken(context.Background(), p.sign(p.validClaims("nonce-1")), "nonce-1"); err != nil {
+			t.Fatalf("VerifyIDToken: %v", err)
+		}
+	})
+}
+
+func TestOIDCPicksUpRotatedKeys(t *testing.T) {
+	p := newFakeProvider(t)
+	client := p.client(t)
+	now := time.Now()
+	client.now = func() time.Time { return now }
+
+	if _, err := client.VerifyIDToken(context.Background(), p.sign(p.validClaims("n")), "n"); err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+
+	next := newTestKey(t)
+	p.keys.Replace([]sharedauth.Key{p.key, next})
+	p.signWith = &next
+	raw := p.sign(p.validClaims("n"))
+
+	// Unknown kids do not refetch the JWKS more than once a minute.
+	if _, err := client.VerifyIDToken(context.Background(), raw, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken before the refresh interval", err)
+	}
+	now = now.Add(jwksMinRefresh)
+	if _, err := client.VerifyIDToken(context.Background(), raw, "n"); err != nil {
+		t.Fatalf("VerifyIDToken after rotation: %v", err)
+	}
+	if p.jwksHits != 2 {
+		t.Errorf("jwks fetched %d times, want 2", p.jwksHits)
+	}
+}
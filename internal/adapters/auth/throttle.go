@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type ThrottleOptions struct {
+	// FreeAttempts failures per username are allowed before backoff starts.
+	FreeAttempts int
+	// IPFreeAttempts is the same allowance per client IP, which is usually
+	// higher because many users can share an address.
+	IPFreeAttempts int
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	// MaxFailures consecutive failures lock the username for
+	// LockoutDuration.
+	MaxFailures     int
+	LockoutDuration time.Duration
+	// Window is how long a failure counts towards the totals.
+	Window time.Duration
+}
+
+// LoginThrottle applies exponential backoff per username and per client IP
+// and temporarily locks usernames after repeated failures.
+type LoginThrottle struct {
+	store ports.LoginAttemptStore
+	opts  ThrottleOptions
+	now   func() time.Time
+}
+
+func NewLoginThrottle(store ports.LoginAttemptStore, opts ThrottleOptions) *LoginThrottle {
+	if opts.FreeAttempts <= 0 {
+		opts.FreeAttempts = 3
+	}
+	if opts.IPFreeAttempts <= 0 {
+		opts.IPFreeAttempts = 20
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = time.Second
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 5 * time.Minute
+	}
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = 10
+	}
+	if opts.LockoutDuration <= 0 {
+		opts.LockoutDuration = 15 * time.Minute
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Hour
+	}
+	return &LoginThrottle{store: store, opts: opts, now: time.Now}
+}
+
+// Check reports whether a login for username from ip may proceed. When it may
+// not, the returned duration says how long the client should wait and the
+// error is ErrAccountLocked or ErrTooManyAttempts.
+func (t *LoginThrottle) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	now := t.now()
+
+	userAttempt, err := t.store.Get(ctx, usernameKey(username))
+	if err != nil {
+		return 0, err
+	}
+	if userAttempt.LockedUntil != nil && userAttempt.LockedUntil.After(now) {
+		return userAttempt.LockedUntil.Sub(now), pkg.ErrAccountLocked
+	}
+	if wait := t.backoff(userAttempt, t.opts.FreeAttempts, now); wait > 0 {
+		return wait, pkg.ErrTooManyAttempts
+	}
+
+	ipAttempt, err := t.store.Get(ctx, ipKey(ip))
+	if err != nil {
+		return 0, err
+	}
+	if wait := t.backoff(ipAttempt, t.opts.IPFreeAttempts, now); wait > 0 {
+		return wait, pkg.ErrTooManyAttempts
+	}
+
+	return 0, nil
+}
+
+// Failure records a failed attempt and locks the username once it reaches
+// MaxFailures.
+func (t *LoginThrottle) Failure(ctx context.Context, username, ip string) error {
+	now := t.now()
+
+	attempt, err := t.store.RecordFailure(ctx, usernameKey(username), now, t.opts.Window)
+	if err != nil {
+		return err
+	}
+	if _, err := t.store.RecordFailure(ctx, ipKey(ip), now, t.opts.Window); err != nil {
+		return err
+	}
+
+	if attempt.Failures >= t.opts.MaxFailures {
+		return t.store.Lock(ctx, usernameKey(username), now.Add(t.opts.LockoutDuration))
+	}
+	return nil
+}
+
+// Success clears the username counters. The IP counter is left alone so that
+// logging into one account does not reset guesses against others.
+func (t *LoginThrottle) Success(ctx context.Context, username string) error {
+	return t.store.Reset(ctx, usernameKey(username))
+}
+
+// Unlock lifts a lockout and clears the failure count for username.
+func (t *LoginThrottle) Unlock(ctx context.Context, username string) error {
+	return t.store.Reset(ctx, usernameKey(username))
+}
+
+func (t *LoginThrottle) backoff(attempt domain.LoginAttempt, free int, now time.Time) time.Duration {
+	if attempt.Failures < free || now.Sub(attempt.LastFailureAt) > t.opts.Window {
+		return 0
+	}
+
+	delay := t.opts.BaseDelay
+	for i := free; i < attempt.Failures && delay < t.opts.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.opts.MaxDelay {
+		delay = t.opts.MaxDelay
+	}
+
+	if wait := attempt.LastFailureAt.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func usernameKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
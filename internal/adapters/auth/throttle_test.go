@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/secondary/memory"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	opts := ThrottleOptions{
+		FreeAttempts:    2,
+		IPFreeAttempts:  6,
+		BaseDelay:       time.Second,
+		MaxDelay:        3 * time.Second,
+		MaxFailures:     5,
+		LockoutDuration: 10 * time.Minute,
+		Window:          time.Hour,
+	}
+	const ip = "192.0.2.1"
+	repeat := func(username string, n int) []string {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = username
+		}
+		return names
+	}
+
+	tests := []struct {
+		name     string
+		failures []string // usernames that failed from ip, one second apart
+		then     func(*LoginThrottle)
+		username string
+		ip       string
+		elapsed  time.Duration // since the last failure
+		wantWait time.Duration
+		wantErr  error
+	}{
+		{name: "no failures", username: "pat", ip: ip},
+		{name: "free attempts", failures: repeat("pat", 1), username: "pat", ip: ip},
+		{name: "backoff starts", failures: repeat("pat", 2), username: "pat", ip: ip, wantWait: time.Second, wantErr: pkg.ErrTooManyAttempts},
+		{name: "backoff doubles", failures: repeat("pat", 3), username: "pat", ip: ip, wantWait: 2 * time.Second, wantErr: pkg.ErrTooManyAttempts},
+		{name: "backoff is capped", failures: repeat("pat", 4), username: "pat", ip: ip, wantWait: 3 * time.Second, wantErr: pkg.ErrTooManyAttempts},
+		{name: "partly waited", failures: repeat("pat", 3), username: "pat", ip: ip, elapsed: 500 * time.Millisecond, wantWait: 1500 * time.Millisecond, wantErr: pkg.ErrTooManyAttempts},
+		{name: "fully waited", failures: repeat("pat", 3), username: "pat", ip: ip, elapsed: 2 * time.Second},
+		{name: "usernames ignore case", failures: repeat("Pat", 2), username: "pAT", ip: ip, wantWait: time.Second, wantErr: pkg.ErrTooManyAttempts},
+		{name: "other usernames unaffected", failures: repeat("pat", 4), username: "sam", ip: ip},
+		{name: "failures age out", failures: repeat("pat", 4), username: "pat", ip: ip, elapsed: 2 * time.Hour},
+		{name: "lockout", failures: repeat("pat", 5), username: "pat", ip: ip, wantWait: 10 * time.Minute, wantErr: pkg.ErrAccountLocked},
+		{name: "lockout counts down", failures: repeat("pat", 5), username: "pat", ip: "198.51.100.1", elapsed: 9 * time.Minute, wantWait: time.Minute, wantErr: pkg.ErrAccountLocked},
+		{name: "lockout expires", failures: repeat("pat", 5), username: "pat", ip: "198.51.100.1", elapsed: 10*time.Minute + time.Second},
+		{
+			name:     "unlock",
+			failures: repeat("pat", 5),
+			then:     func(l *LoginThrottle) { l.Unlock(context.Background(), "pat") },
+			username: "pat", ip: "198.51.100.1",
+		},
+		{
+			name:     "success resets the username",
+			failures: repeat("pat", 4),
+			then:     func(l *LoginThrottle) { l.Success(context.Background(), "PAT") },
+			username: "pat", ip: ip,
+		},
+		{name: "ip backoff", failures: []string{"a", "b", "c", "d", "e", "f"}, username: "pat", ip: ip, wantWait: time.Second, wantErr: pkg.ErrTooManyAttempts},
+		{name: "other ips unaffected", failures: []string{"a", "b", "c", "d", "e", "f"}, username: "pat", ip: "198.51.100.1"},
+		{
+			name:     "success keeps the ip counter",
+			failures: []string{"a", "b", "c", "d", "e", "pat"},
+			then:     func(l *LoginThrottle) { l.Success(context.Background(), "pat") },
+			username: "pat", ip: ip, wantWait: time.Second, wantErr: pkg.ErrTooManyAttempts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			throttle := NewLoginThrottle(memory.NewLoginAttemptStore(), opts)
+			throttle.now = func() time.Time { return now }
+
+			for i, username := range tt.failures {
+				if i > 0 {
+					now = now.Add(time.Second)
+				}
+				if err := throttle.Failure(context.Background(), username, ip); err != nil {
+					t.Fatalf("Failure: %v", err)
+				}
+			}
+			if tt.then != nil {
+				tt.then(throttle)
+			}
+			now = now.Add(tt.elapsed)
+
+			wait, err := throttle.Check(context.Background(), tt.username, tt.ip)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if wait != tt.wantWait {
+				t.Errorf("wait = %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestNewLoginThrottleDefaults(t *testing.T) {
+	throttle := NewLoginThrottle(memory.NewLoginAttemptStore(), ThrottleOptions{})
+	want := ThrottleOptions{
+		FreeAttempts:    3,
+		IPFreeAttempts:  20,
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		MaxFailures:     10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	if throttle.opts != want {
+		t.Errorf("opts = %+v, want %+v", throttle.opts, want)
+	}
+}
@@ -1,170 +0,0 @@
-package handlers
-
-import (
-	"net/http"
-	"strconv"
-	"time"
-
-	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
-
-	"github.com/reginaldsourn/go-crud/internal/core/domain"
-	"github.com/reginaldsourn/go-crud/internal/core/ports"
-	pkg "github.com/reginaldsourn/go-crud/pkg/error"
-)
-
-type UserHandler struct {
-	store ports.UserStore
-}
-
-func NewUserHandler(s ports.UserStore) *UserHandler {
-	return &UserHandler{store: s}
-}
-
-type userResponse struct {
-	ID        int64  `json:"id"`
-	Username  string `json:"username"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
-}
-
-func toUserResponse(u domain.User) userResponse {
-	return userResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		CreatedAt: u.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: u.UpdatedAt.Format(time.RFC3339),
-	}
-}
-
-func (h *UserHandler) Create(c *gin.Context) {
-	var req struct {
-		Username string `json:"username" binding:"required"`
-		Password string `json:"password" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
-		return
-	}
-
-	u, err := h.store.Create(c.Request.Context(), req.Username, passwordHash)
-	if err != nil {
-		status := http.StatusBadRequest
-		if err == pkg.ErrUsernameExists {
-			status = http.StatusConflict
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusCreated, toUserResponse(u))
-}
-
-func (h *UserHandler) Get(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
-		return
-	}
-
-	u, err := h.store.GetByID(c.Request.Context(), id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, toUserResponse(u))
-}
-
-func (h *UserHandler) List(c *gin.Context) {
-	users, err := h.store.List(c.Request.Context())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	resp := make([]userResponse, 0, len(users))
-	for _, u := range users {
-		resp = append(resp, toUserResponse(u))
-	}
-
-	c.JSON(http.StatusOK, resp)
-}
-
-func (h *UserHandler) Update(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
-		return
-	}
-
-	var req struct {
-		Username *string `json:"username"`
-		Password *string `json:"password"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if req.Username == nil && req.Password == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
-		return
-	}
-
-	username := ""
-	if req.Username != nil {
-		if *req.Username == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
-			return
-		}
-		username = *req.Username
-	}
-
-	var passwordHash []byte
-	if req.Password != nil {
-		if *req.Password == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
-			return
-		}
-		passwordHash, err = bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
-			return
-		}
-	}
-
-	u, err := h.store.Update(c.Request.Context(), id, username, passwordHash)
-	if err != nil {
-		status := http.StatusBadRequest
-		if err == pkg.ErrUserNotFound {
-			status = http.StatusNotFound
-		} else if err == pkg.ErrUsernameExists {
-			status = http.StatusConflict
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, toUserResponse(u))
-}
-
-func (h *UserHandler) Delete(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
-		return
-	}
-
-	if err := h.store.Delete(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.Status(http.StatusNoContent)
-}
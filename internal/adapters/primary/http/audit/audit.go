@@ -0,0 +1,61 @@
+// Package audit records audit events for HTTP requests.
+package audit
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+)
+
+const (
+	appendTimeout = 5 * time.Second
+	// Limits match the audit_events column sizes.
+	maxTargetIDLength = 64
+	maxDetailLength   = 255
+)
+
+// Record appends event, filling in the actor, client IP and request ID from
+// the request. During impersonation the actor is the admin. A nil store
+// disables auditing. Failures are logged and returned; most callers ignore
+// them, since the action itself has already happened.
+func Record(c *gin.Context, store ports.AuditStore, event domain.AuditEvent) error {
+	if store == nil {
+		return nil
+	}
+
+	if event.ActorID == nil {
+		if actorID := c.GetInt64("actor_id"); actorID != 0 {
+			// An admin is impersonating the signed-in user; the admin is
+			// the one accountable.
+			userID := c.GetInt64("user_id")
+			event.ActorID = &actorID
+			event.OnBehalfOfID = &userID
+		} else if userID := c.GetInt64("user_id"); userID != 0 {
+			event.ActorID = &userID
+		}
+	}
+	event.IP = c.ClientIP()
+	event.RequestID = c.GetString("request_id")
+	if len(event.TargetID) > maxTargetIDLength {
+		event.TargetID = event.TargetID[:maxTargetIDLength]
+	}
+	if len(event.Detail) > maxDetailLength {
+		event.Detail = event.Detail[:maxDetailLength]
+	}
+
+	// The request context may already be cancelled when the client goes
+	// away, and the event must still be written.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), appendTimeout)
+	defer cancel()
+	if err := store.Append(ctx, &event); err != nil {
+		log.Printf("audit append failed: action=%s target=%s/%s request_id=%s err=%v",
+			event.Action, event.TargetType, event.TargetID, event.RequestID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type recordedEvents struct {
+	events []domain.AuditEvent
+	// live is whether the context passed to Append was still usable.
+	live []bool
+}
+
+func (s *recordedEvents) Append(ctx context.Context, event *domain.AuditEvent) error {
+	s.events = append(s.events, *event)
+	s.live = append(s.live, ctx.Err() == nil)
+	return nil
+}
+
+func (s *recordedEvents) List(context.Context, domain.AuditFilter) ([]domain.AuditEvent, error) {
+	return nil, nil
+}
+
+func (s *recordedEvents) Each(context.Context, domain.AuditFilter, func(domain.AuditEvent) error) error {
+	return nil
+}
+
+func requestContext(values map[string]any) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Request.RemoteAddr = "203.0.113.9:4000"
+	for k, v := range values {
+		c.Set(k, v)
+	}
+	return c
+}
+
+func TestRecord(t *testing.T) {
+	store := &recordedEvents{}
+
+	Record(requestContext(map[string]any{"user_id": int64(5), "request_id": "req-1"}), store, domain.AuditEvent{Action: domain.AuditUserUpdated})
+	Record(requestContext(map[string]any{"user_id": int64(5), "actor_id": int64(1)}), store, domain.AuditEvent{Action: domain.AuditUserUpdated})
+
+	explicit := int64(9)
+	Record(requestContext(map[string]any{"user_id": int64(5)}), store, domain.AuditEvent{Action: domain.AuditUserCreated, ActorID: &explicit})
+
+	signedIn, impersonated, given := store.events[0], store.events[1], store.events[2]
+	if signedIn.ActorID == nil || *signedIn.ActorID != 5 || signedIn.OnBehalfOfID != nil {
+		t.Errorf("signed-in actor = %v on behalf of %v, want 5 alone", signedIn.ActorID, signedIn.OnBehalfOfID)
+	}
+	if signedIn.IP != "203.0.113.9" || signedIn.RequestID != "req-1" {
+		t.Errorf("ip = %q request_id = %q", signedIn.IP, signedIn.RequestID)
+	}
+	if impersonated.ActorID == nil || *impersonated.ActorID != 1 || impersonated.OnBehalfOfID == nil || *impersonated.OnBehalfOfID != 5 {
+		t.Errorf("impersonation actor = %v on behalf of %v, want admin 1 acting for 5", impersonated.ActorID, impersonated.OnBehalfOfID)
+	}
+	if *given.ActorID != 9 {
+		t.Errorf("explicit actor replaced with %d", *given.ActorID)
+	}
+}
+
+func TestRecordOutlivesTheRequest(t *testing.T) {
+	store := &recordedEvents{}
+	c := requestContext(nil)
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	cancel()
+
+	Record(c, store, domain.AuditEvent{
+		Action:   domain.AuditUserDeleted,
+		TargetID: strings.Repeat("7", 100),
+		Detail:   strings.Repeat("d", 300),
+	})
+	if len(store.events) != 1 || !store.live[0] {
+		t.Fatal("event not appended with a live context after the client went away")
+	}
+	if got := store.events[0]; len(got.TargetID) != maxTargetIDLength || len(got.Detail) != maxDetailLength {
+		t.Errorf("target_id %d and detail %d bytes, want them cut to the column sizes", len(got.TargetID), len(got.Detail))
+	}
+
+	if err := Record(c, nil, domain.AuditEvent{Action: domain.AuditUserDeleted}); err != nil {
+		t.Errorf("nil store: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package dto
+
+import "time"
+
+type ProfileResponse struct {
+	ID          int64      `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	DisplayName string     `json:"display_name"`
+	Role        string     `json:"role"`
+	MFAEnabled  bool       `json:"mfa_enabled"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+	PurgeAfter  *time.Time `json:"purge_after,omitempty"`
+	// ImpersonatedBy is set when an admin is viewing the account with an
+	// impersonation token.
+	ImpersonatedBy *Impersonator `json:"impersonated_by,omitempty"`
+}
+
+type Impersonator struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+	Email       *string `json:"email"`
+	// CurrentPassword is required to change the email, which is where
+	// password resets are sent.
+	CurrentPassword string `json:"current_password,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type CloseAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type CloseAccountResponse struct {
+	ClosedAt   time.Time `json:"closed_at"`
+	PurgeAfter time.Time `json:"purge_after"`
+}
@@ -0,0 +1,71 @@
+package dto
+
+import pkg "github.com/reginaldsourn/go-crud/pkg/error"
+
+// Batch modes. Atomic batches commit all operations or none; best-effort
+// batches apply each operation on its own.
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// Batch operation kinds.
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// BatchRequest is the JSON form of a batch. NDJSON batches send one
+// operation per line and pass the mode as a query parameter instead.
+type BatchRequest[T any] struct {
+	Mode       string `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Operations []T    `json:"operations" binding:"required"`
+}
+
+// DeviceBatchOperation creates, updates or deletes one device. Updates may
+// carry the version they expect, as If-Match does for single updates.
+type DeviceBatchOperation struct {
+	Op      string `json:"op" binding:"required,oneof=create update delete"`
+	ID      int64  `json:"id"`
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+	TypeID  int64  `json:"type_id"`
+}
+
+// UserBatchOperation creates, updates or deletes one user.
+type UserBatchOperation struct {
+	Op       string `json:"op" binding:"required,oneof=create update delete"`
+	ID       int64  `json:"id"`
+	Version  int64  `json:"version"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// BatchResult reports the outcome of one operation, in request order.
+// Status is the HTTP status the operation would have had on its own.
+type BatchResult struct {
+	Index    int         `json:"index"`
+	Op       string      `json:"op,omitempty"`
+	Status   int         `json:"status"`
+	Resource any         `json:"resource,omitempty"`
+	Error    *BatchError `json:"error,omitempty"`
+}
+
+type BatchError struct {
+	Code    string           `json:"code"`
+	Message string           `json:"message"`
+	Errors  []pkg.FieldError `json:"errors,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode string `json:"mode"`
+	// Committed is false when an atomic batch was rolled back.
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
+
+func ToBatchError(e *pkg.Error) *BatchError {
+	return &BatchError{Code: e.Code, Message: e.Message, Errors: e.Fields}
+}
@@ -8,28 +8,49 @@ import (
 
 type CreateDeviceRequest struct {
 	Name   string `json:"name" binding:"required"`
-	TypeID int64  `json:"type_id" binding:"required"`
+	TypeID int64  `json:"type_id" binding:"required,gt=0"`
 }
 
 type UpdateDeviceRequest struct {
-	Name   *string `json:"name"`
-	TypeID *int64  `json:"type_id"`
+	Name   *string `json:"name" binding:"omitempty,min=1"`
+	TypeID *int64  `json:"type_id" binding:"omitempty,gt=0"`
+}
+
+// DevicePatch holds the fields a PATCH may change. It is the result of
+// applying the patch to the device's representation, so it is complete.
+type DevicePatch struct {
+	Name   string `json:"name" binding:"required"`
+	TypeID int64  `json:"type_id" binding:"required,gt=0"`
+}
+
+// DeviceImportRow is one line of a device import. Devices are matched by
+// name: unknown names are created and known ones take the row's type.
+type DeviceImportRow struct {
+	Name   string `json:"name" binding:"required,max=128"`
+	TypeID int64  `json:"type_id" binding:"required,gt=0"`
 }
 
 type DeviceResponse struct {
 	ID        int64  `json:"id"`
 	Name      string `json:"name"`
 	TypeID    int64  `json:"type_id"`
+	Version   int64  `json:"version"`
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
+	DeletedAt string `json:"deleted_at,omitempty"`
 }
 
 func ToDeviceResponse(d domain.Device) DeviceResponse {
-	return DeviceResponse{
+	resp := DeviceResponse{
 		ID:        d.ID,
 		Name:      d.Name,
 		TypeID:    d.TypeID,
+		Version:   d.Version,
 		CreatedAt: d.CreatedAt.Format(time.RFC3339),
 		UpdatedAt: d.UpdatedAt.Format(time.RFC3339),
 	}
+	if d.DeletedAt.Valid {
+		resp.DeletedAt = d.DeletedAt.Time.Format(time.RFC3339)
+	}
+	return resp
 }
@@ -0,0 +1,15 @@
+package dto
+
+import "time"
+
+type ImpersonateRequest struct {
+	// Reason is recorded in the audit trail.
+	Reason string `json:"reason" binding:"required"`
+}
+
+type ImpersonateResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+}
@@ -0,0 +1,12 @@
+package dto
+
+// ImportReport summarises an import. A dry run reports what the import
+// would do without committing it.
+type ImportReport struct {
+	DryRun    bool `json:"dry_run"`
+	Committed bool `json:"committed"`
+	Rows      int  `json:"rows"`
+	Created   int  `json:"created"`
+	Updated   int  `json:"updated"`
+	Unchanged int  `json:"unchanged"`
+}
@@ -0,0 +1,39 @@
+package dto
+
+import "time"
+
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required"`
+	// Role defaults to user.
+	Role string `json:"role" binding:"omitempty,oneof=user admin"`
+}
+
+type InvitationResponse struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy int64     `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateInvitationResponse is the only response that carries the acceptance
+// link, so an admin can pass it on when mail delivery is not configured.
+type CreateInvitationResponse struct {
+	InvitationResponse
+	Link string `json:"link"`
+}
+
+// InvitationLookupResponse tells the acceptance page who an invitation is
+// for.
+type InvitationLookupResponse struct {
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,19 @@
+package dto
+
+import "github.com/reginaldsourn/go-crud/internal/core/domain"
+
+// ListResponse is the envelope for paginated lists. NextCursor is omitted on
+// the last page.
+type ListResponse[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int64  `json:"total"`
+}
+
+func ToListResponse[S, T any](page domain.Page[S], convert func(S) T) ListResponse[T] {
+	items := make([]T, 0, len(page.Items))
+	for _, item := range page.Items {
+		items = append(items, convert(item))
+	}
+	return ListResponse[T]{Items: items, NextCursor: page.NextCursor, Total: page.Total}
+}
@@ -0,0 +1,16 @@
+package dto
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ForgotPasswordResponse is the same whether or not the email belongs to an
+// account.
+type ForgotPasswordResponse struct {
+	Message string `json:"message"`
+}
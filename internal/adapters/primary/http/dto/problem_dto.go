@@ -0,0 +1,16 @@
+package dto
+
+import pkg "github.com/reginaldsourn/go-crud/pkg/error"
+
+// Problem is an RFC 7807 problem details body. Code is stable and is what
+// clients should switch on.
+type Problem struct {
+	Type      string           `json:"type"`
+	Title     string           `json:"title"`
+	Status    int              `json:"status"`
+	Detail    string           `json:"detail,omitempty"`
+	Instance  string           `json:"instance,omitempty"`
+	Code      string           `json:"code"`
+	RequestID string           `json:"request_id,omitempty"`
+	Errors    []pkg.FieldError `json:"errors,omitempty"`
+}
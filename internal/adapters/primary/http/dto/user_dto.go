@@ -8,26 +8,59 @@ import (
 
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required"`
+	Email    string `json:"email"`
 	Password string `json:"password" binding:"required"`
 }
 
 type UpdateUserRequest struct {
-	Username *string `json:"username"`
+	Username *string `json:"username" binding:"omitempty,min=1"`
 	Password *string `json:"password"`
 }
 
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
+// UserPatch holds the fields a PATCH may change. It is the result of
+// applying the patch to the user's representation, so it is complete. A
+// removed email clears it; passwords and roles have their own endpoints.
+type UserPatch struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"omitempty,email"`
+}
+
+// RegisterResponse is returned when someone creates their own account, by
+// registering or accepting an invitation.
+type RegisterResponse struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// UserResponse is an account as the API shows it. Email is left out unless
+// the caller is an admin or the account's owner.
 type UserResponse struct {
 	ID        int64  `json:"id"`
 	Username  string `json:"username"`
+	Email     string `json:"email,omitempty"`
+	Role      string `json:"role"`
+	Version   int64  `json:"version"`
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
+	DeletedAt string `json:"deleted_at,omitempty"`
 }
 
 func ToUserResponse(u domain.User) UserResponse {
-	return UserResponse{
+	resp := UserResponse{
 		ID:        u.ID,
 		Username:  u.Username,
+		Email:     u.Email,
+		Role:      u.Role,
+		Version:   u.Version,
 		CreatedAt: u.CreatedAt.Format(time.RFC3339),
 		UpdatedAt: u.UpdatedAt.Format(time.RFC3339),
 	}
+	if u.DeletedAt.Valid {
+		resp.DeletedAt = u.DeletedAt.Time.Format(time.RFC3339)
+	}
+	return resp
 }
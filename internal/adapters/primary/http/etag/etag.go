@@ -0,0 +1,61 @@
+// Package etag implements ETag, If-Match and If-None-Match handling for
+// resources that carry a version number.
+package etag
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Format returns the strong entity tag for a version.
+func Format(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Set writes the ETag header for version.
+func Set(c *gin.Context, version int64) {
+	c.Header("ETag", Format(version))
+}
+
+// NotModified sets the ETag and, when If-None-Match names the current
+// version, answers 304 and returns true.
+func NotModified(c *gin.Context, version int64) bool {
+	Set(c, version)
+	if !matches(c.GetHeader("If-None-Match"), version, true) {
+		return false
+	}
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// Matches reports whether the request's If-Match precondition holds for
+// version. A request without If-Match always matches.
+func Matches(c *gin.Context, version int64) bool {
+	header := c.GetHeader("If-Match")
+	return header == "" || matches(header, version, false)
+}
+
+// matches checks a comma-separated list of entity tags. If-None-Match uses
+// weak comparison, so it also accepts W/ tags; If-Match does not.
+func matches(header string, version int64, weak bool) bool {
+	if header == "" {
+		return false
+	}
+	want := Format(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == want {
+			return true
+		}
+	}
+	return false
+}
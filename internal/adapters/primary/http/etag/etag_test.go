@@ -0,0 +1,49 @@
+package etag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPreconditions(t *testing.T) {
+	tests := []struct {
+		header      string
+		match       bool // If-Match
+		notModified bool // If-None-Match
+	}{
+		{``, true, false},
+		{`"7"`, true, true},
+		{`"6"`, false, false},
+		{`"5", "7"`, true, true},
+		{`*`, true, true},
+		// If-Match needs a strong match; If-None-Match accepts weak tags.
+		{`W/"7"`, false, true},
+		{`7`, false, false},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set("If-Match", tt.header)
+		c.Request.Header.Set("If-None-Match", tt.header)
+
+		if got := Matches(c, 7); got != tt.match {
+			t.Errorf("If-Match %s: Matches = %v, want %v", tt.header, got, tt.match)
+		}
+		if got := NotModified(c, 7); got != tt.notModified {
+			t.Errorf("If-None-Match %s: NotModified = %v, want %v", tt.header, got, tt.notModified)
+		}
+		c.Writer.WriteHeaderNow()
+		if tt.notModified && w.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: status = %d, want 304", tt.header, w.Code)
+		}
+		if got := w.Header().Get("ETag"); got != `"7"` {
+			t.Errorf("ETag = %s, want \"7\"", got)
+		}
+	}
+}
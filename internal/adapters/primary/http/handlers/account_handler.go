@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/auth"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// AccountHandler serves the self-service endpoints under /me.
+type AccountHandler struct {
+	accounts *services.UserService
+	throttle *auth.LoginThrottle
+	issuer   ports.TokenIssuer
+	sessions ports.SessionStore
+	grace    time.Duration
+	audit    ports.AuditStore
+}
+
+func NewAccountHandler(accounts *services.UserService, throttle *auth.LoginThrottle, issuer ports.TokenIssuer, sessions ports.SessionStore, grace time.Duration, audit ports.AuditStore) *AccountHandler {
+	return &AccountHandler{
+		accounts: accounts,
+		throttle: throttle,
+		issuer:   issuer,
+		sessions: sessions,
+		grace:    grace,
+		audit:    audit,
+	}
+}
+
+func (h *AccountHandler) Get(c *gin.Context) {
+	u, ok := currentUser(c, h.accounts)
+	if !ok {
+		return
+	}
+
+	resp := profileResponse(u)
+	if actorID := c.GetInt64("actor_id"); actorID != 0 {
+		resp.ImpersonatedBy = &dto.Impersonator{ID: actorID, Username: c.GetString("actor_username")}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AccountHandler) Update(c *gin.Context) {
+	var req dto.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	before, ok := currentUser(c, h.accounts)
+	if !ok {
+		return
+	}
+	// Password resets go to the email, so changing it takes the password
+	// just like changing the password does.
+	if req.Email != nil && !strings.EqualFold(strings.TrimSpace(*req.Email), before.Email) {
+		if req.CurrentPassword == "" {
+			c.Error(pkg.InvalidField("current_password", "required", "current_password is required to change email"))
+			return
+		}
+		if !h.verifyPassword(c, before, req.CurrentPassword) {
+			return
+		}
+	}
+
+	u, err := h.accounts.UpdateProfile(c.Request.Context(), before.ID, domain.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, pkg.Validation()), errors.Is(err, pkg.ErrInvalidEmail), errors.Is(err, pkg.ErrDuplicateEmail), errors.Is(err, pkg.ErrUserNotFound):
+			c.Error(err)
+		default:
+			c.Error(pkg.Internal("failed to update profile"))
+		}
+		return
+	}
+
+	if changes := domain.DiffFields(before, u); changes != nil {
+		recordUserEvent(c, h.audit, domain.AuditUserUpdated, u.ID, domain.AuditEvent{Changes: changes})
+	}
+	c.JSON(http.StatusOK, profileResponse(u))
+}
+
+// ChangePassword replaces the password after checking the current one. All
+// existing sessions are revoked and a fresh token is returned for the caller.
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	var req dto.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	u, ok := currentUser(c, h.accounts)
+	if !ok {
+		return
+	}
+	if !h.verifyPassword(c, u, req.CurrentPassword) {
+		return
+	}
+
+	if _, err := h.accounts.SetPassword(c.Request.Context(), u.ID, req.NewPassword); err != nil {
+		if errors.Is(err, pkg.ErrPasswordPolicy) {
+			c.Error(passwordErrorAs("new_password", err))
+			return
+		}
+		c.Error(pkg.Internal("failed to change password"))
+		return
+	}
+	recordUserEvent(c, h.audit, domain.AuditPasswordChanged, u.ID, domain.AuditEvent{})
+	if !h.revokeAll(c, u.ID) {
+		return
+	}
+
+	token, err := issueAccessToken(c, h.issuer, h.sessions, u)
+	if err != nil {
+		c.Error(pkg.Internal("failed to issue token"))
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.LoginResponse{Token: token, Username: u.Username})
+}
+
+// Close schedules the account for deletion after the grace period and signs
+// it out everywhere. Signing in again before the purge reopens it.
+func (h *AccountHandler) Close(c *gin.Context) {
+	var req dto.CloseAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	u, ok := currentUser(c, h.accounts)
+	if !ok {
+		return
+	}
+	if !h.verifyPassword(c, u, req.Password) {
+		return
+	}
+
+	closedAt, purgeAfter, err := h.accounts.Close(c.Request.Context(), u.ID, h.grace)
+	if err != nil {
+		c.Error(pkg.Internal("failed to close account"))
+		return
+	}
+	recordUserEvent(c, h.audit, domain.AuditUserClosed, u.ID, domain.AuditEvent{
+		Detail: "purge after " + purgeAfter.UTC().Format(time.RFC3339),
+	})
+	if !h.revokeAll(c, u.ID) {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.CloseAccountResponse{
+		ClosedAt:   closedAt,
+		PurgeAfter: purgeAfter,
+	})
+}
+
+// verifyPassword checks a re-entered password under the login throttle so a
+// stolen token cannot be used to guess it.
+func (h *AccountHandler) verifyPassword(c *gin.Context, u domain.User, pw string) bool {
+	if !checkThrottle(c, h.throttle, u.Username) {
+		return false
+	}
+
+	ok, _, err := h.accounts.VerifyPassword(u, pw)
+	if err != nil || !ok {
+		recordFailure(c, h.throttle, u.Username)
+		c.Error(pkg.ErrIncorrectPassword)
+		return false
+	}
+
+	recordSuccess(c, h.throttle, u.Username)
+	return true
+}
+
+func (h *AccountHandler) revokeAll(c *gin.Context, userID int64) bool {
+	ctx := c.Request.Context()
+	if err := h.accounts.RevokeTokens(ctx, userID); err != nil {
+		c.Error(pkg.Internal("failed to invalidate sessions"))
+		return false
+	}
+	if h.sessions != nil {
+		if err := h.sessions.RevokeAll(ctx, userID); err != nil {
+			log.Printf("session revoke failed: user_id=%d err=%v", userID, err)
+		}
+	}
+	return true
+}
+
+// reopenIfClosed cancels a pending closure when the user signs in during the
+// grace period.
+func reopenIfClosed(c *gin.Context, users *services.UserService, u domain.User) error {
+	if u.ClosedAt == nil {
+		return nil
+	}
+	if err := users.Reopen(c.Request.Context(), u.ID); err != nil {
+		return err
+	}
+	log.Printf("account reopened by sign-in: user_id=%d", u.ID)
+	return nil
+}
+
+func profileResponse(u domain.User) dto.ProfileResponse {
+	return dto.ProfileResponse{
+		ID:          u.ID,
+		Username:    u.Username,
+		Email:       u.Email,
+		DisplayName: u.DisplayName,
+		Role:        u.Role,
+		MFAEnabled:  u.TOTPEnabled,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		ClosedAt:    u.ClosedAt,
+		PurgeAfter:  u.PurgeAfter,
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+	"github.com/reginaldsourn/go-crud/pkg/password"
+)
+
+// accountUsers holds the signed-in account and records what was done to it.
+type accountUsers struct {
+	ports.UserStore
+	user      domain.User
+	revokedAt *time.Time
+}
+
+func (s *accountUsers) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	if id != s.user.ID {
+		return domain.User{}, pkg.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func (s *accountUsers) UpdateProfile(ctx context.Context, id int64, update domain.ProfileUpdate) (domain.User, error) {
+	if update.DisplayName != nil {
+		s.user.DisplayName = *update.DisplayName
+	}
+	if update.Email != nil {
+		s.user.Email = *update.Email
+	}
+	return s.user, nil
+}
+
+func (s *accountUsers) Update(ctx context.Context, id int64, changes domain.UserChanges, version int64) (domain.User, error) {
+	if changes.PasswordHash != nil {
+		s.user.PasswordHash = changes.PasswordHash
+	}
+	return s.user, nil
+}
+
+func (s *accountUsers) RevokeTokens(ctx context.Context, id int64, before time.Time) error {
+	s.revokedAt = &before
+	return nil
+}
+
+func (s *accountUsers) Close(ctx context.Context, id int64, closedAt, purgeAfter time.Time) error {
+	s.user.ClosedAt, s.user.PurgeAfter = &closedAt, &purgeAfter
+	return nil
+}
+
+func newTestAccountHandler(users *accountUsers, grace time.Duration) *AccountHandler {
+	accounts := services.NewUserService(users, fakeHasher{}, password.DefaultPolicy(), false)
+	return NewAccountHandler(accounts, nil, &purposeIssuer{}, nil, grace, nil)
+}
+
+// callAccount runs handler as user 1 with body as the JSON request.
+func callAccount(handler gin.HandlerFunc, method, body string) (*httptest.ResponseRecorder, *gin.Context) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/api/v1/me", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler(c)
+	return w, c
+}
+
+func TestAccountUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantErr   error
+		wantField string
+		wantName  string
+		wantEmail string
+	}{
+		{
+			name:     "display name is trimmed",
+			body:     `{"display_name":"  Pat Smith  "}`,
+			wantName: "Pat Smith", wantEmail: "pat@example.com",
+		},
+		{
+			name:      "display name over 100 characters",
+			body:      `{"display_name":"` + strings.Repeat("x", 101) + `"}`,
+			wantErr:   pkg.Validation(),
+			wantField: "display_name",
+		},
+		{
+			name:      "email change without the password",
+			body:      `{"email":"sam@example.com"}`,
+			wantErr:   pkg.Validation(),
+			wantField: "current_password",
+		},
+		{
+			name:    "email change with the wrong password",
+			body:    `{"email":"sam@example.com","current_password":"nope"}`,
+			wantErr: pkg.ErrIncorrectPassword,
+		},
+		{
+			name:      "email change with the password",
+			body:      `{"email":" sam@example.com ","current_password":"Passw0rd!x"}`,
+			wantEmail: "sam@example.com",
+		},
+		{
+			name:      "same email in another case needs no password",
+			body:      `{"email":"PAT@example.com"}`,
+			wantEmail: "PAT@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &accountUsers{user: domain.User{ID: 1, Username: "pat", Email: "pat@example.com", PasswordHash: []byte("hashed:Passw0rd!x")}}
+			h := newTestAccountHandler(users, time.Hour)
+
+			w, c := callAccount(h.Update, http.MethodPatch, tt.body)
+			if tt.wantErr != nil {
+				if len(c.Errors) == 0 || !errors.Is(c.Errors.Last().Err, tt.wantErr) {
+					t.Fatalf("errors = %v, want %v", c.Errors, tt.wantErr)
+				}
+				var e *pkg.Error
+				if tt.wantField != "" && (!errors.As(c.Errors.Last().Err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != tt.wantField) {
+					t.Errorf("err = %v, want a %s field error", c.Errors.Last().Err, tt.wantField)
+				}
+				if users.user.Email != "pat@example.com" || users.user.DisplayName != "" {
+					t.Errorf("profile changed after a refused update: %+v", users.user)
+				}
+				return
+			}
+
+			var got dto.ProfileResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("status %d, body %s: %v", w.Code, w.Body, err)
+			}
+			if got.DisplayName != tt.wantName || got.Email != tt.wantEmail {
+				t.Errorf("profile = %q %q, want %q %q", got.DisplayName, got.Email, tt.wantName, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestAccountChangePassword(t *testing.T) {
+	users := &accountUsers{user: domain.User{ID: 1, Username: "pat", PasswordHash: []byte("hashed:Passw0rd!x")}}
+	h := newTestAccountHandler(users, time.Hour)
+
+	_, c := callAccount(h.ChangePassword, http.MethodPost, `{"current_password":"wrong","new_password":"N3w-Passw0rd!"}`)
+	if len(c.Errors) == 0 || !errors.Is(c.Errors.Last().Err, pkg.ErrIncorrectPassword) {
+		t.Fatalf("wrong current password: errors = %v", c.Errors)
+	}
+	if users.revokedAt != nil {
+		t.Fatal("tokens revoked after a refused change")
+	}
+
+	before := time.Now()
+	w, c := callAccount(h.ChangePassword, http.MethodPost, `{"current_password":"Passw0rd!x","new_password":"N3w-Passw0rd!"}`)
+	if len(c.Errors) > 0 {
+		t.Fatalf("errors = %v", c.Errors)
+	}
+	if string(users.user.PasswordHash) != "hashed:N3w-Passw0rd!" {
+		t.Errorf("stored hash = %q", users.user.PasswordHash)
+	}
+	if users.revokedAt == nil || users.revokedAt.Before(before) {
+		t.Errorf("revokedAt = %v, want the time of the change", users.revokedAt)
+	}
+	var resp dto.LoginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token != "access-token" {
+		t.Errorf("response = %s, want a fresh token", w.Body)
+	}
+}
+
+func TestAccountClose(t *testing.T) {
+	users := &accountUsers{user: domain.User{ID: 1, Username: "pat", PasswordHash: []byte("hashed:Passw0rd!x")}}
+	h := newTestAccountHandler(users, 30*24*time.Hour)
+
+	w, c := callAccount(h.Close, http.MethodDelete, `{"password":"Passw0rd!x"}`)
+	if len(c.Errors) > 0 || w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d errors = %v", w.Code, c.Errors)
+	}
+
+	var resp dto.CloseAccountResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	if got := resp.PurgeAfter.Sub(resp.ClosedAt); got != 30*24*time.Hour {
+		t.Errorf("purge after closing by %v, want the 30 day grace period", got)
+	}
+	if users.user.ClosedAt == nil || !users.user.ClosedAt.Equal(resp.ClosedAt) {
+		t.Errorf("stored closed_at = %v, want %v", users.user.ClosedAt, resp.ClosedAt)
+	}
+	if users.revokedAt == nil {
+		t.Error("closing the account did not revoke its tokens")
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/pkg/auth"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const maxAPIKeyNameLength = 100
+
+type APIKeysHandler struct {
+	keys ports.APIKeyStore
+}
+
+func NewAPIKeysHandler(keys ports.APIKeyStore) *APIKeysHandler {
+	return &APIKeysHandler{keys: keys}
+}
+
+// Create issues a new key for the current user. The key is returned once and
+// only its hash is stored.
+func (h *APIKeysHandler) Create(c *gin.Context) {
+	var req dto.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		c.Error(pkg.InvalidField("name", "len", "name must be between 1 and 100 characters"))
+		return
+	}
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.Error(pkg.InvalidField("expires_at", "future", "expires_at must be in the future"))
+		return
+	}
+
+	secret, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.Error(pkg.Internal("failed to generate api key"))
+		return
+	}
+
+	key := domain.APIKey{
+		UserID:    c.GetInt64("user_id"),
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    strings.Join(scopes, " "),
+		KeyHash:   hash,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := h.keys.Create(c.Request.Context(), &key); err != nil {
+		c.Error(pkg.Internal("failed to store api key"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.CreateAPIKeyResponse{
+		APIKeyResponse: apiKeyResponse(key),
+		Key:            secret,
+	})
+}
+
+func (h *APIKeysHandler) List(c *gin.Context) {
+	keys, err := h.keys.ListForUser(c.Request.Context(), c.GetInt64("user_id"))
+	if err != nil {
+		c.Error(pkg.Internal("failed to list api keys"))
+		return
+	}
+
+	resp := make([]dto.APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, apiKeyResponse(k))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *APIKeysHandler) Delete(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.Error(pkg.Invalid("invalid api key id"))
+		return
+	}
+
+	if err := h.keys.Delete(c.Request.Context(), c.GetInt64("user_id"), id); err != nil {
+		if errors.Is(err, pkg.ErrAPIKeyNotFound) {
+			c.Error(err)
+			return
+		}
+		c.Error(pkg.Internal("failed to delete api key"))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return []string{domain.ScopeRead}, nil
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		switch s {
+		case domain.ScopeRead, domain.ScopeWrite:
+		default:
+			return nil, pkg.ErrInvalidScope
+		}
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func apiKeyResponse(k domain.APIKey) dto.APIKeyResponse {
+	return dto.APIKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.ScopeList(),
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
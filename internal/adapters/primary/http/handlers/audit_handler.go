@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	auditFlushEvery   = 100
+)
+
+type AuditHandler struct {
+	store ports.AuditStore
+}
+
+func NewAuditHandler(store ports.AuditStore) *AuditHandler {
+	return &AuditHandler{store: store}
+}
+
+// List returns matching events newest first. Older pages are fetched by
+// passing the last ID seen as before_id.
+func (h *AuditHandler) List(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	filter.Limit = defaultAuditLimit
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			c.Error(pkg.InvalidField("limit", "range", "limit must be between 1 and 1000"))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	events, err := h.store.List(c.Request.Context(), filter)
+	if err != nil {
+		c.Error(pkg.Internal("failed to list audit events"))
+		return
+	}
+	if events == nil {
+		events = []domain.AuditEvent{}
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// Export streams every matching event, oldest first, as JSON Lines.
+func (h *AuditHandler) Export(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Header("Content-Type", "application/jsonl")
+	c.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	written := 0
+	err = h.store.Each(c.Request.Context(), filter, func(event domain.AuditEvent) error {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+		written++
+		if written%auditFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Headers are already sent, so the truncated body is the only
+		// signal the client gets.
+		log.Printf("audit export failed after %d events: %v", written, err)
+		return
+	}
+	c.Writer.Flush()
+}
+
+func parseAuditFilter(c *gin.Context) (domain.AuditFilter, error) {
+	filter := domain.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+
+	if raw := c.Query("actor_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return domain.AuditFilter{}, pkg.InvalidField("actor_id", "type", "invalid actor_id")
+		}
+		filter.ActorID = &id
+	}
+	if raw := c.Query("before_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			return domain.AuditFilter{}, pkg.InvalidField("before_id", "type", "invalid before_id")
+		}
+		filter.BeforeID = id
+	}
+	for name, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return domain.AuditFilter{}, pkg.InvalidField(name, "datetime", name+" must be an RFC 3339 timestamp")
+		}
+		*dst = &t
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// auditTrail streams its events and remembers the last filter it was given.
+type auditTrail struct {
+	ports.AuditStore
+	events []domain.AuditEvent
+	filter domain.AuditFilter
+}
+
+func (s *auditTrail) Each(ctx context.Context, filter domain.AuditFilter, fn func(domain.AuditEvent) error) error {
+	s.filter = filter
+	for _, e := range s.events {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAuditExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &auditTrail{events: []domain.AuditEvent{
+		{ID: 1, Action: domain.AuditUserCreated, TargetType: domain.AuditTargetUser, TargetID: "7"},
+		{ID: 2, Action: domain.AuditUserDeleted, TargetType: domain.AuditTargetUser, TargetID: "7"},
+	}}
+	h := NewAuditHandler(store)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/audit/export?target_type=user&target_id=7&actor_id=3&since=2026-01-01T00:00:00Z", nil)
+	h.Export(c)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/jsonl" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if store.filter.TargetID != "7" || store.filter.ActorID == nil || *store.filter.ActorID != 3 || store.filter.Since == nil {
+		t.Errorf("filter = %+v, want the query parameters", store.filter)
+	}
+
+	var ids []int64
+	lines := bufio.NewScanner(w.Body)
+	for lines.Scan() {
+		var e domain.AuditEvent
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+			t.Fatalf("line %q: %v", lines.Text(), err)
+		}
+		ids = append(ids, e.ID)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("exported ids %v, want one line per event in order", ids)
+	}
+
+	// A bad filter is refused before anything is streamed.
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/audit/export?since=yesterday", nil)
+	h.Export(c)
+	if len(c.Errors) == 0 || !errors.Is(c.Errors.Last().Err, pkg.Validation()) || w.Body.Len() != 0 {
+		t.Errorf("bad since: errors = %v body = %q", c.Errors, w.Body)
+	}
+}
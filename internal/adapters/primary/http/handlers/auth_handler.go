@@ -1,60 +1,311 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/reginaldsourn/go-crud/internal/adapters/auth"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/audit"
 	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
 	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
 )
 
 type AuthHandler struct {
-	store     ports.UserStore
-	jwtSecret []byte
-	jwtTTL    time.Duration
+	users    *services.UserService
+	mfa      ports.MFAStore
+	throttle *auth.LoginThrottle
+	issuer   ports.TokenIssuer
+	verifier ports.TokenVerifier
+	sessions ports.SessionStore
+	mfaTTL   time.Duration
+	audit    ports.AuditStore
 }
 
-func NewAuthHandler(store ports.UserStore, secret []byte, ttl time.Duration) *AuthHandler {
+func NewAuthHandler(users *services.UserService, mfa ports.MFAStore, throttle *auth.LoginThrottle, issuer ports.TokenIssuer, verifier ports.TokenVerifier, sessions ports.SessionStore, mfaTTL time.Duration, audit ports.AuditStore) *AuthHandler {
 	return &AuthHandler{
-		store:     store,
-		jwtSecret: secret,
-		jwtTTL:    ttl,
+		users:    users,
+		mfa:      mfa,
+		throttle: throttle,
+		issuer:   issuer,
+		verifier: verifier,
+		sessions: sessions,
+		mfaTTL:   mfaTTL,
+		audit:    audit,
 	}
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req dto.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	u, err := h.store.GetByUsername(c.Request.Context(), req.Username)
+	if !checkThrottle(c, h.throttle, req.Username) {
+		return
+	}
+
+	u, err := h.users.GetByUsername(c.Request.Context(), req.Username)
+	if err != nil {
+		recordFailure(c, h.throttle, req.Username)
+		recordLoginFailure(c, h.audit, domain.User{Username: req.Username}, "unknown user")
+		c.Error(pkg.ErrInvalidCredentials)
+		return
+	}
+	ok, needsRehash, err := h.users.VerifyPassword(u, req.Password)
+	if err != nil || !ok {
+		if err != nil {
+			log.Printf("password verify failed: user_id=%d err=%v", u.ID, err)
+		}
+		recordFailure(c, h.throttle, req.Username)
+		recordLoginFailure(c, h.audit, u, "invalid password")
+		c.Error(pkg.ErrInvalidCredentials)
+		return
+	}
+	if needsRehash {
+		h.rehash(c, u.ID, req.Password)
+	}
+
+	if u.TOTPEnabled {
+		if challenge, ok := mfaChallenge(c, h.issuer, h.mfa, h.mfaTTL, u); ok {
+			c.JSON(http.StatusOK, challenge)
+		}
+		return
+	}
+
+	recordSuccess(c, h.throttle, u.Username)
+
+	if err := reopenIfClosed(c, h.users, u); err != nil {
+		c.Error(pkg.Internal("failed to reopen account"))
+		return
+	}
+
+	token, err := issueAccessToken(c, h.issuer, h.sessions, u)
+	if err != nil {
+		c.Error(pkg.Internal("failed to issue token"))
+		return
+	}
+
+	recordLogin(c, h.audit, u, "password")
+	c.JSON(http.StatusOK, dto.LoginResponse{
+		Token:    token,
+		Username: u.Username,
+	})
+}
+
+// LoginMFA exchanges the challenge token from Login and a TOTP or recovery
+// code for an access token.
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req dto.LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	claims, err := h.verifier.Verify(req.MFAToken)
+	if err != nil || claims.Purpose != sharedauth.PurposeMFA {
+		c.Error(pkg.ErrInvalidMFAToken)
+		return
+	}
+	userID, err := claims.UserID()
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		c.Error(pkg.ErrInvalidMFAToken)
+		return
+	}
+
+	ctx := c.Request.Context()
+	u, err := h.users.Get(ctx, userID)
+	if err != nil || !u.TOTPEnabled {
+		c.Error(pkg.ErrInvalidMFAToken)
 		return
 	}
-	if err := bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	if u.TokensNotBefore != nil && !claims.IssuedAt.After(*u.TokensNotBefore) {
+		c.Error(pkg.ErrInvalidMFAToken)
 		return
 	}
 
-	token, err := auth.GenerateToken(u.Username, h.jwtSecret, h.jwtTTL)
+	if !checkThrottle(c, h.throttle, u.Username) {
+		return
+	}
+	if err := verifySecondFactor(ctx, h.mfa, u, req.Code); err != nil {
+		if errors.Is(err, pkg.ErrInvalidMFACode) {
+			recordFailure(c, h.throttle, u.Username)
+			recordLoginFailure(c, h.audit, u, "invalid second factor")
+		}
+		writeMFAError(c, err)
+		return
+	}
+	recordSuccess(c, h.throttle, u.Username)
+
+	if err := reopenIfClosed(c, h.users, u); err != nil {
+		c.Error(pkg.Internal("failed to reopen account"))
+		return
+	}
+
+	token, err := issueAccessToken(c, h.issuer, h.sessions, u)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue token"})
+		c.Error(pkg.Internal("failed to issue token"))
 		return
 	}
 
+	recordLogin(c, h.audit, u, "password+mfa")
 	c.JSON(http.StatusOK, dto.LoginResponse{
 		Token:    token,
 		Username: u.Username,
 	})
 }
 
+// Logout revokes the session the request was made with. Tokens without a
+// session simply expire.
 func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	if h.sessions != nil && sessionID != "" {
+		err := h.sessions.Revoke(c.Request.Context(), c.GetInt64("user_id"), sessionID)
+		if err != nil && !errors.Is(err, pkg.ErrSessionNotFound) {
+			c.Error(pkg.Internal("failed to revoke session"))
+			return
+		}
+	}
 	c.Status(http.StatusNoContent)
 }
+
+// Unlock clears failed-login counters and any lockout for a user.
+func (h *AuthHandler) Unlock(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.Error(pkg.Invalid("invalid id"))
+		return
+	}
+	if h.throttle == nil {
+		c.Error(pkg.Unavailable("login throttling not configured"))
+		return
+	}
+
+	u, err := h.users.Get(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := h.throttle.Unlock(c.Request.Context(), u.Username); err != nil {
+		c.Error(pkg.Internal("failed to unlock account"))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// rehash replaces a stored hash made with an outdated algorithm or
+// parameters. Failures are logged and do not affect the login.
+func (h *AuthHandler) rehash(c *gin.Context, userID int64, password string) {
+	if err := h.users.Rehash(c.Request.Context(), userID, password); err != nil {
+		log.Printf("password rehash failed: user_id=%d err=%v", userID, err)
+	}
+}
+
+// mfaChallenge issues the token LoginMFA exchanges, together with a code,
+// for an access token. Every way of signing in answers accounts with
+// two-factor authentication with this challenge instead of a token. It
+// writes an error and returns false when no challenge can be issued.
+func mfaChallenge(c *gin.Context, issuer ports.TokenIssuer, mfa ports.MFAStore, ttl time.Duration, u domain.User) (dto.MFAChallengeResponse, bool) {
+	if mfa == nil {
+		// The second factor cannot be checked, and the first alone must not
+		// be enough for an account that asked for two.
+		log.Printf("login refused: user_id=%d has two-factor authentication but no MFA store is configured", u.ID)
+		c.Error(pkg.Unavailable("two-factor authentication is unavailable"))
+		return dto.MFAChallengeResponse{}, false
+	}
+	challenge, _, err := issuer.Issue(sharedauth.TokenRequest{
+		UserID:   u.ID,
+		Username: u.Username,
+		Purpose:  sharedauth.PurposeMFA,
+		TTL:      ttl,
+	})
+	if err != nil {
+		c.Error(pkg.Internal("failed to issue token"))
+		return dto.MFAChallengeResponse{}, false
+	}
+	return dto.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    challenge,
+		ExpiresIn:   int64(ttl.Seconds()),
+	}, true
+}
+
+// recordLogin audits a successful sign-in; method says how the user proved
+// who they are.
+func recordLogin(c *gin.Context, store ports.AuditStore, u domain.User, method string) {
+	actorID := u.ID
+	audit.Record(c, store, domain.AuditEvent{
+		Action:     domain.AuditLoginSucceeded,
+		ActorID:    &actorID,
+		TargetType: domain.AuditTargetUser,
+		TargetID:   strconv.FormatInt(u.ID, 10),
+		Detail:     method,
+	})
+}
+
+// recordLoginFailure audits a failed sign-in. Attempts against unknown
+// accounts are recorded by username.
+func recordLoginFailure(c *gin.Context, store ports.AuditStore, u domain.User, reason string) {
+	event := domain.AuditEvent{
+		Action:     domain.AuditLoginFailed,
+		TargetType: domain.AuditTargetUser,
+		TargetID:   strconv.FormatInt(u.ID, 10),
+		Detail:     reason,
+	}
+	if u.ID == 0 {
+		event.TargetType = domain.AuditTargetUsername
+		event.TargetID = u.Username
+	}
+	audit.Record(c, store, event)
+}
+
+// checkThrottle writes a 429 with Retry-After and returns false when the
+// username or client IP is backing off or locked out.
+func checkThrottle(c *gin.Context, throttle *auth.LoginThrottle, username string) bool {
+	if throttle == nil {
+		return true
+	}
+
+	wait, err := throttle.Check(c.Request.Context(), username, c.ClientIP())
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, pkg.ErrAccountLocked) && !errors.Is(err, pkg.ErrTooManyAttempts) {
+		log.Printf("login throttle check failed: %v", err)
+		return true
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.Error(err)
+	return false
+}
+
+func recordFailure(c *gin.Context, throttle *auth.LoginThrottle, username string) {
+	if throttle == nil {
+		return
+	}
+	if err := throttle.Failure(c.Request.Context(), username, c.ClientIP()); err != nil {
+		log.Printf("login throttle record failed: %v", err)
+	}
+}
+
+func recordSuccess(c *gin.Context, throttle *auth.LoginThrottle, username string) {
+	if throttle == nil {
+		return
+	}
+	if err := throttle.Success(c.Request.Context(), username); err != nil {
+		log.Printf("login throttle reset failed: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+	"github.com/reginaldsourn/go-crud/pkg/password"
+)
+
+type loginUsers struct {
+	ports.UserStore
+	user domain.User
+}
+
+func (s loginUsers) GetByUsername(ctx context.Context, username string) (domain.User, error) {
+	if username != s.user.Username {
+		return domain.User{}, pkg.ErrUserNotFound
+	}
+	return s.user, nil
+}
+
+func TestLoginRefusesTOTPWithoutMFAStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := loginUsers{user: domain.User{ID: 1, Username: "pat", PasswordHash: []byte("hashed:Passw0rd!x"), TOTPEnabled: true}}
+	h := NewAuthHandler(services.NewUserService(users, fakeHasher{}, password.DefaultPolicy(), false), nil, nil, nil, nil, nil, 0, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/login", strings.NewReader(`{"username":"pat","password":"Passw0rd!x"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.Login(c)
+
+	if len(c.Errors) != 1 {
+		t.Fatalf("errors = %v, want one", c.Errors)
+	}
+	var e *pkg.Error
+	if !errors.As(c.Errors.Last().Err, &e) || e.Status != http.StatusServiceUnavailable {
+		t.Fatalf("err = %v, want a 503", c.Errors.Last().Err)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("wrote a response: %s", w.Body)
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/middleware"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const (
+	NDJSONContentType = "application/x-ndjson"
+
+	maxBatchOperations = 1000
+	maxBatchBodyBytes  = 10 << 20
+	maxBatchLineBytes  = 64 << 10
+)
+
+// batchReader yields the operations of a batch one at a time and returns
+// io.EOF after the last one.
+type batchReader[T any] func() (T, error)
+
+// batchApply performs one operation. The returned hook runs once the
+// operation is committed, which for atomic batches is after the whole batch.
+type batchApply[T, S any] func(ctx context.Context, store S, op T) (dto.BatchResult, func(), error)
+
+// invalidOperation marks an operation that could not be decoded. It fails
+// on its own without ending the batch.
+type invalidOperation struct{ err error }
+
+func (e invalidOperation) Error() string { return e.err.Error() }
+
+// openBatch reads a batch from a JSON body or, for application/x-ndjson,
+// streams it one operation per line. Batches are atomic unless the request
+// asks for best_effort.
+func openBatch[T any](c *gin.Context) (string, batchReader[T], error) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBatchBodyBytes)
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+
+	if mediaType == NDJSONContentType {
+		mode := c.DefaultQuery("mode", dto.BatchAtomic)
+
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 4096), maxBatchLineBytes)
+		count := 0
+		return mode, func() (T, error) {
+			var op T
+			for scanner.Scan() {
+				line := bytes.TrimSpace(scanner.Bytes())
+				if len(line) == 0 {
+					continue
+				}
+				if count++; count > maxBatchOperations {
+					return op, pkg.ErrBatchTooLarge
+				}
+				if err := json.Unmarshal(line, &op); err != nil {
+					return op, invalidOperation{err}
+				}
+				return op, nil
+			}
+			if err := scanner.Err(); err != nil {
+				return op, pkg.Invalid("failed to read batch: " + err.Error())
+			}
+			return op, io.EOF
+		}, nil
+	}
+
+	c.Request.Body = body
+	var req dto.BatchRequest[T]
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return "", nil, middleware.ProblemError(err, true)
+	}
+	if len(req.Operations) > maxBatchOperations {
+		return "", nil, pkg.ErrBatchTooLarge
+	}
+	mode := req.Mode
+	if mode == "" {
+		mode = dto.BatchAtomic
+	}
+
+	next := 0
+	return mode, func() (T, error) {
+		if next == len(req.Operations) {
+			var zero T
+			return zero, io.EOF
+		}
+		next++
+		return req.Operations[next-1], nil
+	}, nil
+}
+
+// runBatch applies the operations read from a batch. Atomic batches run in
+// one transaction and stop at the first failure, after which every result
+// reports batch_aborted. Best-effort batches apply what they can. An error
+// is only returned when nothing was applied.
+func runBatch[T, S any](c *gin.Context, mode string, read batchReader[T], store S, transaction func(context.Context, func(S) error) error, apply batchApply[T, S]) (dto.BatchResponse, error) {
+	ctx := c.Request.Context()
+	resp := dto.BatchResponse{Mode: mode, Results: []dto.BatchResult{}}
+	var hooks []func()
+
+	run := func(s S) error {
+		for i := 0; ; i++ {
+			op, err := read()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			var result dto.BatchResult
+			var hook func()
+			var invalid invalidOperation
+			switch {
+			case errors.As(err, &invalid):
+				result = failedBatchResult(i, invalid.err, true)
+			case err != nil:
+				return err
+			default:
+				if err := binding.Validator.ValidateStruct(op); err != nil {
+					result = failedBatchResult(i, err, true)
+				} else if result, hook, err = apply(ctx, s, op); err != nil {
+					kind := result.Op
+					result = failedBatchResult(i, err, false)
+					result.Op = kind
+				}
+			}
+			result.Index = i
+			resp.Results = append(resp.Results, result)
+
+			if result.Error != nil && mode == dto.BatchAtomic {
+				return pkg.ErrBatchAborted
+			}
+			if hook != nil {
+				hooks = append(hooks, hook)
+			}
+			if mode == dto.BatchBestEffort {
+				runHooks(hooks)
+				hooks = nil
+			}
+		}
+	}
+
+	if mode == dto.BatchBestEffort {
+		if err := run(store); err != nil {
+			if len(resp.Results) == 0 {
+				return resp, err
+			}
+			// Earlier operations have been applied, so report the
+			// failure alongside them rather than as the response.
+			resp.Results = append(resp.Results, failedBatchResult(len(resp.Results), err, false))
+		}
+		resp.Committed = true
+		return resp, nil
+	}
+
+	err := transaction(ctx, run)
+	if errors.Is(err, pkg.ErrBatchAborted) {
+		for i := range resp.Results {
+			if resp.Results[i].Error == nil {
+				resp.Results[i].Status = pkg.ErrBatchAborted.Status
+				resp.Results[i].Resource = nil
+				resp.Results[i].Error = dto.ToBatchError(pkg.ErrBatchAborted)
+			}
+		}
+		return resp, nil
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	runHooks(hooks)
+	resp.Committed = true
+	return resp, nil
+}
+
+func runHooks(hooks []func()) {
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+func failedBatchResult(index int, err error, bind bool) dto.BatchResult {
+	e := middleware.ProblemError(err, bind)
+	if e.Code == pkg.CodeInternal {
+		log.Printf("batch operation %d failed: %v", index, err)
+	}
+	return dto.BatchResult{Index: index, Status: e.Status, Error: dto.ToBatchError(e)}
+}
+
+// writeBatch answers 200 when every operation succeeded and 207 otherwise.
+func writeBatch(c *gin.Context, resp dto.BatchResponse) {
+	status := http.StatusOK
+	for _, result := range resp.Results {
+		if result.Error != nil {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+	c.JSON(status, resp)
+}
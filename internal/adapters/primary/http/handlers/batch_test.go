@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/middleware"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type nameOperation struct {
+	Op   string `json:"op" binding:"required,oneof=create delete"`
+	Name string `json:"name"`
+}
+
+// nameSet is the store the test batches edit. Transactions work on a copy
+// and only keep it when the whole function succeeds.
+type nameSet struct {
+	names map[string]bool
+}
+
+func (s *nameSet) transaction(ctx context.Context, fn func(*nameSet) error) error {
+	staged := &nameSet{names: maps.Clone(s.names)}
+	if err := fn(staged); err != nil {
+		return err
+	}
+	s.names = staged.names
+	return nil
+}
+
+func (s *nameSet) sorted() []string {
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	errNameTaken   = pkg.New("name_taken", http.StatusConflict, "name is taken")
+	errNameMissing = pkg.New("name_not_found", http.StatusNotFound, "name not found")
+)
+
+// batchRouter serves POST /names as a batch endpoint over store and records
+// the names whose after-commit hooks ran.
+func batchRouter(store *nameSet) (*gin.Engine, *[]string) {
+	gin.SetMode(gin.TestMode)
+	var hooks []string
+	apply := func(ctx context.Context, s *nameSet, op nameOperation) (dto.BatchResult, func(), error) {
+		result := dto.BatchResult{Op: op.Op}
+		switch op.Op {
+		case dto.BatchCreate:
+			if s.names[op.Name] {
+				return result, nil, errNameTaken
+			}
+			s.names[op.Name] = true
+			result.Status, result.Resource = http.StatusCreated, op.Name
+		default:
+			if !s.names[op.Name] {
+				return result, nil, errNameMissing
+			}
+			delete(s.names, op.Name)
+			result.Status = http.StatusNoContent
+		}
+		return result, func() { hooks = append(hooks, op.Op+" "+op.Name) }, nil
+	}
+
+	r := gin.New()
+	r.Use(middleware.Problems())
+	r.POST("/names", func(c *gin.Context) {
+		mode, read, err := openBatch[nameOperation](c)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		resp, err := runBatch(c, mode, read, store, store.transaction, apply)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		writeBatch(c, resp)
+	})
+	return r, &hooks
+}
+
+// resultSummary is "status code" for each result, code empty on success.
+func resultSummary(results []dto.BatchResult) []string {
+	summary := make([]string, len(results))
+	for i, r := range results {
+		code := ""
+		if r.Error != nil {
+			code = r.Error.Code
+		}
+		summary[i] = strings.TrimSpace(http.StatusText(r.Status) + " " + code)
+	}
+	return summary
+}
+
+func TestBatch(t *testing.T) {
+	ndjson := func(lines ...string) string { return strings.Join(lines, "\n") }
+	creates := func(n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, `{"op":"create","name":"n%04d"}`+"\n", i)
+		}
+		return b.String()
+	}
+	createdNames := func(n int) []string {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf("n%04d", i)
+		}
+		return names
+	}
+	hookNames := func(n int) []string {
+		names := createdNames(n)
+		for i := range names {
+			names[i] = "create " + names[i]
+		}
+		return names
+	}
+	repeat := func(s string, n int) []string {
+		list := make([]string, n)
+		for i := range list {
+			list[i] = s
+		}
+		return list
+	}
+
+	tests := []struct {
+		name          string
+		contentType   string
+		query         string
+		body          string
+		wantStatus    int
+		wantCode      string // problem code when the batch itself fails
+		wantCommitted bool
+		wantResults   []string
+		wantNames     []string
+		wantHooks     []string
+	}{
+		{
+			name:          "atomic",
+			body:          `{"operations":[{"op":"create","name":"b"},{"op":"delete","name":"a"}]}`,
+			wantStatus:    http.StatusOK,
+			wantCommitted: true,
+			wantResults:   []string{"Created", "No Content"},
+			wantNames:     []string{"b"},
+			wantHooks:     []string{"create b", "delete a"},
+		},
+		{
+			name:        "atomic rolls back on failure",
+			body:        `{"operations":[{"op":"create","name":"b"},{"op":"create","name":"a"},{"op":"create","name":"c"}]}`,
+			wantStatus:  http.StatusMultiStatus,
+			wantResults: []string{"Failed Dependency batch_aborted", "Conflict name_taken"},
+			wantNames:   []string{"a"},
+		},
+		{
+			name:        "atomic stops at an invalid operation",
+			body:        `{"operations":[{"op":"create","name":"b"},{"op":"rename","name":"a"}]}`,
+			wantStatus:  http.StatusMultiStatus,
+			wantResults: []string{"Failed Dependency batch_aborted", "Bad Request validation_failed"},
+			wantNames:   []string{"a"},
+		},
+		{
+			name:          "best effort keeps going",
+			body:          `{"mode":"best_effort","operations":[{"op":"create","name":"b"},{"op":"create","name":"a"},{"op":"delete","name":"x"},{"op":"create","name":"c"}]}`,
+			wantStatus:    http.StatusMultiStatus,
+			wantCommitted: true,
+			wantResults:   []string{"Created", "Conflict name_taken", "Not Found name_not_found", "Created"},
+			wantNames:     []string{"a", "b", "c"},
+			wantHooks:     []string{"create b", "create c"},
+		},
+		{
+			name:          "empty batch",
+			body:          `{"operations":[]}`,
+			wantStatus:    http.StatusOK,
+			wantCommitted: true,
+			wantResults:   []string{},
+			wantNames:     []string{"a"},
+		},
+		{
+			name:          "ndjson",
+			contentType:   NDJSONContentType,
+			body:          ndjson(`{"op":"create","name":"b"}`, ``, `  `, `{"op":"create","name":"c"}`, ``),
+			wantStatus:    http.StatusOK,
+			wantCommitted: true,
+			wantResults:   []string{"Created", "Created"},
+			wantNames:     []string{"a", "b", "c"},
+			wantHooks:     []string{"create b", "create c"},
+		},
+		{
+			name:        "ndjson malformed line aborts an atomic batch",
+			contentType: NDJSONContentType,
+			body:        ndjson(`{"op":"create","name":"b"}`, `{"op":`, `{"op":"create","name":"c"}`),
+			wantStatus:  http.StatusMultiStatus,
+			wantResults: []string{"Failed Dependency batch_aborted", "Bad Request invalid_request"},
+			wantNames:   []string{"a"},
+		},
+		{
+			name:          "ndjson best effort from the query",
+			contentType:   NDJSONContentType + "; charset=utf-8",
+			query:         "?mode=best_effort",
+			body:          ndjson(`{"op":"create","name":"b"}`, `{"op":`, `{"op":"create","name":"c"}`),
+			wantStatus:    http.StatusMultiStatus,
+			wantCommitted: true,
+			wantResults:   []string{"Created", "Bad Request invalid_request", "Created"},
+			wantNames:     []string{"a", "b", "c"},
+			wantHooks:     []string{"create b", "create c"},
+		},
+		{
+			name:          "ndjson read error after applied operations",
+			contentType:   NDJSONContentType,
+			query:         "?mode=best_effort",
+			body:          ndjson(`{"op":"create","name":"b"}`, `{"op":"create","name":"`+strings.Repeat("x", maxBatchLineBytes)+`"}`),
+			wantStatus:    http.StatusMultiStatus,
+			wantCommitted: true,
+			wantResults:   []string{"Created", "Bad Request invalid_request"},
+			wantNames:     []string{"a", "b"},
+			wantHooks:     []string{"create b"},
+		},
+		{
+			name:        "ndjson too many operations",
+			contentType: NDJSONContentType,
+			body:        creates(maxBatchOperations + 1),
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    "batch_too_large",
+			wantNames:   []string{"a"},
+		},
+		{
+			name:          "ndjson too many operations in best effort",
+			contentType:   NDJSONContentType,
+			query:         "?mode=best_effort",
+			body:          creates(maxBatchOperations+1) + `{"op":"delete","name":"a"}`,
+			wantStatus:    http.StatusMultiStatus,
+			wantCommitted: true,
+			wantResults:   append(repeat("Created", maxBatchOperations), "Request Entity Too Large batch_too_large"),
+			wantNames:     append([]string{"a"}, createdNames(maxBatchOperations)...),
+			wantHooks:     hookNames(maxBatchOperations),
+		},
+		{
+			name:       "json too many operations",
+			body:       `{"operations":[` + strings.TrimSuffix(strings.Repeat(`{"op":"delete","name":"x"},`, maxBatchOperations+1), ",") + `]}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   "batch_too_large",
+			wantNames:  []string{"a"},
+		},
+		{
+			name:       "unknown mode",
+			body:       `{"mode":"sometimes","operations":[]}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "validation_failed",
+			wantNames:  []string{"a"},
+		},
+		{
+			name:       "missing operations",
+			body:       `{"mode":"atomic"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "validation_failed",
+			wantNames:  []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &nameSet{names: map[string]bool{"a": true}}
+			r, hooks := batchRouter(store)
+
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			req := httptest.NewRequest(http.MethodPost, "/names"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := store.sorted(); !reflect.DeepEqual(got, tt.wantNames) {
+				t.Errorf("names = %v, want %v", got, tt.wantNames)
+			}
+			if !reflect.DeepEqual(*hooks, tt.wantHooks) {
+				t.Errorf("hooks = %v, want %v", *hooks, tt.wantHooks)
+			}
+
+			if tt.wantCode != "" {
+				var problem struct{ Code string }
+				if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || problem.Code != tt.wantCode {
+					t.Errorf("problem code = %q (%v), want %q", problem.Code, err, tt.wantCode)
+				}
+				return
+			}
+
+			var resp dto.BatchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v: %s", err, w.Body)
+			}
+			if resp.Committed != tt.wantCommitted {
+				t.Errorf("committed = %v, want %v", resp.Committed, tt.wantCommitted)
+			}
+			for i, result := range resp.Results {
+				if result.Index != i {
+					t.Errorf("result %d has index %d", i, result.Index)
+				}
+			}
+			if tt.wantResults != nil {
+				if got := resultSummary(resp.Results); !reflect.DeepEqual(got, tt.wantResults) {
+					t.Errorf("results = %q, want %q", got, tt.wantResults)
+				}
+			}
+			for _, result := range resp.Results {
+				if result.Error != nil && result.Resource != nil {
+					t.Errorf("failed result %d carries a resource", result.Index)
+				}
+			}
+		})
+	}
+}
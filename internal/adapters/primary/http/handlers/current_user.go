@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// currentUser loads the account behind the authenticated request. It writes
+// an error response and returns false when the account cannot be loaded.
+func currentUser(c *gin.Context, users *services.UserService) (domain.User, bool) {
+	userID := c.GetInt64("user_id")
+	if userID == 0 {
+		c.Error(pkg.Unauthorized("unauthorized"))
+		return domain.User{}, false
+	}
+
+	u, err := users.Get(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(pkg.Unauthorized("unauthorized"))
+		return domain.User{}, false
+	}
+
+	return u, true
+}
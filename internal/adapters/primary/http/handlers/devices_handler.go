@@ -1,61 +1,68 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/audit"
 	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/etag"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/middleware"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/pagination"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/patch"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
 	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
 	pkg "github.com/reginaldsourn/go-crud/pkg/error"
 )
 
 type DevicesHandler struct {
-	store ports.DeviceStore
+	devices *services.DeviceService
+	audit   ports.AuditStore
 }
 
-func NewDevicesHandler(store ports.DeviceStore) *DevicesHandler {
-	return &DevicesHandler{store: store}
+func NewDevicesHandler(devices *services.DeviceService, audit ports.AuditStore) *DevicesHandler {
+	return &DevicesHandler{devices: devices, audit: audit}
 }
 
 func (h *DevicesHandler) Create(c *gin.Context) {
 	var req dto.CreateDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if req.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
-		return
-	}
-	if req.TypeID <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "type_id is required"})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	device, err := h.store.Create(c.Request.Context(), req.Name, req.TypeID)
+	device, err := h.devices.Create(c.Request.Context(), req.Name, req.TypeID)
 	if err != nil {
-		status := http.StatusBadRequest
-		if err == pkg.ErrDuplicateDevice {
-			status = http.StatusConflict
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	h.record(c, domain.AuditDeviceCreated, device.ID, nil, device)
+	etag.Set(c, device.Version)
 	c.JSON(http.StatusCreated, dto.ToDeviceResponse(device))
 }
 
 func (h *DevicesHandler) Get(c *gin.Context) {
 	id, err := parseIDParam(c, "id")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		c.Error(pkg.Invalid("invalid id"))
 		return
 	}
 
-	device, err := h.store.GetByID(c.Request.Context(), id)
+	device, err := h.devices.Get(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	if etag.NotModified(c, device.Version) {
 		return
 	}
 
@@ -63,81 +70,330 @@ func (h *DevicesHandler) Get(c *gin.Context) {
 }
 
 func (h *DevicesHandler) List(c *gin.Context) {
-	devices, err := h.store.List(c.Request.Context())
+	opts, err := pagination.Parse(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	resp := make([]dto.DeviceResponse, 0, len(devices))
-	for _, device := range devices {
-		resp = append(resp, dto.ToDeviceResponse(device))
+	page, err := h.devices.List(c.Request.Context(), opts)
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
-	c.JSON(http.StatusOK, resp)
+	c.JSON(http.StatusOK, dto.ToListResponse(page, dto.ToDeviceResponse))
 }
 
 func (h *DevicesHandler) Update(c *gin.Context) {
 	id, err := parseIDParam(c, "id")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		c.Error(pkg.Invalid("invalid id"))
 		return
 	}
 
 	var req dto.UpdateDeviceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
-	if req.Name == nil && req.TypeID == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+
+	before, device, err := h.devices.Update(c.Request.Context(), id, services.DeviceUpdate{
+		Name:   req.Name,
+		TypeID: req.TypeID,
+		Match:  ifMatch(c),
+	})
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	name := ""
-	if req.Name != nil {
-		if *req.Name == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
-			return
-		}
-		name = *req.Name
-	}
+	h.record(c, domain.AuditDeviceUpdated, device.ID, before, device)
+	etag.Set(c, device.Version)
+	c.JSON(http.StatusOK, dto.ToDeviceResponse(device))
+}
 
-	typeID := int64(0)
-	if req.TypeID != nil {
-		if *req.TypeID <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "type_id is required"})
-			return
-		}
-		typeID = *req.TypeID
+// Patch applies a merge patch or JSON patch to the device. The patched
+// representation is validated before anything is written.
+func (h *DevicesHandler) Patch(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.Error(pkg.Invalid("invalid id"))
+		return
 	}
 
-	device, err := h.store.Update(c.Request.Context(), id, name, typeID)
+	before, err := h.devices.Get(c.Request.Context(), id)
 	if err != nil {
-		status := http.StatusBadRequest
-		if err == pkg.ErrDeviceNotFound {
-			status = http.StatusNotFound
-		} else if err == pkg.ErrDuplicateDevice {
-			status = http.StatusConflict
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	if !etag.Matches(c, before.Version) {
+		c.Error(pkg.ErrVersionMismatch)
 		return
 	}
 
+	var req dto.DevicePatch
+	if err := patch.Apply(c, dto.ToDeviceResponse(before), &req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	device := before
+	if req.Name != before.Name || req.TypeID != before.TypeID {
+		_, device, err = h.devices.Update(c.Request.Context(), id, services.DeviceUpdate{
+			Name:   &req.Name,
+			TypeID: &req.TypeID,
+			Match:  atVersion(before.Version),
+		})
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		h.record(c, domain.AuditDeviceUpdated, device.ID, before, device)
+	}
+
+	etag.Set(c, device.Version)
 	c.JSON(http.StatusOK, dto.ToDeviceResponse(device))
 }
 
 func (h *DevicesHandler) Delete(c *gin.Context) {
 	id, err := parseIDParam(c, "id")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		c.Error(pkg.Invalid("invalid id"))
 		return
 	}
 
-	if err := h.store.Delete(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	before, err := h.devices.Delete(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
+	h.record(c, domain.AuditDeviceDeleted, id, before, nil)
 	c.Status(http.StatusNoContent)
 }
+
+func (h *DevicesHandler) ListDeleted(c *gin.Context) {
+	devices, err := h.devices.ListDeleted(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp := make([]dto.DeviceResponse, 0, len(devices))
+	for _, device := range devices {
+		resp = append(resp, dto.ToDeviceResponse(device))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *DevicesHandler) Restore(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.Error(pkg.Invalid("invalid id"))
+		return
+	}
+
+	device, err := h.devices.Restore(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.record(c, domain.AuditDeviceRestored, device.ID, nil, nil)
+	etag.Set(c, device.Version)
+	c.JSON(http.StatusOK, dto.ToDeviceResponse(device))
+}
+
+// Batch creates, updates and deletes devices in one request. See runBatch
+// for how atomic and best-effort batches differ.
+func (h *DevicesHandler) Batch(c *gin.Context) {
+	mode, read, err := openBatch[dto.DeviceBatchOperation](c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp, err := runBatch(c, mode, read, h.devices, h.devices.Transaction, func(ctx context.Context, devices *services.DeviceService, op dto.DeviceBatchOperation) (dto.BatchResult, func(), error) {
+		return h.applyBatch(c, ctx, devices, op)
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	writeBatch(c, resp)
+}
+
+func (h *DevicesHandler) applyBatch(c *gin.Context, ctx context.Context, devices *services.DeviceService, op dto.DeviceBatchOperation) (dto.BatchResult, func(), error) {
+	result := dto.BatchResult{Op: op.Op}
+
+	switch op.Op {
+	case dto.BatchCreate:
+		if op.Name == "" {
+			return result, nil, pkg.InvalidField("name", "required", "name is required")
+		}
+		if op.TypeID <= 0 {
+			return result, nil, pkg.InvalidField("type_id", "required", "type_id is required")
+		}
+		device, err := devices.Create(ctx, op.Name, op.TypeID)
+		if err != nil {
+			return result, nil, err
+		}
+		result.Status, result.Resource = http.StatusCreated, dto.ToDeviceResponse(device)
+		return result, func() { h.record(c, domain.AuditDeviceCreated, device.ID, nil, device) }, nil
+
+	case dto.BatchUpdate:
+		if op.ID <= 0 {
+			return result, nil, pkg.InvalidField("id", "required", "id is required")
+		}
+		if op.TypeID < 0 {
+			return result, nil, pkg.InvalidField("type_id", "gt", "type_id must be positive")
+		}
+		before, device, err := devices.Update(ctx, op.ID, services.DeviceUpdate{
+			Name:   nonEmpty(op.Name),
+			TypeID: nonEmpty(op.TypeID),
+			Match:  atVersion(op.Version),
+		})
+		if err != nil {
+			return result, nil, err
+		}
+		result.Status, result.Resource = http.StatusOK, dto.ToDeviceResponse(device)
+		return result, func() { h.record(c, domain.AuditDeviceUpdated, device.ID, before, device) }, nil
+
+	default:
+		if op.ID <= 0 {
+			return result, nil, pkg.InvalidField("id", "required", "id is required")
+		}
+		before, err := devices.Delete(ctx, op.ID)
+		if err != nil {
+			return result, nil, err
+		}
+		result.Status = http.StatusNoContent
+		return result, func() { h.record(c, domain.AuditDeviceDeleted, op.ID, before, nil) }, nil
+	}
+}
+
+var deviceExportColumns = []exportColumn[domain.Device]{
+	{"id", func(d domain.Device) string { return strconv.FormatInt(d.ID, 10) }},
+	{"name", func(d domain.Device) string { return d.Name }},
+	{"type_id", func(d domain.Device) string { return strconv.FormatInt(d.TypeID, 10) }},
+	{"version", func(d domain.Device) string { return strconv.FormatInt(d.Version, 10) }},
+	{"created_at", func(d domain.Device) string { return d.CreatedAt.Format(time.RFC3339) }},
+	{"updated_at", func(d domain.Device) string { return d.UpdatedAt.Format(time.RFC3339) }},
+}
+
+// Export streams every device as CSV or NDJSON.
+func (h *DevicesHandler) Export(c *gin.Context) {
+	writeExport(c, "devices", deviceExportColumns, func(d domain.Device) any { return dto.ToDeviceResponse(d) }, h.devices.Each)
+}
+
+// errDryRun rolls back an import that was only checked.
+var errDryRun = errors.New("dry run")
+
+// Import upserts devices by name from CSV or NDJSON. Every row is checked
+// and the import is applied in one transaction only if all of them pass;
+// otherwise the response lists the failing rows by line. With dry_run=true
+// the import is checked and rolled back.
+func (h *DevicesHandler) Import(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.Error(pkg.InvalidField("dry_run", "boolean", "dry_run must be true or false"))
+		return
+	}
+
+	read, err := openImport(c, deviceImportRowFromCSV)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	report := dto.ImportReport{DryRun: dryRun}
+	err = h.devices.Transaction(c.Request.Context(), func(devices *services.DeviceService) error {
+		var rowErrs importErrors
+		seen := map[string]int{}
+		for {
+			line, row, err := read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			var rowErr importRowError
+			if errors.As(err, &rowErr) {
+				report.Rows++
+				rowErrs.add(rowErr)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			report.Rows++
+			if first, ok := seen[row.Name]; ok {
+				rowErrs.add(lineError(line, pkg.InvalidField("name", "unique", fmt.Sprintf("name already appears on line %d", first))))
+				continue
+			}
+			seen[row.Name] = line
+			if !rowErrs.empty() {
+				// Keep checking the remaining rows, but the import
+				// will not be applied.
+				continue
+			}
+			outcome, err := devices.Upsert(c.Request.Context(), row.Name, row.TypeID)
+			if err != nil {
+				rowErrs.add(lineError(line, middleware.ProblemError(err, false)))
+				continue
+			}
+			switch outcome {
+			case services.Created:
+				report.Created++
+			case services.Updated:
+				report.Updated++
+			default:
+				report.Unchanged++
+			}
+		}
+
+		if !rowErrs.empty() {
+			return rowErrs.err()
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		c.Error(err)
+		return
+	}
+
+	report.Committed = !dryRun
+	if report.Committed && report.Created+report.Updated > 0 {
+		audit.Record(c, h.audit, domain.AuditEvent{
+			Action:     domain.AuditDevicesImported,
+			TargetType: domain.AuditTargetDevice,
+			Detail:     fmt.Sprintf("created %d, updated %d", report.Created, report.Updated),
+		})
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func deviceImportRowFromCSV(record map[string]string) (dto.DeviceImportRow, []pkg.FieldError) {
+	row := dto.DeviceImportRow{Name: record["name"]}
+	if raw := record["type_id"]; raw != "" {
+		typeID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return row, []pkg.FieldError{{Field: "type_id", Code: "type", Message: "type_id must be a number"}}
+		}
+		row.TypeID = typeID
+	}
+	return row, nil
+}
+
+func (h *DevicesHandler) record(c *gin.Context, action string, deviceID int64, before, after any) {
+	audit.Record(c, h.audit, domain.AuditEvent{
+		Action:     action,
+		TargetType: domain.AuditTargetDevice,
+		TargetID:   strconv.FormatInt(deviceID, 10),
+		Changes:    domain.DiffFields(before, after),
+	})
+}
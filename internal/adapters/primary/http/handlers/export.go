@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CSVContentType = "text/csv"
+
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+
+	// exportFlushEvery is how many rows are written between flushes.
+	exportFlushEvery = 100
+)
+
+type exportColumn[T any] struct {
+	name  string
+	value func(T) string
+}
+
+// writeExport streams every row from each as CSV or NDJSON, chosen by the
+// format query parameter. Rows are written as they are loaded, so nothing
+// beyond one chunk of rows is held in memory. A failure after the first row
+// can only cut the response short.
+func writeExport[T any](c *gin.Context, name string, columns []exportColumn[T], toJSON func(T) any, each func(context.Context, func(T) error) error) {
+	format := c.DefaultQuery("format", exportFormatCSV)
+
+	contentType := CSVContentType + "; charset=utf-8"
+	if format == exportFormatNDJSON {
+		contentType = NDJSONContentType
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+name+"."+format+`"`)
+	c.Status(http.StatusOK)
+
+	var write func(T) error
+	var flush func() error
+	if format == exportFormatCSV {
+		w := csv.NewWriter(c.Writer)
+		header := make([]string, len(columns))
+		for i, col := range columns {
+			header[i] = col.name
+		}
+		if err := w.Write(header); err != nil {
+			c.Error(err)
+			return
+		}
+		record := make([]string, len(columns))
+		write = func(row T) error {
+			for i, col := range columns {
+				record[i] = col.value(row)
+			}
+			return w.Write(record)
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+	} else {
+		enc := json.NewEncoder(c.Writer)
+		write = func(row T) error { return enc.Encode(toJSON(row)) }
+		flush = func() error { return nil }
+	}
+
+	rows := 0
+	err := each(c.Request.Context(), func(row T) error {
+		if err := write(row); err != nil {
+			return err
+		}
+		if rows++; rows%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		log.Printf("%s export failed after %d rows: %v request_id=%s", name, rows, err, c.GetString("request_id"))
+		c.Error(err)
+	}
+}
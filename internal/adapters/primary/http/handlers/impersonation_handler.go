@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/audit"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const maxImpersonationReasonLength = 255
+
+// ImpersonationHandler lets admins act as another user for support.
+type ImpersonationHandler struct {
+	users  *services.UserService
+	issuer ports.TokenIssuer
+	audit  ports.AuditStore
+	ttl    time.Duration
+}
+
+func NewImpersonationHandler(users *services.UserService, issuer ports.TokenIssuer, audit ports.AuditStore, ttl time.Duration) *ImpersonationHandler {
+	return &ImpersonationHandler{users: users, issuer: issuer, audit: audit, ttl: ttl}
+}
+
+// Start issues a short-lived token for the target user that carries the
+// admin in its act claim. The token is not tied to a session, so it does not
+// show up in the user's session list; it expires on its own or when the
+// admin's tokens are revoked.
+func (h *ImpersonationHandler) Start(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.Error(pkg.Invalid("invalid id"))
+		return
+	}
+
+	var req dto.ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" || len(reason) > maxImpersonationReasonLength {
+		c.Error(pkg.InvalidField("reason", "len", "reason must be between 1 and 255 characters"))
+		return
+	}
+
+	admin, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if id == admin.ID {
+		c.Error(pkg.Invalid("cannot impersonate yourself"))
+		return
+	}
+
+	target, err := h.users.Get(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, pkg.ErrUserNotFound) {
+			c.Error(err)
+			return
+		}
+		c.Error(pkg.Internal("failed to load user"))
+		return
+	}
+	// Acting as another admin would hand out that admin's privileges under
+	// someone else's name.
+	if target.Role == domain.RoleAdmin {
+		c.Error(pkg.Forbidden("cannot impersonate an admin"))
+		return
+	}
+
+	token, claims, err := h.issuer.Issue(sharedauth.TokenRequest{
+		UserID:        target.ID,
+		Username:      target.Username,
+		TTL:           h.ttl,
+		ActorID:       admin.ID,
+		ActorUsername: admin.Username,
+	})
+	if err != nil {
+		c.Error(pkg.Internal("failed to issue token"))
+		return
+	}
+
+	// Impersonation must never go unrecorded, so the token is withheld if
+	// the audit write fails.
+	err = audit.Record(c, h.audit, domain.AuditEvent{
+		Action:     domain.AuditImpersonationStarted,
+		TargetType: domain.AuditTargetUser,
+		TargetID:   strconv.FormatInt(target.ID, 10),
+		Detail:     reason,
+	})
+	if err != nil {
+		c.Error(pkg.Internal("failed to record impersonation"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.ImpersonateResponse{
+		Token:     token,
+		ExpiresAt: claims.ExpiresAt.Time,
+		UserID:    target.ID,
+		Username:  target.Username,
+	})
+}
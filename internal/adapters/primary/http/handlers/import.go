@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/middleware"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const (
+	maxImportBytes  = 50 << 20
+	maxImportErrors = 1000
+)
+
+// importReader yields the rows of an import with the line each one starts
+// on, and returns io.EOF after the last. Invalid rows are reported as
+// importRowError; any other error ends the import.
+type importReader[T any] func() (line int, row T, err error)
+
+// importRowError rejects one row. Its fields carry the row's line.
+type importRowError struct{ err *pkg.Error }
+
+func (e importRowError) Error() string { return e.err.Error() }
+
+// openImport reads rows from a CSV body with a header line, or from NDJSON.
+// CSV columns are matched to T by their JSON names and columns T does not
+// know are ignored, so an export can be imported back unchanged. fromCSV
+// builds a row from the named columns of one record.
+func openImport[T any](c *gin.Context, fromCSV func(record map[string]string) (T, []pkg.FieldError)) (importReader[T], error) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+
+	switch mediaType {
+	case NDJSONContentType:
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 4096), maxBatchLineBytes)
+		line := 0
+		return func() (int, T, error) {
+			var row T
+			for scanner.Scan() {
+				line++
+				raw := bytes.TrimSpace(scanner.Bytes())
+				if len(raw) == 0 {
+					continue
+				}
+				if err := json.Unmarshal(raw, &row); err != nil {
+					return line, row, lineError(line, middleware.ProblemError(err, true))
+				}
+				return line, row, validateImportRow(line, row)
+			}
+			if err := scanner.Err(); err != nil {
+				return line, row, pkg.Invalid("failed to read import: " + err.Error())
+			}
+			return line, row, io.EOF
+		}, nil
+
+	case CSVContentType:
+		r := csv.NewReader(body)
+		r.ReuseRecord = true
+		header, err := r.Read()
+		if err != nil {
+			return nil, pkg.Invalid("import must start with a header line")
+		}
+		header = append([]string(nil), header...)
+		for i := range header {
+			header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+		}
+		r.FieldsPerRecord = len(header)
+
+		return func() (int, T, error) {
+			var row T
+			record, err := r.Read()
+			line, _ := r.FieldPos(0)
+			if errors.Is(err, io.EOF) {
+				return line, row, io.EOF
+			}
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return parseErr.Line, row, lineError(parseErr.Line, pkg.Invalid(parseErr.Err.Error()))
+			}
+			if err != nil {
+				return line, row, pkg.Invalid("failed to read import: " + err.Error())
+			}
+
+			named := make(map[string]string, len(header))
+			for i, name := range header {
+				named[name] = strings.TrimSpace(record[i])
+			}
+			row, fields := fromCSV(named)
+			if len(fields) > 0 {
+				return line, row, lineError(line, pkg.Validation(fields...))
+			}
+			return line, row, validateImportRow(line, row)
+		}, nil
+
+	default:
+		return nil, pkg.ErrUnsupportedImport
+	}
+}
+
+func validateImportRow(line int, row any) error {
+	if err := binding.Validator.ValidateStruct(row); err != nil {
+		return lineError(line, middleware.ProblemError(err, true))
+	}
+	return nil
+}
+
+// lineError tags every field of e with line. Errors without fields are
+// reported against the whole row.
+func lineError(line int, e *pkg.Error) importRowError {
+	fields := append([]pkg.FieldError(nil), e.Fields...)
+	if len(fields) == 0 {
+		fields = []pkg.FieldError{{Field: "row", Code: e.Code, Message: e.Message}}
+	}
+	for i := range fields {
+		fields[i].Line = line
+	}
+	return importRowError{e.WithFields(fields...)}
+}
+
+// importErrors collects row errors up to maxImportErrors.
+type importErrors struct {
+	fields  []pkg.FieldError
+	dropped int
+}
+
+func (e *importErrors) add(err importRowError) {
+	for _, field := range err.err.Fields {
+		if len(e.fields) == maxImportErrors {
+			e.dropped++
+			continue
+		}
+		e.fields = append(e.fields, field)
+	}
+}
+
+func (e *importErrors) empty() bool {
+	return len(e.fields) == 0
+}
+
+func (e *importErrors) err() error {
+	err := pkg.ErrInvalidImport
+	if e.dropped > 0 {
+		err = err.WithMessage(err.Message + "; further errors were omitted")
+	}
+	return err.WithFields(e.fields...)
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/middleware"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// memoryDevices keeps devices by name. Transactions work on a copy that is
+// kept only when the function succeeds. Creating a device named "boom"
+// fails.
+type memoryDevices struct {
+	ports.DeviceStore
+	byName map[string]domain.Device
+	nextID int64
+}
+
+func (s *memoryDevices) GetByName(ctx context.Context, name string) (domain.Device, error) {
+	d, ok := s.byName[name]
+	if !ok {
+		return domain.Device{}, pkg.ErrDeviceNotFound
+	}
+	return d, nil
+}
+
+func (s *memoryDevices) Create(ctx context.Context, name string, typeID int64) (domain.Device, error) {
+	if name == "boom" {
+		return domain.Device{}, errors.New("database is down")
+	}
+	s.nextID++
+	d := domain.Device{ID: s.nextID, Name: name, TypeID: typeID, Version: 1}
+	s.byName[name] = d
+	return d, nil
+}
+
+func (s *memoryDevices) Update(ctx context.Context, id int64, name string, typeID int64, version int64) (domain.Device, error) {
+	for key, d := range s.byName {
+		if d.ID == id {
+			d.TypeID, d.Version = typeID, d.Version+1
+			s.byName[key] = d
+			return d, nil
+		}
+	}
+	return domain.Device{}, pkg.ErrDeviceNotFound
+}
+
+func (s *memoryDevices) Transaction(ctx context.Context, fn func(ports.DeviceStore) error) error {
+	staged := &memoryDevices{byName: maps.Clone(s.byName), nextID: s.nextID}
+	if err := fn(staged); err != nil {
+		return err
+	}
+	s.byName, s.nextID = staged.byName, staged.nextID
+	return nil
+}
+
+func (s *memoryDevices) types() map[string]int64 {
+	types := map[string]int64{}
+	for name, d := range s.byName {
+		types[name] = d.TypeID
+	}
+	return types
+}
+
+type memoryAudit struct {
+	ports.AuditStore
+	events []domain.AuditEvent
+}
+
+func (s *memoryAudit) Append(ctx context.Context, event *domain.AuditEvent) error {
+	s.events = append(s.events, *event)
+	return nil
+}
+
+func TestDeviceImport(t *testing.T) {
+	type fieldAt struct {
+		Line  int
+		Field string
+		Code  string
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		query       string
+		body        string
+		wantStatus  int
+		wantReport  dto.ImportReport
+		wantCode    string
+		wantFields  []fieldAt
+		wantTypes   map[string]int64
+		wantAudited bool
+	}{
+		{
+			name:        "csv",
+			contentType: CSVContentType,
+			body:        "\ufeffid, name ,type_id\n9,fan,2\n,lamp,3\n",
+			wantStatus:  http.StatusOK,
+			wantReport:  dto.ImportReport{Committed: true, Rows: 2, Created: 1, Updated: 1},
+			wantTypes:   map[string]int64{"lamp": 3, "fan": 2},
+			wantAudited: true,
+		},
+		{
+			name:        "ndjson",
+			contentType: NDJSONContentType,
+			body:        `{"name":"lamp","type_id":1}` + "\n\n" + `{"name":"fan","type_id":2}`,
+			wantStatus:  http.StatusOK,
+			wantReport:  dto.ImportReport{Committed: true, Rows: 2, Created: 1, Unchanged: 1},
+			wantTypes:   map[string]int64{"lamp": 1, "fan": 2},
+			wantAudited: true,
+		},
+		{
+			name:        "nothing changed",
+			contentType: NDJSONContentType,
+			body:        `{"name":"lamp","type_id":1}`,
+			wantStatus:  http.StatusOK,
+			wantReport:  dto.ImportReport{Committed: true, Rows: 1, Unchanged: 1},
+			wantTypes:   map[string]int64{"lamp": 1},
+		},
+		{
+			name:        "dry run",
+			contentType: CSVContentType,
+			query:       "?dry_run=true",
+			body:        "name,type_id\nfan,2\nlamp,3\n",
+			wantStatus:  http.StatusOK,
+			wantReport:  dto.ImportReport{DryRun: true, Rows: 2, Created: 1, Updated: 1},
+			wantTypes:   map[string]int64{"lamp": 1},
+		},
+		{
+			name:        "dry run with invalid rows",
+			contentType: CSVContentType,
+			query:       "?dry_run=1",
+			body:        "name,type_id\nfan,-1\n",
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "invalid_import",
+			wantFields:  []fieldAt{{2, "type_id", "gt"}},
+			wantTypes:   map[string]int64{"lamp": 1},
+		},
+		{
+			name:        "csv errors by line",
+			contentType: CSVContentType,
+			body:        "name,type_id\nfan,2\nheater,abc\n,2\n\"desk\nlamp\",-1\nfan,4\n",
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "invalid_import",
+			wantFields: []fieldAt{
+				{3, "type_id", "type"},
+				{4, "name", "required"},
+				{5, "type_id", "gt"},
+				{7, "name", "unique"},
+			},
+			wantTypes: map[string]int64{"lamp": 1},
+		},
+		{
+			name:        "csv with a short record",
+			contentType: CSVContentType,
+			body:        "name,type_id\nfan,2\nheater\n",
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "invalid_import",
+			wantFields:  []fieldAt{{3, "row", pkg.CodeInvalidRequest}},
+			wantTypes:   map[string]int64{"lamp": 1},
+		},
+		{
+			name:        "ndjson errors by line",
+			contentType: NDJSONContentType,
+			body:        `{"name":"fan","type_id":2}` + "\n\n" + `{"name":` + "\n" + `{"type_id":2}` + "\n",
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "invalid_import",
+			wantFields:  []fieldAt{{3, "row", pkg.CodeInvalidRequest}, {4, "name", "required"}},
+			wantTypes:   map[string]int64{"lamp": 1},
+		},
+		{
+			name:        "store failure rolls back",
+			contentType: NDJSONContentType,
+			body:        `{"name":"fan","type_id":2}` + "\n" + `{"name":"boom","type_id":2}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "invalid_import",
+			wantFields:  []fieldAt{{2, "row", pkg.CodeInternal}},
+			wantTypes:   map[string]int64{"lamp": 1},
+		},
+		{
+			name:        "missing header",
+			contentType: CSVContentType,
+			body:        "",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    pkg.CodeInvalidRequest,
+			wantTypes:   map[string]int64{"lamp": 1},
+		},
+		{
+			name:        "unsupported format",
+			contentType: "application/json",
+			body:        `[{"name":"fan","type_id":2}]`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+			wantCode:    "unsupported_import_format",
+			wantTypes:   map[string]int64{"lamp": 1},
+		},
+		{
+			name:        "bad dry_run",
+			contentType: CSVContentType,
+			query:       "?dry_run=maybe",
+			body:        "name,type_id\nfan,2\n",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    pkg.CodeValidationFailed,
+			wantFields:  []fieldAt{{0, "dry_run", "boolean"}},
+			wantTypes:   map[string]int64{"lamp": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			store := &memoryDevices{byName: map[string]domain.Device{"lamp": {ID: 1, Name: "lamp", TypeID: 1, Version: 1}}, nextID: 1}
+			audit := &memoryAudit{}
+			h := NewDevicesHandler(services.NewDeviceService(store), audit)
+			r := gin.New()
+			r.Use(middleware.Problems())
+			r.POST("/devices/import", h.Import)
+
+			req := httptest.NewRequest(http.MethodPost, "/devices/import"+tt.query, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := store.types(); !reflect.DeepEqual(got, tt.wantTypes) {
+				t.Errorf("devices = %v, want %v", got, tt.wantTypes)
+			}
+			if audited := len(audit.events) > 0; audited != tt.wantAudited {
+				t.Errorf("audited = %v, want %v", audited, tt.wantAudited)
+			}
+
+			if tt.wantCode == "" {
+				var report dto.ImportReport
+				if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if report != tt.wantReport {
+					t.Errorf("report = %+v, want %+v", report, tt.wantReport)
+				}
+				return
+			}
+
+			var problem dto.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if problem.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", problem.Code, tt.wantCode)
+			}
+			var fields []fieldAt
+			for _, f := range problem.Errors {
+				fields = append(fields, fieldAt{f.Line, f.Field, f.Code})
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("errors = %+v, want %+v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestImportErrorsCap(t *testing.T) {
+	var errs importErrors
+	for line := 1; line <= maxImportErrors+5; line++ {
+		errs.add(lineError(line, pkg.InvalidField("name", "required", "name is required")))
+	}
+
+	var e *pkg.Error
+	if !errors.As(errs.err(), &e) {
+		t.Fatalf("err = %v, want a *pkg.Error", errs.err())
+	}
+	if len(e.Fields) != maxImportErrors {
+		t.Errorf("kept %d errors, want %d", len(e.Fields), maxImportErrors)
+	}
+	if last := e.Fields[len(e.Fields)-1].Line; last != maxImportErrors {
+		t.Errorf("last kept error is on line %d, want %d", last, maxImportErrors)
+	}
+	if !strings.Contains(e.Message, "further errors were omitted") {
+		t.Errorf("message = %q, want a note about omitted errors", e.Message)
+	}
+}
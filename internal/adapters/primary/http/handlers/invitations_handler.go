@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/audit"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type InvitationsHandler struct {
+	invitations ports.InvitationStore
+	mailer      ports.Mailer
+	acceptURL   string
+	ttl         time.Duration
+	accounts    *services.UserService
+	audit       ports.AuditStore
+}
+
+func NewInvitationsHandler(invitations ports.InvitationStore, mailer ports.Mailer, acceptURL string, ttl time.Duration, accounts *services.UserService, audit ports.AuditStore) *InvitationsHandler {
+	return &InvitationsHandler{
+		invitations: invitations,
+		mailer:      mailer,
+		acceptURL:   acceptURL,
+		ttl:         ttl,
+		accounts:    accounts,
+		audit:       audit,
+	}
+}
+
+// Create invites an email address with a role. Any earlier pending
+// invitation for the same address is withdrawn.
+func (h *InvitationsHandler) Create(c *gin.Context) {
+	var req dto.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if _, err := mail.ParseAddress(email); err != nil {
+		c.Error(pkg.ErrInvalidEmail)
+		return
+	}
+
+	role := req.Role
+	if role == "" {
+		role = domain.RoleUser
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.accounts.GetByEmail(ctx, email); err == nil {
+		c.Error(pkg.ErrDuplicateEmail)
+		return
+	} else if !errors.Is(err, pkg.ErrUserNotFound) {
+		c.Error(pkg.Internal("failed to create invitation"))
+		return
+	}
+
+	token, tokenHash, err := newLinkToken()
+	if err != nil {
+		c.Error(pkg.Internal("failed to create invitation"))
+		return
+	}
+
+	if err := h.invitations.DeletePendingForEmail(ctx, email); err != nil {
+		log.Printf("invitation cleanup failed: email=%s err=%v", email, err)
+	}
+
+	inviter := c.GetInt64("user_id")
+	invitation := domain.Invitation{
+		Email:     email,
+		Role:      role,
+		TokenHash: tokenHash,
+		InvitedBy: inviter,
+		ExpiresAt: time.Now().Add(h.ttl),
+	}
+	if err := h.invitations.Create(ctx, &invitation); err != nil {
+		c.Error(pkg.Internal("failed to create invitation"))
+		return
+	}
+
+	audit.Record(c, h.audit, domain.AuditEvent{
+		Action:     domain.AuditInvitationIssued,
+		TargetType: domain.AuditTargetInvitation,
+		TargetID:   strconv.FormatInt(invitation.ID, 10),
+		Changes:    domain.DiffFields(nil, invitationResponse(invitation)),
+	})
+
+	link := buildTokenLink(h.acceptURL, token)
+	if h.mailer != nil {
+		msg := ports.MailMessage{
+			To:      email,
+			Subject: "You have been invited",
+			Body: fmt.Sprintf("You have been invited to create an account.\n\nUse the link below within %s to choose a username and password:\n\n%s\n\nIf you were not expecting this, you can ignore this email.",
+				h.ttl, link),
+		}
+		go func() {
+			sendCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := h.mailer.Send(sendCtx, msg); err != nil {
+				log.Printf("invitation mail failed: invitation_id=%d err=%v", invitation.ID, err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusCreated, dto.CreateInvitationResponse{
+		InvitationResponse: invitationResponse(invitation),
+		Link:               link,
+	})
+}
+
+// List returns pending invitations.
+func (h *InvitationsHandler) List(c *gin.Context) {
+	invitations, err := h.invitations.ListPending(c.Request.Context(), time.Now())
+	if err != nil {
+		c.Error(pkg.Internal("failed to list invitations"))
+		return
+	}
+
+	resp := make([]dto.InvitationResponse, 0, len(invitations))
+	for _, inv := range invitations {
+		resp = append(resp, invitationResponse(inv))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Delete withdraws a pending invitation.
+func (h *InvitationsHandler) Delete(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.Error(pkg.Invalid("invalid invitation id"))
+		return
+	}
+
+	if err := h.invitations.Delete(c.Request.Context(), id); err != nil {
+		if errors.Is(err, pkg.ErrInvitationNotFound) {
+			c.Error(err)
+			return
+		}
+		c.Error(pkg.Internal("failed to delete invitation"))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Lookup lets the acceptance page show who the invitation is for before the
+// user picks a username and password.
+func (h *InvitationsHandler) Lookup(c *gin.Context) {
+	sum := sha256.Sum256([]byte(c.Query("token")))
+	invitation, err := h.invitations.Find(c.Request.Context(), sum[:], time.Now())
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.InvitationLookupResponse{
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt,
+	})
+}
+
+// Accept creates the invited account with the chosen username and password.
+func (h *InvitationsHandler) Accept(c *gin.Context) {
+	var req dto.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	// As with password resets, the invitation is only consumed once the
+	// password has been accepted.
+	sum := sha256.Sum256([]byte(req.Token))
+	invitation, err := h.invitations.Find(ctx, sum[:], now)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+
+	passwordHash, err := h.accounts.HashPassword(req.Password, req.Username)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	u, err := h.invitations.Accept(ctx, sum[:], req.Username, passwordHash, now)
+	if err != nil {
+		switch {
+		case errors.Is(err, pkg.ErrUsernameExists), errors.Is(err, pkg.ErrDuplicateEmail), errors.Is(err, pkg.ErrInvalidUsername):
+			c.Error(err)
+		default:
+			writeInvitationError(c, err)
+		}
+		return
+	}
+
+	// The new user is the actor: nobody is signed in on this request.
+	actorID := u.ID
+	recordUserEvent(c, h.audit, domain.AuditUserCreated, u.ID, domain.AuditEvent{
+		ActorID: &actorID,
+		Detail:  "accepted invitation " + strconv.FormatInt(invitation.ID, 10),
+		Changes: domain.DiffFields(nil, u),
+	})
+
+	c.JSON(http.StatusCreated, dto.RegisterResponse{ID: u.ID, Username: u.Username})
+}
+
+func writeInvitationError(c *gin.Context, err error) {
+	if errors.Is(err, pkg.ErrInvalidInvitation) {
+		c.Error(err)
+		return
+	}
+	c.Error(pkg.Internal("failed to accept invitation"))
+}
+
+func invitationResponse(inv domain.Invitation) dto.InvitationResponse {
+	return dto.InvitationResponse{
+		ID:        inv.ID,
+		Email:     inv.Email,
+		Role:      inv.Role,
+		InvitedBy: inv.InvitedBy,
+		ExpiresAt: inv.ExpiresAt,
+		CreatedAt: inv.CreatedAt,
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+	"github.com/reginaldsourn/go-crud/pkg/password"
+)
+
+// invitedUsers is the account table the invitation store writes into.
+type invitedUsers struct {
+	ports.UserStore
+	users []domain.User
+}
+
+func (s *invitedUsers) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+	return domain.User{}, pkg.ErrUserNotFound
+}
+
+// memoryInvitations keeps invitations in a slice and creates accounts in
+// users when one is accepted.
+type memoryInvitations struct {
+	ports.InvitationStore
+	invitations []domain.Invitation
+	users       *invitedUsers
+}
+
+func (s *memoryInvitations) Create(ctx context.Context, inv *domain.Invitation) error {
+	inv.ID = int64(len(s.invitations) + 1)
+	inv.CreatedAt = time.Now()
+	s.invitations = append(s.invitations, *inv)
+	return nil
+}
+
+func (s *memoryInvitations) pending(inv domain.Invitation, now time.Time) bool {
+	return inv.AcceptedAt == nil && inv.ExpiresAt.After(now)
+}
+
+func (s *memoryInvitations) ListPending(ctx context.Context, now time.Time) ([]domain.Invitation, error) {
+	var pending []domain.Invitation
+	for _, inv := range s.invitations {
+		if s.pending(inv, now) {
+			pending = append(pending, inv)
+		}
+	}
+	return pending, nil
+}
+
+func (s *memoryInvitations) Find(ctx context.Context, tokenHash []byte, now time.Time) (domain.Invitation, error) {
+	for _, inv := range s.invitations {
+		if bytes.Equal(inv.TokenHash, tokenHash) && s.pending(inv, now) {
+			return inv, nil
+		}
+	}
+	return domain.Invitation{}, pkg.ErrInvalidInvitation
+}
+
+func (s *memoryInvitations) Accept(ctx context.Context, tokenHash []byte, username string, passwordHash []byte, now time.Time) (domain.User, error) {
+	for i, inv := range s.invitations {
+		if !bytes.Equal(inv.TokenHash, tokenHash) || !s.pending(inv, now) {
+			continue
+		}
+		u := domain.User{ID: int64(len(s.users.users) + 1), Username: username, Email: inv.Email, Role: inv.Role, PasswordHash: passwordHash}
+		s.users.users = append(s.users.users, u)
+		s.invitations[i].AcceptedAt, s.invitations[i].UserID = &now, &u.ID
+		return u, nil
+	}
+	return domain.User{}, pkg.ErrInvalidInvitation
+}
+
+func (s *memoryInvitations) DeletePendingForEmail(ctx context.Context, email string) error {
+	kept := s.invitations[:0]
+	for _, inv := range s.invitations {
+		if inv.Email != email || !s.pending(inv, time.Now()) {
+			kept = append(kept, inv)
+		}
+	}
+	s.invitations = kept
+	return nil
+}
+
+// chanMailer hands every message to the test.
+type chanMailer chan ports.MailMessage
+
+func (m chanMailer) Send(ctx context.Context, msg ports.MailMessage) error {
+	m <- msg
+	return nil
+}
+
+func TestInvitations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := &invitedUsers{users: []domain.User{{ID: 1, Username: "admin", Email: "admin@example.com", Role: domain.RoleAdmin}}}
+	store := &memoryInvitations{users: users}
+	mailer := make(chanMailer, 1)
+	accounts := services.NewUserService(users, fakeHasher{}, password.DefaultPolicy(), true)
+	h := NewInvitationsHandler(store, mailer, "https://app.example/accept", time.Hour, accounts, nil)
+
+	call := func(handler gin.HandlerFunc, method, target, body string) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler(c)
+		if len(c.Errors) > 0 {
+			return w, c.Errors.Last().Err
+		}
+		return w, nil
+	}
+	invite := func(body string) dto.CreateInvitationResponse {
+		t.Helper()
+		w, err := call(h.Create, http.MethodPost, "/api/v1/invitations", body)
+		if err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("invite %s: status = %d err = %v", body, w.Code, err)
+		}
+		var resp dto.CreateInvitationResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode %s: %v", w.Body, err)
+		}
+		if msg := <-mailer; msg.To != resp.Email || !strings.Contains(msg.Body, resp.Link) {
+			t.Errorf("mailed %q to %s, want the link sent to %s", msg.Body, msg.To, resp.Email)
+		}
+		return resp
+	}
+
+	if _, err := call(h.Create, http.MethodPost, "/api/v1/invitations", `{"email":"ADMIN@example.com"}`); !errors.Is(err, pkg.ErrDuplicateEmail) {
+		t.Errorf("inviting an existing account: err = %v, want %v", err, pkg.ErrDuplicateEmail)
+	}
+	if _, err := call(h.Create, http.MethodPost, "/api/v1/invitations", `{"email":"not an address"}`); !errors.Is(err, pkg.ErrInvalidEmail) {
+		t.Errorf("inviting a malformed address: err = %v, want %v", err, pkg.ErrInvalidEmail)
+	}
+
+	first := invite(`{"email":" sam@example.com "}`)
+	if first.Email != "sam@example.com" || first.Role != domain.RoleUser || first.InvitedBy != 1 {
+		t.Errorf("invitation = %+v, want sam@example.com as a user invited by 1", first.InvitationResponse)
+	}
+	second := invite(`{"email":"sam@example.com","role":"admin"}`)
+
+	// Re-inviting withdraws the first link.
+	if pending, _ := store.ListPending(context.Background(), time.Now()); len(pending) != 1 || pending[0].ID != second.ID {
+		t.Fatalf("pending = %+v, want only the second invitation", pending)
+	}
+	link, err := url.Parse(second.Link)
+	if err != nil || link.Host != "app.example" {
+		t.Fatalf("link = %q, want one on the acceptance page", second.Link)
+	}
+	token := link.Query().Get("token")
+	firstLink, _ := url.Parse(first.Link)
+	if _, err := call(h.Lookup, http.MethodGet, "/api/v1/invitations/lookup?token="+url.QueryEscape(firstLink.Query().Get("token")), ""); !errors.Is(err, pkg.ErrInvalidInvitation) {
+		t.Errorf("withdrawn link: err = %v, want %v", err, pkg.ErrInvalidInvitation)
+	}
+
+	w, err := call(h.Lookup, http.MethodGet, "/api/v1/invitations/lookup?token="+url.QueryEscape(token), "")
+	var lookup dto.InvitationLookupResponse
+	if err != nil || json.Unmarshal(w.Body.Bytes(), &lookup) != nil || lookup.Email != "sam@example.com" || lookup.Role != domain.RoleAdmin {
+		t.Fatalf("lookup: %s err = %v, want sam@example.com as admin", w.Body, err)
+	}
+
+	accept := func(username, plain string) (*httptest.ResponseRecorder, error) {
+		body, _ := json.Marshal(dto.AcceptInvitationRequest{Token: token, Username: username, Password: plain})
+		return call(h.Accept, http.MethodPost, "/api/v1/invitations/accept", string(body))
+	}
+
+	// A password the policy refuses leaves the invitation usable.
+	if _, err := accept("sam", "short"); !errors.Is(err, pkg.ErrPasswordPolicy) {
+		t.Fatalf("weak password: err = %v, want %v", err, pkg.ErrPasswordPolicy)
+	}
+	if len(users.users) != 1 {
+		t.Fatalf("account created despite the refused password: %+v", users.users)
+	}
+
+	w, err = accept("sam", "Passw0rd!x")
+	if err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("accept: status = %d err = %v", w.Code, err)
+	}
+	var created dto.RegisterResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Username != "sam" {
+		t.Errorf("accept response = %s", w.Body)
+	}
+	sam, err := users.GetByEmail(context.Background(), "sam@example.com")
+	if err != nil || sam.Role != domain.RoleAdmin || string(sam.PasswordHash) != "hashed:Passw0rd!x" {
+		t.Errorf("account = %+v err = %v, want an admin with the chosen password", sam, err)
+	}
+
+	if _, err := accept("sam2", "Passw0rd!x"); !errors.Is(err, pkg.ErrInvalidInvitation) {
+		t.Errorf("second accept: err = %v, want %v", err, pkg.ErrInvalidInvitation)
+	}
+}
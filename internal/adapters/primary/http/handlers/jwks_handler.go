@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+)
+
+// JWKSProvider exposes the public keys that verify tokens issued here.
+type JWKSProvider interface {
+	PublicJWKS() sharedauth.JWKS
+}
+
+type JWKSHandler struct {
+	keys JWKSProvider
+}
+
+func NewJWKSHandler(keys JWKSProvider) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// Get serves the key set. Retired keys stay listed until their overlap
+// window ends, so caching for a few minutes is safe.
+func (h *JWKSHandler) Get(c *gin.Context) {
+	set := sharedauth.JWKS{Keys: []sharedauth.JWK{}}
+	if h.keys != nil {
+		set = h.keys.PublicJWKS()
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	"github.com/reginaldsourn/go-crud/pkg/auth"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const recoveryCodeCount = 10
+
+type MFAHandler struct {
+	users  *services.UserService
+	mfa    ports.MFAStore
+	issuer string
+}
+
+func NewMFAHandler(users *services.UserService, mfa ports.MFAStore, issuer string) *MFAHandler {
+	return &MFAHandler{
+		users:  users,
+		mfa:    mfa,
+		issuer: issuer,
+	}
+}
+
+// Enroll generates a new pending TOTP secret for the current user.
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	u, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if u.TOTPEnabled {
+		c.Error(pkg.ErrMFAAlreadyEnabled)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.Error(pkg.Internal("failed to generate secret"))
+		return
+	}
+
+	uri := auth.TOTPURI(h.issuer, u.Username, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		c.Error(pkg.Internal("failed to render qr code"))
+		return
+	}
+
+	if err := h.mfa.SetTOTPSecret(c.Request.Context(), u.ID, secret); err != nil {
+		c.Error(pkg.Internal("failed to store secret"))
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRCodePNG:  base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// Verify confirms a pending enrollment with a code from the authenticator and
+// returns freshly generated recovery codes.
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var req dto.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	u, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if u.TOTPEnabled {
+		c.Error(pkg.ErrMFAAlreadyEnabled)
+		return
+	}
+	if u.TOTPSecret == "" {
+		c.Error(pkg.ErrMFANotEnrolled)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := verifyTOTP(ctx, h.mfa, u, req.Code); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.Error(pkg.Internal("failed to generate recovery codes"))
+		return
+	}
+	if err := h.mfa.EnableTOTP(ctx, u.ID, hashes); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable turns TOTP off after checking a current code or recovery code.
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req dto.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	u, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if !u.TOTPEnabled {
+		c.Error(pkg.ErrMFANotEnrolled)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := verifySecondFactor(ctx, h.mfa, u, req.Code); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+	if err := h.mfa.DisableTOTP(ctx, u.ID); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current
+// TOTP code.
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req dto.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	u, ok := currentUser(c, h.users)
+	if !ok {
+		return
+	}
+	if !u.TOTPEnabled {
+		c.Error(pkg.ErrMFANotEnrolled)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := verifyTOTP(ctx, h.mfa, u, req.Code); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.Error(pkg.Internal("failed to generate recovery codes"))
+		return
+	}
+	if err := h.mfa.ReplaceRecoveryCodes(ctx, u.ID, hashes); err != nil {
+		writeMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func verifySecondFactor(ctx context.Context, store ports.MFAStore, u domain.User, code string) error {
+	if err := verifyTOTP(ctx, store, u, code); err == nil || !errors.Is(err, pkg.ErrInvalidMFACode) {
+		return err
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if normalized == "" {
+		return pkg.ErrInvalidMFACode
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return store.ConsumeRecoveryCode(ctx, u.ID, sum[:])
+}
+
+func verifyTOTP(ctx context.Context, store ports.MFAStore, u domain.User, code string) error {
+	step, ok := auth.ValidateTOTP(u.TOTPSecret, code, time.Now())
+	if !ok {
+		return pkg.ErrInvalidMFACode
+	}
+	return store.ConsumeTOTPStep(ctx, u.ID, step)
+}
+
+func writeMFAError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, pkg.ErrInvalidMFACode), errors.Is(err, pkg.ErrMFANotEnrolled):
+		c.Error(err)
+	default:
+		c.Error(pkg.Internal("two-factor verification failed"))
+	}
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns display codes in the form "xxxxx-xxxxx" together
+// with the hashes to persist.
+func newRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf))[:10]
+		sum := sha256.Sum256([]byte(raw))
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, sum[:])
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return code
+}
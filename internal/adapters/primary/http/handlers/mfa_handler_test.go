@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// memoryMFA tracks used TOTP steps and unused recovery code hashes.
+type memoryMFA struct {
+	ports.MFAStore
+	lastStep int64
+	codes    map[string]bool
+}
+
+func (s *memoryMFA) ConsumeTOTPStep(ctx context.Context, userID, step int64) error {
+	if step <= s.lastStep {
+		return pkg.ErrInvalidMFACode
+	}
+	s.lastStep = step
+	return nil
+}
+
+func (s *memoryMFA) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error {
+	if !s.codes[string(codeHash)] {
+		return pkg.ErrInvalidMFACode
+	}
+	delete(s.codes, string(codeHash))
+	return nil
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatalf("newRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q is not xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q repeated", code)
+		}
+		seen[code] = true
+		if sum := sha256.Sum256([]byte(normalizeRecoveryCode(code))); string(sum[:]) != string(hashes[i]) {
+			t.Errorf("hash %d does not match code %q", i, code)
+		}
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"abcde-fghij", "abcdefghij"},
+		{"ABCDE-FGHIJ", "abcdefghij"},
+		{" abcde fghij ", "abcdefghij"},
+		{"abcdefghij", "abcdefghij"},
+		{"--", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	// The RFC 6238 SHA-1 key, base32 encoded.
+	u := domain.User{ID: 1, TOTPSecret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}
+	now := time.Now()
+	current := totpCodeAt(t, u.TOTPSecret, now)
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatalf("newRecoveryCodes: %v", err)
+	}
+	newStore := func() *memoryMFA {
+		store := &memoryMFA{codes: map[string]bool{}}
+		for _, h := range hashes {
+			store.codes[string(h)] = true
+		}
+		return store
+	}
+
+	tests := []struct {
+		name    string
+		codes   []string
+		wantErr []error
+	}{
+		{"totp", []string{current}, []error{nil}},
+		{"totp replay", []string{current, current}, []error{nil, pkg.ErrInvalidMFACode}},
+		{"recovery code", []string{codes[0]}, []error{nil}},
+		{"recovery code as typed", []string{"  " + strings.ToUpper(codes[1]) + " "}, []error{nil}},
+		{"recovery code reuse", []string{codes[2], codes[2]}, []error{nil, pkg.ErrInvalidMFACode}},
+		{"wrong code", []string{"000000x"}, []error{pkg.ErrInvalidMFACode}},
+		{"empty", []string{""}, []error{pkg.ErrInvalidMFACode}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore()
+			for i, code := range tt.codes {
+				err := verifySecondFactor(context.Background(), store, u, code)
+				if want := tt.wantErr[i]; !errors.Is(err, want) || (want == nil && err != nil) {
+					t.Errorf("attempt %d: err = %v, want %v", i+1, err, want)
+				}
+			}
+		})
+	}
+}
+
+// totpCodeAt computes the code an authenticator app would show for secret.
+func totpCodeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", n%1000000)
+}
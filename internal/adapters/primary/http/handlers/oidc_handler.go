@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/auth"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const (
+	oidcFlowCookie       = "oidc_flow"
+	oidcFlowCookieMaxAge = 600
+)
+
+type OIDCHandlerOptions struct {
+	// AutoProvision creates a local account on first login when no account
+	// is linked.
+	AutoProvision bool
+	// LinkByEmail links the identity to an existing account with the same
+	// address when the provider reports the email as verified. Admin
+	// accounts are never linked this way.
+	LinkByEmail bool
+	// PostLoginRedirect, when set, receives the issued token, or the MFA
+	// challenge for accounts with two-factor authentication, in the URL
+	// fragment instead of a JSON response.
+	PostLoginRedirect string
+	// CookiePath scopes the flow cookie to the OIDC routes.
+	CookiePath string
+}
+
+type OIDCHandler struct {
+	client     *auth.OIDCClient
+	identities ports.ExternalIdentityStore
+	accounts   *services.UserService
+	issuer     ports.TokenIssuer
+	mfa        ports.MFAStore
+	mfaTTL     time.Duration
+	sessions   ports.SessionStore
+	audit      ports.AuditStore
+	opts       OIDCHandlerOptions
+}
+
+func NewOIDCHandler(client *auth.OIDCClient, identities ports.ExternalIdentityStore, accounts *services.UserService, issuer ports.TokenIssuer, mfa ports.MFAStore, mfaTTL time.Duration, sessions ports.SessionStore, audit ports.AuditStore, opts OIDCHandlerOptions) *OIDCHandler {
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	return &OIDCHandler{
+		client:     client,
+		identities: identities,
+		accounts:   accounts,
+		issuer:     issuer,
+		mfa:        mfa,
+		mfaTTL:     mfaTTL,
+		sessions:   sessions,
+		audit:      audit,
+		opts:       opts,
+	}
+}
+
+// Login starts the authorization code flow. State, nonce and the PKCE
+// verifier are kept in a short-lived HttpOnly cookie.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	flow, err := auth.NewOIDCFlow()
+	if err != nil {
+		c.Error(pkg.Internal("failed to start login"))
+		return
+	}
+
+	target, err := h.client.AuthCodeURL(c.Request.Context(), flow)
+	if err != nil {
+		log.Printf("oidc login failed: %v", err)
+		c.Error(pkg.Upstream("identity provider unavailable"))
+		return
+	}
+
+	raw, err := json.Marshal(flow)
+	if err != nil {
+		c.Error(pkg.Internal("failed to start login"))
+		return
+	}
+	h.setFlowCookie(c, base64.RawURLEncoding.EncodeToString(raw), oidcFlowCookieMaxAge)
+
+	c.Redirect(http.StatusFound, target)
+}
+
+// Callback completes the flow, resolves the local account and issues this
+// service's own token. Accounts with two-factor authentication get the same
+// MFA challenge as a password login: the provider stands in for the
+// password, not for the second factor.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.Error(pkg.Unauthorized("identity provider denied login: " + providerErr))
+		return
+	}
+
+	flow, ok := h.readFlowCookie(c)
+	h.setFlowCookie(c, "", -1)
+	if !ok || subtle.ConstantTimeCompare([]byte(flow.State), []byte(c.Query("state"))) != 1 {
+		c.Error(pkg.Invalid("invalid or expired login state"))
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.Error(pkg.Invalid("missing authorization code"))
+		return
+	}
+
+	claims, err := h.client.Exchange(c.Request.Context(), code, flow)
+	if err != nil {
+		log.Printf("oidc callback failed: %v", err)
+		if errors.Is(err, auth.ErrInvalidIDToken) || errors.Is(err, auth.ErrOIDCExchange) {
+			c.Error(pkg.Unauthorized("login failed"))
+			return
+		}
+		c.Error(pkg.Upstream("identity provider unavailable"))
+		return
+	}
+
+	u, err := h.resolveUser(c.Request.Context(), claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, pkg.ErrPermissionDenied):
+			recordLoginFailure(c, h.audit, domain.User{Username: claims.Subject}, "oidc identity not linked")
+			c.Error(pkg.ErrPermissionDenied.WithMessage("no account is linked to this identity"))
+		case errors.Is(err, pkg.ErrDuplicateEmail):
+			c.Error(pkg.ErrDuplicateEmail.WithMessage("an account with this email already exists"))
+		default:
+			log.Printf("oidc account resolution failed: sub=%s err=%v", claims.Subject, err)
+			c.Error(pkg.Internal("login failed"))
+		}
+		return
+	}
+
+	h.completeLogin(c, u)
+}
+
+// completeLogin answers a successful provider login for u with an access
+// token, or with an MFA challenge when u has two-factor authentication.
+func (h *OIDCHandler) completeLogin(c *gin.Context, u domain.User) {
+	if u.TOTPEnabled {
+		challenge, ok := mfaChallenge(c, h.issuer, h.mfa, h.mfaTTL, u)
+		if !ok {
+			return
+		}
+		if h.opts.PostLoginRedirect != "" {
+			c.Redirect(http.StatusFound, h.opts.PostLoginRedirect+"#"+url.Values{
+				"mfa_token":  {challenge.MFAToken},
+				"expires_in": {strconv.FormatInt(challenge.ExpiresIn, 10)},
+			}.Encode())
+			return
+		}
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	if err := reopenIfClosed(c, h.accounts, u); err != nil {
+		c.Error(pkg.Internal("failed to reopen account"))
+		return
+	}
+
+	token, err := issueAccessToken(c, h.issuer, h.sessions, u)
+	if err != nil {
+		c.Error(pkg.Internal("failed to issue token"))
+		return
+	}
+	recordLogin(c, h.audit, u, "oidc")
+
+	if h.opts.PostLoginRedirect != "" {
+		c.Redirect(http.StatusFound, h.opts.PostLoginRedirect+"#"+url.Values{"token": {token}}.Encode())
+		return
+	}
+	c.JSON(http.StatusOK, dto.LoginResponse{Token: token, Username: u.Username})
+}
+
+// resolveUser finds the account linked to the identity, links it by verified
+// email, or provisions a new one, depending on configuration. Only an
+// explicit email_verified of true counts; an admin account found by email
+// is refused rather than handed to whoever controls the provider account.
+func (h *OIDCHandler) resolveUser(ctx context.Context, claims auth.IDTokenClaims) (domain.User, error) {
+	provider := h.client.Issuer()
+
+	identity, err := h.identities.Find(ctx, provider, claims.Subject)
+	if err == nil {
+		return h.accounts.Get(ctx, identity.UserID)
+	}
+	if !errors.Is(err, pkg.ErrIdentityNotFound) {
+		return domain.User{}, err
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+
+	var u domain.User
+	switch {
+	case email != "" && h.opts.LinkByEmail:
+		u, err = h.accounts.GetByEmail(ctx, email)
+		if err == nil && u.Role == domain.RoleAdmin {
+			err = pkg.ErrPermissionDenied
+		} else if errors.Is(err, pkg.ErrUserNotFound) && h.opts.AutoProvision {
+			u, err = h.accounts.Provision(ctx, usernameFromClaims(claims), email)
+		} else if errors.Is(err, pkg.ErrUserNotFound) {
+			err = pkg.ErrPermissionDenied
+		}
+	case h.opts.AutoProvision:
+		u, err = h.accounts.Provision(ctx, usernameFromClaims(claims), email)
+	default:
+		err = pkg.ErrPermissionDenied
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	err = h.identities.Link(ctx, &domain.ExternalIdentity{
+		UserID:   u.ID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if errors.Is(err, pkg.ErrIdentityLinked) {
+		// A concurrent callback linked it first.
+		identity, err = h.identities.Find(ctx, provider, claims.Subject)
+		if err != nil {
+			return domain.User{}, err
+		}
+		return h.accounts.Get(ctx, identity.UserID)
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	return u, nil
+}
+
+// usernameFromClaims suggests a local username for a provisioned account.
+func usernameFromClaims(claims auth.IDTokenClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" && claims.Email != "" {
+		candidate, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(candidate) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+		case r == '.' || r == '-' || r == '_':
+			b.WriteRune(r)
+		}
+	}
+	if b.Len() == 0 {
+		return "user"
+	}
+	return b.String()
+}
+
+func (h *OIDCHandler) setFlowCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     h.opts.CookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https"),
+		// Lax lets the cookie ride along on the provider's top-level
+		// redirect back to the callback.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *OIDCHandler) readFlowCookie(c *gin.Context) (auth.OIDCFlow, bool) {
+	value, err := c.Cookie(oidcFlowCookie)
+	if err != nil || value == "" {
+		return auth.OIDCFlow{}, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return auth.OIDCFlow{}, false
+	}
+	var flow auth.OIDCFlow
+	if err := json.Unmarshal(raw, &flow); err != nil || flow.State == "" {
+		return auth.OIDCFlow{}, false
+	}
+	return flow, true
+}
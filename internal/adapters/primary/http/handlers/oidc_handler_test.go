@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/golang-jwt/jwt/v4"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/auth"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+	"github.com/reginaldsourn/go-crud/pkg/password"
+)
+
+// oidcUsers keeps accounts in memory. Only the methods account resolution
+// uses are implemented.
+type oidcUsers struct {
+	ports.UserStore
+	users []domain.User
+}
+
+func (s *oidcUsers) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	for _, u := range s.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return domain.User{}, pkg.ErrUserNotFound
+}
+
+func (s *oidcUsers) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) {
+			return u, nil
+		}
+	}
+	return domain.User{}, pkg.ErrUserNotFound
+}
+
+func (s *oidcUsers) Create(ctx context.Context, username, email string, passwordHash []byte) (domain.User, error) {
+	for _, u := range s.users {
+		if u.Username == username {
+			return domain.User{}, pkg.ErrUsernameExists
+		}
+		if email != "" && strings.EqualFold(u.Email, email) {
+			return domain.User{}, pkg.ErrDuplicateEmail
+		}
+	}
+	u := domain.User{ID: int64(len(s.users) + 1), Username: username, Email: email, PasswordHash: passwordHash}
+	s.users = append(s.users, u)
+	return u, nil
+}
+
+type oidcIdentities struct {
+	linked []domain.ExternalIdentity
+}
+
+func (s *oidcIdentities) Find(ctx context.Context, provider, subject string) (domain.ExternalIdentity, error) {
+	for _, i := range s.linked {
+		if i.Provider == provider && i.Subject == subject {
+			return i, nil
+		}
+	}
+	return domain.ExternalIdentity{}, pkg.ErrIdentityNotFound
+}
+
+func (s *oidcIdentities) Link(ctx context.Context, identity *domain.ExternalIdentity) error {
+	if _, err := s.Find(ctx, identity.Provider, identity.Subject); err == nil {
+		return pkg.ErrIdentityLinked
+	}
+	s.linked = append(s.linked, *identity)
+	return nil
+}
+
+type fakeHasher struct{}
+
+func (fakeHasher) Hash(password string) ([]byte, error) { return []byte("hashed:" + password), nil }
+
+func (fakeHasher) Verify(password string, encoded []byte) (bool, bool, error) {
+	return string(encoded) == "hashed:"+password, false, nil
+}
+
+const testProvider = "https://idp.example"
+
+func newTestOIDCHandler(t *testing.T, users *oidcUsers, identities *oidcIdentities, opts OIDCHandlerOptions) *OIDCHandler {
+	t.Helper()
+	client, err := auth.NewOIDCClient(auth.OIDCOptions{Issuer: testProvider, ClientID: "client-1", RedirectURL: "https://app.example/callback"})
+	if err != nil {
+		t.Fatalf("NewOIDCClient: %v", err)
+	}
+	accounts := services.NewUserService(users, fakeHasher{}, password.DefaultPolicy(), false)
+	return NewOIDCHandler(client, identities, accounts, nil, nil, 0, nil, nil, opts)
+}
+
+func TestOIDCResolveUser(t *testing.T) {
+	existing := domain.User{ID: 1, Username: "pat", Email: "Pat@Example.com", Role: domain.RoleUser}
+	admin := domain.User{ID: 2, Username: "root", Email: "root@example.com", Role: domain.RoleAdmin}
+	claims := func(email string, verified bool) auth.IDTokenClaims {
+		return auth.IDTokenClaims{
+			RegisteredClaims:  jwt.RegisteredClaims{Subject: "subject-1"},
+			Email:             email,
+			EmailVerified:     verified,
+			PreferredUsername: "Pat.Smith",
+		}
+	}
+
+	tests := []struct {
+		name         string
+		opts         OIDCHandlerOptions
+		claims       auth.IDTokenClaims
+		linked       bool
+		wantErr      error
+		wantID       int64
+		wantUsername string
+		wantEmail    string
+	}{
+		{
+			name:   "already linked",
+			claims: claims("", false),
+			linked: true,
+			wantID: 1, wantUsername: "pat", wantEmail: "Pat@Example.com",
+		},
+		{
+			name:   "link by verified email",
+			opts:   OIDCHandlerOptions{LinkByEmail: true},
+			claims: claims("pat@example.com", true),
+			wantID: 1, wantUsername: "pat", wantEmail: "Pat@Example.com",
+		},
+		{
+			name:    "unverified email is not linked",
+			opts:    OIDCHandlerOptions{LinkByEmail: true},
+			claims:  claims("pat@example.com", false),
+			wantErr: pkg.ErrPermissionDenied,
+		},
+		{
+			name:    "admin accounts are not linked by email",
+			opts:    OIDCHandlerOptions{LinkByEmail: true, AutoProvision: true},
+			claims:  claims("root@example.com", true),
+			wantErr: pkg.ErrPermissionDenied,
+		},
+		{
+			name:    "email is not linked unless enabled",
+			opts:    OIDCHandlerOptions{AutoProvision: true},
+			claims:  claims("pat@example.com", true),
+			wantErr: pkg.ErrDuplicateEmail,
+		},
+		{
+			name:    "unknown email without provisioning",
+			opts:    OIDCHandlerOptions{LinkByEmail: true},
+			claims:  claims("sam@example.com", true),
+			wantErr: pkg.ErrPermissionDenied,
+		},
+		{
+			name:   "unknown email is provisioned",
+			opts:   OIDCHandlerOptions{LinkByEmail: true, AutoProvision: true},
+			claims: claims("sam@example.com", true),
+			wantID: 3, wantUsername: "pat.smith", wantEmail: "sam@example.com",
+		},
+		{
+			name:   "unverified email is provisioned without it",
+			opts:   OIDCHandlerOptions{LinkByEmail: true, AutoProvision: true},
+			claims: claims("pat@example.com", false),
+			wantID: 3, wantUsername: "pat.smith", wantEmail: "",
+		},
+		{
+			name:    "not linked and nothing enabled",
+			claims:  claims("pat@example.com", true),
+			wantErr: pkg.ErrPermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &oidcUsers{users: []domain.User{existing, admin}}
+			identities := &oidcIdentities{}
+			if tt.linked {
+				identities.linked = append(identities.linked, domain.ExternalIdentity{UserID: 1, Provider: testProvider, Subject: "subject-1"})
+			}
+			h := newTestOIDCHandler(t, users, identities, tt.opts)
+
+			u, err := h.resolveUser(context.Background(), tt.claims)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if len(identities.linked) != 0 {
+					t.Errorf("identity linked after a refused login: %+v", identities.linked)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveUser: %v", err)
+			}
+			if u.ID != tt.wantID || u.Username != tt.wantUsername || u.Email != tt.wantEmail {
+				t.Errorf("user = %d %q %q, want %d %q %q", u.ID, u.Username, u.Email, tt.wantID, tt.wantUsername, tt.wantEmail)
+			}
+			if _, err := identities.Find(context.Background(), testProvider, "subject-1"); err != nil {
+				t.Errorf("identity not linked: %v", err)
+			}
+		})
+	}
+}
+
+func TestOIDCProvisionAvoidsTakenUsernames(t *testing.T) {
+	users := &oidcUsers{users: []domain.User{{ID: 1, Username: "pat.smith"}}}
+	h := newTestOIDCHandler(t, users, &oidcIdentities{}, OIDCHandlerOptions{AutoProvision: true})
+
+	u, err := h.resolveUser(context.Background(), auth.IDTokenClaims{
+		RegisteredClaims:  jwt.RegisteredClaims{Subject: "subject-2"},
+		PreferredUsername: "Pat.Smith",
+	})
+	if err != nil {
+		t.Fatalf("resolveUser: %v", err)
+	}
+	if !strings.HasPrefix(u.Username, "pat.smith-") {
+		t.Errorf("username = %q, want a suffixed pat.smith", u.Username)
+	}
+	if string(u.PasswordHash) == "" {
+		t.Error("provisioned account has no password hash")
+	}
+}
+
+func TestUsernameFromClaims(t *testing.T) {
+	tests := []struct {
+		preferred, email, want string
+	}{
+		{"Pat.Smith", "", "pat.smith"},
+		{"", "sam_o@example.com", "sam_o"},
+		{"Zoë Ünal", "", "zonal"},
+		{"", "", "user"},
+		{"!!!", "", "user"},
+	}
+	for _, tt := range tests {
+		got := usernameFromClaims(auth.IDTokenClaims{PreferredUsername: tt.preferred, Email: tt.email})
+		if got != tt.want {
+			t.Errorf("usernameFromClaims(%q, %q) = %q, want %q", tt.preferred, tt.email, got, tt.want)
+		}
+	}
+}
+
+// purposeIssuer hands out tokens named after their purpose, so a test can
+// tell a challenge from an access token.
+type purposeIssuer struct {
+	issued []sharedauth.TokenRequest
+}
+
+func (i *purposeIssuer) Issue(req sharedauth.TokenRequest) (string, sharedauth.Claims, error) {
+	i.issued = append(i.issued, req)
+	if req.Purpose != "" {
+		return req.Purpose + "-token", sharedauth.Claims{}, nil
+	}
+	return "access-token", sharedauth.Claims{}, nil
+}
+
+func TestOIDCLoginRequiresSecondFactor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	u := domain.User{ID: 1, Username: "pat", TOTPEnabled: true}
+
+	t.Run("json", func(t *testing.T) {
+		issuer := &purposeIssuer{}
+		h := newTestOIDCHandler(t, &oidcUsers{users: []domain.User{u}}, &oidcIdentities{}, OIDCHandlerOptions{})
+		h.issuer, h.mfa, h.mfaTTL = issuer, &memoryMFA{}, 5*time.Minute
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/oidc/callback", nil)
+		h.completeLogin(c, u)
+
+		var got dto.MFAChallengeResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("decode %s: %v", w.Body, err)
+		}
+		want := dto.MFAChallengeResponse{MFARequired: true, MFAToken: sharedauth.PurposeMFA + "-token", ExpiresIn: 300}
+		if got != want {
+			t.Errorf("response = %+v, want %+v", got, want)
+		}
+		if len(issuer.issued) != 1 || issuer.issued[0].Purpose != sharedauth.PurposeMFA {
+			t.Errorf("issued = %+v, want only an MFA challenge", issuer.issued)
+		}
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		h := newTestOIDCHandler(t, &oidcUsers{users: []domain.User{u}}, &oidcIdentities{}, OIDCHandlerOptions{PostLoginRedirect: "https://app.example/signed-in"})
+		h.issuer, h.mfa, h.mfaTTL = &purposeIssuer{}, &memoryMFA{}, 5*time.Minute
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/oidc/callback", nil)
+		h.completeLogin(c, u)
+
+		if w.Code != http.StatusFound {
+			t.Fatalf("status = %d, want 302", w.Code)
+		}
+		target, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Location: %v", err)
+		}
+		fragment, _ := url.ParseQuery(target.Fragment)
+		if fragment.Get("token") != "" || fragment.Get("mfa_token") != sharedauth.PurposeMFA+"-token" {
+			t.Errorf("fragment = %q, want only an MFA challenge", target.Fragment)
+		}
+	})
+
+	t.Run("no mfa store", func(t *testing.T) {
+		issuer := &purposeIssuer{}
+		h := newTestOIDCHandler(t, &oidcUsers{users: []domain.User{u}}, &oidcIdentities{}, OIDCHandlerOptions{})
+		h.issuer = issuer
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/oidc/callback", nil)
+		h.completeLogin(c, u)
+
+		var e *pkg.Error
+		if len(c.Errors) != 1 || !errors.As(c.Errors.Last().Err, &e) || e.Status != http.StatusServiceUnavailable {
+			t.Fatalf("errors = %v, want one 503", c.Errors)
+		}
+		if len(issuer.issued) != 0 {
+			t.Errorf("issued = %+v, want nothing", issuer.issued)
+		}
+	})
+}
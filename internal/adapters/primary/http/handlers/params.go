@@ -4,8 +4,32 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/etag"
 )
 
 func parseIDParam(c *gin.Context, name string) (int64, error) {
 	return strconv.ParseInt(c.Param(name), 10, 64)
 }
+
+// ifMatch checks a version against the request's If-Match header.
+func ifMatch(c *gin.Context) func(int64) bool {
+	return func(version int64) bool { return etag.Matches(c, version) }
+}
+
+// atVersion only accepts version v. A zero v accepts any version.
+func atVersion(v int64) func(int64) bool {
+	if v == 0 {
+		return nil
+	}
+	return func(version int64) bool { return version == v }
+}
+
+// nonEmpty treats a zero value as a field that was left out.
+func nonEmpty[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return &v
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const forgotPasswordMessage = "if an account with that email exists, a reset link has been sent"
+
+type PasswordHandler struct {
+	resets   ports.PasswordResetStore
+	mailer   ports.Mailer
+	resetURL string
+	ttl      time.Duration
+	accounts *services.UserService
+	sessions ports.SessionStore
+}
+
+func NewPasswordHandler(resets ports.PasswordResetStore, mailer ports.Mailer, resetURL string, ttl time.Duration, accounts *services.UserService, sessions ports.SessionStore) *PasswordHandler {
+	return &PasswordHandler{
+		resets:   resets,
+		mailer:   mailer,
+		resetURL: resetURL,
+		ttl:      ttl,
+		accounts: accounts,
+		sessions: sessions,
+	}
+}
+
+// Forgot issues a reset token and mails it to the account owner. The response
+// is identical whether or not the email belongs to an account.
+func (h *PasswordHandler) Forgot(c *gin.Context) {
+	var req dto.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	accepted := dto.ForgotPasswordResponse{Message: forgotPasswordMessage}
+
+	u, err := h.accounts.GetByEmail(c.Request.Context(), req.Email)
+	if err != nil {
+		if !errors.Is(err, pkg.ErrUserNotFound) {
+			log.Printf("password reset lookup failed: %v", err)
+		}
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	token, tokenHash, err := newLinkToken()
+	if err != nil {
+		log.Printf("password reset token generation failed: %v", err)
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.resets.DeleteForUser(ctx, u.ID); err != nil {
+		log.Printf("password reset cleanup failed: user_id=%d err=%v", u.ID, err)
+	}
+	if _, err := h.resets.Create(ctx, u.ID, tokenHash, time.Now().Add(h.ttl)); err != nil {
+		log.Printf("password reset store failed: user_id=%d err=%v", u.ID, err)
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	msg := ports.MailMessage{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("A password reset was requested for %s.\n\nUse the link below within %s to choose a new password:\n\n%s\n\nIf you did not request this, you can ignore this email.",
+			u.Username, h.ttl, buildTokenLink(h.resetURL, token)),
+	}
+
+	// Delivery happens in the background so response timing does not reveal
+	// whether the account exists.
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.mailer.Send(sendCtx, msg); err != nil {
+			log.Printf("password reset mail failed: user_id=%d err=%v", u.ID, err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// Reset consumes a reset token, sets the new password and invalidates every
+// token previously issued to the account.
+func (h *PasswordHandler) Reset(c *gin.Context) {
+	var req dto.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+
+	// The token is looked up first and only consumed once the new password
+	// has been accepted, so a policy failure does not burn the link.
+	sum := sha256.Sum256([]byte(req.Token))
+	pending, err := h.resets.Find(ctx, sum[:], now)
+	if err != nil {
+		writeResetTokenError(c, err)
+		return
+	}
+
+	u, err := h.accounts.Get(ctx, pending.UserID)
+	if err != nil {
+		writeResetTokenError(c, pkg.ErrInvalidResetToken)
+		return
+	}
+	passwordHash, err := h.accounts.HashPassword(req.Password, u.Username)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	token, err := h.resets.Consume(ctx, sum[:], now)
+	if err != nil {
+		writeResetTokenError(c, err)
+		return
+	}
+
+	if _, err := h.accounts.StorePasswordHash(ctx, token.UserID, passwordHash); err != nil {
+		if errors.Is(err, pkg.ErrUserNotFound) {
+			// The account went away after the token was issued.
+			c.Error(pkg.ErrInvalidResetToken)
+			return
+		}
+		c.Error(pkg.Internal("failed to reset password"))
+		return
+	}
+
+	if err := h.accounts.RevokeTokens(ctx, token.UserID); err != nil {
+		c.Error(pkg.Internal("failed to invalidate sessions"))
+		return
+	}
+	if h.sessions != nil {
+		// RevokeTokens already rejects the old tokens; this keeps the
+		// session list in step with that.
+		if err := h.sessions.RevokeAll(ctx, token.UserID); err != nil {
+			log.Printf("password reset session revoke failed: user_id=%d err=%v", token.UserID, err)
+		}
+	}
+	if err := h.resets.DeleteForUser(ctx, token.UserID); err != nil {
+		log.Printf("password reset cleanup failed: user_id=%d err=%v", token.UserID, err)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func writeResetTokenError(c *gin.Context, err error) {
+	if errors.Is(err, pkg.ErrInvalidResetToken) {
+		c.Error(err)
+		return
+	}
+	c.Error(pkg.Internal("failed to reset password"))
+}
+
+// passwordErrorAs moves a password policy failure, which the user service
+// reports against "password", to the request field that carried it.
+func passwordErrorAs(field string, err error) error {
+	var policyErr *pkg.Error
+	if !errors.As(err, &policyErr) {
+		return err
+	}
+	fields := make([]pkg.FieldError, len(policyErr.Fields))
+	for i, f := range policyErr.Fields {
+		f.Field = field
+		fields[i] = f
+	}
+	return pkg.ErrPasswordPolicy.WithFields(fields...)
+}
+
+// buildTokenLink adds the token to the query of a frontend URL.
+func buildTokenLink(base, token string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// newLinkToken returns a random URL-safe token and its SHA-256 hash.
+func newLinkToken() (string, []byte, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(token))
+	return token, sum[:], nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const maxUserAgentLength = 512
+
+type SessionsHandler struct {
+	sessions ports.SessionStore
+}
+
+func NewSessionsHandler(sessions ports.SessionStore) *SessionsHandler {
+	return &SessionsHandler{sessions: sessions}
+}
+
+// List returns the current user's active sessions, flagging the one the
+// request was made with.
+func (h *SessionsHandler) List(c *gin.Context) {
+	sessions, err := h.sessions.ListActive(c.Request.Context(), c.GetInt64("user_id"))
+	if err != nil {
+		c.Error(pkg.Internal("failed to list sessions"))
+		return
+	}
+
+	current := c.GetString("session_id")
+	resp := make([]dto.SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, dto.SessionResponse{
+			ID:         s.ID,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == current,
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *SessionsHandler) Delete(c *gin.Context) {
+	err := h.sessions.Revoke(c.Request.Context(), c.GetInt64("user_id"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, pkg.ErrSessionNotFound) {
+			c.Error(err)
+			return
+		}
+		c.Error(pkg.Internal("failed to revoke session"))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// issueAccessToken issues an access token for u. When sessions are tracked
+// the login is recorded as a session and the token carries its ID.
+func issueAccessToken(c *gin.Context, issuer ports.TokenIssuer, sessions ports.SessionStore, u domain.User) (string, error) {
+	if sessions == nil {
+		token, _, err := issuer.Issue(sharedauth.TokenRequest{UserID: u.ID, Username: u.Username})
+		return token, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	sessionID := hex.EncodeToString(id)
+
+	token, claims, err := issuer.Issue(sharedauth.TokenRequest{
+		UserID:    u.ID,
+		Username:  u.Username,
+		SessionID: sessionID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	userAgent := truncateUserAgent(c.Request.UserAgent())
+	now := time.Now()
+	err = sessions.Create(c.Request.Context(), &domain.Session{
+		ID:         sessionID,
+		UserID:     u.ID,
+		IP:         c.ClientIP(),
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// truncateUserAgent drops invalid UTF-8, which text columns reject, and cuts
+// the header to maxUserAgentLength bytes without splitting a character.
+func truncateUserAgent(userAgent string) string {
+	userAgent = strings.ToValidUTF8(userAgent, "")
+	if len(userAgent) <= maxUserAgentLength {
+		return userAgent
+	}
+	cut := maxUserAgentLength
+	for cut > 0 && !utf8.RuneStart(userAgent[cut]) {
+		cut--
+	}
+	return userAgent[:cut]
+}
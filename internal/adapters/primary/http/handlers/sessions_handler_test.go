@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUserAgent(t *testing.T) {
+	tests := []struct {
+		name, in string
+		wantLen  int
+	}{
+		{"short", "curl/8.5.0", 10},
+		{"exactly the limit", strings.Repeat("a", maxUserAgentLength), maxUserAgentLength},
+		{"ascii over the limit", strings.Repeat("a", maxUserAgentLength+10), maxUserAgentLength},
+		// The euro sign takes three bytes, so the limit falls inside one.
+		{"multibyte at the limit", strings.Repeat("a", maxUserAgentLength-1) + "€€", maxUserAgentLength - 1},
+		{"invalid bytes dropped", "agent\xff/1.0", len("agent/1.0")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateUserAgent(tt.in)
+			if len(got) != tt.wantLen {
+				t.Errorf("len = %d, want %d", len(got), tt.wantLen)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("result is not valid UTF-8: %q", got)
+			}
+		})
+	}
+}
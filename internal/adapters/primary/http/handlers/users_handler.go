@@ -1,146 +1,411 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/audit"
 	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/etag"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/pagination"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/patch"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
 	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
 	pkg "github.com/reginaldsourn/go-crud/pkg/error"
 )
 
 type UsersHandler struct {
-	store ports.UserStore
+	users *services.UserService
+	audit ports.AuditStore
 }
 
-func NewUsersHandler(store ports.UserStore) *UsersHandler {
-	return &UsersHandler{store: store}
+func NewUsersHandler(users *services.UserService, audit ports.AuditStore) *UsersHandler {
+	return &UsersHandler{users: users, audit: audit}
 }
 
-func (h *UsersHandler) Create(c *gin.Context) {
+// Register creates an account for an anonymous caller, who becomes the
+// actor of its audit event.
+func (h *UsersHandler) Register(c *gin.Context) {
 	var req dto.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	u, err := h.users.Register(c.Request.Context(), newUser(req))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		c.Error(err)
+		return
+	}
+
+	actorID := u.ID
+	recordUserEvent(c, h.audit, domain.AuditUserCreated, u.ID, domain.AuditEvent{
+		ActorID: &actorID,
+		Detail:  "self-registration",
+		Changes: domain.DiffFields(nil, u),
+	})
+	c.JSON(http.StatusCreated, dto.RegisterResponse{ID: u.ID, Username: u.Username})
+}
+
+func (h *UsersHandler) Create(c *gin.Context) {
+	var req dto.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
 
-	u, err := h.store.Create(c.Request.Context(), req.Username, passwordHash)
+	u, err := h.users.Create(c.Request.Context(), newUser(req))
 	if err != nil {
-		status := http.StatusBadRequest
-		if err == pkg.ErrUsernameExists {
-			status = http.StatusConflict
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
+	recordUserEvent(c, h.audit, domain.AuditUserCreated, u.ID, domain.AuditEvent{Changes: domain.DiffFields(nil, u)})
+	etag.Set(c, u.Version)
 	c.JSON(http.StatusCreated, dto.ToUserResponse(u))
 }
 
 func (h *UsersHandler) Get(c *gin.Context) {
 	id, err := parseIDParam(c, "id")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		c.Error(pkg.Invalid("invalid id"))
 		return
 	}
 
-	u, err := h.store.GetByID(c.Request.Context(), id)
+	viewer, ok := h.viewer(c)
+	if !ok {
+		return
+	}
+	u, err := h.users.Get(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	if etag.NotModified(c, u.Version) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.ToUserResponse(u))
+	c.JSON(http.StatusOK, userResponseFor(viewer)(u))
 }
 
 func (h *UsersHandler) List(c *gin.Context) {
-	users, err := h.store.List(c.Request.Context())
+	opts, err := pagination.Parse(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	viewer, ok := h.viewer(c)
+	if !ok {
+		return
+	}
+	// Filtering or sorting on a hidden field would reveal it a guess at a
+	// time.
+	if viewer.Role != domain.RoleAdmin && listUsesField(opts, "email") {
+		c.Error(pkg.ErrPermissionDenied.WithMessage("only admins can filter or sort users by email"))
+		return
+	}
+
+	page, err := h.users.List(c.Request.Context(), opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	resp := make([]dto.UserResponse, 0, len(users))
-	for _, u := range users {
-		resp = append(resp, dto.ToUserResponse(u))
+	c.JSON(http.StatusOK, dto.ToListResponse(page, userResponseFor(viewer)))
+}
+
+// viewer loads the caller, whose role decides what they may see of other
+// accounts.
+func (h *UsersHandler) viewer(c *gin.Context) (domain.User, bool) {
+	u, err := h.users.Get(c.Request.Context(), c.GetInt64("user_id"))
+	if err != nil {
+		c.Error(pkg.Unauthorized("unauthorized"))
+		return domain.User{}, false
 	}
+	return u, true
+}
 
-	c.JSON(http.StatusOK, resp)
+// userResponseFor renders accounts for viewer. Email addresses are only
+// shown to admins and to the account's owner.
+func userResponseFor(viewer domain.User) func(domain.User) dto.UserResponse {
+	return func(u domain.User) dto.UserResponse {
+		resp := dto.ToUserResponse(u)
+		if viewer.Role != domain.RoleAdmin && viewer.ID != u.ID {
+			resp.Email = ""
+		}
+		return resp
+	}
+}
+
+func listUsesField(opts domain.ListOptions, field string) bool {
+	if opts.Sort == field {
+		return true
+	}
+	for _, f := range opts.Filters {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *UsersHandler) Update(c *gin.Context) {
 	id, err := parseIDParam(c, "id")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		c.Error(pkg.Invalid("invalid id"))
 		return
 	}
 
 	var req dto.UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err).SetType(gin.ErrorTypeBind)
 		return
 	}
-	if req.Username == nil && req.Password == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+
+	before, u, err := h.users.Update(c.Request.Context(), id, services.UserUpdate{
+		Username: req.Username,
+		Password: req.Password,
+		Match:    ifMatch(c),
+	})
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
-	username := ""
-	if req.Username != nil {
-		if *req.Username == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "username is required"})
-			return
-		}
-		username = *req.Username
+	event := domain.AuditEvent{Changes: domain.DiffFields(before, u)}
+	if req.Password != nil {
+		// The hash is hidden from the diff; note that it changed.
+		event.Detail = "password changed"
 	}
+	recordUserEvent(c, h.audit, domain.AuditUserUpdated, u.ID, event)
+	etag.Set(c, u.Version)
+	c.JSON(http.StatusOK, dto.ToUserResponse(u))
+}
 
-	var passwordHash []byte
-	if req.Password != nil {
-		if *req.Password == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
-			return
-		}
-		passwordHash, err = bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
-			return
-		}
+// Patch applies a merge patch or JSON patch to the user. The patched
+// representation is validated before anything is written.
+func (h *UsersHandler) Patch(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.Error(pkg.Invalid("invalid id"))
+		return
 	}
 
-	u, err := h.store.Update(c.Request.Context(), id, username, passwordHash)
+	before, err := h.users.Get(c.Request.Context(), id)
 	if err != nil {
-		status := http.StatusBadRequest
-		if err == pkg.ErrUserNotFound {
-			status = http.StatusNotFound
-		} else if err == pkg.ErrUsernameExists {
-			status = http.StatusConflict
-		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		c.Error(err)
+		return
+	}
+	if !etag.Matches(c, before.Version) {
+		c.Error(pkg.ErrVersionMismatch)
 		return
 	}
 
+	var req dto.UserPatch
+	if err := patch.Apply(c, dto.ToUserResponse(before), &req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	update := services.UserUpdate{Match: atVersion(before.Version)}
+	if req.Username != before.Username {
+		update.Username = &req.Username
+	}
+	if req.Email != before.Email {
+		update.Email = &req.Email
+	}
+
+	u := before
+	if update.Username != nil || update.Email != nil {
+		if _, u, err = h.users.Update(c.Request.Context(), id, update); err != nil {
+			c.Error(err)
+			return
+		}
+		recordUserEvent(c, h.audit, domain.AuditUserUpdated, u.ID, domain.AuditEvent{Changes: domain.DiffFields(before, u)})
+	}
+	etag.Set(c, u.Version)
 	c.JSON(http.StatusOK, dto.ToUserResponse(u))
 }
 
 func (h *UsersHandler) Delete(c *gin.Context) {
 	id, err := parseIDParam(c, "id")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		c.Error(pkg.Invalid("invalid id"))
 		return
 	}
 
-	if err := h.store.Delete(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	before, err := h.users.Delete(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
 		return
 	}
 
+	recordUserEvent(c, h.audit, domain.AuditUserDeleted, id, domain.AuditEvent{Changes: domain.DiffFields(before, nil)})
 	c.Status(http.StatusNoContent)
 }
+
+func (h *UsersHandler) ListDeleted(c *gin.Context) {
+	users, err := h.users.ListDeleted(c.Request.Context())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp := make([]dto.UserResponse, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, dto.ToUserResponse(u))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *UsersHandler) Restore(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.Error(pkg.Invalid("invalid id"))
+		return
+	}
+
+	u, err := h.users.Restore(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	recordUserEvent(c, h.audit, domain.AuditUserRestored, u.ID, domain.AuditEvent{})
+	etag.Set(c, u.Version)
+	c.JSON(http.StatusOK, dto.ToUserResponse(u))
+}
+
+// SetRole changes a user's role. Admins cannot change their own role.
+func (h *UsersHandler) SetRole(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.Error(pkg.Invalid("invalid id"))
+		return
+	}
+
+	var req dto.SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	before, u, err := h.users.SetRole(c.Request.Context(), c.GetInt64("user_id"), id, req.Role)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if before.Role != u.Role {
+		recordUserEvent(c, h.audit, domain.AuditUserRoleChanged, u.ID, domain.AuditEvent{Changes: domain.DiffFields(before, u)})
+	}
+	etag.Set(c, u.Version)
+	c.JSON(http.StatusOK, dto.ToUserResponse(u))
+}
+
+// Batch creates, updates and deletes users in one request. See runBatch for
+// how atomic and best-effort batches differ.
+func (h *UsersHandler) Batch(c *gin.Context) {
+	mode, read, err := openBatch[dto.UserBatchOperation](c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	resp, err := runBatch(c, mode, read, h.users, h.users.Transaction, func(ctx context.Context, users *services.UserService, op dto.UserBatchOperation) (dto.BatchResult, func(), error) {
+		return h.applyBatch(c, ctx, users, op)
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	writeBatch(c, resp)
+}
+
+func (h *UsersHandler) applyBatch(c *gin.Context, ctx context.Context, users *services.UserService, op dto.UserBatchOperation) (dto.BatchResult, func(), error) {
+	result := dto.BatchResult{Op: op.Op}
+
+	switch op.Op {
+	case dto.BatchCreate:
+		if op.Username == "" {
+			return result, nil, pkg.InvalidField("username", "required", "username is required")
+		}
+		if op.Password == "" {
+			return result, nil, pkg.InvalidField("password", "required", "password is required")
+		}
+		u, err := users.Create(ctx, services.NewUser{Username: op.Username, Email: op.Email, Password: op.Password})
+		if err != nil {
+			return result, nil, err
+		}
+		result.Status, result.Resource = http.StatusCreated, dto.ToUserResponse(u)
+		return result, func() {
+			recordUserEvent(c, h.audit, domain.AuditUserCreated, u.ID, domain.AuditEvent{Changes: domain.DiffFields(nil, u)})
+		}, nil
+
+	case dto.BatchUpdate:
+		if op.ID <= 0 {
+			return result, nil, pkg.InvalidField("id", "required", "id is required")
+		}
+		before, u, err := users.Update(ctx, op.ID, services.UserUpdate{
+			Username: nonEmpty(op.Username),
+			Password: nonEmpty(op.Password),
+			Match:    atVersion(op.Version),
+		})
+		if err != nil {
+			return result, nil, err
+		}
+		result.Status, result.Resource = http.StatusOK, dto.ToUserResponse(u)
+		return result, func() {
+			event := domain.AuditEvent{Changes: domain.DiffFields(before, u)}
+			if op.Password != "" {
+				event.Detail = "password changed"
+			}
+			recordUserEvent(c, h.audit, domain.AuditUserUpdated, u.ID, event)
+		}, nil
+
+	default:
+		if op.ID <= 0 {
+			return result, nil, pkg.InvalidField("id", "required", "id is required")
+		}
+		before, err := users.Delete(ctx, op.ID)
+		if err != nil {
+			return result, nil, err
+		}
+		result.Status = http.StatusNoContent
+		return result, func() {
+			recordUserEvent(c, h.audit, domain.AuditUserDeleted, op.ID, domain.AuditEvent{Changes: domain.DiffFields(before, nil)})
+		}, nil
+	}
+}
+
+var userExportColumns = []exportColumn[domain.User]{
+	{"id", func(u domain.User) string { return strconv.FormatInt(u.ID, 10) }},
+	{"username", func(u domain.User) string { return u.Username }},
+	{"email", func(u domain.User) string { return u.Email }},
+	{"role", func(u domain.User) string { return u.Role }},
+	{"version", func(u domain.User) string { return strconv.FormatInt(u.Version, 10) }},
+	{"created_at", func(u domain.User) string { return u.CreatedAt.Format(time.RFC3339) }},
+	{"updated_at", func(u domain.User) string { return u.UpdatedAt.Format(time.RFC3339) }},
+}
+
+// Export streams every user as CSV or NDJSON.
+func (h *UsersHandler) Export(c *gin.Context) {
+	writeExport(c, "users", userExportColumns, func(u domain.User) any { return dto.ToUserResponse(u) }, h.users.Each)
+}
+
+func newUser(req dto.CreateUserRequest) services.NewUser {
+	return services.NewUser{Username: req.Username, Email: req.Email, Password: req.Password}
+}
+
+func recordUserEvent(c *gin.Context, store ports.AuditStore, action string, userID int64, event domain.AuditEvent) {
+	event.Action = action
+	event.TargetType = domain.AuditTargetUser
+	event.TargetID = strconv.FormatInt(userID, 10)
+	audit.Record(c, store, event)
+}
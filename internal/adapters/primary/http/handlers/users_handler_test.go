@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+	"github.com/reginaldsourn/go-crud/pkg/password"
+)
+
+func TestUserResponseForHidesEmail(t *testing.T) {
+	account := domain.User{ID: 2, Username: "pat", Email: "pat@example.com"}
+
+	tests := []struct {
+		name   string
+		viewer domain.User
+		want   string
+	}{
+		{"owner", domain.User{ID: 2, Role: domain.RoleUser}, "pat@example.com"},
+		{"admin", domain.User{ID: 1, Role: domain.RoleAdmin}, "pat@example.com"},
+		{"someone else", domain.User{ID: 3, Role: domain.RoleUser}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := userResponseFor(tt.viewer)(account).Email; got != tt.want {
+				t.Errorf("email = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListUsesField(t *testing.T) {
+	tests := []struct {
+		name string
+		opts domain.ListOptions
+		want bool
+	}{
+		{"nothing", domain.ListOptions{}, false},
+		{"sort", domain.ListOptions{Sort: "email"}, true},
+		{"filter", domain.ListOptions{Filters: []domain.ListFilter{{Field: "email", Op: domain.FilterContains, Value: "@"}}}, true},
+		{"other fields", domain.ListOptions{Sort: "username", Filters: []domain.ListFilter{{Field: "role", Op: domain.FilterEquals, Value: "admin"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listUsesField(tt.opts, "email"); got != tt.want {
+				t.Errorf("listUsesField = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// versionedUsers holds one account and applies updates only at its current
+// version. With interleave set, another writer gets in between every read
+// and the next update.
+type versionedUsers struct {
+	ports.UserStore
+	user       domain.User
+	interleave bool
+}
+
+func (s *versionedUsers) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	u := s.user
+	if s.interleave {
+		s.user.Version++
+	}
+	return u, nil
+}
+
+func (s *versionedUsers) Update(ctx context.Context, id int64, changes domain.UserChanges, version int64) (domain.User, error) {
+	if version != s.user.Version {
+		return domain.User{}, pkg.ErrVersionMismatch
+	}
+	if changes.Username != nil {
+		s.user.Username = *changes.Username
+	}
+	s.user.Version++
+	return s.user, nil
+}
+
+func TestUsersConditionalRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &versionedUsers{user: domain.User{ID: 2, Username: "pat", Version: 3, CreatedAt: time.Now()}}
+	h := NewUsersHandler(services.NewUserService(store, fakeHasher{}, password.DefaultPolicy(), false), nil)
+
+	call := func(handler gin.HandlerFunc, method string, header http.Header, body string) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, "/api/v1/users/2", strings.NewReader(body))
+		c.Request.Header = header
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: "2"}}
+		c.Set("user_id", int64(2))
+		handler(c)
+		c.Writer.WriteHeaderNow()
+		if len(c.Errors) > 0 {
+			return w, c.Errors.Last().Err
+		}
+		return w, nil
+	}
+
+	w, _ := call(h.Get, http.MethodGet, http.Header{}, "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+		t.Fatalf("GET: status %d ETag %s, want 200 \"3\"", w.Code, w.Header().Get("ETag"))
+	}
+	w, _ = call(h.Get, http.MethodGet, http.Header{"If-None-Match": {`"3"`}}, "")
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("GET If-None-Match current: status %d body %q, want an empty 304", w.Code, w.Body)
+	}
+	if w, _ = call(h.Get, http.MethodGet, http.Header{"If-None-Match": {`"2"`}}, ""); w.Code != http.StatusOK {
+		t.Errorf("GET If-None-Match stale: status %d, want 200", w.Code)
+	}
+
+	if _, err := call(h.Update, http.MethodPut, http.Header{"If-Match": {`"2"`}}, `{"username":"sam"}`); !errors.Is(err, pkg.ErrVersionMismatch) {
+		t.Errorf("PUT If-Match stale: err = %v, want %v", err, pkg.ErrVersionMismatch)
+	}
+	if store.user.Username != "pat" {
+		t.Fatalf("stale update was written: %+v", store.user)
+	}
+
+	w, err := call(h.Update, http.MethodPut, http.Header{"If-Match": {`"3"`}}, `{"username":"sam"}`)
+	if err != nil || w.Header().Get("ETag") != `"4"` || store.user.Username != "sam" {
+		t.Fatalf("PUT If-Match current: err = %v ETag %s user %+v", err, w.Header().Get("ETag"), store.user)
+	}
+
+	// Without If-Match the update still only lands on the version it read.
+	store.interleave = true
+	if _, err := call(h.Update, http.MethodPut, http.Header{}, `{"username":"lee"}`); !errors.Is(err, pkg.ErrVersionMismatch) {
+		t.Errorf("PUT racing another writer: err = %v, want %v", err, pkg.ErrVersionMismatch)
+	}
+	if store.user.Username != "sam" {
+		t.Errorf("racing update overwrote the other write: %+v", store.user)
+	}
+}
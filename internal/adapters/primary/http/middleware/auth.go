@@ -1,36 +1,235 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
-	"github.com/reginaldsourn/go-crud/internal/adapters/auth"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/audit"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/pkg/auth"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
 )
 
-// AuthMiddleware validates JWT and stores the username in the request context.
-func AuthMiddleware(secret []byte) gin.HandlerFunc {
+const (
+	AuthMethodToken  = "token"
+	AuthMethodAPIKey = "api_key"
+
+	// touchInterval limits last-used writes to one per API key or session
+	// per interval.
+	touchInterval = time.Minute
+)
+
+type AuthOptions struct {
+	Verifier ports.TokenVerifier
+	// Users, when set, is consulted to reject tokens issued before the
+	// account's sessions were revoked. API keys require it.
+	Users ports.UserStore
+	// APIKeys enables the "Authorization: ApiKey ..." scheme when set.
+	APIKeys ports.APIKeyStore
+	// Sessions, when set, rejects tokens whose session was revoked or has
+	// expired.
+	Sessions ports.SessionStore
+	// Audit records every request made with an impersonation token.
+	Audit ports.AuditStore
+}
+
+// AuthMiddleware validates a bearer token or API key and stores the user ID,
+// username and auth method in the request context. API key requests also get
+// their scopes, and unsafe methods require the write scope. Impersonation
+// tokens additionally set actor_id and actor_username to the admin behind
+// them, and every such request is audited.
+func AuthMiddleware(opts AuthOptions) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing Authorization header"})
+			abort(c, pkg.ErrMissingCredentials)
 			return
 		}
 
 		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid Authorization header"})
+		if len(parts) != 2 {
+			abort(c, pkg.Unauthorized("invalid Authorization header"))
 			return
 		}
 
-		claims, err := auth.ParseToken(parts[1], secret)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		switch {
+		case strings.EqualFold(parts[0], "Bearer"):
+			authenticateToken(c, opts, parts[1])
+		case strings.EqualFold(parts[0], "ApiKey") && opts.APIKeys != nil && opts.Users != nil:
+			authenticateAPIKey(c, opts, parts[1])
+		default:
+			abort(c, pkg.Unauthorized("invalid Authorization header"))
+			return
+		}
+		if c.IsAborted() {
 			return
 		}
 
-		c.Set("username", claims.Sub)
 		c.Next()
+
+		if c.GetInt64("actor_id") != 0 {
+			audit.Record(c, opts.Audit, domain.AuditEvent{
+				Action:     domain.AuditImpersonatedRequest,
+				TargetType: domain.AuditTargetUser,
+				TargetID:   strconv.FormatInt(c.GetInt64("user_id"), 10),
+				Detail:     fmt.Sprintf("%s %s %d", c.Request.Method, c.Request.URL.Path, responseStatus(c)),
+			})
+		}
+	}
+}
+
+func authenticateToken(c *gin.Context, opts AuthOptions, token string) {
+	claims, err := opts.Verifier.Verify(token)
+	if err != nil || claims.Purpose != "" {
+		abort(c, pkg.ErrInvalidToken)
+		return
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		abort(c, pkg.ErrInvalidToken)
+		return
+	}
+
+	username := claims.Username
+	if opts.Users != nil {
+		u, err := opts.Users.GetByID(c.Request.Context(), userID)
+		if err != nil {
+			abort(c, pkg.ErrInvalidToken)
+			return
+		}
+		if tokenRevoked(c, opts, claims, u.TokensNotBefore) {
+			abort(c, pkg.ErrTokenRevoked)
+			return
+		}
+		username = u.Username
+	}
+
+	if claims.Actor != nil {
+		if !authenticateActor(c, opts, *claims.Actor, claims) {
+			abort(c, pkg.ErrInvalidToken)
+			return
+		}
+	}
+
+	if opts.Sessions != nil && claims.SessionID != "" {
+		session, err := opts.Sessions.Get(c.Request.Context(), claims.SessionID)
+		now := time.Now()
+		if err != nil || session.UserID != userID || session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+			abort(c, pkg.ErrSessionRevoked)
+			return
+		}
+		if now.Sub(session.LastUsedAt) >= touchInterval {
+			// Failing to record usage should not fail the request.
+			_ = opts.Sessions.Touch(c.Request.Context(), session.ID, now)
+		}
+		c.Set("session_id", session.ID)
+	}
+
+	c.Set("user_id", userID)
+	c.Set("username", username)
+	c.Set("auth_method", AuthMethodToken)
+}
+
+// tokenRevoked reports whether revoking the account's tokens at notBefore
+// covers claims. Issue times have whole-second precision, so a token from
+// the second of the revocation counts as revoked unless it belongs to a
+// session created afterwards, such as the one a password change signs the
+// caller back in with.
+func tokenRevoked(c *gin.Context, opts AuthOptions, claims auth.Claims, notBefore *time.Time) bool {
+	if notBefore == nil || claims.IssuedAt.After(*notBefore) {
+		return false
+	}
+	if opts.Sessions == nil || claims.SessionID == "" || claims.IssuedAt.Before(notBefore.Truncate(time.Second)) {
+		return true
+	}
+	session, err := opts.Sessions.Get(c.Request.Context(), claims.SessionID)
+	return err != nil || !session.CreatedAt.After(*notBefore)
+}
+
+// authenticateActor checks the admin behind an impersonation token. The
+// token stops working as soon as the admin loses the role or revokes their
+// own tokens.
+func authenticateActor(c *gin.Context, opts AuthOptions, actor auth.Actor, claims auth.Claims) bool {
+	actorID, err := actor.UserID()
+	if err != nil || actorID == 0 {
+		return false
+	}
+
+	actorUsername := actor.Username
+	if opts.Users != nil {
+		a, err := opts.Users.GetByID(c.Request.Context(), actorID)
+		if err != nil || a.Role != domain.RoleAdmin || a.ClosedAt != nil {
+			return false
+		}
+		if a.TokensNotBefore != nil && !claims.IssuedAt.After(*a.TokensNotBefore) {
+			return false
+		}
+		actorUsername = a.Username
+	}
+
+	c.Set("actor_id", actorID)
+	c.Set("actor_username", actorUsername)
+	return true
+}
+
+func authenticateAPIKey(c *gin.Context, opts AuthOptions, presented string) {
+	ctx := c.Request.Context()
+
+	prefix, ok := auth.ParseAPIKeyPrefix(presented)
+	if !ok {
+		abort(c, pkg.ErrInvalidAPIKey)
+		return
+	}
+	key, err := opts.APIKeys.FindByPrefix(ctx, prefix)
+	if err != nil || !auth.CheckAPIKey(presented, key.KeyHash) {
+		abort(c, pkg.ErrInvalidAPIKey)
+		return
+	}
+
+	now := time.Now()
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		abort(c, pkg.ErrAPIKeyExpired)
+		return
+	}
+
+	u, err := opts.Users.GetByID(ctx, key.UserID)
+	if err != nil || u.ClosedAt != nil {
+		abort(c, pkg.ErrInvalidAPIKey)
+		return
+	}
+
+	if !isSafeMethod(c.Request.Method) && !key.HasScope(domain.ScopeWrite) {
+		abort(c, pkg.ErrInsufficientScope.WithMessage("api key lacks the write scope"))
+		return
+	}
+	if isSafeMethod(c.Request.Method) && !key.HasScope(domain.ScopeRead) && !key.HasScope(domain.ScopeWrite) {
+		abort(c, pkg.ErrInsufficientScope.WithMessage("api key lacks the read scope"))
+		return
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		// Failing to record usage should not fail the request.
+		_ = opts.APIKeys.Touch(ctx, key.ID, now)
+	}
+
+	c.Set("user_id", u.ID)
+	c.Set("username", u.Username)
+	c.Set("auth_method", AuthMethodAPIKey)
+	c.Set("api_key_id", key.ID)
+	c.Set("scopes", key.ScopeList())
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
 	}
 }
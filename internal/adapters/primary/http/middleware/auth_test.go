@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/golang-jwt/jwt/v4"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/pkg/auth"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// claimsVerifier accepts the tokens it was given claims for.
+type claimsVerifier map[string]auth.Claims
+
+func (v claimsVerifier) Verify(token string) (auth.Claims, error) {
+	claims, ok := v[token]
+	if !ok {
+		return auth.Claims{}, auth.ErrInvalidToken
+	}
+	return claims, nil
+}
+
+type authUsers struct {
+	ports.UserStore
+	users map[int64]domain.User
+}
+
+func (s authUsers) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	u, ok := s.users[id]
+	if !ok {
+		return domain.User{}, pkg.ErrUserNotFound
+	}
+	return u, nil
+}
+
+type authSessions struct {
+	ports.SessionStore
+	sessions map[string]domain.Session
+}
+
+func (s authSessions) Get(ctx context.Context, id string) (domain.Session, error) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return domain.Session{}, pkg.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s authSessions) Touch(ctx context.Context, id string, at time.Time) error { return nil }
+
+func authRouter(opts AuthOptions) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Problems())
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt64("user_id")})
+	}
+	r.GET("/me", AuthMiddleware(opts), handler)
+	r.POST("/me", AuthMiddleware(opts), handler)
+	return r
+}
+
+func TestAuthRejectsRevokedTokens(t *testing.T) {
+	revokedAt := time.Date(2026, 3, 1, 12, 0, 0, int(500*time.Millisecond), time.UTC)
+	issued := func(at time.Time, sessionID string) auth.Claims {
+		return auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "1", IssuedAt: jwt.NewNumericDate(at)},
+			SessionID:        sessionID,
+		}
+	}
+	live := func(createdAt time.Time) domain.Session {
+		now := time.Now()
+		return domain.Session{UserID: 1, CreatedAt: createdAt, LastUsedAt: now, ExpiresAt: now.Add(time.Hour)}
+	}
+
+	opts := AuthOptions{
+		Verifier: claimsVerifier{
+			"earlier second":      issued(revokedAt.Add(-time.Second), ""),
+			"same second":         issued(revokedAt, ""),
+			"old session":         issued(revokedAt, "s-old"),
+			"new session":         issued(revokedAt, "s-new"),
+			"next second":         issued(revokedAt.Add(time.Second), ""),
+			"earlier new session": issued(revokedAt.Add(-time.Second), "s-new"),
+		},
+		Users: authUsers{users: map[int64]domain.User{1: {ID: 1, Username: "pat", TokensNotBefore: &revokedAt}}},
+		Sessions: authSessions{sessions: map[string]domain.Session{
+			"s-old": live(revokedAt.Add(-100 * time.Millisecond)),
+			"s-new": live(revokedAt.Add(100 * time.Millisecond)),
+		}},
+	}
+	r := authRouter(opts)
+
+	tests := []struct {
+		token string
+		want  int
+	}{
+		{"earlier second", http.StatusUnauthorized},
+		// Tokens carry whole seconds, so this one may predate the revocation.
+		{"same second", http.StatusUnauthorized},
+		{"old session", http.StatusUnauthorized},
+		// A session created after the revocation proves the token did too.
+		{"new session", http.StatusOK},
+		{"next second", http.StatusOK},
+		{"earlier new session", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.token, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+type authKeys struct {
+	ports.APIKeyStore
+	keys    []domain.APIKey
+	touched []int64
+}
+
+func (s *authKeys) FindByPrefix(ctx context.Context, prefix string) (domain.APIKey, error) {
+	for _, k := range s.keys {
+		if k.Prefix == prefix {
+			return k, nil
+		}
+	}
+	return domain.APIKey{}, pkg.ErrAPIKeyNotFound
+}
+
+func (s *authKeys) Touch(ctx context.Context, id int64, at time.Time) error {
+	s.touched = append(s.touched, id)
+	return nil
+}
+
+func TestAuthAPIKeys(t *testing.T) {
+	keys := &authKeys{}
+	// newKey stores a key for userID and returns the secret to present.
+	newKey := func(userID int64, scopes string, expiresAt *time.Time) string {
+		t.Helper()
+		secret, prefix, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("GenerateAPIKey: %v", err)
+		}
+		keys.keys = append(keys.keys, domain.APIKey{
+			ID: int64(len(keys.keys) + 1), UserID: userID, Prefix: prefix, Scopes: scopes, KeyHash: hash, ExpiresAt: expiresAt,
+		})
+		return secret
+	}
+	closedAt := time.Now().Add(-time.Hour)
+	expired := time.Now().Add(-time.Minute)
+
+	readKey := newKey(1, domain.ScopeRead, nil)
+	writeKey := newKey(1, domain.ScopeWrite, nil)
+	expiredKey := newKey(1, domain.ScopeRead, &expired)
+	closedKey := newKey(2, domain.ScopeRead, nil)
+
+	r := authRouter(AuthOptions{
+		Verifier: claimsVerifier{},
+		APIKeys:  keys,
+		Users: authUsers{users: map[int64]domain.User{
+			1: {ID: 1, Username: "pat"},
+			2: {ID: 2, Username: "sam", ClosedAt: &closedAt},
+		}},
+	})
+	call := func(method, authorization string) (int, dto.Problem) {
+		req := httptest.NewRequest(method, "/me", nil)
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var problem dto.Problem
+		if w.Code != http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("%s %s: decode problem %s: %v", method, authorization, w.Body, err)
+			}
+		}
+		return w.Code, problem
+	}
+
+	if status, _ := call(http.MethodGet, "ApiKey "+readKey); status != http.StatusOK {
+		t.Errorf("read key GET: status = %d, want 200", status)
+	}
+	if status, _ := call(http.MethodGet, "apikey "+readKey); status != http.StatusOK {
+		t.Errorf("scheme is case-insensitive: status = %d, want 200", status)
+	}
+	if status, problem := call(http.MethodPost, "ApiKey "+readKey); status != http.StatusForbidden || problem.Code != "insufficient_scope" {
+		t.Errorf("read key POST: %d %q, want 403 insufficient_scope", status, problem.Code)
+	}
+	// write implies read.
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		if status, _ := call(method, "ApiKey "+writeKey); status != http.StatusOK {
+			t.Errorf("write key %s: status = %d, want 200", method, status)
+		}
+	}
+	if status, problem := call(http.MethodGet, "ApiKey "+expiredKey); status != http.StatusUnauthorized || problem.Code != "api_key_expired" {
+		t.Errorf("expired key: %d %q, want 401 api_key_expired", status, problem.Code)
+	}
+	if status, problem := call(http.MethodGet, "ApiKey "+closedKey); status != http.StatusUnauthorized || problem.Code != "invalid_api_key" {
+		t.Errorf("closed account: %d %q, want 401 invalid_api_key", status, problem.Code)
+	}
+
+	// A known prefix with the wrong secret must not match; secrets are hex.
+	tampered := readKey[:len(readKey)-1] + "x"
+	if status, problem := call(http.MethodGet, "ApiKey "+tampered); status != http.StatusUnauthorized || problem.Code != "invalid_api_key" {
+		t.Errorf("wrong secret: %d %q, want 401 invalid_api_key", status, problem.Code)
+	}
+	if status, problem := call(http.MethodGet, "ApiKey not-a-key"); status != http.StatusUnauthorized || problem.Code != "invalid_api_key" {
+		t.Errorf("malformed key: %d %q, want 401 invalid_api_key", status, problem.Code)
+	}
+
+	if len(keys.touched) == 0 || keys.touched[0] != 1 {
+		t.Errorf("touched = %v, want the read key recorded as used", keys.touched)
+	}
+}
+
+func TestAuthImpersonationFollowsTheAdmin(t *testing.T) {
+	issuedAt := time.Now().Add(-time.Minute)
+	revokedAt := time.Now()
+	acting := func(actorID string) auth.Claims {
+		return auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "2", IssuedAt: jwt.NewNumericDate(issuedAt)},
+			Actor:            &auth.Actor{Subject: actorID},
+		}
+	}
+	r := authRouter(AuthOptions{
+		Verifier: claimsVerifier{
+			"admin":     acting("1"),
+			"demoted":   acting("3"),
+			"revoked":   acting("4"),
+			"not an id": acting("root"),
+		},
+		Users: authUsers{users: map[int64]domain.User{
+			1: {ID: 1, Username: "root", Role: domain.RoleAdmin},
+			2: {ID: 2, Username: "pat", Role: domain.RoleUser},
+			3: {ID: 3, Username: "ex-admin", Role: domain.RoleUser},
+			4: {ID: 4, Username: "ops", Role: domain.RoleAdmin, TokensNotBefore: &revokedAt},
+		}},
+	})
+
+	for token, want := range map[string]int{
+		"admin":     http.StatusOK,
+		"demoted":   http.StatusUnauthorized,
+		"revoked":   http.StatusUnauthorized,
+		"not an id": http.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: status = %d, want %d: %s", token, w.Code, want, w.Body)
+		}
+	}
+}
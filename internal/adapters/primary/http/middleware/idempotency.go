@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestSize  = 1 << 20
+	maxIdempotentResponseSize = 1 << 20
+)
+
+// Idempotency makes a POST safe to retry when the client sends an
+// Idempotency-Key. The first successful response is stored for ttl under
+// the key and the caller's user ID and replayed for later requests with the
+// same key. Reusing a key for a different request is rejected. Failed
+// requests are not stored, so the client can correct and retry them under
+// the same key. Requests without the header pass through untouched.
+//
+// Anonymous requests, such as registrations, share one scope and are told
+// apart by the key alone. A replay still needs the same route and body, so
+// it only answers a caller who already sent everything the first request
+// did.
+//
+// Requests are compared by an HMAC of the body keyed with secret, so stored
+// records do not reveal what was sent, such as a new account's password.
+func Idempotency(store ports.IdempotencyStore, ttl time.Duration, secret []byte) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		userID := c.GetInt64("user_id")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey(key) {
+			abort(c, pkg.ErrInvalidIdempotencyKey)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentRequestSize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abort(c, pkg.ErrRequestTooLarge)
+				return
+			}
+			abort(c, pkg.Invalid("failed to read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		rec := domain.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash(c, secret, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+		existing, reserved, err := store.Reserve(c.Request.Context(), rec)
+		if err != nil {
+			abort(c, err)
+			return
+		}
+		if !reserved {
+			replay(c, rec, existing)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// The request context may be cancelled by now; the outcome must
+		// still be recorded or the key stays locked until it expires.
+		ctx := context.WithoutCancel(c.Request.Context())
+		status := responseStatus(c)
+		if status < 200 || status >= 300 || recorder.overflow {
+			if err := store.Release(ctx, rec.UserID, rec.Key); err != nil {
+				log.Printf("idempotency key release failed: %v", err)
+			}
+			return
+		}
+
+		rec.Status = status
+		rec.ContentType = recorder.Header().Get("Content-Type")
+		rec.ETag = recorder.Header().Get("ETag")
+		rec.Body = recorder.body.Bytes()
+		if err := store.Complete(ctx, rec); err != nil {
+			log.Printf("idempotency record store failed: %v", err)
+		}
+	}
+}
+
+func replay(c *gin.Context, rec, existing domain.IdempotencyRecord) {
+	switch {
+	case existing.RequestHash != rec.RequestHash:
+		abort(c, pkg.ErrIdempotencyKeyReused)
+	case !existing.Completed():
+		abort(c, pkg.ErrIdempotencyInProgress)
+	default:
+		if existing.ContentType != "" {
+			c.Header("Content-Type", existing.ContentType)
+		}
+		if existing.ETag != "" {
+			c.Header("ETag", existing.ETag)
+		}
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Status(existing.Status)
+		if _, err := c.Writer.Write(existing.Body); err != nil {
+			log.Printf("idempotent replay failed: %v", err)
+		}
+		c.Abort()
+	}
+}
+
+// requestHash identifies a request by route and body, so a key reused for a
+// different endpoint or payload is caught.
+func requestHash(c *gin.Context, secret, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	io.WriteString(h, c.Request.Method+" "+c.FullPath()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// responseRecorder keeps a copy of the response body for replay. Responses
+// too large to store are passed through but not recorded.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseRecorder) record(b []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(b) > maxIdempotentResponseSize {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(b)
+}
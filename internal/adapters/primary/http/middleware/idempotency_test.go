@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/secondary/memory"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+// idempotencyRouter serves POST /things behind Idempotency. The caller's
+// user ID comes from the X-User header and every create that reaches the
+// handler is counted.
+func idempotencyRouter(store *memory.IdempotencyStore, ttl time.Duration, secret string) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+	created := 0
+	r := gin.New()
+	r.Use(Problems())
+	r.Use(func(c *gin.Context) {
+		if id, err := strconv.ParseInt(c.GetHeader("X-User"), 10, 64); err == nil {
+			c.Set("user_id", id)
+		}
+	})
+	r.POST("/things", Idempotency(store, ttl, []byte(secret)), func(c *gin.Context) {
+		if c.Query("fail") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nope"})
+			return
+		}
+		created++
+		c.Header("ETag", `"1"`)
+		c.JSON(http.StatusCreated, gin.H{"id": created})
+	})
+	return r, &created
+}
+
+type idempotentRequest struct {
+	user, key, body, query string
+}
+
+func (req idempotentRequest) do(r http.Handler) *httptest.ResponseRecorder {
+	httpReq := httptest.NewRequest(http.MethodPost, "/things"+req.query, strings.NewReader(req.body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	if req.user != "" {
+		httpReq.Header.Set("X-User", req.user)
+	}
+	if req.key != "" {
+		httpReq.Header.Set(IdempotencyKeyHeader, req.key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httpReq)
+	return w
+}
+
+func TestIdempotency(t *testing.T) {
+	first := idempotentRequest{user: "1", key: "k1", body: `{"name":"a"}`}
+
+	tests := []struct {
+		name        string
+		before      []idempotentRequest
+		req         idempotentRequest
+		wantStatus  int
+		wantReplay  bool
+		wantCreated int
+	}{
+		{
+			name:        "first request",
+			req:         first,
+			wantStatus:  http.StatusCreated,
+			wantCreated: 1,
+		},
+		{
+			name:        "replay",
+			before:      []idempotentRequest{first},
+			req:         first,
+			wantStatus:  http.StatusCreated,
+			wantReplay:  true,
+			wantCreated: 1,
+		},
+		{
+			name:        "body mismatch",
+			before:      []idempotentRequest{first},
+			req:         idempotentRequest{user: "1", key: "k1", body: `{"name":"b"}`},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCreated: 1,
+		},
+		{
+			name:        "same key from another user",
+			before:      []idempotentRequest{first},
+			req:         idempotentRequest{user: "2", key: "k1", body: `{"name":"a"}`},
+			wantStatus:  http.StatusCreated,
+			wantCreated: 2,
+		},
+		{
+			name:        "anonymous requests are replayed by key",
+			before:      []idempotentRequest{{key: "k1", body: `{"name":"a"}`}},
+			req:         idempotentRequest{key: "k1", body: `{"name":"a"}`},
+			wantStatus:  http.StatusCreated,
+			wantReplay:  true,
+			wantCreated: 1,
+		},
+		{
+			name:        "anonymous key reused for another body",
+			before:      []idempotentRequest{{key: "k1", body: `{"name":"a"}`}},
+			req:         idempotentRequest{key: "k1", body: `{"name":"b"}`},
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCreated: 1,
+		},
+		{
+			name:        "anonymous and user keys are separate",
+			before:      []idempotentRequest{{key: "k1", body: `{"name":"a"}`}},
+			req:         first,
+			wantStatus:  http.StatusCreated,
+			wantCreated: 2,
+		},
+		{
+			name:        "failed request releases the key",
+			before:      []idempotentRequest{{user: "1", key: "k1", body: `{"name":"a"}`, query: "?fail=1"}},
+			req:         first,
+			wantStatus:  http.StatusCreated,
+			wantCreated: 1,
+		},
+		{
+			name:        "invalid key",
+			req:         idempotentRequest{user: "1", key: "has space", body: `{}`},
+			wantStatus:  http.StatusBadRequest,
+			wantCreated: 0,
+		},
+		{
+			name:        "body too large",
+			req:         idempotentRequest{user: "1", key: "k1", body: `"` + strings.Repeat("x", maxIdempotentRequestSize) + `"`},
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCreated: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, created := idempotencyRouter(memory.NewIdempotencyStore(), time.Hour, "secret")
+			for _, req := range tt.before {
+				req.do(r)
+			}
+
+			w := tt.req.do(r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get(IdempotentReplayedHeader) == "true"; got != tt.wantReplay {
+				t.Errorf("replayed = %v, want %v", got, tt.wantReplay)
+			}
+			if *created != tt.wantCreated {
+				t.Errorf("handler ran %d times, want %d", *created, tt.wantCreated)
+			}
+			if tt.wantReplay {
+				if got := w.Header().Get("ETag"); got != `"1"` {
+					t.Errorf("replayed ETag = %q", got)
+				}
+				if got := w.Body.String(); got != `{"id":1}` {
+					t.Errorf("replayed body = %s", got)
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyExpiry(t *testing.T) {
+	r, created := idempotencyRouter(memory.NewIdempotencyStore(), time.Millisecond, "secret")
+	req := idempotentRequest{user: "1", key: "k1", body: `{"name":"a"}`}
+
+	req.do(r)
+	time.Sleep(5 * time.Millisecond)
+	w := req.do(r)
+
+	if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Fatalf("status = %d replayed = %q, want a fresh 201", w.Code, w.Header().Get(IdempotentReplayedHeader))
+	}
+	if *created != 2 {
+		t.Errorf("handler ran %d times, want 2", *created)
+	}
+}
+
+func TestIdempotencyHashIsKeyed(t *testing.T) {
+	store := memory.NewIdempotencyStore()
+	rec := domain.IdempotencyRecord{UserID: 1, Key: "k1"}
+	body := `{"password":"Passw0rd!x"}`
+
+	hashWith := func(secret string) string {
+		r, _ := idempotencyRouter(store, time.Hour, secret)
+		store.Release(context.Background(), rec.UserID, rec.Key)
+		idempotentRequest{user: "1", key: "k1", body: body}.do(r)
+		existing, _, _ := store.Reserve(context.Background(), domain.IdempotencyRecord{UserID: 1, Key: "k1", CreatedAt: time.Now()})
+		return existing.RequestHash
+	}
+
+	a, b := hashWith("secret-a"), hashWith("secret-b")
+	if a == "" || a == b {
+		t.Errorf("request hashes %q and %q should differ between secrets", a, b)
+	}
+	if strings.Contains(a, "Passw0rd") {
+		t.Errorf("request hash contains the body: %q", a)
+	}
+}
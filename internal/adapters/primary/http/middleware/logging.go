@@ -24,6 +24,10 @@ func Logging() gin.HandlerFunc {
 		clientIP := c.ClientIP()
 		method := c.Request.Method
 
+		if requestID := c.GetString("request_id"); requestID != "" {
+			log.Printf("%s %s %d %s %s request_id=%s", method, path, status, latency, clientIP, requestID)
+			return
+		}
 		log.Printf("%s %s %d %s %s", method, path, status, latency, clientIP)
 	}
 }
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:problem-type:"
+)
+
+var jsonFieldNames sync.Once
+
+// Problems renders the last error a handler attached with c.Error as an
+// application/problem+json response, unless the handler already wrote one.
+// Errors tagged gin.ErrorTypeBind are request decoding failures and become
+// 400s with per-field details. Errors that are not *pkg.Error are logged and
+// reported as a bare 500 so internals do not leak.
+func Problems() gin.HandlerFunc {
+	jsonFieldNames.Do(useJSONFieldNames)
+
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		problem := problemFor(c, c.Errors.Last())
+		c.Header("Content-Type", ProblemContentType)
+		c.Status(problem.Status)
+		if err := json.NewEncoder(c.Writer).Encode(problem); err != nil {
+			log.Printf("write problem failed: %v", err)
+		}
+	}
+}
+
+// responseStatus is the status the request ends with, including a problem
+// that Problems has yet to render.
+func responseStatus(c *gin.Context) int {
+	if !c.Writer.Written() && len(c.Errors) > 0 {
+		return problemError(c.Errors.Last()).Status
+	}
+	return c.Writer.Status()
+}
+
+// abort stops the handler chain with err.
+func abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+func problemFor(c *gin.Context, ginErr *gin.Error) dto.Problem {
+	e := problemError(ginErr)
+	if e.Code == pkg.CodeInternal && !errors.As(ginErr.Err, new(*pkg.Error)) {
+		log.Printf("%s %s failed: %v request_id=%s", c.Request.Method, c.Request.URL.Path, ginErr.Err, c.GetString("request_id"))
+	}
+
+	return dto.Problem{
+		Type:      problemTypePrefix + e.Code,
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Message,
+		Instance:  c.Request.URL.Path,
+		Code:      e.Code,
+		RequestID: c.GetString("request_id"),
+		Errors:    e.Fields,
+	}
+}
+
+// ProblemError converts err to the error a problem response would report.
+// bind marks request decoding and validation failures, as
+// gin.ErrorTypeBind does for errors attached to the context.
+func ProblemError(err error, bind bool) *pkg.Error {
+	ginErr := &gin.Error{Err: err, Type: gin.ErrorTypePrivate}
+	if bind {
+		ginErr.Type = gin.ErrorTypeBind
+	}
+	return problemError(ginErr)
+}
+
+func problemError(ginErr *gin.Error) *pkg.Error {
+	err := ginErr.Err
+	if ginErr.IsType(gin.ErrorTypeBind) {
+		return bindError(err)
+	}
+
+	var e *pkg.Error
+	if !errors.As(err, &e) {
+		return pkg.Internal("internal server error")
+	}
+	if e != err {
+		// Wrapping adds context to the message, such as which field of
+		// the list options was rejected.
+		return e.WithMessage(err.Error())
+	}
+	return e
+}
+
+// bindError turns a request decoding failure into a validation problem.
+func bindError(err error) *pkg.Error {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var e *pkg.Error
+
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.As(err, &validationErrs):
+		fields := make([]pkg.FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, pkg.FieldError{
+				Field:   fe.Field(),
+				Code:    fe.Tag(),
+				Message: fieldMessage(fe),
+			})
+		}
+		return pkg.Validation(fields...)
+	case errors.As(err, &typeErr):
+		return pkg.Validation(pkg.FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type.Kind()),
+		})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return pkg.Invalid("request body is not valid JSON")
+	case errors.Is(err, io.EOF):
+		return pkg.Invalid("request body is required")
+	default:
+		return pkg.Invalid(err.Error())
+	}
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fe.Field() + " is required"
+	case "email":
+		return fe.Field() + " must be an email address"
+	case "min", "max", "len":
+		return fmt.Sprintf("%s fails the %s=%s limit", fe.Field(), fe.Tag(), fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", fe.Field(), fe.Param())
+	default:
+		return fmt.Sprintf("%s fails the %s check", fe.Field(), fe.Tag())
+	}
+}
+
+// useJSONFieldNames makes validation errors name fields as they appear in
+// request bodies rather than by their Go names.
+func useJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			name, _, _ = strings.Cut(field.Tag.Get("form"), ",")
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+}
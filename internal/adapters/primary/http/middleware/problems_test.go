@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type problemRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Age   int    `json:"age" binding:"min=0"`
+}
+
+// serveProblem runs handler behind Problems and decodes the problem it wrote.
+func serveProblem(t *testing.T, handler gin.HandlerFunc, body string) (*httptest.ResponseRecorder, dto.Problem) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("request_id", "req-7") }, Problems())
+	r.POST("/api/v1/things", handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/things?x=1", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var problem dto.Problem
+	if w.Header().Get("Content-Type") == ProblemContentType {
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("decode %s: %v", w.Body, err)
+		}
+	}
+	return w, problem
+}
+
+func bindProblemRequest(c *gin.Context) {
+	var req problemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func TestProblemsRendersDomainErrors(t *testing.T) {
+	w, problem := serveProblem(t, func(c *gin.Context) { c.Error(pkg.ErrUserNotFound) }, "")
+
+	want := dto.Problem{
+		Type:      "urn:problem-type:user_not_found",
+		Title:     "Not Found",
+		Status:    http.StatusNotFound,
+		Detail:    "user not found",
+		Instance:  "/api/v1/things",
+		Code:      "user_not_found",
+		RequestID: "req-7",
+	}
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !reflect.DeepEqual(problem, want) {
+		t.Errorf("problem = %+v, want %+v", problem, want)
+	}
+}
+
+func TestProblemsKeepsWrappedContext(t *testing.T) {
+	_, problem := serveProblem(t, func(c *gin.Context) {
+		c.Error(fmt.Errorf("sort: %w", pkg.Invalid("unknown field")))
+	}, "")
+	if problem.Status != http.StatusBadRequest || problem.Detail != "sort: unknown field" {
+		t.Errorf("problem = %+v, want the wrapped message", problem)
+	}
+}
+
+func TestProblemsDescribesBindFailures(t *testing.T) {
+	_, problem := serveProblem(t, bindProblemRequest, `{"email":"nope","age":-1}`)
+	if problem.Code != pkg.CodeValidationFailed || len(problem.Errors) != 2 {
+		t.Fatalf("problem = %+v, want a validation failure for both fields", problem)
+	}
+	if e := problem.Errors[0]; e.Field != "email" || e.Code != "email" || e.Message != "email must be an email address" {
+		t.Errorf("email error = %+v", e)
+	}
+	if e := problem.Errors[1]; e.Field != "age" || e.Code != "min" {
+		t.Errorf("age error = %+v", e)
+	}
+
+	_, problem = serveProblem(t, bindProblemRequest, `{"email":"pat@example.com","age":"old"}`)
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "age" || problem.Errors[0].Code != "type" {
+		t.Errorf("wrong type: problem = %+v", problem)
+	}
+
+	_, problem = serveProblem(t, bindProblemRequest, `{"email":`)
+	if problem.Code != pkg.CodeInvalidRequest || problem.Detail != "request body is not valid JSON" {
+		t.Errorf("truncated body: problem = %+v", problem)
+	}
+	_, problem = serveProblem(t, bindProblemRequest, "")
+	if problem.Detail != "request body is required" {
+		t.Errorf("empty body: problem = %+v", problem)
+	}
+}
+
+func TestProblemsHidesUnexpectedErrors(t *testing.T) {
+	w, problem := serveProblem(t, func(c *gin.Context) {
+		c.Error(errors.New(`pq: relation "users" does not exist`))
+	}, "")
+	if w.Code != http.StatusInternalServerError || problem.Code != pkg.CodeInternal {
+		t.Fatalf("status %d problem %+v, want a 500", w.Code, problem)
+	}
+	if strings.Contains(w.Body.String(), "relation") {
+		t.Errorf("body %s leaks the underlying error", w.Body)
+	}
+}
+
+func TestProblemsLeavesWrittenResponses(t *testing.T) {
+	w, _ := serveProblem(t, func(c *gin.Context) {
+		c.JSON(http.StatusAccepted, gin.H{"ok": true})
+		c.Error(pkg.ErrUserNotFound)
+	}, "")
+	if w.Code != http.StatusAccepted || w.Body.String() != `{"ok":true}` {
+		t.Errorf("status %d body %s, want the handler's response untouched", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 64
+)
+
+// RequestID tags each request with an ID, reusing the caller's X-Request-ID
+// when it is well formed. The ID is stored as "request_id" in the gin
+// context and echoed in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			buf := make([]byte, 16)
+			if _, err := rand.Read(buf); err == nil {
+				id = hex.EncodeToString(buf)
+			} else {
+				id = ""
+			}
+		}
+
+		if id != "" {
+			c.Set("request_id", id)
+			c.Header(RequestIDHeader, id)
+		}
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
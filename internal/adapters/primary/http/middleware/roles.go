@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// RequireRole allows the request only when the authenticated user holds one
+// of the given roles. It must run after AuthMiddleware.
+func RequireRole(users ports.UserStore, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if users == nil {
+			abort(c, pkg.Unavailable("user store not configured"))
+			return
+		}
+
+		u, err := users.GetByID(c.Request.Context(), c.GetInt64("user_id"))
+		if err != nil {
+			abort(c, pkg.Unauthorized("unauthorized"))
+			return
+		}
+
+		for _, role := range roles {
+			if u.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		abort(c, pkg.ErrPermissionDenied)
+	}
+}
+
+// RequireInteractive rejects requests authenticated with an API key, so a
+// leaked key cannot mint further keys or change second factors. It must run
+// after AuthMiddleware.
+func RequireInteractive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") == AuthMethodAPIKey {
+			abort(c, pkg.ErrInteractiveOnly)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ForbidImpersonation rejects requests made with an impersonation token, so
+// support staff can look around an account but not take it over. It must run
+// after AuthMiddleware.
+func ForbidImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetInt64("actor_id") != 0 {
+			abort(c, pkg.ErrImpersonating)
+			return
+		}
+		c.Next()
+	}
+}
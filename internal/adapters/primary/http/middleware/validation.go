@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/openapi"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const (
+	// maxValidatedBodyBytes bounds how much of a request body is read for
+	// validation. Larger bodies are passed on unchecked for the handler's
+	// own limits to reject.
+	maxValidatedBodyBytes = 10 << 20
+	maxValidationErrors   = 100
+)
+
+type ValidationOptions struct {
+	// Responses also checks what handlers write against the document and
+	// turns mismatches into 500s. Responses are buffered to do so, which is
+	// why this is meant for tests.
+	Responses bool
+}
+
+// Validation checks requests against the operation the OpenAPI document
+// describes for their route: path, query and header parameters, and JSON
+// bodies. Violations are reported together as one validation problem with
+// a field error each. Routes the document does not describe pass through,
+// as do bodies in media types the operation does not list, which the
+// handler rejects itself. Operations that report failures per item, such as
+// batches, only have their parameters checked.
+func Validation(doc *openapi.Document, opts ValidationOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op, ok := doc.Operation(c.Request.Method, c.FullPath(), c.Param)
+		if !ok {
+			c.Next()
+			return
+		}
+		if err := validateRequest(c, doc, op); err != nil {
+			abort(c, err)
+			return
+		}
+		if !opts.Responses {
+			c.Next()
+			return
+		}
+
+		w := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if !w.wrote && len(c.Errors) > 0 {
+			// Problems renders the error once this returns.
+			return
+		}
+		if fields := validateResponse(doc, op, w); len(fields) > 0 {
+			log.Printf("%s %s response does not match the openapi document: %v", c.Request.Method, c.FullPath(), fields)
+			w.Header().Del("ETag")
+			_ = c.Error(pkg.Internal("response does not match the openapi document").WithFields(fields...))
+			return
+		}
+		w.flush()
+	}
+}
+
+func validateRequest(c *gin.Context, doc *openapi.Document, op *openapi.Operation) error {
+	var fields []pkg.FieldError
+	for _, p := range op.Parameters {
+		raw, present := parameterValue(c, p)
+		if !present {
+			if p.Required {
+				fields = append(fields, pkg.FieldError{Field: p.Name, Code: "required", Message: p.Name + " is required"})
+			}
+			continue
+		}
+		fields = append(fields, doc.ValidateParameter(p, raw)...)
+	}
+
+	if op.RequestBody != nil && !op.PartialSuccess {
+		bodyFields, err := validateRequestBody(c, doc, op.RequestBody)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, bodyFields...)
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(fields) > maxValidationErrors {
+		fields = fields[:maxValidationErrors]
+	}
+	return pkg.Validation(fields...)
+}
+
+func parameterValue(c *gin.Context, p openapi.Parameter) (string, bool) {
+	switch p.In {
+	case "path":
+		v := c.Param(p.Name)
+		return v, v != ""
+	case "query":
+		return c.GetQuery(p.Name)
+	case "header":
+		v := c.GetHeader(p.Name)
+		return v, v != ""
+	}
+	return "", false
+}
+
+// validateRequestBody checks a JSON body. Handlers that accept several media
+// types fall back to JSON, so an unlisted media type is validated as JSON
+// when the operation takes JSON at all.
+func validateRequestBody(c *gin.Context, doc *openapi.Document, body *openapi.RequestBody) ([]pkg.FieldError, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	media, ok := body.Content[mediaType]
+	if !ok {
+		mediaType = "application/json"
+		media, ok = body.Content[mediaType]
+	}
+	if !ok || !isJSON(mediaType) {
+		return nil, nil
+	}
+
+	raw, complete, err := peekBody(c)
+	if err != nil {
+		return nil, pkg.Invalid("failed to read request body")
+	}
+	if !complete {
+		return nil, nil
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		if body.Required {
+			return nil, pkg.Invalid("request body is required")
+		}
+		return nil, nil
+	}
+
+	value, err := decodeJSON(raw)
+	if err != nil {
+		return nil, pkg.Invalid("request body is not valid JSON")
+	}
+	return doc.Validate(media.Schema, value, ""), nil
+}
+
+// peekBody reads the request body and puts it back for the handler. Bodies
+// over maxValidatedBodyBytes are left unread past the limit and reported as
+// incomplete.
+func peekBody(c *gin.Context) ([]byte, bool, error) {
+	original := c.Request.Body
+	raw, err := io.ReadAll(io.LimitReader(original, maxValidatedBodyBytes+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(raw) > maxValidatedBodyBytes {
+		c.Request.Body = readCloser{io.MultiReader(bytes.NewReader(raw), original), original}
+		return nil, false, nil
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+	return raw, true, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func decodeJSON(raw []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// validateResponse checks a buffered response: its status must be one the
+// operation documents, and JSON and NDJSON bodies must match the schema for
+// that status.
+func validateResponse(doc *openapi.Document, op *openapi.Operation, w *bufferedWriter) []pkg.FieldError {
+	status := w.Status()
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if status < http.StatusBadRequest {
+			return []pkg.FieldError{{Field: "status", Code: "oneof", Message: "status " + strconv.Itoa(status) + " is not documented"}}
+		}
+		resp = op.Responses["default"]
+	}
+	if resp.Ref != "" {
+		resp = doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+	}
+
+	if w.body.Len() == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	media, ok := resp.Content[mediaType]
+	if !ok {
+		return []pkg.FieldError{{Field: "content_type", Code: "oneof", Message: "content type " + mediaType + " is not documented for status " + strconv.Itoa(status)}}
+	}
+
+	switch {
+	case isJSON(mediaType):
+		value, err := decodeJSON(w.body.Bytes())
+		if err != nil {
+			return []pkg.FieldError{{Field: "body", Code: "json", Message: "response body is not valid JSON"}}
+		}
+		return doc.Validate(media.Schema, value, "")
+	case mediaType == "application/x-ndjson" || mediaType == "application/jsonl":
+		var fields []pkg.FieldError
+		scanner := bufio.NewScanner(bytes.NewReader(w.body.Bytes()))
+		scanner.Buffer(nil, maxValidatedBodyBytes)
+		for line := 1; scanner.Scan(); line++ {
+			value, err := decodeJSON(scanner.Bytes())
+			if err != nil {
+				fields = append(fields, pkg.FieldError{Field: "body", Line: line, Code: "json", Message: "line is not valid JSON"})
+				continue
+			}
+			for _, f := range doc.Validate(media.Schema, value, "") {
+				f.Line = line
+				fields = append(fields, f)
+			}
+		}
+		return fields
+	}
+	return nil
+}
+
+// bufferedWriter holds a response back until it has been validated.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status int
+	wrote  bool
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.wrote {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.wrote = true
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.body.Write(b)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.wrote = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.wrote {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.wrote
+}
+
+// Flush is a no-op: streamed responses are sent once they are complete.
+func (w *bufferedWriter) Flush() {}
+
+func (w *bufferedWriter) flush() {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if !w.wrote {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+	if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+		log.Printf("write response failed: %v", err)
+	}
+}
@@ -0,0 +1,397 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/openapi"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+func intPtr(n int) *int                   { return &n }
+func floatPtr(f float64) *float64         { return &f }
+func schemaOf(typ string) *openapi.Schema { return &openapi.Schema{Type: openapi.Types{typ}} }
+
+// validationDocument describes POST /things/{id} and POST /batches, an
+// operation that reports failures per item.
+func validationDocument() *openapi.Document {
+	thing := &openapi.Schema{
+		Type:     openapi.Types{"object"},
+		Required: []string{"name"},
+		Properties: map[string]*openapi.Schema{
+			"name":  {Type: openapi.Types{"string"}, MinLength: intPtr(1), MaxLength: intPtr(10)},
+			"count": {Type: openapi.Types{"integer"}, ExclusiveMinimum: floatPtr(0)},
+			"email": {Type: openapi.Types{"string"}, Format: "email"},
+		},
+	}
+	created := &openapi.Schema{
+		Type:       openapi.Types{"object"},
+		Required:   []string{"id"},
+		Properties: map[string]*openapi.Schema{"id": schemaOf("integer")},
+	}
+	return &openapi.Document{
+		Components: openapi.Components{Schemas: map[string]*openapi.Schema{"Thing": thing}},
+		Paths: map[string]map[string]openapi.Operation{
+			"/things/{id}": {"post": {
+				Parameters: []openapi.Parameter{
+					{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: openapi.Types{"integer"}, Minimum: floatPtr(1)}},
+					{Name: "limit", In: "query", Schema: &openapi.Schema{Type: openapi.Types{"integer"}, Maximum: floatPtr(10)}},
+					{Name: "X-Tenant", In: "header", Required: true, Schema: schemaOf("string")},
+				},
+				RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+					"application/json": {Schema: &openapi.Schema{Ref: "#/components/schemas/Thing"}},
+					"text/csv":         {Schema: schemaOf("string")},
+				}},
+				Responses: map[string]openapi.Response{
+					"201": {Content: map[string]openapi.MediaType{
+						"application/json":     {Schema: created},
+						"application/x-ndjson": {Schema: created},
+					}},
+					"default": {Content: map[string]openapi.MediaType{"application/problem+json": {}}},
+				},
+			}},
+			"/batches": {"post": {
+				RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+					"application/json": {Schema: &openapi.Schema{Ref: "#/components/schemas/Thing"}},
+				}},
+				Responses:      map[string]openapi.Response{"200": {}},
+				PartialSuccess: true,
+			}},
+		},
+	}
+}
+
+// validationRouter serves the routes of validationDocument plus one the
+// document leaves out. The X-Respond header picks what the things handler
+// writes, and every request that reaches a handler is counted.
+func validationRouter(opts ValidationOptions) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+	handled := 0
+	r := gin.New()
+	r.Use(Problems())
+	r.Use(Validation(validationDocument(), opts))
+	r.POST("/things/:id", func(c *gin.Context) {
+		handled++
+		c.Header("ETag", `"1"`)
+		switch c.GetHeader("X-Respond") {
+		case "undocumented":
+			c.JSON(http.StatusAccepted, gin.H{"id": 1})
+		case "mismatch":
+			c.JSON(http.StatusCreated, gin.H{"id": "one"})
+		case "text":
+			c.String(http.StatusCreated, "created")
+		case "ndjson":
+			c.Data(http.StatusCreated, "application/x-ndjson", []byte("{\"id\":1}\n{\"id\":\"two\"}\n"))
+		case "error":
+			_ = c.Error(pkg.ErrDeviceNotFound)
+		default:
+			c.JSON(http.StatusCreated, gin.H{"id": 1})
+		}
+	})
+	r.POST("/batches", func(c *gin.Context) {
+		handled++
+		c.Status(http.StatusOK)
+	})
+	r.POST("/undocumented", func(c *gin.Context) {
+		handled++
+		c.Status(http.StatusNoContent)
+	})
+	return r, &handled
+}
+
+func TestValidation(t *testing.T) {
+	type field struct {
+		Field string
+		Line  int
+		Code  string
+	}
+
+	tests := []struct {
+		name        string
+		responses   bool
+		path        string
+		contentType string
+		tenant      string
+		respond     string
+		body        string
+		wantStatus  int
+		wantCode    string
+		wantFields  []field
+		wantHandled bool
+		wantETag    bool
+	}{
+		{
+			name:        "valid",
+			path:        "/things/1?limit=5",
+			body:        `{"name":"lamp","count":2,"email":"a@example.com"}`,
+			wantStatus:  http.StatusCreated,
+			wantHandled: true,
+			wantETag:    true,
+		},
+		{
+			name:       "invalid parameters",
+			path:       "/things/0?limit=11",
+			body:       `{"name":"lamp"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   pkg.CodeValidationFailed,
+			wantFields: []field{{"id", 0, "min"}, {"limit", 0, "max"}},
+		},
+		{
+			name:       "parameter of the wrong type",
+			path:       "/things/one",
+			body:       `{"name":"lamp"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   pkg.CodeValidationFailed,
+			wantFields: []field{{"id", 0, "type"}},
+		},
+		{
+			name:       "missing required header",
+			path:       "/things/1",
+			tenant:     "-",
+			body:       `{"name":"lamp"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   pkg.CodeValidationFailed,
+			wantFields: []field{{"X-Tenant", 0, "required"}},
+		},
+		{
+			name:       "body fields are reported together",
+			path:       "/things/1",
+			body:       `{"count":0,"email":"nope","extra":true}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   pkg.CodeValidationFailed,
+			wantFields: []field{{"name", 0, "required"}, {"count", 0, "gt"}, {"email", 0, "email"}},
+		},
+		{
+			name:       "body of the wrong type",
+			path:       "/things/1",
+			body:       `{"name":12345678901}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   pkg.CodeValidationFailed,
+			wantFields: []field{{"name", 0, "type"}},
+		},
+		{
+			name:       "parameters and body together",
+			path:       "/things/1?limit=x",
+			body:       `{"name":""}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   pkg.CodeValidationFailed,
+			wantFields: []field{{"limit", 0, "type"}, {"name", 0, "required"}},
+		},
+		{
+			name:       "empty required body",
+			path:       "/things/1",
+			body:       "  ",
+			wantStatus: http.StatusBadRequest,
+			wantCode:   pkg.CodeInvalidRequest,
+		},
+		{
+			name:       "invalid JSON",
+			path:       "/things/1",
+			body:       `{"name":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   pkg.CodeInvalidRequest,
+		},
+		{
+			name:        "unlisted media type is validated as JSON",
+			path:        "/things/1",
+			contentType: "application/merge-patch+json",
+			body:        `{"name":""}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    pkg.CodeValidationFailed,
+			wantFields:  []field{{"name", 0, "required"}},
+		},
+		{
+			name:        "non-JSON media type passes through",
+			path:        "/things/1",
+			contentType: "text/csv",
+			body:        "name\nlamp\n",
+			wantStatus:  http.StatusCreated,
+			wantHandled: true,
+			wantETag:    true,
+		},
+		{
+			name:        "partial success operations skip the body",
+			path:        "/batches",
+			body:        `{"count":"many"}`,
+			wantStatus:  http.StatusOK,
+			wantHandled: true,
+		},
+		{
+			name:        "undocumented routes pass through",
+			path:        "/undocumented",
+			body:        `{`,
+			wantStatus:  http.StatusNoContent,
+			wantHandled: true,
+		},
+		{
+			name:        "documented response",
+			responses:   true,
+			path:        "/things/1",
+			body:        `{"name":"lamp"}`,
+			wantStatus:  http.StatusCreated,
+			wantHandled: true,
+			wantETag:    true,
+		},
+		{
+			name:        "undocumented status",
+			responses:   true,
+			path:        "/things/1",
+			respond:     "undocumented",
+			body:        `{"name":"lamp"}`,
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    pkg.CodeInternal,
+			wantFields:  []field{{"status", 0, "oneof"}},
+			wantHandled: true,
+		},
+		{
+			name:        "response schema mismatch",
+			responses:   true,
+			path:        "/things/1",
+			respond:     "mismatch",
+			body:        `{"name":"lamp"}`,
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    pkg.CodeInternal,
+			wantFields:  []field{{"id", 0, "type"}},
+			wantHandled: true,
+		},
+		{
+			name:        "undocumented response content type",
+			responses:   true,
+			path:        "/things/1",
+			respond:     "text",
+			body:        `{"name":"lamp"}`,
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    pkg.CodeInternal,
+			wantFields:  []field{{"content_type", 0, "oneof"}},
+			wantHandled: true,
+		},
+		{
+			name:        "ndjson responses are checked by line",
+			responses:   true,
+			path:        "/things/1",
+			respond:     "ndjson",
+			body:        `{"name":"lamp"}`,
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    pkg.CodeInternal,
+			wantFields:  []field{{"id", 2, "type"}},
+			wantHandled: true,
+		},
+		{
+			name:        "handler errors are left to Problems",
+			responses:   true,
+			path:        "/things/1",
+			respond:     "error",
+			body:        `{"name":"lamp"}`,
+			wantStatus:  http.StatusNotFound,
+			wantCode:    pkg.ErrDeviceNotFound.Code,
+			wantHandled: true,
+			wantETag:    true,
+		},
+		{
+			name:        "mismatches are ignored without the option",
+			path:        "/things/1",
+			respond:     "mismatch",
+			body:        `{"name":"lamp"}`,
+			wantStatus:  http.StatusCreated,
+			wantHandled: true,
+			wantETag:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, handled := validationRouter(ValidationOptions{Responses: tt.responses})
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			req.Header.Set("Content-Type", contentType)
+			switch tt.tenant {
+			case "":
+				req.Header.Set("X-Tenant", "acme")
+			case "-":
+			default:
+				req.Header.Set("X-Tenant", tt.tenant)
+			}
+			if tt.respond != "" {
+				req.Header.Set("X-Respond", tt.respond)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := *handled > 0; got != tt.wantHandled {
+				t.Errorf("handled = %v, want %v", got, tt.wantHandled)
+			}
+			if got := w.Header().Get("ETag") != ""; got != tt.wantETag {
+				t.Errorf("ETag sent = %v, want %v", got, tt.wantETag)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+
+			var problem dto.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("decode: %v: %s", err, w.Body)
+			}
+			if problem.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", problem.Code, tt.wantCode)
+			}
+			var fields []field
+			for _, f := range problem.Errors {
+				fields = append(fields, field{f.Field, f.Line, f.Code})
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("errors = %+v, want %+v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestValidationCapsErrors(t *testing.T) {
+	properties := map[string]*openapi.Schema{}
+	body := map[string]int{}
+	for i := 0; i < maxValidationErrors+10; i++ {
+		name := "f" + strings.Repeat("x", i)
+		properties[name] = schemaOf("string")
+		body[name] = i
+	}
+	doc := &openapi.Document{Paths: map[string]map[string]openapi.Operation{
+		"/wide": {"post": {RequestBody: &openapi.RequestBody{Content: map[string]openapi.MediaType{
+			"application/json": {Schema: &openapi.Schema{Type: openapi.Types{"object"}, Properties: properties}},
+		}}}},
+	}}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Problems())
+	r.Use(Validation(doc, ValidationOptions{}))
+	r.POST("/wide", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodPost, "/wide", strings.NewReader(string(raw)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var problem dto.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode: %v: %s", err, w.Body)
+	}
+	if w.Code != http.StatusBadRequest || len(problem.Errors) != maxValidationErrors {
+		t.Errorf("status %d with %d errors, want %d with %d", w.Code, len(problem.Errors), http.StatusBadRequest, maxValidationErrors)
+	}
+}
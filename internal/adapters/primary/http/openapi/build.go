@@ -0,0 +1,177 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+)
+
+const (
+	bearerScheme = "bearerAuth"
+	apiKeyScheme = "apiKey"
+)
+
+var (
+	buildOnce sync.Once
+	document  *Document
+	rendered  []byte
+)
+
+// Spec returns the API description. It is built once, on first use.
+func Spec() *Document {
+	buildOnce.Do(func() {
+		document = Build()
+		var err error
+		if rendered, err = json.Marshal(document); err != nil {
+			panic("openapi: " + err.Error())
+		}
+	})
+	return document
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Build assembles a fresh document from the route table.
+func Build() *Document {
+	schemas := newSchemaRegistry()
+	doc := &Document{
+		OpenAPI: Version,
+		Info: Info{
+			Title:   "go-crud API",
+			Version: "v1",
+			Description: "Errors are RFC 7807 problem details; switch on their code, not their message. " +
+				"Validation failures list the offending fields in errors.",
+		},
+		Paths: map[string]map[string]Operation{},
+		Components: Components{
+			Schemas: schemas.schemas,
+			Responses: map[string]Response{
+				"Problem": {
+					Description: "The request failed.",
+					Content:     map[string]MediaType{problemContentType: {Schema: schemas.schemaOf(dto.Problem{})}},
+				},
+			},
+			SecuritySchemes: map[string]SecurityScheme{
+				bearerScheme: {
+					Type:         "http",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+					Description:  "Token from login, an invitation, OIDC or impersonation.",
+				},
+				apiKeyScheme: {
+					Type: "apiKey",
+					In:   "header",
+					Name: "Authorization",
+					Description: "Personal API key sent as \"Authorization: ApiKey <key>\". " +
+						"Keys without the write scope can only call GET, HEAD and OPTIONS.",
+				},
+			},
+		},
+	}
+
+	seenTags := map[string]bool{}
+	for _, op := range operations() {
+		if op.tag != "" && !seenTags[op.tag] {
+			seenTags[op.tag] = true
+			doc.Tags = append(doc.Tags, Tag{Name: op.tag})
+		}
+		if doc.Paths[op.path] == nil {
+			doc.Paths[op.path] = map[string]Operation{}
+		}
+		doc.Paths[op.path][strings.ToLower(op.method)] = buildOperation(schemas, op)
+	}
+	return doc
+}
+
+func buildOperation(schemas *schemaRegistry, op operation) Operation {
+	out := Operation{
+		OperationID: op.id,
+		Summary:     op.summary,
+		Description: op.description,
+		Parameters:  append([]Parameter(nil), op.params...),
+		Responses:   map[string]Response{"default": {Ref: "#/components/responses/Problem"}},
+	}
+	if op.tag != "" {
+		out.Tags = []string{op.tag}
+	}
+
+	for _, m := range pathParam.FindAllStringSubmatch(op.path, -1) {
+		if !hasParam(op.params, m[1], "path") {
+			out.Parameters = append(out.Parameters, Parameter{
+				Name:     m[1],
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: Types{"integer"}, Format: "int64"},
+			})
+		}
+	}
+
+	switch op.access {
+	case authenticated, admin:
+		out.Security = []SecurityRequirement{{bearerScheme: {}}, {apiKeyScheme: {}}}
+	case interactive:
+		out.Security = []SecurityRequirement{{bearerScheme: {}}}
+	}
+	if op.access == admin {
+		out.Description = strings.TrimSpace(out.Description + " Requires the admin role.")
+	}
+
+	if op.request != nil {
+		out.RequestBody = &RequestBody{Required: true, Content: content(schemas, op.request)}
+	}
+
+	resp := Response{Description: http.StatusText(op.status), Headers: op.headers}
+	if op.response != nil {
+		resp.Content = content(schemas, op.response)
+	}
+	out.Responses[strconv.Itoa(op.status)] = resp
+	if op.partial {
+		out.PartialSuccess = true
+		partial := resp
+		partial.Description = "Some items failed; see each result."
+		out.Responses[strconv.Itoa(http.StatusMultiStatus)] = partial
+	}
+	return out
+}
+
+func hasParam(params []Parameter, name, in string) bool {
+	for _, p := range params {
+		if p.Name == name && p.In == in {
+			return true
+		}
+	}
+	return false
+}
+
+func content(schemas *schemaRegistry, bodies map[string]any) map[string]MediaType {
+	out := make(map[string]MediaType, len(bodies))
+	for mediaType, body := range bodies {
+		out[mediaType] = MediaType{Schema: bodySchema(schemas, body)}
+	}
+	return out
+}
+
+func bodySchema(schemas *schemaRegistry, body any) *Schema {
+	switch b := body.(type) {
+	case *Schema:
+		return b
+	case oneOf:
+		s := &Schema{}
+		for _, alt := range b {
+			s.OneOf = append(s.OneOf, bodySchema(schemas, alt))
+		}
+		return s
+	default:
+		s := schemas.schemaOf(body)
+		// A top-level list is always written, never null.
+		if s.Items != nil {
+			s.Type = Types{"array"}
+		}
+		return s
+	}
+}
@@ -0,0 +1,24 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// ServeSpec serves the document as JSON.
+func ServeSpec(c *gin.Context) {
+	Spec()
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "application/json; charset=utf-8", rendered)
+}
+
+// ServeDocs serves a page that renders the document for browsing. It is
+// self-contained, so it works without access to a CDN.
+func ServeDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+}
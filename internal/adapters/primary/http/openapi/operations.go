@@ -0,0 +1,328 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/patch"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+)
+
+// The middleware validates requests against this package, and the handlers
+// depend on the middleware, so the media types they define are repeated
+// here rather than imported.
+const (
+	jsonContentType      = "application/json"
+	jsonLinesContentType = "application/jsonl"
+	problemContentType   = "application/problem+json"
+	ndjsonContentType    = "application/x-ndjson"
+	csvContentType       = "text/csv"
+
+	mergePatchContentType = patch.MergePatchContentType
+	jsonPatchContentType  = patch.JSONPatchContentType
+)
+
+// access is who may call an operation.
+type access int
+
+const (
+	public access = iota
+	authenticated
+	// interactive operations refuse API keys.
+	interactive
+	admin
+)
+
+// operation describes one route. Paths use OpenAPI templates; path
+// parameters are integers unless listed in params. Request and response
+// bodies map a media type to a DTO value, or to a *Schema for bodies that
+// are not DTOs.
+type operation struct {
+	method      string
+	path        string
+	id          string
+	summary     string
+	description string
+	tag         string
+	access      access
+	params      []Parameter
+	request     map[string]any
+	status      int
+	response    map[string]any
+	headers     map[string]Header
+	// partial operations apply the items of their body independently; see
+	// Operation.PartialSuccess.
+	partial bool
+}
+
+func jsonBody(v any) map[string]any {
+	return map[string]any{jsonContentType: v}
+}
+
+// oneOf is a body that takes one of several shapes.
+type oneOf []any
+
+func query(name, typ, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: Types{typ}}}
+}
+
+func enumQuery(name, description string, values ...any) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: Types{"string"}, Enum: values}}
+}
+
+var (
+	listParams = []Parameter{
+		query("limit", "integer", "Page size, 1 to 100."),
+		query("cursor", "string", "next_cursor from the previous page."),
+		query("offset", "integer", "Rows to skip when no cursor is given."),
+		query("sort", "string", "Field to order by; a leading - sorts descending."),
+	}
+	listDescription = "Any other query parameter filters on the field it names: name=x matches exactly, " +
+		"name~=x matches a case-insensitive substring, and created_after / created_before bound timestamps."
+
+	ifMatch = Parameter{
+		Name:        "If-Match",
+		In:          "header",
+		Description: "ETag of the version being changed. The change fails with 412 when the resource has moved on.",
+		Schema:      &Schema{Type: Types{"string"}},
+	}
+	idempotencyKey = Parameter{
+		Name:        "Idempotency-Key",
+		In:          "header",
+		Description: "Retries with the same key replay the first response instead of creating again.",
+		Schema:      &Schema{Type: Types{"string"}, MaxLength: intPtr(255)},
+	}
+	batchMode    = enumQuery("mode", "Batch mode for NDJSON bodies; JSON bodies carry it in the body.", dto.BatchAtomic, dto.BatchBestEffort)
+	exportFormat = enumQuery("format", "Export format, csv by default.", "csv", "ndjson")
+
+	etagHeader = map[string]Header{
+		"ETag": {Description: "Version of the resource, for If-Match.", Schema: &Schema{Type: Types{"string"}}},
+	}
+)
+
+var (
+	textSchema      = &Schema{Type: Types{"string"}}
+	mergePatch      = &Schema{Type: Types{"object"}, Description: "JSON Merge Patch (RFC 7396) of the resource."}
+	jsonPatchSchema = &Schema{
+		Type:        Types{"array"},
+		Description: "JSON Patch (RFC 6902) operations, applied in order.",
+		Items: &Schema{
+			Type:     Types{"object"},
+			Required: []string{"op", "path"},
+			Properties: map[string]*Schema{
+				"op":    {Type: Types{"string"}, Enum: []any{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  {Type: Types{"string"}},
+				"from":  {Type: Types{"string"}},
+				"value": {},
+			},
+		},
+	}
+	helloSchema = &Schema{
+		Type:       Types{"object"},
+		Required:   []string{"message"},
+		Properties: map[string]*Schema{"message": {Type: Types{"string"}}},
+	}
+	versionsSchema = &Schema{
+		Type:     Types{"object"},
+		Required: []string{"api", "go"},
+		Properties: map[string]*Schema{
+			"api": {Type: Types{"string"}},
+			"go": {
+				Type: Types{"object"},
+				Properties: map[string]*Schema{
+					"toolchain": {Type: Types{"string"}},
+					"valid":     {Type: Types{"boolean"}},
+					"lang":      {Type: Types{"string"}},
+				},
+			},
+		},
+	}
+)
+
+func patchBody() map[string]any {
+	return map[string]any{mergePatchContentType: mergePatch, jsonPatchContentType: jsonPatchSchema}
+}
+
+// operations is the route table the document is built from. Every route
+// registered in NewRouter must appear here; MissingRoutes enforces it.
+func operations() []operation {
+	return []operation{
+		{method: http.MethodGet, path: "/hello", id: "hello", summary: "Liveness check", tag: "meta",
+			status: http.StatusOK, response: jsonBody(helloSchema)},
+		{method: http.MethodGet, path: "/versions", id: "getVersions", summary: "API and toolchain versions", tag: "meta",
+			status: http.StatusOK, response: jsonBody(versionsSchema)},
+		{method: http.MethodGet, path: "/.well-known/jwks.json", id: "getJWKS", summary: "Token verification keys", tag: "meta",
+			status: http.StatusOK, response: jsonBody(sharedauth.JWKS{})},
+		{method: http.MethodGet, path: "/openapi.json", id: "getOpenAPI", summary: "This document", tag: "meta",
+			status: http.StatusOK, response: jsonBody(&Schema{Type: Types{"object"}})},
+		{method: http.MethodGet, path: "/docs", id: "getDocs", summary: "Browsable API documentation", tag: "meta",
+			status: http.StatusOK, response: map[string]any{"text/html": textSchema}},
+
+		{method: http.MethodPost, path: "/api/v1/register", id: "register", summary: "Create an account", tag: "auth",
+			description: "Fails with 403 when public registration is disabled.",
+			params:      []Parameter{idempotencyKey},
+			request:     jsonBody(dto.CreateUserRequest{}), status: http.StatusCreated, response: jsonBody(dto.RegisterResponse{})},
+		{method: http.MethodPost, path: "/api/v1/login", id: "login", summary: "Log in with a username and password", tag: "auth",
+			description: "Accounts with two-factor authentication get an MFA challenge instead of a token.",
+			request:     jsonBody(dto.LoginRequest{}), status: http.StatusOK, response: jsonBody(oneOf{dto.LoginResponse{}, dto.MFAChallengeResponse{}})},
+		{method: http.MethodPost, path: "/api/v1/login/mfa", id: "loginMFA", summary: "Complete a login with a two-factor code", tag: "auth",
+			request: jsonBody(dto.LoginMFARequest{}), status: http.StatusOK, response: jsonBody(dto.LoginResponse{})},
+		{method: http.MethodPost, path: "/api/v1/logout", id: "logout", summary: "Revoke the current token", tag: "auth", access: authenticated,
+			status: http.StatusNoContent},
+		{method: http.MethodGet, path: "/api/v1/oidc/login", id: "oidcLogin", summary: "Start an OpenID Connect login", tag: "auth",
+			status: http.StatusFound},
+		{method: http.MethodGet, path: "/api/v1/oidc/callback", id: "oidcCallback", summary: "Finish an OpenID Connect login", tag: "auth",
+			description: "Redirects to the configured post-login page when there is one. Accounts with two-factor authentication get an MFA challenge instead of a token.",
+			params: []Parameter{
+				query("code", "string", "Authorization code from the provider."),
+				query("state", "string", "State issued by the login redirect."),
+				query("error", "string", "Error reported by the provider."),
+			},
+			status: http.StatusOK, response: jsonBody(oneOf{dto.LoginResponse{}, dto.MFAChallengeResponse{}})},
+		{method: http.MethodPost, path: "/api/v1/password/forgot", id: "forgotPassword", summary: "Mail a password reset link", tag: "auth",
+			request: jsonBody(dto.ForgotPasswordRequest{}), status: http.StatusAccepted, response: jsonBody(dto.ForgotPasswordResponse{})},
+		{method: http.MethodPost, path: "/api/v1/password/reset", id: "resetPassword", summary: "Set a new password with a reset token", tag: "auth",
+			request: jsonBody(dto.ResetPasswordRequest{}), status: http.StatusNoContent},
+
+		{method: http.MethodGet, path: "/api/v1/me", id: "getProfile", summary: "Get the current account", tag: "account", access: authenticated,
+			status: http.StatusOK, response: jsonBody(dto.ProfileResponse{})},
+		{method: http.MethodPatch, path: "/api/v1/me", id: "updateProfile", summary: "Update the current account", tag: "account", access: authenticated,
+			description: "Changing the email requires current_password.",
+			request:     jsonBody(dto.UpdateProfileRequest{}), status: http.StatusOK, response: jsonBody(dto.ProfileResponse{})},
+		{method: http.MethodDelete, path: "/api/v1/me", id: "closeAccount", summary: "Close the current account", tag: "account", access: interactive,
+			description: "The account is purged after a grace period; logging in again before then reopens it.",
+			request:     jsonBody(dto.CloseAccountRequest{}), status: http.StatusAccepted, response: jsonBody(dto.CloseAccountResponse{})},
+		{method: http.MethodPost, path: "/api/v1/me/password", id: "changePassword", summary: "Change the password", tag: "account", access: interactive,
+			description: "Other sessions are revoked and a fresh token is returned.",
+			request:     jsonBody(dto.ChangePasswordRequest{}), status: http.StatusOK, response: jsonBody(dto.LoginResponse{})},
+
+		{method: http.MethodPost, path: "/api/v1/me/mfa/totp", id: "enrollTOTP", summary: "Start TOTP enrollment", tag: "mfa", access: interactive,
+			status: http.StatusOK, response: jsonBody(dto.TOTPEnrollResponse{})},
+		{method: http.MethodPost, path: "/api/v1/me/mfa/totp/verify", id: "verifyTOTP", summary: "Confirm TOTP enrollment", tag: "mfa", access: interactive,
+			request: jsonBody(dto.MFACodeRequest{}), status: http.StatusOK, response: jsonBody(dto.RecoveryCodesResponse{})},
+		{method: http.MethodDelete, path: "/api/v1/me/mfa/totp", id: "disableTOTP", summary: "Turn off two-factor authentication", tag: "mfa", access: interactive,
+			request: jsonBody(dto.MFACodeRequest{}), status: http.StatusNoContent},
+		{method: http.MethodPost, path: "/api/v1/me/mfa/recovery-codes", id: "regenerateRecoveryCodes", summary: "Replace the recovery codes", tag: "mfa", access: interactive,
+			request: jsonBody(dto.MFACodeRequest{}), status: http.StatusOK, response: jsonBody(dto.RecoveryCodesResponse{})},
+
+		{method: http.MethodGet, path: "/api/v1/me/sessions", id: "listSessions", summary: "List active sessions", tag: "sessions", access: authenticated,
+			status: http.StatusOK, response: jsonBody([]dto.SessionResponse{})},
+		{method: http.MethodDelete, path: "/api/v1/me/sessions/{id}", id: "revokeSession", summary: "Revoke a session", tag: "sessions", access: authenticated,
+			params: []Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: Types{"string"}}}},
+			status: http.StatusNoContent},
+
+		{method: http.MethodGet, path: "/api/v1/me/api-keys", id: "listAPIKeys", summary: "List API keys", tag: "api-keys", access: interactive,
+			status: http.StatusOK, response: jsonBody([]dto.APIKeyResponse{})},
+		{method: http.MethodPost, path: "/api/v1/me/api-keys", id: "createAPIKey", summary: "Create an API key", tag: "api-keys", access: interactive,
+			description: "The key itself is only returned by this call.",
+			request:     jsonBody(dto.CreateAPIKeyRequest{}), status: http.StatusCreated, response: jsonBody(dto.CreateAPIKeyResponse{})},
+		{method: http.MethodDelete, path: "/api/v1/me/api-keys/{id}", id: "deleteAPIKey", summary: "Revoke an API key", tag: "api-keys", access: interactive,
+			status: http.StatusNoContent},
+
+		{method: http.MethodGet, path: "/api/v1/invitations/accept", id: "lookupInvitation", summary: "Show who an invitation is for", tag: "invitations",
+			params: []Parameter{query("token", "string", "Token from the invitation link.")},
+			status: http.StatusOK, response: jsonBody(dto.InvitationLookupResponse{})},
+		{method: http.MethodPost, path: "/api/v1/invitations/accept", id: "acceptInvitation", summary: "Accept an invitation", tag: "invitations",
+			request: jsonBody(dto.AcceptInvitationRequest{}), status: http.StatusCreated, response: jsonBody(dto.RegisterResponse{})},
+		{method: http.MethodGet, path: "/api/v1/invitations", id: "listInvitations", summary: "List pending invitations", tag: "invitations", access: admin,
+			status: http.StatusOK, response: jsonBody([]dto.InvitationResponse{})},
+		{method: http.MethodPost, path: "/api/v1/invitations", id: "createInvitation", summary: "Invite someone by email", tag: "invitations", access: admin,
+			request: jsonBody(dto.CreateInvitationRequest{}), status: http.StatusCreated, response: jsonBody(dto.CreateInvitationResponse{})},
+		{method: http.MethodDelete, path: "/api/v1/invitations/{id}", id: "deleteInvitation", summary: "Withdraw an invitation", tag: "invitations", access: admin,
+			status: http.StatusNoContent},
+
+		{method: http.MethodGet, path: "/api/v1/audit", id: "listAuditEvents", summary: "List audit events, newest first", tag: "audit", access: admin,
+			params: append(auditParams(), query("limit", "integer", "Page size, 1 to 1000.")),
+			status: http.StatusOK, response: jsonBody([]domain.AuditEvent{})},
+		{method: http.MethodGet, path: "/api/v1/audit/export", id: "exportAuditEvents", summary: "Export audit events, oldest first", tag: "audit", access: admin,
+			params: auditParams(),
+			status: http.StatusOK, response: map[string]any{jsonLinesContentType: domain.AuditEvent{}}},
+
+		{method: http.MethodGet, path: "/api/v1/users", id: "listUsers", summary: "List users", description: listDescription + " Emails are only shown to admins and the account's owner, and only admins can filter or sort by email.", tag: "users", access: authenticated,
+			params: listParams, status: http.StatusOK, response: jsonBody(dto.ListResponse[dto.UserResponse]{})},
+		{method: http.MethodPost, path: "/api/v1/users", id: "createUser", summary: "Create a user", tag: "users", access: admin,
+			params: []Parameter{idempotencyKey}, request: jsonBody(dto.CreateUserRequest{}),
+			status: http.StatusCreated, response: jsonBody(dto.UserResponse{}), headers: etagHeader},
+		{method: http.MethodPost, path: "/api/v1/users:batch", id: "batchUsers", summary: "Create, update and delete users in one request", tag: "users", access: admin,
+			params: []Parameter{batchMode},
+			request: map[string]any{
+				jsonContentType:   dto.BatchRequest[dto.UserBatchOperation]{},
+				ndjsonContentType: dto.UserBatchOperation{},
+			},
+			status: http.StatusOK, response: jsonBody(dto.BatchResponse{}), partial: true},
+		{method: http.MethodGet, path: "/api/v1/users/deleted", id: "listDeletedUsers", summary: "List soft-deleted users", tag: "users", access: admin,
+			status: http.StatusOK, response: jsonBody([]dto.UserResponse{})},
+		{method: http.MethodGet, path: "/api/v1/users/export", id: "exportUsers", summary: "Export users", tag: "users", access: admin,
+			params: []Parameter{exportFormat},
+			status: http.StatusOK, response: map[string]any{csvContentType: textSchema, ndjsonContentType: dto.UserResponse{}}},
+		{method: http.MethodGet, path: "/api/v1/users/{id}", id: "getUser", summary: "Get a user", tag: "users", access: authenticated,
+			description: "The email is only shown to admins and the account's owner.",
+			status:      http.StatusOK, response: jsonBody(dto.UserResponse{}), headers: etagHeader},
+		{method: http.MethodPut, path: "/api/v1/users/{id}", id: "updateUser", summary: "Update a user", tag: "users", access: admin,
+			params: []Parameter{ifMatch}, request: jsonBody(dto.UpdateUserRequest{}),
+			status: http.StatusOK, response: jsonBody(dto.UserResponse{}), headers: etagHeader},
+		{method: http.MethodPatch, path: "/api/v1/users/{id}", id: "patchUser", summary: "Patch a user", tag: "users", access: admin,
+			description: "Only username and email can be patched.",
+			params:      []Parameter{ifMatch}, request: patchBody(),
+			status: http.StatusOK, response: jsonBody(dto.UserResponse{}), headers: etagHeader},
+		{method: http.MethodDelete, path: "/api/v1/users/{id}", id: "deleteUser", summary: "Delete a user", tag: "users", access: admin,
+			status: http.StatusNoContent},
+		{method: http.MethodPost, path: "/api/v1/users/{id}/unlock", id: "unlockUser", summary: "Clear failed login lockouts", tag: "users", access: admin,
+			status: http.StatusNoContent},
+		{method: http.MethodPost, path: "/api/v1/users/{id}/restore", id: "restoreUser", summary: "Restore a soft-deleted user", tag: "users", access: admin,
+			status: http.StatusOK, response: jsonBody(dto.UserResponse{})},
+		{method: http.MethodPut, path: "/api/v1/users/{id}/role", id: "setUserRole", summary: "Change a user's role", tag: "users", access: admin,
+			request: jsonBody(dto.SetRoleRequest{}), status: http.StatusOK, response: jsonBody(dto.UserResponse{})},
+		{method: http.MethodPost, path: "/api/v1/users/{id}/impersonate", id: "impersonateUser", summary: "Get a short-lived token acting as a user", tag: "users", access: admin,
+			description: "Every request made with the token is audited. Not available to API keys.",
+			request:     jsonBody(dto.ImpersonateRequest{}), status: http.StatusCreated, response: jsonBody(dto.ImpersonateResponse{})},
+
+		{method: http.MethodGet, path: "/api/v1/devices", id: "listDevices", summary: "List devices", description: listDescription, tag: "devices", access: authenticated,
+			params: listParams, status: http.StatusOK, response: jsonBody(dto.ListResponse[dto.DeviceResponse]{})},
+		{method: http.MethodPost, path: "/api/v1/devices", id: "createDevice", summary: "Create a device", tag: "devices", access: authenticated,
+			params: []Parameter{idempotencyKey}, request: jsonBody(dto.CreateDeviceRequest{}),
+			status: http.StatusCreated, response: jsonBody(dto.DeviceResponse{}), headers: etagHeader},
+		{method: http.MethodPost, path: "/api/v1/devices:batch", id: "batchDevices", summary: "Create, update and delete devices in one request", tag: "devices", access: authenticated,
+			params: []Parameter{batchMode},
+			request: map[string]any{
+				jsonContentType:   dto.BatchRequest[dto.DeviceBatchOperation]{},
+				ndjsonContentType: dto.DeviceBatchOperation{},
+			},
+			status: http.StatusOK, response: jsonBody(dto.BatchResponse{}), partial: true},
+		{method: http.MethodGet, path: "/api/v1/devices/deleted", id: "listDeletedDevices", summary: "List soft-deleted devices", tag: "devices", access: admin,
+			status: http.StatusOK, response: jsonBody([]dto.DeviceResponse{})},
+		{method: http.MethodGet, path: "/api/v1/devices/export", id: "exportDevices", summary: "Export devices", tag: "devices", access: authenticated,
+			params: []Parameter{exportFormat},
+			status: http.StatusOK, response: map[string]any{csvContentType: textSchema, ndjsonContentType: dto.DeviceResponse{}}},
+		{method: http.MethodPost, path: "/api/v1/devices/import", id: "importDevices", summary: "Create or update devices by name", tag: "devices", access: authenticated,
+			description: "CSV bodies need a header row naming the columns.",
+			params:      []Parameter{query("dry_run", "boolean", "Report what the import would do without committing it.")},
+			request:     map[string]any{csvContentType: textSchema, ndjsonContentType: dto.DeviceImportRow{}},
+			status:      http.StatusOK, response: jsonBody(dto.ImportReport{})},
+		{method: http.MethodGet, path: "/api/v1/devices/{id}", id: "getDevice", summary: "Get a device", tag: "devices", access: authenticated,
+			status: http.StatusOK, response: jsonBody(dto.DeviceResponse{}), headers: etagHeader},
+		{method: http.MethodPut, path: "/api/v1/devices/{id}", id: "updateDevice", summary: "Update a device", tag: "devices", access: authenticated,
+			params: []Parameter{ifMatch}, request: jsonBody(dto.UpdateDeviceRequest{}),
+			status: http.StatusOK, response: jsonBody(dto.DeviceResponse{}), headers: etagHeader},
+		{method: http.MethodPatch, path: "/api/v1/devices/{id}", id: "patchDevice", summary: "Patch a device", tag: "devices", access: authenticated,
+			params: []Parameter{ifMatch}, request: patchBody(),
+			status: http.StatusOK, response: jsonBody(dto.DeviceResponse{}), headers: etagHeader},
+		{method: http.MethodDelete, path: "/api/v1/devices/{id}", id: "deleteDevice", summary: "Delete a device", tag: "devices", access: authenticated,
+			status: http.StatusNoContent},
+		{method: http.MethodPost, path: "/api/v1/devices/{id}/restore", id: "restoreDevice", summary: "Restore a soft-deleted device", tag: "devices", access: admin,
+			status: http.StatusOK, response: jsonBody(dto.DeviceResponse{})},
+	}
+}
+
+func auditParams() []Parameter {
+	return []Parameter{
+		query("action", "string", "Only events with this action."),
+		query("actor_id", "integer", "Only events by this user."),
+		query("target_type", "string", "Only events on this kind of target."),
+		query("target_id", "string", "Only events on this target."),
+		{Name: "since", In: "query", Schema: &Schema{Type: Types{"string"}, Format: "date-time"}},
+		{Name: "until", In: "query", Schema: &Schema{Type: Types{"string"}, Format: "date-time"}},
+		query("before_id", "integer", "Only events older than this ID, for paging."),
+	}
+}
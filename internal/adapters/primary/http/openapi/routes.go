@@ -0,0 +1,75 @@
+package openapi
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MissingRoutes lists the registered routes the document does not describe,
+// as "METHOD path". Fallbacks that only report a feature as unavailable are
+// not part of the API and are skipped.
+func MissingRoutes(doc *Document, routes gin.RoutesInfo) []string {
+	var missing []string
+	for _, route := range routes {
+		if strings.HasSuffix(route.Handler, "Unavailable") {
+			continue
+		}
+		if !documented(doc, route.Method, route.Path) {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// documented reports whether the document has an operation for a gin route.
+// A custom method route like /devices:method matches any documented
+// devices:<name> operation.
+func documented(doc *Document, method, ginPath string) bool {
+	method = strings.ToLower(method)
+	path, customPrefix := templatePath(ginPath)
+	if customPrefix == "" {
+		_, ok := doc.Paths[path][method]
+		return ok
+	}
+	for path, ops := range doc.Paths {
+		if _, ok := ops[method]; ok && strings.HasPrefix(path, customPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Operation finds the operation serving a gin route, given the route's
+// full path and a lookup for its parameters. Custom method routes resolve
+// to the method actually requested.
+func (d *Document) Operation(method, ginPath string, param func(string) string) (*Operation, bool) {
+	path, customPrefix := templatePath(ginPath)
+	if customPrefix != "" {
+		_, name, _ := strings.Cut(path[len(customPrefix)-1:], ":")
+		path = customPrefix + strings.TrimPrefix(param(name), ":")
+	}
+	op, ok := d.Paths[path][strings.ToLower(method)]
+	if !ok {
+		return nil, false
+	}
+	return &op, true
+}
+
+// templatePath converts a gin path to an OpenAPI path template. For custom
+// method routes it also returns the path up to and including the colon.
+func templatePath(ginPath string) (path, customPrefix string) {
+	segments := strings.Split(ginPath, "/")
+	for i, seg := range segments {
+		switch {
+		case strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*"):
+			segments[i] = "{" + seg[1:] + "}"
+		case strings.Contains(seg, ":") && i == len(segments)-1:
+			collection, _, _ := strings.Cut(seg, ":")
+			customPrefix = strings.Join(append(segments[:i:i], collection), "/") + ":"
+		}
+	}
+	return strings.Join(segments, "/"), customPrefix
+}
@@ -0,0 +1,280 @@
+package openapi
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaRegistry derives schemas from Go types. Named structs become
+// components referenced with $ref so every DTO is described once.
+type schemaRegistry struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+	}
+}
+
+// schemaOf returns the schema for the type of v.
+func (r *schemaRegistry) schemaOf(v any) *Schema {
+	return r.schema(reflect.TypeOf(v))
+}
+
+func (r *schemaRegistry) schema(t reflect.Type) *Schema {
+	switch {
+	case t == nil:
+		return &Schema{}
+	case t == timeType:
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := r.schema(t.Elem())
+		if s.Ref == "" && len(s.Type) > 0 {
+			s.Type = append(s.Type, "null")
+		}
+		return s
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s := &Schema{Type: Types{"integer"}}
+		switch t.Kind() {
+		case reflect.Int32, reflect.Uint32:
+			s.Format = "int32"
+		case reflect.Int64, reflect.Uint64:
+			s.Format = "int64"
+		}
+		return s
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string"}, Format: "byte"}
+		}
+		return &Schema{Type: Types{"array", "null"}, Items: r.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: Types{"object", "null"}, AdditionalProperties: r.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + r.register(t)}
+	}
+	return &Schema{}
+}
+
+// register adds a named struct to the components and returns its name.
+func (r *schemaRegistry) register(t reflect.Type) string {
+	if name, ok := r.names[t]; ok {
+		return name
+	}
+	name := componentName(t)
+	if _, taken := r.schemas[name]; taken {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	r.names[t] = name
+	// Reserve the name first so self-referencing types terminate.
+	r.schemas[name] = &Schema{}
+	*r.schemas[name] = *r.structSchema(t)
+	return name
+}
+
+// componentName turns a Go type name into a component name. Generic types
+// such as ListResponse[dto.DeviceResponse] become ListResponseDeviceResponse.
+func componentName(t reflect.Type) string {
+	name, args, generic := strings.Cut(t.Name(), "[")
+	if !generic {
+		return name
+	}
+	for _, arg := range strings.Split(strings.TrimSuffix(args, "]"), ",") {
+		name += arg[strings.LastIndex(arg, ".")+1:]
+	}
+	return name
+}
+
+// structSchema describes a struct the way encoding/json writes it. Request
+// DTOs mark required fields with binding tags; types without binding tags
+// are responses, and their fields are required unless they may be omitted
+// or null.
+func (r *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: Types{"object"}, Properties: map[string]*Schema{}}
+	bound := hasBindingTags(t)
+	r.addFields(s, t, bound)
+	return s
+}
+
+func (r *schemaRegistry) addFields(s *Schema, t reflect.Type, bound bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				r.addFields(s, ft, bound)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := r.schema(f.Type)
+		required := applyBinding(prop, f.Tag.Get("binding"), f.Type)
+		if !bound {
+			required = !strings.Contains(opts, "omitempty") && !nullable(f.Type)
+		}
+		s.Properties[name] = prop
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func hasBindingTags(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("binding") != "" {
+			return true
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && hasBindingTags(f.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// applyBinding translates the validator rules in a binding tag into schema
+// keywords and reports whether the field is required.
+func applyBinding(s *Schema, tag string, t reflect.Type) bool {
+	if tag == "" {
+		return false
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	required, omitempty := false, false
+	for _, rule := range strings.Split(tag, ",") {
+		key, arg, _ := strings.Cut(rule, "=")
+		switch key {
+		case "omitempty":
+			omitempty = true
+		case "required":
+			required = true
+			// The validator treats zero values as missing.
+			if t.Kind() == reflect.String && s.MinLength == nil {
+				s.MinLength = intPtr(1)
+			}
+		case "email":
+			s.Format = "email"
+		case "url":
+			s.Format = "uri"
+		case "oneof":
+			for _, v := range strings.Fields(arg) {
+				s.Enum = append(s.Enum, v)
+			}
+		case "gt", "gte", "min", "lt", "lte", "max", "len":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			applyBound(s, key, n, t)
+		}
+	}
+	// The validator skips the other rules for empty values.
+	if omitempty && t.Kind() == reflect.String && len(s.Enum) > 0 {
+		s.Enum = append(s.Enum, "")
+	}
+	return required
+}
+
+// applyBound applies a size rule. Like the validator, it bounds the value of
+// numbers and the length of strings and slices.
+func applyBound(s *Schema, rule string, n float64, t reflect.Type) {
+	switch t.Kind() {
+	case reflect.String:
+		switch rule {
+		case "gt":
+			s.MinLength = intPtr(int(n) + 1)
+		case "gte", "min":
+			s.MinLength = intPtr(int(n))
+		case "lt":
+			s.MaxLength = intPtr(int(n) - 1)
+		case "lte", "max":
+			s.MaxLength = intPtr(int(n))
+		case "len":
+			s.MinLength, s.MaxLength = intPtr(int(n)), intPtr(int(n))
+		}
+	case reflect.Slice, reflect.Array:
+		switch rule {
+		case "gt":
+			s.MinItems = intPtr(int(n) + 1)
+		case "gte", "min":
+			s.MinItems = intPtr(int(n))
+		case "lt":
+			s.MaxItems = intPtr(int(n) - 1)
+		case "lte", "max":
+			s.MaxItems = intPtr(int(n))
+		case "len":
+			s.MinItems, s.MaxItems = intPtr(int(n)), intPtr(int(n))
+		}
+	default:
+		switch rule {
+		case "gt":
+			s.ExclusiveMinimum = &n
+		case "gte", "min":
+			s.Minimum = &n
+		case "lt":
+			s.ExclusiveMaximum = &n
+		case "lte", "max":
+			s.Maximum = &n
+		case "len":
+			s.Minimum, s.Maximum = &n, &n
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,265 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// Validate checks a decoded JSON value against a schema and reports every
+// violation as a field error. Numbers must be decoded as json.Number so
+// integers can be told apart. Field names are dotted paths into the value,
+// prefixed with field when it is not empty. Error codes follow the request
+// binding validator (required, min, max, gt, lt, oneof, email), plus type
+// for values of the wrong JSON type.
+func (d *Document) Validate(s *Schema, value any, field string) []pkg.FieldError {
+	var errs []pkg.FieldError
+	d.validate(s, value, field, &errs)
+	return errs
+}
+
+func (d *Document) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	if s == nil {
+		return &Schema{}
+	}
+	return s
+}
+
+func (d *Document) validate(s *Schema, value any, field string, errs *[]pkg.FieldError) {
+	s = d.resolve(s)
+
+	if len(s.OneOf) > 0 {
+		for _, alt := range s.OneOf {
+			if len(d.Validate(alt, value, field)) == 0 {
+				return
+			}
+		}
+		*errs = append(*errs, fieldError(field, "oneof", "%s does not match any allowed shape", label(field)))
+		return
+	}
+
+	typ := jsonType(value)
+	if len(s.Type) > 0 && !s.Type.Has(typ) && !(typ == "integer" && s.Type.Has("number")) {
+		*errs = append(*errs, fieldError(field, "type", "%s must be %s", label(field), typeList(s.Type)))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		*errs = append(*errs, fieldError(field, "oneof", "%s must be one of %s", label(field), enumList(s.Enum)))
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		validateString(s, v, field, errs)
+	case json.Number:
+		validateNumber(s, v, field, errs)
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			*errs = append(*errs, fieldError(field, "min", "%s must have at least %d items", label(field), *s.MinItems))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			*errs = append(*errs, fieldError(field, "max", "%s must have at most %d items", label(field), *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				d.validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i), errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				child := join(field, name)
+				*errs = append(*errs, fieldError(child, "required", "%s is required", child))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := s.Properties[name]; ok {
+				d.validate(prop, v[name], join(field, name), errs)
+			} else if s.AdditionalProperties != nil {
+				d.validate(s.AdditionalProperties, v[name], join(field, name), errs)
+			}
+		}
+	}
+}
+
+func validateString(s *Schema, v, field string, errs *[]pkg.FieldError) {
+	n := len([]rune(v))
+	if s.MinLength != nil && n < *s.MinLength {
+		if *s.MinLength == 1 {
+			*errs = append(*errs, fieldError(field, "required", "%s is required", label(field)))
+		} else {
+			*errs = append(*errs, fieldError(field, "min", "%s must be at least %d characters", label(field), *s.MinLength))
+		}
+		return
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		*errs = append(*errs, fieldError(field, "max", "%s must be at most %d characters", label(field), *s.MaxLength))
+		return
+	}
+	// An empty string is how optional fields are left out, so formats only
+	// apply to values that were given.
+	if v == "" {
+		return
+	}
+	switch s.Format {
+	case "email":
+		if _, err := mail.ParseAddress(v); err != nil {
+			*errs = append(*errs, fieldError(field, "email", "%s must be an email address", label(field)))
+		}
+	case "uri":
+		if u, err := url.Parse(v); err != nil || !u.IsAbs() {
+			*errs = append(*errs, fieldError(field, "uri", "%s must be an absolute URL", label(field)))
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			*errs = append(*errs, fieldError(field, "datetime", "%s must be an RFC 3339 timestamp", label(field)))
+		}
+	}
+}
+
+func validateNumber(s *Schema, v json.Number, field string, errs *[]pkg.FieldError) {
+	f, err := v.Float64()
+	if err != nil {
+		*errs = append(*errs, fieldError(field, "type", "%s must be a number", label(field)))
+		return
+	}
+	switch {
+	case s.Minimum != nil && f < *s.Minimum:
+		*errs = append(*errs, fieldError(field, "min", "%s must be at least %s", label(field), formatNumber(*s.Minimum)))
+	case s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum:
+		*errs = append(*errs, fieldError(field, "gt", "%s must be greater than %s", label(field), formatNumber(*s.ExclusiveMinimum)))
+	case s.Maximum != nil && f > *s.Maximum:
+		*errs = append(*errs, fieldError(field, "max", "%s must be at most %s", label(field), formatNumber(*s.Maximum)))
+	case s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum:
+		*errs = append(*errs, fieldError(field, "lt", "%s must be less than %s", label(field), formatNumber(*s.ExclusiveMaximum)))
+	}
+}
+
+// ValidateParameter checks the raw value of a path, query or header
+// parameter. The value is converted to the type its schema describes first,
+// so it can be validated like a body field.
+func (d *Document) ValidateParameter(p Parameter, raw string) []pkg.FieldError {
+	s := d.resolve(p.Schema)
+	v, ok := parseParameter(s, raw)
+	if !ok {
+		return []pkg.FieldError{fieldError(p.Name, "type", "%s must be %s", p.Name, typeList(s.Type))}
+	}
+	return d.Validate(s, v, p.Name)
+}
+
+func parseParameter(s *Schema, raw string) (any, bool) {
+	switch {
+	case s.Type.Has("integer"):
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(raw), true
+	case s.Type.Has("number"):
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(raw), true
+	case s.Type.Has("boolean"):
+		b, err := strconv.ParseBool(raw)
+		return b, err == nil
+	default:
+		return raw, true
+	}
+}
+
+func jsonType(v any) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := n.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case float64:
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+func inEnum(enum []any, v any) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []any) string {
+	values := make([]string, 0, len(enum))
+	for _, v := range enum {
+		if s := fmt.Sprint(v); s != "" {
+			values = append(values, s)
+		}
+	}
+	return strings.Join(values, " ")
+}
+
+func typeList(types Types) string {
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		switch t {
+		case "null":
+			continue
+		case "integer", "object", "array":
+			names = append(names, "an "+t)
+		default:
+			names = append(names, "a "+t)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func join(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func label(field string) string {
+	if field == "" {
+		return "body"
+	}
+	return field
+}
+
+func fieldError(field, code, format string, args ...any) pkg.FieldError {
+	return pkg.FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,95 @@
+// Package pagination reads list options from query strings.
+package pagination
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// Parse reads list options from the request query:
+//
+//	limit=50            page size, 1 to domain.MaxListLimit
+//	cursor=...          next_cursor from the previous page
+//	offset=100          rows to skip when no cursor is given
+//	sort=-created_at    field to order by; a leading "-" sorts descending
+//	name=x              equality filter on any other parameter
+//	name~=x             case-insensitive substring filter
+//	created_after=t     created_at later than t (created_before likewise)
+//
+// Field names are checked by the store.
+func Parse(c *gin.Context) (domain.ListOptions, error) {
+	return ParseQuery(c.Request.URL.Query())
+}
+
+// ParseQuery is Parse for an already decoded query string.
+func ParseQuery(query url.Values) (domain.ListOptions, error) {
+	var opts domain.ListOptions
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > domain.MaxListLimit {
+			return domain.ListOptions{}, pkg.InvalidField("limit", "range", fmt.Sprintf("limit must be between 1 and %d", domain.MaxListLimit))
+		}
+		opts.Limit = limit
+	}
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return domain.ListOptions{}, pkg.InvalidField("offset", "range", "offset must be a non-negative integer")
+		}
+		opts.Offset = offset
+	}
+	opts.Cursor = query.Get("cursor")
+	if raw := query.Get("sort"); raw != "" {
+		opts.Sort = strings.TrimPrefix(raw, "-")
+		opts.Desc = strings.HasPrefix(raw, "-")
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch key {
+		case "limit", "offset", "cursor", "sort":
+			continue
+		}
+		field, op := parseFilterKey(key)
+		if field == "" {
+			return domain.ListOptions{}, pkg.ErrInvalidListOptions.WithMessage(fmt.Sprintf("invalid filter %q", key))
+		}
+		for _, value := range query[key] {
+			opts.Filters = append(opts.Filters, domain.ListFilter{Field: field, Op: op, Value: value})
+		}
+	}
+
+	return opts, nil
+}
+
+// parseFilterKey splits a query key into a field and operator. Range
+// suffixes name timestamp fields without their "_at", so created_after
+// filters on created_at.
+func parseFilterKey(key string) (string, string) {
+	if field, ok := strings.CutSuffix(key, "~"); ok {
+		return field, domain.FilterContains
+	}
+	for suffix, op := range map[string]string{"_after": domain.FilterAfter, "_before": domain.FilterBefore} {
+		if base, ok := strings.CutSuffix(key, suffix); ok && base != "" {
+			if !strings.HasSuffix(base, "_at") {
+				base += "_at"
+			}
+			return base, op
+		}
+	}
+	return key, domain.FilterEquals
+}
@@ -0,0 +1,75 @@
+package pagination
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    domain.ListOptions
+		wantErr error
+	}{
+		{name: "empty", query: "", want: domain.ListOptions{}},
+		{name: "paging", query: "limit=20&offset=40", want: domain.ListOptions{Limit: 20, Offset: 40}},
+		{name: "cursor", query: "cursor=abc&limit=10", want: domain.ListOptions{Limit: 10, Cursor: "abc"}},
+		{name: "sort ascending", query: "sort=username", want: domain.ListOptions{Sort: "username"}},
+		{name: "sort descending", query: "sort=-created_at", want: domain.ListOptions{Sort: "created_at", Desc: true}},
+		{
+			name:  "filters are sorted by key",
+			query: "username~=pa&role=admin&role=owner",
+			want: domain.ListOptions{Filters: []domain.ListFilter{
+				{Field: "role", Op: domain.FilterEquals, Value: "admin"},
+				{Field: "role", Op: domain.FilterEquals, Value: "owner"},
+				{Field: "username", Op: domain.FilterContains, Value: "pa"},
+			}},
+		},
+		{
+			name:  "range filters name timestamp fields",
+			query: "created_after=2024-01-01T00:00:00Z&updated_at_before=2024-02-01T00:00:00Z",
+			want: domain.ListOptions{Filters: []domain.ListFilter{
+				{Field: "created_at", Op: domain.FilterAfter, Value: "2024-01-01T00:00:00Z"},
+				{Field: "updated_at", Op: domain.FilterBefore, Value: "2024-02-01T00:00:00Z"},
+			}},
+		},
+		{
+			name:  "bare suffix is an equality filter",
+			query: "_after=x",
+			want:  domain.ListOptions{Filters: []domain.ListFilter{{Field: "_after", Op: domain.FilterEquals, Value: "x"}}},
+		},
+		{name: "limit max", query: "limit=500", want: domain.ListOptions{Limit: domain.MaxListLimit}},
+		{name: "limit too large", query: "limit=501", wantErr: pkg.Validation()},
+		{name: "limit zero", query: "limit=0", wantErr: pkg.Validation()},
+		{name: "limit not a number", query: "limit=ten", wantErr: pkg.Validation()},
+		{name: "negative offset", query: "offset=-1", wantErr: pkg.Validation()},
+		{name: "empty filter field", query: "~=x", wantErr: pkg.ErrInvalidListOptions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseQuery(query)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseQuery: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuery = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,443 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to a resource's JSON representation.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// maxPatchBytes bounds a patch body. Patches change one resource, so this
+// is far more than any legitimate one needs.
+const maxPatchBytes = 1 << 20
+
+// AcceptPatch is the value of the Accept-Patch header for patchable
+// resources.
+const AcceptPatch = MergePatchContentType + ", " + JSONPatchContentType
+
+// Apply patches current, the resource as clients see it, with the request
+// body and decodes the result into target. Only fields that target declares
+// may change; changing any other field of current is rejected. target is
+// validated with its binding tags, so validation failures should be reported
+// with gin.ErrorTypeBind like any other bind error.
+func Apply(c *gin.Context, current, target any) error {
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	if mediaType != MergePatchContentType && mediaType != JSONPatchContentType {
+		c.Header("Accept-Patch", AcceptPatch)
+		return pkg.ErrUnsupportedPatch
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPatchBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return pkg.ErrRequestTooLarge
+		}
+		return pkg.Invalid("failed to read request body")
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return pkg.Invalid("request body is required")
+	}
+
+	// Both patch algorithms work in place, so keep a separate copy of the
+	// original to compare against.
+	original, err := toDocument(current)
+	if err != nil {
+		return err
+	}
+	doc, err := toDocument(current)
+	if err != nil {
+		return err
+	}
+
+	var patched any
+	if mediaType == MergePatchContentType {
+		var p any
+		if err := json.Unmarshal(body, &p); err != nil {
+			return pkg.ErrInvalidPatch.WithMessage("merge patch is not valid JSON")
+		}
+		patched = mergePatch(doc, p)
+	} else {
+		var ops []operation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return pkg.ErrInvalidPatch.WithMessage("json patch must be an array of operations")
+		}
+		patched, err = applyOperations(doc, ops)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, ok := patched.(map[string]any)
+	if !ok {
+		return pkg.ErrInvalidPatch.WithMessage("patched document must be an object")
+	}
+	if err := checkReadOnly(original.(map[string]any), result, target); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if err := dec.Decode(target); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(target)
+}
+
+// toDocument converts v to the generic form the patch algorithms work on.
+func toDocument(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// checkReadOnly rejects changes to fields that target does not declare.
+func checkReadOnly(before, after map[string]any, target any) error {
+	editable := jsonFieldNames(target)
+
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	var fields []pkg.FieldError
+	for k := range keys {
+		if editable[k] {
+			continue
+		}
+		if !reflect.DeepEqual(before[k], after[k]) {
+			fields = append(fields, pkg.FieldError{Field: k, Code: "read_only", Message: k + " cannot be patched"})
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return pkg.Validation(fields...)
+}
+
+func jsonFieldNames(v any) map[string]bool {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// mergePatch implements RFC 7396: objects merge recursively, null removes a
+// member and anything else replaces the target outright.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+var errMissingValue = errors.New("missing value")
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (o operation) value() (any, error) {
+	if o.Value == nil {
+		return nil, errMissingValue
+	}
+	var v any
+	err := json.Unmarshal(o.Value, &v)
+	return v, err
+}
+
+// applyOperations implements RFC 6902. The operations apply in order and
+// the patch fails as a whole if any of them fails.
+func applyOperations(doc any, ops []operation) (any, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = applyOperation(doc, op)
+		if err != nil {
+			var e *pkg.Error
+			if errors.As(err, &e) {
+				return nil, err
+			}
+			return nil, pkg.ErrInvalidPatch.WithMessage(fmt.Sprintf("operation %d: %v", i, err))
+		}
+	}
+	return doc, nil
+}
+
+func applyOperation(doc any, op operation) (any, error) {
+	if op.Path == nil {
+		return nil, errors.New("path is required")
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		doc, _, err = remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "move", "copy":
+		if op.From == nil {
+			return nil, errors.New("from is required")
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v any
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, errors.New("cannot move a value into itself")
+			}
+			doc, v, err = remove(doc, from)
+		} else {
+			v, err = get(doc, from)
+			if err == nil {
+				// Copies must not share structure with the original.
+				v, err = toDocument(v)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, v)
+	case "test":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := get(doc, path)
+		if err != nil || !reflect.DeepEqual(got, v) {
+			return nil, pkg.ErrPatchTestFailed.WithMessage("test failed at " + *op.Path)
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into unescaped tokens.
+func parsePointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("path %q must start with /", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path /%s not found", token)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path /%s not found", token)
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at path. For arrays the value is inserted, and "-"
+// appends.
+func add(doc any, path []string, v any) (any, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = v
+		return doc, nil
+	case []any:
+		i := len(node)
+		if last != "-" {
+			if i, err = arrayIndex(last, len(node)); err != nil {
+				return nil, err
+			}
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = v
+		return set(doc, path[:len(path)-1], node)
+	default:
+		return nil, errors.New("cannot add to a scalar")
+	}
+}
+
+// remove deletes the value at path and returns it.
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		v, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("path /%s not found", last)
+		}
+		delete(node, last)
+		return doc, v, nil
+	case []any:
+		i, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = set(doc, path[:len(path)-1], node)
+		return doc, v, err
+	default:
+		return nil, nil, fmt.Errorf("path /%s not found", last)
+	}
+}
+
+// set replaces the value at an existing path. Slices change identity when
+// they grow or shrink, so their parent must be updated.
+func set(doc any, path []string, v any) (any, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = v
+	case []any:
+		i, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = v
+	}
+	return doc, nil
+}
+
+// arrayIndex parses an array index token no greater than max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i := 0
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid array index %q", token)
+		}
+		i = i*10 + int(r-'0')
+		if i > max {
+			return 0, fmt.Errorf("array index %s out of range", token)
+		}
+	}
+	return i, nil
+}
@@ -0,0 +1,258 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("bad test JSON %s: %v", s, err)
+	}
+	return v
+}
+
+// The cases come from RFC 7396 Appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		got := mergePatch(decode(t, tt.target), decode(t, tt.patch))
+		if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
+
+// Most cases come from RFC 6902 Appendix A.
+func TestApplyOperations(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		ops     string
+		want    string
+		wantErr error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, nil},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"append", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, nil},
+		{"add null", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":null}]`, `{"baz":null,"foo":"bar"}`, nil},
+		{"add nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`, nil},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, nil},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, nil},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, nil},
+		{"test passes", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`, nil},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`, nil},
+		{"operations apply in order", `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"move","from":"/a","path":"/c"}]`, `{"b":2,"c":1}`, nil},
+		{"test fails", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", pkg.ErrPatchTestFailed},
+		{"test of a missing path", `{}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", pkg.ErrPatchTestFailed},
+		{"test compares numbers by value", `{"n":1}`, `[{"op":"test","path":"/n","value":1.0}]`, `{"n":1}`, nil},
+		{"add to a missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", pkg.ErrInvalidPatch},
+		{"remove a missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "", pkg.ErrInvalidPatch},
+		{"replace a missing member", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`, "", pkg.ErrInvalidPatch},
+		{"index out of range", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"x"}]`, "", pkg.ErrInvalidPatch},
+		{"index with leading zero", `{"foo":["a","b"]}`, `[{"op":"remove","path":"/foo/01"}]`, "", pkg.ErrInvalidPatch},
+		{"non-numeric index", `{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/x"}]`, "", pkg.ErrInvalidPatch},
+		{"missing value", `{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, "", pkg.ErrInvalidPatch},
+		{"missing path", `{"foo":"bar"}`, `[{"op":"remove"}]`, "", pkg.ErrInvalidPatch},
+		{"missing from", `{"foo":"bar"}`, `[{"op":"move","path":"/baz"}]`, "", pkg.ErrInvalidPatch},
+		{"relative path", `{"foo":"bar"}`, `[{"op":"remove","path":"foo"}]`, "", pkg.ErrInvalidPatch},
+		{"move into itself", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, "", pkg.ErrInvalidPatch},
+		{"unknown op", `{"foo":"bar"}`, `[{"op":"merge","path":"/foo","value":1}]`, "", pkg.ErrInvalidPatch},
+		{"all or nothing", `{"a":1}`, `[{"op":"remove","path":"/a"},{"op":"remove","path":"/a"}]`, "", pkg.ErrInvalidPatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []operation
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyOperations(decode(t, tt.doc), ops)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyOperations: %v", err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("result = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type resource struct {
+	ID       int64    `json:"id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Role     string   `json:"role"`
+	Tags     []string `json:"tags"`
+}
+
+type resourcePatch struct {
+	Username string   `json:"username" binding:"required,min=3"`
+	Email    string   `json:"email" binding:"omitempty,email"`
+	Tags     []string `json:"tags"`
+}
+
+func TestApply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	current := resource{ID: 7, Username: "pat", Email: "pat@example.com", Role: "user", Tags: []string{"a"}}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        resourcePatch
+		wantErr     error
+		wantFields  []string
+		wantBindErr bool
+	}{
+		{
+			name:        "merge patch",
+			contentType: MergePatchContentType,
+			body:        `{"username":"sam"}`,
+			want:        resourcePatch{Username: "sam", Email: "pat@example.com", Tags: []string{"a"}},
+		},
+		{
+			name:        "merge patch removes a field",
+			contentType: MergePatchContentType + "; charset=utf-8",
+			body:        `{"email":null}`,
+			want:        resourcePatch{Username: "pat", Tags: []string{"a"}},
+		},
+		{
+			name:        "json patch",
+			contentType: JSONPatchContentType,
+			body:        `[{"op":"test","path":"/username","value":"pat"},{"op":"add","path":"/tags/-","value":"b"}]`,
+			want:        resourcePatch{Username: "pat", Email: "pat@example.com", Tags: []string{"a", "b"}},
+		},
+		{
+			name:        "setting a read-only field to its current value",
+			contentType: MergePatchContentType,
+			body:        `{"id":7,"role":"user","username":"sam"}`,
+			want:        resourcePatch{Username: "sam", Email: "pat@example.com", Tags: []string{"a"}},
+		},
+		{
+			name:        "read-only fields",
+			contentType: MergePatchContentType,
+			body:        `{"role":"admin","id":1}`,
+			wantErr:     pkg.Validation(),
+			wantFields:  []string{"id", "role"},
+		},
+		{
+			name:        "removing a read-only field",
+			contentType: JSONPatchContentType,
+			body:        `[{"op":"remove","path":"/role"}]`,
+			wantErr:     pkg.Validation(),
+			wantFields:  []string{"role"},
+		},
+		{
+			name:        "adding an unknown field",
+			contentType: MergePatchContentType,
+			body:        `{"is_admin":true}`,
+			wantErr:     pkg.Validation(),
+			wantFields:  []string{"is_admin"},
+		},
+		{
+			name:        "binding rules apply to the result",
+			contentType: MergePatchContentType,
+			body:        `{"email":"not-an-email"}`,
+			wantBindErr: true,
+		},
+		{
+			name:        "required fields cannot be removed",
+			contentType: MergePatchContentType,
+			body:        `{"username":null}`,
+			wantBindErr: true,
+		},
+		{name: "plain json", contentType: "application/json", body: `{"username":"sam"}`, wantErr: pkg.ErrUnsupportedPatch},
+		{name: "empty body", contentType: MergePatchContentType, body: " ", wantErr: pkg.Invalid("")},
+		{name: "malformed merge patch", contentType: MergePatchContentType, body: `{`, wantErr: pkg.ErrInvalidPatch},
+		{name: "json patch is not an array", contentType: JSONPatchContentType, body: `{"op":"remove"}`, wantErr: pkg.ErrInvalidPatch},
+		{name: "result is not an object", contentType: MergePatchContentType, body: `["x"]`, wantErr: pkg.ErrInvalidPatch},
+		{name: "failed test", contentType: JSONPatchContentType, body: `[{"op":"test","path":"/username","value":"sam"}]`, wantErr: pkg.ErrPatchTestFailed},
+		{name: "body over the limit", contentType: MergePatchContentType, body: `{"username":"` + strings.Repeat("x", maxPatchBytes) + `"}`, wantErr: pkg.ErrRequestTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/things/7", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+
+			var got resourcePatch
+			err := Apply(c, current, &got)
+			switch {
+			case tt.wantBindErr:
+				var verrs validator.ValidationErrors
+				if !errors.As(err, &verrs) {
+					t.Fatalf("err = %v, want validation errors from binding", err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantFields != nil {
+					var e *pkg.Error
+					errors.As(err, &e)
+					var fields []string
+					for _, f := range e.Fields {
+						fields = append(fields, f.Field)
+						if f.Code != "read_only" {
+							t.Errorf("field %s code = %q, want read_only", f.Field, f.Code)
+						}
+					}
+					if !reflect.DeepEqual(fields, tt.wantFields) {
+						t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+					}
+				}
+				if errors.Is(err, pkg.ErrUnsupportedPatch) && w.Header().Get("Accept-Patch") != AcceptPatch {
+					t.Errorf("Accept-Patch = %q, want %q", w.Header().Get("Accept-Patch"), AcceptPatch)
+				}
+			case err != nil:
+				t.Fatalf("Apply: %v", err)
+			default:
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("target = %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	if current.Username != "pat" || !reflect.DeepEqual(current.Tags, []string{"a"}) {
+		t.Errorf("Apply modified the current resource: %+v", current)
+	}
+}
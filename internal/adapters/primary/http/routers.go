@@ -2,53 +2,258 @@ package http
 
 import (
 	"go/version"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 
-	httphandlers "github.com/reginaldsourn/go-crud/internal/adapters/http/handlers"
+	"github.com/reginaldsourn/go-crud/internal/adapters/auth"
 	primaryhandlers "github.com/reginaldsourn/go-crud/internal/adapters/primary/http/handlers"
 	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/middleware"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/openapi"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
 	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	"github.com/reginaldsourn/go-crud/internal/core/services"
 	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+	"github.com/reginaldsourn/go-crud/pkg/password"
 )
 
 type RouterDependencies struct {
-	UserStore ports.UserStore
-	JWTSecret []byte
-	JWTTTL    time.Duration
+	// TrustedProxies lists the proxy IPs and CIDRs allowed to report the
+	// client IP through X-Forwarded-For. None are trusted when it is empty.
+	TrustedProxies []string
+
+	UserStore   ports.UserStore
+	DeviceStore ports.DeviceStore
+	// Tokens issues and verifies every token handed out by this server.
+	Tokens TokenService
+	// JWKS publishes the token verification keys. It is nil when tokens are
+	// signed with a shared secret, and the endpoint then serves an empty set.
+	JWKS primaryhandlers.JWKSProvider
+
+	PasswordResetStore ports.PasswordResetStore
+	Mailer             ports.Mailer
+	PasswordResetURL   string
+	PasswordResetTTL   time.Duration
+
+	// InvitationStore lets admins invite users by email. Invitations are
+	// mailed through Mailer when it is set.
+	InvitationStore ports.InvitationStore
+	InvitationURL   string
+	InvitationTTL   time.Duration
+	// DisableRegistration closes /register so accounts can only be created
+	// by admins or through invitations.
+	DisableRegistration bool
+
+	// OIDC enables login through an external OpenID Connect provider when
+	// set together with ExternalIdentityStore.
+	OIDC                  *auth.OIDCClient
+	ExternalIdentityStore ports.ExternalIdentityStore
+	OIDCOptions           primaryhandlers.OIDCHandlerOptions
+
+	// SessionStore records logins so users can list and revoke them. Without
+	// it tokens are not tied to sessions.
+	SessionStore ports.SessionStore
+
+	// AuditStore receives the audit trail and serves /audit. Without it
+	// nothing is audited.
+	AuditStore ports.AuditStore
+
+	// APIKeyStore enables personal API keys when set.
+	APIKeyStore ports.APIKeyStore
+
+	MFAStore    ports.MFAStore
+	MFAIssuer   string
+	MFATokenTTL time.Duration
+
+	// LoginThrottle is optional; without it login attempts are unlimited.
+	LoginThrottle *auth.LoginThrottle
+
+	// IdempotencyStore lets clients retry creates safely with an
+	// Idempotency-Key header. Without it the header is ignored. Responses
+	// are kept for IdempotencyTTL, 24 hours by default. Requests are
+	// compared by an HMAC keyed with IdempotencySecret.
+	IdempotencyStore  ports.IdempotencyStore
+	IdempotencyTTL    time.Duration
+	IdempotencySecret []byte
+
+	// ImpersonationTTL caps how long an admin can act as another user.
+	// Impersonation is only offered when AuditStore is set. Defaults to 15
+	// minutes.
+	ImpersonationTTL time.Duration
+
+	// AccountClosureGrace is how long a closed account is kept before it is
+	// purged. Defaults to 30 days.
+	AccountClosureGrace time.Duration
+
+	PasswordPolicy password.Policy
+	// PasswordHasher defaults to bcrypt when nil.
+	PasswordHasher ports.PasswordHasher
+}
+
+const apiVersion = "v1"
+
+type TokenService interface {
+	ports.TokenIssuer
+	ports.TokenVerifier
 }
 
 func NewRouter(deps RouterDependencies) *gin.Engine {
 	router := gin.New()
+	// Client IPs feed the login throttle and the audit trail, so they must
+	// not be taken from headers anyone can set.
+	if err := router.SetTrustedProxies(deps.TrustedProxies); err != nil {
+		log.Printf("ignoring trusted proxies: %v", err)
+		_ = router.SetTrustedProxies(nil)
+	}
 	router.Use(gin.Recovery())
+	router.Use(middleware.RequestID())
 	router.Use(middleware.Logging())
-	router.Use(middleware.CORS(middleware.CORSOptions{}))
+	router.Use(middleware.Problems())
+	router.Use(middleware.CORS(middleware.CORSOptions{
+		AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", middleware.IdempotencyKeyHeader},
+		ExposedHeaders: []string{middleware.RequestIDHeader, "ETag", middleware.IdempotentReplayedHeader},
+	}))
+	router.Use(middleware.Validation(openapi.Spec(), middleware.ValidationOptions{
+		Responses: gin.Mode() == gin.TestMode,
+	}))
+
+	hasher := deps.PasswordHasher
+	if hasher == nil {
+		hasher = password.NewChain(password.NewBcryptHasher(0))
+	}
 
 	userStoreAvailable := deps.UserStore != nil
-	var userHandler *httphandlers.UserHandler
+	var users *services.UserService
+	var usersHandler *primaryhandlers.UsersHandler
 	var authHandler *primaryhandlers.AuthHandler
 	if userStoreAvailable {
-		userHandler = httphandlers.NewUserHandler(deps.UserStore)
+		users = services.NewUserService(deps.UserStore, hasher, deps.PasswordPolicy, deps.DisableRegistration)
+		usersHandler = primaryhandlers.NewUsersHandler(users, deps.AuditStore)
 	}
 
-	ttl := deps.JWTTTL
-	if ttl <= 0 {
-		ttl = 24 * time.Hour
+	mfaTTL := deps.MFATokenTTL
+	if mfaTTL <= 0 {
+		mfaTTL = 5 * time.Minute
 	}
 	if userStoreAvailable {
-		authHandler = primaryhandlers.NewAuthHandler(deps.UserStore, deps.JWTSecret, ttl)
+		authHandler = primaryhandlers.NewAuthHandler(users, deps.MFAStore, deps.LoginThrottle, deps.Tokens, deps.Tokens, deps.SessionStore, mfaTTL, deps.AuditStore)
+	}
+
+	var mfaHandler *primaryhandlers.MFAHandler
+	mfaAvailable := userStoreAvailable && deps.MFAStore != nil
+	if mfaAvailable {
+		mfaHandler = primaryhandlers.NewMFAHandler(users, deps.MFAStore, deps.MFAIssuer)
+	}
+
+	var passwordHandler *primaryhandlers.PasswordHandler
+	passwordResetAvailable := userStoreAvailable && deps.PasswordResetStore != nil && deps.Mailer != nil
+	if passwordResetAvailable {
+		resetTTL := deps.PasswordResetTTL
+		if resetTTL <= 0 {
+			resetTTL = time.Hour
+		}
+		passwordHandler = primaryhandlers.NewPasswordHandler(deps.PasswordResetStore, deps.Mailer, deps.PasswordResetURL, resetTTL, users, deps.SessionStore)
+	}
+
+	var invitationsHandler *primaryhandlers.InvitationsHandler
+	invitationsAvailable := userStoreAvailable && deps.InvitationStore != nil
+	if invitationsAvailable {
+		inviteTTL := deps.InvitationTTL
+		if inviteTTL <= 0 {
+			inviteTTL = 7 * 24 * time.Hour
+		}
+		invitationsHandler = primaryhandlers.NewInvitationsHandler(deps.InvitationStore, deps.Mailer, deps.InvitationURL, inviteTTL, users, deps.AuditStore)
 	}
 
+	var oidcHandler *primaryhandlers.OIDCHandler
+	oidcAvailable := userStoreAvailable && deps.OIDC != nil && deps.ExternalIdentityStore != nil
+	if oidcAvailable {
+		oidcOpts := deps.OIDCOptions
+		oidcOpts.CookiePath = "/api/" + apiVersion + "/oidc"
+		oidcHandler = primaryhandlers.NewOIDCHandler(deps.OIDC, deps.ExternalIdentityStore, users, deps.Tokens, deps.MFAStore, mfaTTL, deps.SessionStore, deps.AuditStore, oidcOpts)
+	}
+
+	var apiKeysHandler *primaryhandlers.APIKeysHandler
+	apiKeysAvailable := userStoreAvailable && deps.APIKeyStore != nil
+	if apiKeysAvailable {
+		apiKeysHandler = primaryhandlers.NewAPIKeysHandler(deps.APIKeyStore)
+	}
+
+	var devicesHandler *primaryhandlers.DevicesHandler
+	deviceStoreAvailable := deps.DeviceStore != nil
+	if deviceStoreAvailable {
+		devicesHandler = primaryhandlers.NewDevicesHandler(services.NewDeviceService(deps.DeviceStore), deps.AuditStore)
+	}
+
+	var accountHandler *primaryhandlers.AccountHandler
+	if userStoreAvailable {
+		grace := deps.AccountClosureGrace
+		if grace <= 0 {
+			grace = 30 * 24 * time.Hour
+		}
+		accountHandler = primaryhandlers.NewAccountHandler(users, deps.LoginThrottle, deps.Tokens, deps.SessionStore, grace, deps.AuditStore)
+	}
+
+	var impersonationHandler *primaryhandlers.ImpersonationHandler
+	impersonationAvailable := userStoreAvailable && deps.AuditStore != nil
+	if impersonationAvailable {
+		ttl := deps.ImpersonationTTL
+		if ttl <= 0 {
+			ttl = 15 * time.Minute
+		}
+		impersonationHandler = primaryhandlers.NewImpersonationHandler(users, deps.Tokens, deps.AuditStore, ttl)
+	}
+
+	var auditHandler *primaryhandlers.AuditHandler
+	auditAvailable := userStoreAvailable && deps.AuditStore != nil
+	if auditAvailable {
+		auditHandler = primaryhandlers.NewAuditHandler(deps.AuditStore)
+	}
+
+	var sessionsHandler *primaryhandlers.SessionsHandler
+	sessionsAvailable := userStoreAvailable && deps.SessionStore != nil
+	if sessionsAvailable {
+		sessionsHandler = primaryhandlers.NewSessionsHandler(deps.SessionStore)
+	}
+
+	requireAuth := middleware.AuthMiddleware(middleware.AuthOptions{
+		Verifier: deps.Tokens,
+		Users:    deps.UserStore,
+		APIKeys:  deps.APIKeyStore,
+		Sessions: deps.SessionStore,
+		Audit:    deps.AuditStore,
+	})
+	requireInteractive := middleware.RequireInteractive()
+	forbidImpersonation := middleware.ForbidImpersonation()
+	requireAdmin := middleware.RequireRole(deps.UserStore, domain.RoleAdmin)
+
+	idempotent := func(c *gin.Context) { c.Next() }
+	if deps.IdempotencyStore != nil {
+		ttl := deps.IdempotencyTTL
+		if ttl <= 0 {
+			ttl = 24 * time.Hour
+		}
+		idempotent = middleware.Idempotency(deps.IdempotencyStore, ttl, deps.IdempotencySecret)
+	}
+
+	router.NoRoute(func(c *gin.Context) {
+		c.Error(pkg.NotFound("no route for " + c.Request.Method + " " + c.Request.URL.Path))
+	})
+
 	router.GET("/hello", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Hello, World!",
 		})
 	})
 
-	v := "v1"
+	router.GET("/.well-known/jwks.json", primaryhandlers.NewJWKSHandler(deps.JWKS).Get)
+	router.GET("/openapi.json", openapi.ServeSpec)
+	router.GET("/docs", openapi.ServeDocs)
+
+	v := apiVersion
 	router.GET("/versions", func(c *gin.Context) {
 		toolchain := "go1.22.0"
 		c.JSON(http.StatusOK, gin.H{
@@ -63,76 +268,182 @@ func NewRouter(deps RouterDependencies) *gin.Engine {
 
 	api := router.Group("/api/" + v)
 	{
-		api.POST("/register", func(c *gin.Context) {
-			if !userStoreAvailable {
-				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "user store not configured"})
-				return
-			}
+		if userStoreAvailable {
+			api.POST("/register", idempotent, usersHandler.Register)
+			api.POST("/login", authHandler.Login)
+			api.POST("/logout", requireAuth, authHandler.Logout)
+		} else {
+			api.POST("/register", serviceUnavailable)
+			api.POST("/login", serviceUnavailable)
+			api.POST("/logout", serviceUnavailable)
+		}
 
-			var req struct {
-				Username string `json:"username" binding:"required"`
-				Password string `json:"password" binding:"required"`
-			}
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
+		if oidcAvailable {
+			api.GET("/oidc/login", oidcHandler.Login)
+			api.GET("/oidc/callback", oidcHandler.Callback)
+		} else {
+			api.GET("/oidc/login", oidcUnavailable)
+			api.GET("/oidc/callback", oidcUnavailable)
+		}
 
-			passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
-				return
-			}
+		mfaAPI := api.Group("/me/mfa", requireAuth, requireInteractive, forbidImpersonation)
+		if mfaAvailable {
+			api.POST("/login/mfa", authHandler.LoginMFA)
+			mfaAPI.POST("/totp", mfaHandler.Enroll)
+			mfaAPI.POST("/totp/verify", mfaHandler.Verify)
+			mfaAPI.DELETE("/totp", mfaHandler.Disable)
+			mfaAPI.POST("/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+		} else {
+			api.POST("/login/mfa", serviceUnavailable)
+			mfaAPI.Any("/*path", serviceUnavailable)
+		}
 
-			u, err := deps.UserStore.Create(c.Request.Context(), req.Username, passwordHash)
-			if err != nil {
-				status := http.StatusBadRequest
-				if err == pkg.ErrUsernameExists {
-					status = http.StatusConflict
-				}
-				c.JSON(status, gin.H{"error": err.Error()})
-				return
-			}
+		sessionsAPI := api.Group("/me/sessions", requireAuth)
+		if sessionsAvailable {
+			sessionsAPI.GET("", sessionsHandler.List)
+			sessionsAPI.DELETE("/:id", forbidImpersonation, sessionsHandler.Delete)
+		} else {
+			sessionsAPI.Any("", serviceUnavailable)
+			sessionsAPI.Any("/:id", serviceUnavailable)
+		}
 
-			c.JSON(http.StatusCreated, gin.H{
-				"id":       u.ID,
-				"username": u.Username,
-			})
-		})
+		apiKeysAPI := api.Group("/me/api-keys", requireAuth, requireInteractive, forbidImpersonation)
+		if apiKeysAvailable {
+			apiKeysAPI.GET("", apiKeysHandler.List)
+			apiKeysAPI.POST("", apiKeysHandler.Create)
+			apiKeysAPI.DELETE("/:id", apiKeysHandler.Delete)
+		} else {
+			apiKeysAPI.Any("", serviceUnavailable)
+			apiKeysAPI.Any("/:id", serviceUnavailable)
+		}
+
+		if passwordResetAvailable {
+			api.POST("/password/forgot", passwordHandler.Forgot)
+			api.POST("/password/reset", passwordHandler.Reset)
+		} else {
+			api.POST("/password/forgot", serviceUnavailable)
+			api.POST("/password/reset", serviceUnavailable)
+		}
+
+		invitationsAPI := api.Group("/invitations")
+		if invitationsAvailable {
+			invitationsAPI.GET("/accept", invitationsHandler.Lookup)
+			invitationsAPI.POST("/accept", invitationsHandler.Accept)
+			invitationsAPI.POST("", requireAuth, requireAdmin, invitationsHandler.Create)
+			invitationsAPI.GET("", requireAuth, requireAdmin, invitationsHandler.List)
+			invitationsAPI.DELETE("/:id", requireAuth, requireAdmin, invitationsHandler.Delete)
+		} else {
+			invitationsAPI.Any("", serviceUnavailable)
+			invitationsAPI.Any("/:id", serviceUnavailable)
+		}
 
 		if userStoreAvailable {
-			api.POST("/login", authHandler.Login)
-			api.POST("/logout", middleware.AuthMiddleware(deps.JWTSecret), authHandler.Logout)
+			api.GET("/me", requireAuth, accountHandler.Get)
+			api.PATCH("/me", requireAuth, forbidImpersonation, accountHandler.Update)
+			api.DELETE("/me", requireAuth, requireInteractive, forbidImpersonation, accountHandler.Close)
+			api.POST("/me/password", requireAuth, requireInteractive, forbidImpersonation, accountHandler.ChangePassword)
 		} else {
-			api.POST("/login", serviceUnavailable)
-			api.POST("/logout", serviceUnavailable)
+			api.Any("/me", serviceUnavailable)
+			api.POST("/me/password", serviceUnavailable)
 		}
 
-		api.GET("/me", middleware.AuthMiddleware(deps.JWTSecret), func(c *gin.Context) {
-			username, _ := c.Get("username")
-			c.JSON(http.StatusOK, gin.H{
-				"username": username,
-			})
-		})
+		auditAPI := api.Group("/audit")
+		if auditAvailable {
+			auditAPI.GET("", requireAuth, requireAdmin, auditHandler.List)
+			auditAPI.GET("/export", requireAuth, requireAdmin, auditHandler.Export)
+		} else {
+			auditAPI.Any("", serviceUnavailable)
+			auditAPI.Any("/export", serviceUnavailable)
+		}
 
-		usersAPI := api.Group("/users", middleware.AuthMiddleware(deps.JWTSecret))
+		// Custom methods such as /devices:batch share the collection's path
+		// segment, so gin sees them as a parameter that starts with ':'.
+		if userStoreAvailable {
+			api.POST("/users:method", requireAuth, requireAdmin, customMethods(map[string]gin.HandlerFunc{
+				"batch": usersHandler.Batch,
+			}))
+		}
+		if deviceStoreAvailable {
+			api.POST("/devices:method", requireAuth, customMethods(map[string]gin.HandlerFunc{
+				"batch": devicesHandler.Batch,
+			}))
+		}
+
+		usersAPI := api.Group("/users", requireAuth)
 		{
 			if userStoreAvailable {
-				usersAPI.POST("", userHandler.Create)
-				usersAPI.GET("", userHandler.List)
-				usersAPI.GET("/:id", userHandler.Get)
-				usersAPI.PUT("/:id", userHandler.Update)
-				usersAPI.DELETE("/:id", userHandler.Delete)
+				// Accounts are changed by admins; everyone else changes
+				// their own through /me.
+				usersAPI.POST("", requireAdmin, idempotent, usersHandler.Create)
+				usersAPI.GET("", usersHandler.List)
+				usersAPI.GET("/deleted", requireAdmin, usersHandler.ListDeleted)
+				usersAPI.GET("/export", requireAdmin, usersHandler.Export)
+				usersAPI.GET("/:id", usersHandler.Get)
+				usersAPI.PUT("/:id", requireAdmin, usersHandler.Update)
+				usersAPI.PATCH("/:id", requireAdmin, usersHandler.Patch)
+				usersAPI.DELETE("/:id", requireAdmin, usersHandler.Delete)
+				usersAPI.POST("/:id/unlock", requireAdmin, authHandler.Unlock)
+				usersAPI.POST("/:id/restore", requireAdmin, usersHandler.Restore)
+				usersAPI.PUT("/:id/role", requireAdmin, usersHandler.SetRole)
+				if impersonationAvailable {
+					usersAPI.POST("/:id/impersonate", requireAdmin, requireInteractive, forbidImpersonation, impersonationHandler.Start)
+				} else {
+					usersAPI.POST("/:id/impersonate", impersonationUnavailable)
+				}
 			} else {
 				usersAPI.Any("", serviceUnavailable)
 				usersAPI.Any("/:id", serviceUnavailable)
 			}
 		}
+
+		devicesAPI := api.Group("/devices", requireAuth)
+		{
+			if deviceStoreAvailable {
+				devicesAPI.POST("", idempotent, devicesHandler.Create)
+				devicesAPI.GET("", devicesHandler.List)
+				devicesAPI.GET("/deleted", requireAdmin, devicesHandler.ListDeleted)
+				devicesAPI.GET("/export", devicesHandler.Export)
+				devicesAPI.POST("/import", devicesHandler.Import)
+				devicesAPI.GET("/:id", devicesHandler.Get)
+				devicesAPI.PUT("/:id", devicesHandler.Update)
+				devicesAPI.PATCH("/:id", devicesHandler.Patch)
+				devicesAPI.DELETE("/:id", devicesHandler.Delete)
+				devicesAPI.POST("/:id/restore", requireAdmin, devicesHandler.Restore)
+			} else {
+				devicesAPI.Any("", deviceStoreUnavailable)
+				devicesAPI.Any("/:id", deviceStoreUnavailable)
+			}
+		}
 	}
 
 	return router
 }
 
 func serviceUnavailable(c *gin.Context) {
-	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "user store not configured"})
+	c.Error(pkg.Unavailable("user store not configured"))
+}
+
+func deviceStoreUnavailable(c *gin.Context) {
+	c.Error(pkg.Unavailable("device store not configured"))
+}
+
+func impersonationUnavailable(c *gin.Context) {
+	c.Error(pkg.Unavailable("impersonation requires an audit store"))
+}
+
+func oidcUnavailable(c *gin.Context) {
+	c.Error(pkg.Unavailable("oidc login not configured"))
+}
+
+// customMethods dispatches POST /collection:method routes by method name.
+func customMethods(methods map[string]gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name, ok := strings.CutPrefix(c.Param("method"), ":")
+		handler := methods[name]
+		if !ok || handler == nil {
+			c.Error(pkg.NotFound("no route for " + c.Request.Method + " " + c.Request.URL.Path))
+			return
+		}
+		handler(c)
+	}
 }
@@ -0,0 +1,398 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reginaldsourn/go-crud/internal/adapters/auth"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/dto"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/middleware"
+	"github.com/reginaldsourn/go-crud/internal/adapters/primary/http/openapi"
+	"github.com/reginaldsourn/go-crud/internal/adapters/secondary/memory"
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	sharedauth "github.com/reginaldsourn/go-crud/pkg/auth"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+	"github.com/reginaldsourn/go-crud/pkg/password"
+)
+
+// The stubs only need to be non-nil so every optional route is registered;
+// none of their methods are called.
+type (
+	stubUsers       struct{ ports.UserStore }
+	stubDevices     struct{ ports.DeviceStore }
+	stubTokens      struct{ TokenService }
+	stubResets      struct{ ports.PasswordResetStore }
+	stubMailer      struct{ ports.Mailer }
+	stubInvitations struct{ ports.InvitationStore }
+	stubIdentities  struct{ ports.ExternalIdentityStore }
+	stubSessions    struct{ ports.SessionStore }
+	stubAudit       struct{ ports.AuditStore }
+	stubAPIKeys     struct{ ports.APIKeyStore }
+	stubMFA         struct{ ports.MFAStore }
+	stubIdempotency struct{ ports.IdempotencyStore }
+)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	oidc, err := auth.NewOIDCClient(auth.OIDCOptions{Issuer: "https://idp.example", ClientID: "client", RedirectURL: "https://app.example/callback"})
+	if err != nil {
+		t.Fatalf("NewOIDCClient: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		deps RouterDependencies
+	}{
+		{name: "no dependencies"},
+		{name: "every feature", deps: RouterDependencies{
+			UserStore:             stubUsers{},
+			DeviceStore:           stubDevices{},
+			Tokens:                stubTokens{},
+			PasswordResetStore:    stubResets{},
+			Mailer:                stubMailer{},
+			InvitationStore:       stubInvitations{},
+			OIDC:                  oidc,
+			ExternalIdentityStore: stubIdentities{},
+			SessionStore:          stubSessions{},
+			AuditStore:            stubAudit{},
+			APIKeyStore:           stubAPIKeys{},
+			MFAStore:              stubMFA{},
+			IdempotencyStore:      stubIdempotency{},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter(tt.deps)
+			if missing := openapi.MissingRoutes(openapi.Spec(), r.Routes()); len(missing) > 0 {
+				t.Errorf("routes missing from the openapi document: %v", missing)
+			}
+		})
+	}
+}
+
+// registeredUsers accepts each username once, like the real store.
+type registeredUsers struct {
+	ports.UserStore
+	byName map[string]domain.User
+}
+
+func (s *registeredUsers) Create(ctx context.Context, username, email string, passwordHash []byte) (domain.User, error) {
+	if _, ok := s.byName[username]; ok {
+		return domain.User{}, pkg.ErrUsernameExists
+	}
+	u := domain.User{ID: int64(len(s.byName) + 1), Username: username, Email: email, PasswordHash: passwordHash, Version: 1}
+	s.byName[username] = u
+	return u, nil
+}
+
+func TestRegisterRetryIsReplayed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := &registeredUsers{byName: map[string]domain.User{}}
+	r := NewRouter(RouterDependencies{
+		UserStore:         users,
+		Tokens:            stubTokens{},
+		PasswordPolicy:    password.DefaultPolicy(),
+		PasswordHasher:    password.NewChain(password.NewBcryptHasher(4)),
+		IdempotencyStore:  memory.NewIdempotencyStore(),
+		IdempotencySecret: []byte("secret"),
+	})
+	register := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/register", strings.NewReader(`{"username":"pat","password":"Passw0rd!x"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := register("signup-1")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first registration: status = %d: %s", first.Code, first.Body)
+	}
+	retry := register("signup-1")
+	if retry.Code != http.StatusCreated || retry.Header().Get(middleware.IdempotentReplayedHeader) != "true" {
+		t.Fatalf("retry: status = %d replayed = %q, want the first 201 replayed: %s", retry.Code, retry.Header().Get(middleware.IdempotentReplayedHeader), retry.Body)
+	}
+	var got dto.RegisterResponse
+	if err := json.Unmarshal(retry.Body.Bytes(), &got); err != nil || got.ID != 1 || got.Username != "pat" {
+		t.Errorf("replayed body = %s (%v), want account 1", retry.Body, err)
+	}
+	if len(users.byName) != 1 {
+		t.Errorf("created %d accounts, want 1", len(users.byName))
+	}
+
+	if w := register(""); w.Code != http.StatusConflict {
+		t.Errorf("registration without a key: status = %d, want 409", w.Code)
+	}
+}
+
+// sessionUsers holds accounts for logging in.
+type sessionUsers struct {
+	ports.UserStore
+	users []domain.User
+}
+
+func (s sessionUsers) GetByUsername(ctx context.Context, username string) (domain.User, error) {
+	for _, u := range s.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return domain.User{}, pkg.ErrUserNotFound
+}
+
+func (s sessionUsers) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	for _, u := range s.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return domain.User{}, pkg.ErrUserNotFound
+}
+
+// memorySessions keeps sessions by ID.
+type memorySessions struct {
+	ports.SessionStore
+	sessions map[string]domain.Session
+}
+
+func (s *memorySessions) Create(ctx context.Context, session *domain.Session) error {
+	s.sessions[session.ID] = *session
+	return nil
+}
+
+func (s *memorySessions) Get(ctx context.Context, id string) (domain.Session, error) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return domain.Session{}, pkg.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *memorySessions) ListActive(ctx context.Context, userID int64) ([]domain.Session, error) {
+	var active []domain.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			active = append(active, session)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].UserAgent < active[j].UserAgent })
+	return active, nil
+}
+
+func (s *memorySessions) Touch(ctx context.Context, id string, at time.Time) error { return nil }
+
+func (s *memorySessions) Revoke(ctx context.Context, userID int64, id string) error {
+	session, ok := s.sessions[id]
+	if !ok || session.UserID != userID {
+		return pkg.ErrSessionNotFound
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	s.sessions[id] = session
+	return nil
+}
+
+// newTestTokens returns a token service signing with a fixed secret.
+func newTestTokens(t *testing.T) *sharedauth.TokenService {
+	t.Helper()
+	keys, err := sharedauth.NewStaticHMAC([]byte("router-test-secret"))
+	if err != nil {
+		t.Fatalf("NewStaticHMAC: %v", err)
+	}
+	tokens, err := sharedauth.NewTokenService(sharedauth.TokenOptions{Keys: keys, Issuer: "test", Audience: []string{"test"}, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("NewTokenService: %v", err)
+	}
+	return tokens
+}
+
+func TestSessionRevocation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hasher := password.NewChain(password.NewBcryptHasher(4))
+	hash, err := hasher.Hash("Passw0rd!x")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	sessions := &memorySessions{sessions: map[string]domain.Session{
+		"someone-elses": {ID: "someone-elses", UserID: 2, ExpiresAt: time.Now().Add(time.Hour)},
+	}}
+	r := NewRouter(RouterDependencies{
+		UserStore:      sessionUsers{users: []domain.User{{ID: 1, Username: "pat", PasswordHash: hash, Role: domain.RoleUser}}},
+		Tokens:         newTestTokens(t),
+		PasswordHasher: hasher,
+		SessionStore:   sessions,
+	})
+
+	do := func(method, path, token, userAgent, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		req.Header.Set("User-Agent", userAgent)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	login := func(userAgent string) string {
+		t.Helper()
+		w := do(http.MethodPost, "/api/v1/login", "", userAgent, `{"username":"pat","password":"Passw0rd!x"}`)
+		var resp dto.LoginResponse
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &resp) != nil || resp.Token == "" {
+			t.Fatalf("login from %s: status = %d: %s", userAgent, w.Code, w.Body)
+		}
+		return resp.Token
+	}
+
+	laptop := login("laptop")
+	phone := login("phone")
+
+	w := do(http.MethodGet, "/api/v1/me/sessions", laptop, "laptop", "")
+	var listed []dto.SessionResponse
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &listed) != nil {
+		t.Fatalf("list: status = %d: %s", w.Code, w.Body)
+	}
+	if len(listed) != 2 || listed[0].UserAgent != "laptop" || !listed[0].Current || listed[1].Current {
+		t.Fatalf("sessions = %+v, want laptop (current) and phone", listed)
+	}
+	phoneSession := listed[1].ID
+
+	if w := do(http.MethodDelete, "/api/v1/me/sessions/someone-elses", laptop, "laptop", ""); w.Code != http.StatusNotFound {
+		t.Errorf("revoking another user's session: status = %d, want 404", w.Code)
+	}
+	if w := do(http.MethodDelete, "/api/v1/me/sessions/"+phoneSession, laptop, "laptop", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke phone: status = %d: %s", w.Code, w.Body)
+	}
+
+	w = do(http.MethodGet, "/api/v1/me/sessions", phone, "phone", "")
+	var problem dto.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || w.Code != http.StatusUnauthorized || problem.Code != "session_revoked" {
+		t.Errorf("revoked token: status = %d body = %s, want 401 session_revoked", w.Code, w.Body)
+	}
+	if w := do(http.MethodGet, "/api/v1/me/sessions", laptop, "laptop", ""); w.Code != http.StatusOK {
+		t.Errorf("other session after revoking phone: status = %d, want 200", w.Code)
+	}
+}
+
+// memoryAudit records appended events.
+type memoryAudit struct {
+	ports.AuditStore
+	events []domain.AuditEvent
+}
+
+func (s *memoryAudit) Append(ctx context.Context, event *domain.AuditEvent) error {
+	s.events = append(s.events, *event)
+	return nil
+}
+
+func TestImpersonation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hasher := password.NewChain(password.NewBcryptHasher(4))
+	hash, err := hasher.Hash("Passw0rd!x")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	trail := &memoryAudit{}
+	r := NewRouter(RouterDependencies{
+		UserStore: sessionUsers{users: []domain.User{
+			{ID: 1, Username: "root", PasswordHash: hash, Role: domain.RoleAdmin},
+			{ID: 2, Username: "pat", Email: "pat@example.com", PasswordHash: hash, Role: domain.RoleUser},
+			{ID: 3, Username: "ops", PasswordHash: hash, Role: domain.RoleAdmin},
+		}},
+		Tokens:         newTestTokens(t),
+		PasswordHasher: hasher,
+		AuditStore:     trail,
+	})
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/login", "", `{"username":"root","password":"Passw0rd!x"}`)
+	var login dto.LoginResponse
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &login) != nil {
+		t.Fatalf("login: status = %d: %s", w.Code, w.Body)
+	}
+	admin := login.Token
+	trail.events = nil // the login itself
+
+	for path, want := range map[string]int{
+		"/api/v1/users/1/impersonate": http.StatusBadRequest, // yourself
+		"/api/v1/users/3/impersonate": http.StatusForbidden,  // another admin
+		"/api/v1/users/9/impersonate": http.StatusNotFound,
+	} {
+		if w := do(http.MethodPost, path, admin, `{"reason":"ticket 42"}`); w.Code != want {
+			t.Errorf("%s: status = %d, want %d: %s", path, w.Code, want, w.Body)
+		}
+	}
+	if w := do(http.MethodPost, "/api/v1/users/2/impersonate", admin, `{"reason":"  "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("blank reason: status = %d, want 400", w.Code)
+	}
+	if len(trail.events) != 0 {
+		t.Fatalf("refused attempts were audited as started: %+v", trail.events)
+	}
+
+	w = do(http.MethodPost, "/api/v1/users/2/impersonate", admin, `{"reason":"ticket 42"}`)
+	var started dto.ImpersonateResponse
+	if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &started) != nil || started.UserID != 2 {
+		t.Fatalf("impersonate pat: status = %d: %s", w.Code, w.Body)
+	}
+	if len(trail.events) != 1 || trail.events[0].Action != domain.AuditImpersonationStarted || trail.events[0].Detail != "ticket 42" {
+		t.Fatalf("audit = %+v, want the start recorded with its reason", trail.events)
+	}
+
+	w = do(http.MethodGet, "/api/v1/me", started.Token, "")
+	var me dto.ProfileResponse
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &me) != nil {
+		t.Fatalf("me: status = %d: %s", w.Code, w.Body)
+	}
+	if me.Username != "pat" || me.ImpersonatedBy == nil || me.ImpersonatedBy.ID != 1 || me.ImpersonatedBy.Username != "root" {
+		t.Errorf("me = %+v impersonated_by = %+v, want pat viewed by root", me, me.ImpersonatedBy)
+	}
+
+	// Looking around is fine; taking the account over is not.
+	var problem dto.Problem
+	w = do(http.MethodPost, "/api/v1/me/password", started.Token, `{"current_password":"Passw0rd!x","new_password":"N3w-Passw0rd!"}`)
+	if json.Unmarshal(w.Body.Bytes(), &problem) != nil || w.Code != http.StatusForbidden || problem.Code != pkg.ErrImpersonating.Code {
+		t.Errorf("password change while impersonating: status = %d: %s", w.Code, w.Body)
+	}
+	if w := do(http.MethodPost, "/api/v1/users/3/impersonate", started.Token, `{"reason":"chain"}`); w.Code != http.StatusForbidden {
+		t.Errorf("impersonating from an impersonation token: status = %d, want 403", w.Code)
+	}
+
+	var requests []string
+	for _, e := range trail.events[1:] {
+		if e.Action != domain.AuditImpersonatedRequest || *e.ActorID != 1 || *e.OnBehalfOfID != 2 || e.TargetID != "2" {
+			t.Errorf("event = %+v, want root acting for pat", e)
+		}
+		requests = append(requests, e.Detail)
+	}
+	want := []string{"GET /api/v1/me 200", "POST /api/v1/me/password 403", "POST /api/v1/users/3/impersonate 403"}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audited requests %q, want %q", requests, want)
+	}
+}
@@ -0,0 +1,31 @@
+// Package jobs runs periodic background work alongside the HTTP server.
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every runs fn immediately and then once per interval until ctx is
+// canceled. Errors are logged and the job keeps its schedule.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	run := func() {
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("job %s failed: %v", name, err)
+		}
+	}
+
+	run()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type GormAPIKeyStore struct {
+	db *gorm.DB
+}
+
+func NewGormAPIKeyStore(db *gorm.DB) *GormAPIKeyStore {
+	return &GormAPIKeyStore{db: db}
+}
+
+func (s *GormAPIKeyStore) Create(ctx context.Context, key *domain.APIKey) error {
+	return s.db.WithContext(ctx).Create(key).Error
+}
+
+func (s *GormAPIKeyStore) ListForUser(ctx context.Context, userID int64) ([]domain.APIKey, error) {
+	var keys []domain.APIKey
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *GormAPIKeyStore) FindByPrefix(ctx context.Context, prefix string) (domain.APIKey, error) {
+	var key domain.APIKey
+	if err := s.db.WithContext(ctx).Where("prefix = ?", prefix).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.APIKey{}, pkg.ErrAPIKeyNotFound
+		}
+		return domain.APIKey{}, err
+	}
+	return key, nil
+}
+
+func (s *GormAPIKeyStore) Touch(ctx context.Context, id int64, at time.Time) error {
+	return s.db.WithContext(ctx).Model(&domain.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+func (s *GormAPIKeyStore) Delete(ctx context.Context, userID, id int64) error {
+	tx := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&domain.APIKey{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type GormAuditStore struct {
+	db *gorm.DB
+}
+
+func NewGormAuditStore(db *gorm.DB) *GormAuditStore {
+	return &GormAuditStore{db: db}
+}
+
+func (s *GormAuditStore) Append(ctx context.Context, event *domain.AuditEvent) error {
+	return s.db.WithContext(ctx).Create(event).Error
+}
+
+func (s *GormAuditStore) List(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error) {
+	q := auditQuery(s.db.WithContext(ctx), filter).Order("id DESC")
+	if filter.Limit > 0 {
+		q = q.Limit(filter.Limit)
+	}
+
+	var events []domain.AuditEvent
+	if err := q.Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (s *GormAuditStore) Each(ctx context.Context, filter domain.AuditFilter, fn func(domain.AuditEvent) error) error {
+	db := s.db.WithContext(ctx)
+	rows, err := auditQuery(db, filter).Order("id ASC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event domain.AuditEvent
+		if err := db.ScanRows(rows, &event); err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func auditQuery(db *gorm.DB, filter domain.AuditFilter) *gorm.DB {
+	q := db.Model(&domain.AuditEvent{})
+	if filter.Action != "" {
+		q = q.Where("action = ?", filter.Action)
+	}
+	if filter.ActorID != nil {
+		q = q.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.TargetType != "" {
+		q = q.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		q = q.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Since != nil {
+		q = q.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		q = q.Where("created_at < ?", *filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		q = q.Where("id < ?", filter.BeforeID)
+	}
+	return q
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+func TestAuditStoreIsAppendOnly(t *testing.T) {
+	typ := reflect.TypeOf(&GormAuditStore{})
+	var methods []string
+	for i := 0; i < typ.NumMethod(); i++ {
+		methods = append(methods, typ.Method(i).Name)
+	}
+	sort.Strings(methods)
+	if want := []string{"Append", "Each", "List"}; !reflect.DeepEqual(methods, want) {
+		t.Errorf("methods = %v, want only %v", methods, want)
+	}
+
+	d := &scriptedDB{}
+	event := &domain.AuditEvent{Action: domain.AuditUserCreated, TargetType: domain.AuditTargetUser, TargetID: "7"}
+	if err := NewGormAuditStore(openScriptedDB(t, d)).Append(context.Background(), event); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if len(d.statements) == 0 {
+		t.Fatal("Append ran nothing")
+	}
+	for _, stmt := range d.statements {
+		if !strings.HasPrefix(stmt, `INSERT INTO "audit_events"`) {
+			t.Errorf("Append ran %q, want only an insert", stmt)
+		}
+	}
+}
+
+func TestAuditStoreFilters(t *testing.T) {
+	actor := int64(3)
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := since.AddDate(0, 1, 0)
+	filter := domain.AuditFilter{
+		Action: domain.AuditUserCreated, ActorID: &actor, TargetType: domain.AuditTargetUser, TargetID: "7",
+		Since: &since, Until: &until, BeforeID: 50, Limit: 10,
+	}
+
+	d := &scriptedDB{}
+	store := NewGormAuditStore(openScriptedDB(t, d))
+	if _, err := store.List(context.Background(), filter); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if err := store.Each(context.Background(), filter, func(domain.AuditEvent) error { return nil }); err != nil {
+		t.Fatalf("Each: %v", err)
+	}
+	if len(d.statements) != 2 {
+		t.Fatalf("statements = %q, want one query each", d.statements)
+	}
+
+	list, each := d.statements[0], d.statements[1]
+	for _, clause := range []string{"action = $1", "actor_id = $2", "target_type = $3", "target_id = $4", "created_at >= $5", "created_at < $6", "id < $7"} {
+		if !strings.Contains(list, clause) || !strings.Contains(each, clause) {
+			t.Errorf("missing %q in\n%s\n%s", clause, list, each)
+		}
+	}
+	wantArgs := []any{domain.AuditUserCreated, actor, domain.AuditTargetUser, "7", since, until, int64(50)}
+	if got := d.args[1]; !reflect.DeepEqual(got, wantArgs) {
+		t.Errorf("Each args = %v, want %v", got, wantArgs)
+	}
+
+	// List pages newest first; the export streams everything oldest first.
+	if !strings.Contains(list, "ORDER BY id DESC LIMIT") {
+		t.Errorf("List query = %s, want newest first with a limit", list)
+	}
+	if !strings.HasSuffix(each, "ORDER BY id ASC") {
+		t.Errorf("Each query = %s, want oldest first without a limit", each)
+	}
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type GormDeviceStore struct {
+	db *gorm.DB
+}
+
+func NewGormDeviceStore(db *gorm.DB) *GormDeviceStore {
+	return &GormDeviceStore{db: db}
+}
+
+func (s *GormDeviceStore) Create(ctx context.Context, name string, typeID int64) (domain.Device, error) {
+	device := domain.Device{
+		Name:   name,
+		TypeID: typeID,
+	}
+	if err := s.db.WithContext(ctx).Create(&device).Error; err != nil {
+		if isDuplicateErr(err) {
+			return domain.Device{}, pkg.ErrDuplicateDevice
+		}
+		return domain.Device{}, err
+	}
+
+	return device, nil
+}
+
+func (s *GormDeviceStore) GetByID(ctx context.Context, id int64) (domain.Device, error) {
+	var device domain.Device
+	if err := s.db.WithContext(ctx).First(&device, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Device{}, pkg.ErrDeviceNotFound
+		}
+		return domain.Device{}, err
+	}
+
+	return device, nil
+}
+
+func (s *GormDeviceStore) GetByName(ctx context.Context, name string) (domain.Device, error) {
+	var device domain.Device
+	if err := s.db.WithContext(ctx).Where("name = ?", name).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Device{}, pkg.ErrDeviceNotFound
+		}
+		return domain.Device{}, err
+	}
+
+	return device, nil
+}
+
+var deviceListColumns = map[string]listColumn[domain.Device]{
+	"id":         {column: "id", kind: kindInt, value: func(d domain.Device) string { return strconv.FormatInt(d.ID, 10) }},
+	"name":       {column: "name", kind: kindString, value: func(d domain.Device) string { return d.Name }},
+	"type_id":    {column: "type_id", kind: kindInt, value: func(d domain.Device) string { return strconv.FormatInt(d.TypeID, 10) }},
+	"created_at": {column: "created_at", kind: kindTime, value: func(d domain.Device) string { return formatTime(d.CreatedAt) }},
+	"updated_at": {column: "updated_at", kind: kindTime, value: func(d domain.Device) string { return formatTime(d.UpdatedAt) }},
+}
+
+func (s *GormDeviceStore) List(ctx context.Context, opts domain.ListOptions) (domain.Page[domain.Device], error) {
+	q := s.db.WithContext(ctx).Model(&domain.Device{})
+	return listPage(q, opts, deviceListColumns, func(d domain.Device) int64 { return d.ID })
+}
+
+func (s *GormDeviceStore) Each(ctx context.Context, fn func(domain.Device) error) error {
+	var devices []domain.Device
+	return s.db.WithContext(ctx).FindInBatches(&devices, eachBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, device := range devices {
+			if err := fn(device); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func (s *GormDeviceStore) Update(ctx context.Context, id int64, name string, typeID int64, version int64) (domain.Device, error) {
+	changes := map[string]any{"version": gorm.Expr("version + 1")}
+	if name != "" {
+		changes["name"] = name
+	}
+	if typeID > 0 {
+		changes["type_id"] = typeID
+	}
+
+	q := s.db.WithContext(ctx).Model(&domain.Device{}).Where("id = ?", id)
+	if version > 0 {
+		q = q.Where("version = ?", version)
+	}
+	tx := q.Updates(changes)
+	if tx.Error != nil {
+		if isDuplicateErr(tx.Error) {
+			return domain.Device{}, pkg.ErrDuplicateDevice
+		}
+		return domain.Device{}, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		// Either the device is gone or the version moved on.
+		if _, err := s.GetByID(ctx, id); err != nil {
+			return domain.Device{}, err
+		}
+		return domain.Device{}, pkg.ErrVersionMismatch
+	}
+
+	return s.GetByID(ctx, id)
+}
+
+// Delete soft-deletes the device; it can be restored until it is purged.
+func (s *GormDeviceStore) Delete(ctx context.Context, id int64) error {
+	tx := s.db.WithContext(ctx).Delete(&domain.Device{}, id)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+func (s *GormDeviceStore) ListDeleted(ctx context.Context) ([]domain.Device, error) {
+	var devices []domain.Device
+	err := s.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Find(&devices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// Restore undeletes a device. It fails with ErrDuplicateDevice when a live
+// device has taken the name in the meantime.
+func (s *GormDeviceStore) Restore(ctx context.Context, id int64) (domain.Device, error) {
+	tx := s.db.WithContext(ctx).Unscoped().Model(&domain.Device{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]any{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if tx.Error != nil {
+		if isDuplicateErr(tx.Error) {
+			return domain.Device{}, pkg.ErrDuplicateDevice
+		}
+		return domain.Device{}, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return domain.Device{}, pkg.ErrDeviceNotFound
+	}
+
+	return s.GetByID(ctx, id)
+}
+
+func (s *GormDeviceStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	tx := s.db.WithContext(ctx).Unscoped().Where("deleted_at < ?", before).Delete(&domain.Device{})
+	return tx.RowsAffected, tx.Error
+}
+
+func (s *GormDeviceStore) Transaction(ctx context.Context, fn func(ports.DeviceStore) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormDeviceStore{db: tx})
+	})
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type GormExternalIdentityStore struct {
+	db *gorm.DB
+}
+
+func NewGormExternalIdentityStore(db *gorm.DB) *GormExternalIdentityStore {
+	return &GormExternalIdentityStore{db: db}
+}
+
+func (s *GormExternalIdentityStore) Find(ctx context.Context, provider, subject string) (domain.ExternalIdentity, error) {
+	var identity domain.ExternalIdentity
+	err := s.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.ExternalIdentity{}, pkg.ErrIdentityNotFound
+		}
+		return domain.ExternalIdentity{}, err
+	}
+	return identity, nil
+}
+
+func (s *GormExternalIdentityStore) Link(ctx context.Context, identity *domain.ExternalIdentity) error {
+	if err := s.db.WithContext(ctx).Create(identity).Error; err != nil {
+		if isDuplicateErr(err) {
+			return pkg.ErrIdentityLinked
+		}
+		return err
+	}
+	return nil
+}
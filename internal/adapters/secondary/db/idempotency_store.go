@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type GormIdempotencyStore struct {
+	db *gorm.DB
+}
+
+func NewGormIdempotencyStore(db *gorm.DB) *GormIdempotencyStore {
+	return &GormIdempotencyStore{db: db}
+}
+
+// Reserve inserts the record, taking over an expired one in the same
+// statement so two retries cannot both win the key.
+func (s *GormIdempotencyStore) Reserve(ctx context.Context, rec domain.IdempotencyRecord) (domain.IdempotencyRecord, bool, error) {
+	tx := s.db.WithContext(ctx).Exec(`
+		INSERT INTO idempotency_records (user_id, key, request_hash, status, content_type, etag, body, created_at, expires_at)
+		VALUES (?, ?, ?, 0, '', '', NULL, ?, ?)
+		ON CONFLICT (user_id, key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status = 0,
+			content_type = '',
+			etag = '',
+			body = NULL,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_records.expires_at <= EXCLUDED.created_at`,
+		rec.UserID, rec.Key, rec.RequestHash, rec.CreatedAt, rec.ExpiresAt,
+	)
+	if tx.Error != nil {
+		return domain.IdempotencyRecord{}, false, tx.Error
+	}
+	if tx.RowsAffected > 0 {
+		return domain.IdempotencyRecord{}, true, nil
+	}
+
+	var existing domain.IdempotencyRecord
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND key = ?", rec.UserID, rec.Key).
+		First(&existing).Error
+	if err != nil {
+		return domain.IdempotencyRecord{}, false, err
+	}
+
+	return existing, false, nil
+}
+
+func (s *GormIdempotencyStore) Complete(ctx context.Context, rec domain.IdempotencyRecord) error {
+	return s.db.WithContext(ctx).Model(&domain.IdempotencyRecord{}).
+		Where("user_id = ? AND key = ?", rec.UserID, rec.Key).
+		Updates(map[string]any{
+			"status":       rec.Status,
+			"content_type": rec.ContentType,
+			"etag":         rec.ETag,
+			"body":         rec.Body,
+		}).Error
+}
+
+func (s *GormIdempotencyStore) Release(ctx context.Context, userID int64, key string) error {
+	return s.db.WithContext(ctx).
+		Where("user_id = ? AND key = ?", userID, key).
+		Delete(&domain.IdempotencyRecord{}).Error
+}
+
+func (s *GormIdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	tx := s.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&domain.IdempotencyRecord{})
+	return tx.RowsAffected, tx.Error
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type GormInvitationStore struct {
+	db *gorm.DB
+}
+
+func NewGormInvitationStore(db *gorm.DB) *GormInvitationStore {
+	return &GormInvitationStore{db: db}
+}
+
+func (s *GormInvitationStore) Create(ctx context.Context, invitation *domain.Invitation) error {
+	return s.db.WithContext(ctx).Create(invitation).Error
+}
+
+func (s *GormInvitationStore) ListPending(ctx context.Context, now time.Time) ([]domain.Invitation, error) {
+	var invitations []domain.Invitation
+	err := s.db.WithContext(ctx).
+		Where("accepted_at IS NULL AND expires_at > ?", now).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (s *GormInvitationStore) Find(ctx context.Context, tokenHash []byte, now time.Time) (domain.Invitation, error) {
+	var invitation domain.Invitation
+	err := s.db.WithContext(ctx).
+		Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", tokenHash, now).
+		First(&invitation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Invitation{}, pkg.ErrInvalidInvitation
+		}
+		return domain.Invitation{}, err
+	}
+	return invitation, nil
+}
+
+func (s *GormInvitationStore) Accept(ctx context.Context, tokenHash []byte, username string, passwordHash []byte, now time.Time) (domain.User, error) {
+	if username == "" {
+		return domain.User{}, pkg.ErrInvalidUsername
+	}
+
+	var user domain.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the invitation so two concurrent accepts cannot both create
+		// an account.
+		var invitation domain.Invitation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", tokenHash, now).
+			First(&invitation).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return pkg.ErrInvalidInvitation
+			}
+			return err
+		}
+
+		user = domain.User{
+			Username:     username,
+			Email:        invitation.Email,
+			PasswordHash: passwordHash,
+			Role:         invitation.Role,
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			if isDuplicateErr(err) {
+				return duplicateUserErr(err)
+			}
+			return err
+		}
+
+		return tx.Model(&invitation).Updates(map[string]any{
+			"accepted_at": now,
+			"user_id":     user.ID,
+		}).Error
+	})
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	return user, nil
+}
+
+func (s *GormInvitationStore) Delete(ctx context.Context, id int64) error {
+	tx := s.db.WithContext(ctx).Where("id = ? AND accepted_at IS NULL", id).Delete(&domain.Invitation{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrInvitationNotFound
+	}
+	return nil
+}
+
+func (s *GormInvitationStore) DeletePendingForEmail(ctx context.Context, email string) error {
+	return s.db.WithContext(ctx).
+		Where("LOWER(email) = LOWER(?) AND accepted_at IS NULL", email).
+		Delete(&domain.Invitation{}).Error
+}
+
+func (s *GormInvitationStore) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	tx := s.db.WithContext(ctx).
+		Where("accepted_at IS NULL AND expires_at < ?", before).
+		Delete(&domain.Invitation{})
+	return tx.RowsAffected, tx.Error
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// eachBatchSize is how many rows Each loads at a time.
+const eachBatchSize = 500
+
+type columnKind int
+
+const (
+	kindString columnKind = iota
+	kindInt
+	kindTime
+)
+
+// listColumn is a field that list queries may sort and filter on. value
+// renders the field of a row in the form parseColumnValue reads back.
+type listColumn[T any] struct {
+	column string
+	kind   columnKind
+	value  func(T) string
+}
+
+// listCursor marks the last row of a page. Sort pins the cursor to the
+// ordering it was issued for.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// listPage runs a filtered, sorted and paginated query over q, which must
+// have its model set. Pages after the first are fetched by keyset on the sort
+// column and id, so rows inserted meanwhile neither repeat nor go missing.
+func listPage[T any](q *gorm.DB, opts domain.ListOptions, columns map[string]listColumn[T], id func(T) int64) (domain.Page[T], error) {
+	q, err := applyListFilters(q, opts.Filters, columns)
+	if err != nil {
+		return domain.Page[T]{}, err
+	}
+	q = q.Session(&gorm.Session{})
+
+	sortKey := opts.Sort
+	if sortKey == "" {
+		sortKey = "id"
+	}
+	col, ok := columns[sortKey]
+	if !ok {
+		return domain.Page[T]{}, fmt.Errorf("%w: cannot sort by %q", pkg.ErrInvalidListOptions, sortKey)
+	}
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	sortTag := sortKey + " " + dir
+
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = domain.DefaultListLimit
+	}
+	if limit > domain.MaxListLimit {
+		limit = domain.MaxListLimit
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return domain.Page[T]{}, err
+	}
+
+	page := q
+	switch {
+	case opts.Cursor != "":
+		cur, err := decodeListCursor(opts.Cursor)
+		if err != nil || cur.Sort != sortTag {
+			return domain.Page[T]{}, pkg.ErrInvalidCursor
+		}
+		if sortKey == "id" {
+			page = page.Where("id "+cmp+" ?", cur.ID)
+			break
+		}
+		v, err := parseColumnValue(col.kind, cur.Value)
+		if err != nil {
+			return domain.Page[T]{}, pkg.ErrInvalidCursor
+		}
+		page = page.Where(fmt.Sprintf("(%s, id) %s (?, ?)", col.column, cmp), v, cur.ID)
+	case opts.Offset > 0:
+		page = page.Offset(opts.Offset)
+	}
+
+	order := "id " + dir
+	if sortKey != "id" {
+		order = col.column + " " + dir + ", " + order
+	}
+
+	var items []T
+	if err := page.Order(order).Limit(limit + 1).Find(&items).Error; err != nil {
+		return domain.Page[T]{}, err
+	}
+
+	result := domain.Page[T]{Items: items, Total: total}
+	if len(items) > limit {
+		result.Items = items[:limit]
+		last := result.Items[limit-1]
+		result.NextCursor = encodeListCursor(listCursor{Sort: sortTag, Value: col.value(last), ID: id(last)})
+	}
+	if result.Items == nil {
+		result.Items = []T{}
+	}
+	return result, nil
+}
+
+func applyListFilters[T any](q *gorm.DB, filters []domain.ListFilter, columns map[string]listColumn[T]) (*gorm.DB, error) {
+	for _, f := range filters {
+		col, ok := columns[f.Field]
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot filter by %q", pkg.ErrInvalidListOptions, f.Field)
+		}
+
+		switch {
+		case f.Op == domain.FilterContains && col.kind == kindString:
+			q = q.Where(col.column+" ILIKE ?", "%"+escapeLike(f.Value)+"%")
+			continue
+		case f.Op == domain.FilterContains,
+			(f.Op == domain.FilterAfter || f.Op == domain.FilterBefore) && col.kind == kindString:
+			return nil, fmt.Errorf("%w: unsupported filter on %q", pkg.ErrInvalidListOptions, f.Field)
+		}
+
+		v, err := parseColumnValue(col.kind, f.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid value for %q", pkg.ErrInvalidListOptions, f.Field)
+		}
+		switch f.Op {
+		case domain.FilterEquals:
+			q = q.Where(col.column+" = ?", v)
+		case domain.FilterAfter:
+			q = q.Where(col.column+" > ?", v)
+		case domain.FilterBefore:
+			q = q.Where(col.column+" < ?", v)
+		default:
+			return nil, fmt.Errorf("%w: unsupported filter on %q", pkg.ErrInvalidListOptions, f.Field)
+		}
+	}
+	return q, nil
+}
+
+func parseColumnValue(kind columnKind, raw string) (any, error) {
+	switch kind {
+	case kindInt:
+		return strconv.ParseInt(raw, 10, 64)
+	case kindTime:
+		return time.Parse(time.RFC3339Nano, raw)
+	default:
+		return raw, nil
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+func encodeListCursor(cur listCursor) string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeListCursor(s string) (listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return listCursor{}, err
+	}
+	var cur listCursor
+	if err := json.Unmarshal(raw, &cur); err != nil {
+		return listCursor{}, err
+	}
+	return cur, nil
+}
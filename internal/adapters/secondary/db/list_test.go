@@ -0,0 +1,271 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type listRow struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+}
+
+var listRowColumns = map[string]listColumn[listRow]{
+	"id":         {column: "id", kind: kindInt, value: func(r listRow) string { return strconv.FormatInt(r.ID, 10) }},
+	"name":       {column: "name", kind: kindString, value: func(r listRow) string { return r.Name }},
+	"created_at": {column: "created_at", kind: kindTime, value: func(r listRow) string { return formatTime(r.CreatedAt) }},
+}
+
+// recordingDB is a database/sql connector that answers COUNT queries with
+// total and every other query with rows, recording what it was asked.
+type recordingDB struct {
+	total   int64
+	rows    []listRow
+	queries []string
+	args    [][]any
+}
+
+func (d *recordingDB) Connect(context.Context) (driver.Conn, error) { return recordingConn{d}, nil }
+func (d *recordingDB) Driver() driver.Driver                        { return nil }
+
+type recordingConn struct{ db *recordingDB }
+
+func (c recordingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c recordingConn) Close() error                        { return nil }
+func (c recordingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c recordingConn) QueryContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	args := make([]any, len(named))
+	for i, a := range named {
+		args[i] = a.Value
+	}
+	c.db.queries = append(c.db.queries, query)
+	c.db.args = append(c.db.args, args)
+
+	if strings.HasPrefix(query, "SELECT count(*)") {
+		return &recordedRows{columns: []string{"count"}, values: [][]driver.Value{{c.db.total}}}, nil
+	}
+	rows := &recordedRows{columns: []string{"id", "name", "created_at"}}
+	for _, r := range c.db.rows {
+		rows.values = append(rows.values, []driver.Value{r.ID, r.Name, r.CreatedAt})
+	}
+	return rows, nil
+}
+
+type recordedRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *recordedRows) Columns() []string { return r.columns }
+func (r *recordedRows) Close() error      { return nil }
+
+func (r *recordedRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func openRecordingDB(t *testing.T, rec *recordingDB) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(rec)}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return db
+}
+
+func TestListPage(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := func(n int) []listRow {
+		list := make([]listRow, n)
+		for i := range list {
+			list[i] = listRow{ID: int64(i + 1), Name: "name-" + strconv.Itoa(i+1), CreatedAt: base.Add(time.Duration(i) * time.Hour)}
+		}
+		return list
+	}
+	cursor := func(sort, value string, id int64) string {
+		return encodeListCursor(listCursor{Sort: sort, Value: value, ID: id})
+	}
+	stamp := formatTime(base)
+	parsedStamp, _ := time.Parse(time.RFC3339Nano, stamp)
+
+	tests := []struct {
+		name       string
+		opts       domain.ListOptions
+		rows       int
+		wantSQL    []string // fragments of the page query
+		notSQL     []string
+		wantArgs   []any
+		wantItems  int
+		wantCursor *listCursor
+		wantErr    error
+	}{
+		{
+			name:       "first page",
+			opts:       domain.ListOptions{Limit: 2},
+			rows:       3,
+			wantSQL:    []string{"ORDER BY id ASC LIMIT $1"},
+			wantArgs:   []any{int64(3)},
+			wantItems:  2,
+			wantCursor: &listCursor{Sort: "id ASC", Value: "2", ID: 2},
+		},
+		{
+			name:      "last page",
+			opts:      domain.ListOptions{Limit: 2},
+			rows:      2,
+			wantArgs:  []any{int64(3)},
+			wantItems: 2,
+		},
+		{
+			name:      "empty",
+			opts:      domain.ListOptions{},
+			wantArgs:  []any{int64(domain.DefaultListLimit + 1)},
+			wantItems: 0,
+		},
+		{
+			name:     "limit is capped",
+			opts:     domain.ListOptions{Limit: domain.MaxListLimit * 2},
+			wantArgs: []any{int64(domain.MaxListLimit + 1)},
+		},
+		{
+			name:     "cursor on id",
+			opts:     domain.ListOptions{Limit: 2, Cursor: cursor("id ASC", "2", 2)},
+			wantSQL:  []string{"WHERE id > $1", "ORDER BY id ASC"},
+			wantArgs: []any{int64(2), int64(3)},
+		},
+		{
+			name:     "cursor descending",
+			opts:     domain.ListOptions{Limit: 2, Desc: true, Cursor: cursor("id DESC", "5", 5)},
+			wantSQL:  []string{"WHERE id < $1", "ORDER BY id DESC"},
+			wantArgs: []any{int64(5), int64(3)},
+		},
+		{
+			name:     "cursor on a sort column",
+			opts:     domain.ListOptions{Limit: 2, Sort: "name", Cursor: cursor("name ASC", "b", 3)},
+			wantSQL:  []string{"WHERE (name, id) > ($1, $2)", "ORDER BY name ASC, id ASC"},
+			wantArgs: []any{"b", int64(3), int64(3)},
+		},
+		{
+			name:     "cursor on a time column",
+			opts:     domain.ListOptions{Limit: 2, Sort: "created_at", Desc: true, Cursor: cursor("created_at DESC", stamp, 3)},
+			wantSQL:  []string{"WHERE (created_at, id) < ($1, $2)", "ORDER BY created_at DESC, id DESC"},
+			wantArgs: []any{parsedStamp, int64(3), int64(3)},
+		},
+		{
+			name:       "next cursor on a sort column",
+			opts:       domain.ListOptions{Limit: 1, Sort: "created_at"},
+			rows:       2,
+			wantArgs:   []any{int64(2)},
+			wantItems:  1,
+			wantCursor: &listCursor{Sort: "created_at ASC", Value: stamp, ID: 1},
+		},
+		{
+			name:     "offset",
+			opts:     domain.ListOptions{Limit: 2, Offset: 10},
+			wantSQL:  []string{"LIMIT $1 OFFSET $2"},
+			wantArgs: []any{int64(3), int64(10)},
+		},
+		{
+			name:     "cursor takes precedence over offset",
+			opts:     domain.ListOptions{Limit: 2, Offset: 10, Cursor: cursor("id ASC", "2", 2)},
+			notSQL:   []string{"OFFSET"},
+			wantArgs: []any{int64(2), int64(3)},
+		},
+		{
+			name:     "contains filter escapes wildcards",
+			opts:     domain.ListOptions{Limit: 2, Filters: []domain.ListFilter{{Field: "name", Op: domain.FilterContains, Value: `50%_off\`}}},
+			wantSQL:  []string{"WHERE name ILIKE $1"},
+			wantArgs: []any{`%50\%\_off\\%`, int64(3)},
+		},
+		{
+			name: "filters and cursor combine",
+			opts: domain.ListOptions{Limit: 2, Cursor: cursor("id ASC", "2", 2), Filters: []domain.ListFilter{
+				{Field: "created_at", Op: domain.FilterAfter, Value: stamp},
+				{Field: "id", Op: domain.FilterBefore, Value: "10"},
+			}},
+			wantSQL:  []string{"WHERE created_at > $1 AND id < $2 AND id > $3"},
+			wantArgs: []any{parsedStamp, int64(10), int64(2), int64(3)},
+		},
+		{name: "cursor for another sort", opts: domain.ListOptions{Sort: "name", Cursor: cursor("id ASC", "2", 2)}, wantErr: pkg.ErrInvalidCursor},
+		{name: "cursor for another direction", opts: domain.ListOptions{Desc: true, Cursor: cursor("id ASC", "2", 2)}, wantErr: pkg.ErrInvalidCursor},
+		{name: "malformed cursor", opts: domain.ListOptions{Cursor: "!!!"}, wantErr: pkg.ErrInvalidCursor},
+		{name: "cursor value of the wrong type", opts: domain.ListOptions{Sort: "created_at", Cursor: cursor("created_at ASC", "yesterday", 2)}, wantErr: pkg.ErrInvalidCursor},
+		{name: "unknown sort", opts: domain.ListOptions{Sort: "password_hash"}, wantErr: pkg.ErrInvalidListOptions},
+		{name: "unknown filter", opts: domain.ListOptions{Filters: []domain.ListFilter{{Field: "password_hash", Op: domain.FilterEquals, Value: "x"}}}, wantErr: pkg.ErrInvalidListOptions},
+		{name: "bad filter value", opts: domain.ListOptions{Filters: []domain.ListFilter{{Field: "id", Op: domain.FilterEquals, Value: "one"}}}, wantErr: pkg.ErrInvalidListOptions},
+		{name: "contains on a number", opts: domain.ListOptions{Filters: []domain.ListFilter{{Field: "id", Op: domain.FilterContains, Value: "1"}}}, wantErr: pkg.ErrInvalidListOptions},
+		{name: "range on a string", opts: domain.ListOptions{Filters: []domain.ListFilter{{Field: "name", Op: domain.FilterAfter, Value: "m"}}}, wantErr: pkg.ErrInvalidListOptions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recordingDB{total: 42, rows: rows(tt.rows)}
+			q := openRecordingDB(t, rec).Table("list_rows")
+
+			page, err := listPage(q, tt.opts, listRowColumns, func(r listRow) int64 { return r.ID })
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("listPage: %v", err)
+			}
+
+			if len(rec.queries) != 2 || !strings.HasPrefix(rec.queries[0], "SELECT count(*)") {
+				t.Fatalf("queries = %q, want a count and a page query", rec.queries)
+			}
+			query, args := rec.queries[1], rec.args[1]
+			for _, fragment := range tt.wantSQL {
+				if !strings.Contains(query, fragment) {
+					t.Errorf("query %q does not contain %q", query, fragment)
+				}
+			}
+			for _, fragment := range tt.notSQL {
+				if strings.Contains(query, fragment) {
+					t.Errorf("query %q contains %q", query, fragment)
+				}
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+
+			if page.Total != 42 {
+				t.Errorf("total = %d, want 42", page.Total)
+			}
+			if page.Items == nil || len(page.Items) != tt.wantItems {
+				t.Errorf("items = %v, want %d", page.Items, tt.wantItems)
+			}
+			if tt.wantCursor == nil {
+				if page.NextCursor != "" {
+					t.Errorf("next cursor = %q, want none", page.NextCursor)
+				}
+				return
+			}
+			got, err := decodeListCursor(page.NextCursor)
+			if err != nil || got != *tt.wantCursor {
+				t.Errorf("next cursor = %+v (%v), want %+v", got, err, *tt.wantCursor)
+			}
+		})
+	}
+}
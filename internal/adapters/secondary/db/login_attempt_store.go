@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type GormLoginAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewGormLoginAttemptStore(db *gorm.DB) *GormLoginAttemptStore {
+	return &GormLoginAttemptStore{db: db}
+}
+
+func (s *GormLoginAttemptStore) Get(ctx context.Context, key string) (domain.LoginAttempt, error) {
+	var attempt domain.LoginAttempt
+	if err := s.db.WithContext(ctx).Where("key = ?", key).First(&attempt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.LoginAttempt{}, nil
+		}
+		return domain.LoginAttempt{}, err
+	}
+
+	return attempt, nil
+}
+
+func (s *GormLoginAttemptStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (domain.LoginAttempt, error) {
+	var attempt domain.LoginAttempt
+	err := s.db.WithContext(ctx).Raw(`
+		INSERT INTO login_attempts (key, failures, last_failure_at, updated_at)
+		VALUES (?, 1, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN login_attempts.last_failure_at < ? THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = EXCLUDED.last_failure_at,
+			updated_at = EXCLUDED.updated_at
+		RETURNING key, failures, last_failure_at, locked_until, updated_at`,
+		key, now, now, now.Add(-window),
+	).Scan(&attempt).Error
+	if err != nil {
+		return domain.LoginAttempt{}, err
+	}
+
+	return attempt, nil
+}
+
+func (s *GormLoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	attempt := domain.LoginAttempt{
+		Key:         key,
+		LockedUntil: &until,
+	}
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"locked_until", "updated_at"}),
+	}).Create(&attempt).Error
+}
+
+func (s *GormLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Where("key = ?", key).Delete(&domain.LoginAttempt{}).Error
+}
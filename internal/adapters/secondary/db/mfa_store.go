@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type GormMFAStore struct {
+	db *gorm.DB
+}
+
+func NewGormMFAStore(db *gorm.DB) *GormMFAStore {
+	return &GormMFAStore{db: db}
+}
+
+func (s *GormMFAStore) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	tx := s.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"totp_secret":    secret,
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+	})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *GormMFAStore) EnableTOTP(ctx context.Context, userID int64, recoveryCodeHashes [][]byte) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&domain.User{}).
+			Where("id = ? AND totp_secret <> ''", userID).
+			Update("totp_enabled", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return pkg.ErrMFANotEnrolled
+		}
+
+		return replaceRecoveryCodes(tx, userID, recoveryCodeHashes)
+	})
+}
+
+func (s *GormMFAStore) DisableTOTP(ctx context.Context, userID int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&domain.User{}).Where("id = ?", userID).Updates(map[string]any{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return pkg.ErrUserNotFound
+		}
+
+		return tx.Where("user_id = ?", userID).Delete(&domain.RecoveryCode{}).Error
+	})
+}
+
+func (s *GormMFAStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+}
+
+func (s *GormMFAStore) ConsumeTOTPStep(ctx context.Context, userID int64, step int64) error {
+	tx := s.db.WithContext(ctx).Model(&domain.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+func (s *GormMFAStore) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error {
+	tx := s.db.WithContext(ctx).Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+func (s *GormMFAStore) CountRecoveryCodes(ctx context.Context, userID int64) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID int64, codeHashes [][]byte) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&domain.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(codeHashes) == 0 {
+		return nil
+	}
+
+	codes := make([]domain.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, domain.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	return tx.Create(&codes).Error
+}
@@ -13,9 +13,91 @@ func Run(db *gorm.DB) error {
 		return fmt.Errorf("db is nil")
 	}
 
+	// The original username and email indexes also covered deleted rows,
+	// and the first email index was unique across empty strings. They are
+	// replaced by partial indexes over live rows declared on domain.User and
+	// domain.Device.
+	for _, index := range []string{"idx_users_email", "idx_users_email_nonempty", "idx_users_username"} {
+		if err := db.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+			return fmt.Errorf("drop legacy index %s: %w", index, err)
+		}
+	}
+
 	if err := db.AutoMigrate(&domain.User{}); err != nil {
 		return fmt.Errorf("auto migrate users: %w", err)
 	}
+	// Emails are looked up case-insensitively, so they must be unique that
+	// way too. GORM cannot declare an expression index on the struct.
+	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower_live ON users (LOWER(email))
+	WHERE email <> '' AND deleted_at IS NULL`).Error; err != nil {
+		return fmt.Errorf("create email index (live accounts whose emails differ only in case must be merged first): %w", err)
+	}
+	// It replaces the case-sensitive idx_users_email_live, which is only
+	// dropped once the new index is in place.
+	if err := db.Exec("DROP INDEX IF EXISTS idx_users_email_live").Error; err != nil {
+		return fmt.Errorf("drop legacy index idx_users_email_live: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.Device{}); err != nil {
+		return fmt.Errorf("auto migrate devices: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.PasswordResetToken{}); err != nil {
+		return fmt.Errorf("auto migrate password reset tokens: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.RecoveryCode{}); err != nil {
+		return fmt.Errorf("auto migrate recovery codes: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.LoginAttempt{}); err != nil {
+		return fmt.Errorf("auto migrate login attempts: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.SigningKey{}); err != nil {
+		return fmt.Errorf("auto migrate signing keys: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.APIKey{}); err != nil {
+		return fmt.Errorf("auto migrate api keys: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.ExternalIdentity{}); err != nil {
+		return fmt.Errorf("auto migrate external identities: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.Session{}); err != nil {
+		return fmt.Errorf("auto migrate sessions: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.Invitation{}); err != nil {
+		return fmt.Errorf("auto migrate invitations: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.AuditEvent{}); err != nil {
+		return fmt.Errorf("auto migrate audit events: %w", err)
+	}
+
+	if err := db.AutoMigrate(&domain.IdempotencyRecord{}); err != nil {
+		return fmt.Errorf("auto migrate idempotency records: %w", err)
+	}
+
+	// The audit trail is append-only even for someone with direct database
+	// access through the application role.
+	for _, stmt := range []string{
+		`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events`,
+		`CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("protect audit events: %w", err)
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type GormPasswordResetStore struct {
+	db *gorm.DB
+}
+
+func NewGormPasswordResetStore(db *gorm.DB) *GormPasswordResetStore {
+	return &GormPasswordResetStore{db: db}
+}
+
+func (s *GormPasswordResetStore) Create(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) (domain.PasswordResetToken, error) {
+	token := domain.PasswordResetToken{
+		UserID:    userID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(&token).Error; err != nil {
+		return domain.PasswordResetToken{}, err
+	}
+
+	return token, nil
+}
+
+func (s *GormPasswordResetStore) Find(ctx context.Context, tokenHash []byte, now time.Time) (domain.PasswordResetToken, error) {
+	var token domain.PasswordResetToken
+	err := s.db.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+		First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.PasswordResetToken{}, pkg.ErrInvalidResetToken
+		}
+		return domain.PasswordResetToken{}, err
+	}
+
+	return token, nil
+}
+
+func (s *GormPasswordResetStore) Consume(ctx context.Context, tokenHash []byte, now time.Time) (domain.PasswordResetToken, error) {
+	var tokens []domain.PasswordResetToken
+	tx := s.db.WithContext(ctx).
+		Model(&tokens).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).
+		Update("used_at", now)
+	if tx.Error != nil {
+		return domain.PasswordResetToken{}, tx.Error
+	}
+	if tx.RowsAffected == 0 || len(tokens) == 0 {
+		return domain.PasswordResetToken{}, pkg.ErrInvalidResetToken
+	}
+
+	return tokens[0], nil
+}
+
+func (s *GormPasswordResetStore) DeleteForUser(ctx context.Context, userID int64) error {
+	return s.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.PasswordResetToken{}).Error
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type GormSessionStore struct {
+	db *gorm.DB
+}
+
+func NewGormSessionStore(db *gorm.DB) *GormSessionStore {
+	return &GormSessionStore{db: db}
+}
+
+func (s *GormSessionStore) Create(ctx context.Context, session *domain.Session) error {
+	return s.db.WithContext(ctx).Create(session).Error
+}
+
+func (s *GormSessionStore) Get(ctx context.Context, id string) (domain.Session, error) {
+	var session domain.Session
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Session{}, pkg.ErrSessionNotFound
+		}
+		return domain.Session{}, err
+	}
+	return session, nil
+}
+
+func (s *GormSessionStore) ListActive(ctx context.Context, userID int64) ([]domain.Session, error) {
+	var sessions []domain.Session
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (s *GormSessionStore) Touch(ctx context.Context, id string, at time.Time) error {
+	return s.db.WithContext(ctx).Model(&domain.Session{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+func (s *GormSessionStore) Revoke(ctx context.Context, userID int64, id string) error {
+	tx := s.db.WithContext(ctx).Model(&domain.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *GormSessionStore) RevokeAll(ctx context.Context, userID int64) error {
+	return s.db.WithContext(ctx).Model(&domain.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *GormSessionStore) DeleteExpired(ctx context.Context, before time.Time) error {
+	return s.db.WithContext(ctx).
+		Where("expires_at < ? OR revoked_at < ?", before, before).
+		Delete(&domain.Session{}).Error
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type GormSigningKeyStore struct {
+	db *gorm.DB
+}
+
+func NewGormSigningKeyStore(db *gorm.DB) *GormSigningKeyStore {
+	return &GormSigningKeyStore{db: db}
+}
+
+func (s *GormSigningKeyStore) List(ctx context.Context) ([]domain.SigningKey, error) {
+	var keys []domain.SigningKey
+	if err := s.db.WithContext(ctx).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *GormSigningKeyStore) Save(ctx context.Context, key domain.SigningKey) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at"}),
+	}).Create(&key).Error
+}
+
+func (s *GormSigningKeyStore) Delete(ctx context.Context, id string) error {
+	return s.db.WithContext(ctx).Delete(&domain.SigningKey{}, "id = ?", id).Error
+}
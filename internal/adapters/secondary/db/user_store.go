@@ -3,11 +3,17 @@ package db
 import (
 	"context"
 	"errors"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
 	pkg "github.com/reginaldsourn/go-crud/pkg/error"
 )
 
@@ -19,18 +25,24 @@ func NewGormUserStore(db *gorm.DB) *GormUserStore {
 	return &GormUserStore{db: db}
 }
 
-func (s *GormUserStore) Create(ctx context.Context, username string, passwordHash []byte) (domain.User, error) {
+func (s *GormUserStore) Create(ctx context.Context, username, email string, passwordHash []byte) (domain.User, error) {
 	if username == "" {
 		return domain.User{}, pkg.ErrInvalidUsername
 	}
+	if email != "" {
+		if _, err := mail.ParseAddress(email); err != nil {
+			return domain.User{}, pkg.ErrInvalidEmail
+		}
+	}
 
 	user := domain.User{
 		Username:     username,
+		Email:        email,
 		PasswordHash: passwordHash,
 	}
 	if err := s.db.WithContext(ctx).Create(&user).Error; err != nil {
 		if isDuplicateErr(err) {
-			return domain.User{}, pkg.ErrUsernameExists
+			return domain.User{}, duplicateUserErr(err)
 		}
 		return domain.User{}, err
 	}
@@ -62,39 +74,91 @@ func (s *GormUserStore) GetByUsername(ctx context.Context, username string) (dom
 	return user, nil
 }
 
-func (s *GormUserStore) List(ctx context.Context) ([]domain.User, error) {
-	var users []domain.User
-	if err := s.db.WithContext(ctx).Order("id ASC").Find(&users).Error; err != nil {
-		return nil, err
+func (s *GormUserStore) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	if email == "" {
+		return domain.User{}, pkg.ErrUserNotFound
 	}
 
-	return users, nil
-}
-
-func (s *GormUserStore) Update(ctx context.Context, id int64, username string, passwordHash []byte) (domain.User, error) {
 	var user domain.User
-	if err := s.db.WithContext(ctx).First(&user, id).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("LOWER(email) = LOWER(?)", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return domain.User{}, pkg.ErrUserNotFound
 		}
 		return domain.User{}, err
 	}
 
-	if username != "" {
-		user.Username = username
+	return user, nil
+}
+
+var userListColumns = map[string]listColumn[domain.User]{
+	"id":           {column: "id", kind: kindInt, value: func(u domain.User) string { return strconv.FormatInt(u.ID, 10) }},
+	"username":     {column: "username", kind: kindString, value: func(u domain.User) string { return u.Username }},
+	"email":        {column: "email", kind: kindString, value: func(u domain.User) string { return u.Email }},
+	"display_name": {column: "display_name", kind: kindString, value: func(u domain.User) string { return u.DisplayName }},
+	"role":         {column: "role", kind: kindString, value: func(u domain.User) string { return u.Role }},
+	"created_at":   {column: "created_at", kind: kindTime, value: func(u domain.User) string { return formatTime(u.CreatedAt) }},
+	"updated_at":   {column: "updated_at", kind: kindTime, value: func(u domain.User) string { return formatTime(u.UpdatedAt) }},
+}
+
+func (s *GormUserStore) List(ctx context.Context, opts domain.ListOptions) (domain.Page[domain.User], error) {
+	q := s.db.WithContext(ctx).Model(&domain.User{})
+	return listPage(q, opts, userListColumns, func(u domain.User) int64 { return u.ID })
+}
+
+func (s *GormUserStore) Each(ctx context.Context, fn func(domain.User) error) error {
+	var users []domain.User
+	return s.db.WithContext(ctx).FindInBatches(&users, eachBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, u := range users {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// Update runs as a single conditional UPDATE, so concurrent edits cannot
+// silently overwrite each other when a version is given.
+func (s *GormUserStore) Update(ctx context.Context, id int64, update domain.UserChanges, version int64) (domain.User, error) {
+	changes := map[string]any{"version": gorm.Expr("version + 1")}
+	if update.Username != nil {
+		if *update.Username == "" {
+			return domain.User{}, pkg.ErrInvalidUsername
+		}
+		changes["username"] = *update.Username
 	}
-	if len(passwordHash) > 0 {
-		user.PasswordHash = passwordHash
+	if update.Email != nil {
+		if *update.Email != "" {
+			if _, err := mail.ParseAddress(*update.Email); err != nil {
+				return domain.User{}, pkg.ErrInvalidEmail
+			}
+		}
+		changes["email"] = *update.Email
+	}
+	if len(update.PasswordHash) > 0 {
+		changes["password_hash"] = update.PasswordHash
 	}
 
-	if err := s.db.WithContext(ctx).Save(&user).Error; err != nil {
-		if isDuplicateErr(err) {
-			return domain.User{}, pkg.ErrUsernameExists
+	q := s.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id)
+	if version > 0 {
+		q = q.Where("version = ?", version)
+	}
+	tx := q.Updates(changes)
+	if tx.Error != nil {
+		if isDuplicateErr(tx.Error) {
+			return domain.User{}, duplicateUserErr(tx.Error)
 		}
-		return domain.User{}, err
+		return domain.User{}, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		// Either the account is gone or the version moved on.
+		if _, err := s.GetByID(ctx, id); err != nil {
+			return domain.User{}, err
+		}
+		return domain.User{}, pkg.ErrVersionMismatch
 	}
 
-	return user, nil
+	return s.GetByID(ctx, id)
 }
 
 func (s *GormUserStore) Delete(ctx context.Context, id int64) error {
@@ -109,6 +173,44 @@ func (s *GormUserStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+// RevokeTokens invalidates every token issued to the user up to the given
+// time. It is stored as is: tokens carry whole seconds, and the check treats
+// one from the same second as revoked.
+func (s *GormUserStore) RevokeTokens(ctx context.Context, id int64, before time.Time) error {
+	tx := s.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Update("tokens_not_before", before)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *GormUserStore) SetRole(ctx context.Context, id int64, role string) (domain.User, error) {
+	tx := s.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Updates(map[string]any{
+		"role":    role,
+		"version": gorm.Expr("version + 1"),
+	})
+	if tx.Error != nil {
+		return domain.User{}, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return domain.User{}, pkg.ErrUserNotFound
+	}
+
+	return s.GetByID(ctx, id)
+}
+
+func duplicateUserErr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.ConstraintName == "idx_users_email_lower_live" {
+		return pkg.ErrDuplicateEmail
+	}
+	return pkg.ErrUsernameExists
+}
+
 func isDuplicateErr(err error) bool {
 	if errors.Is(err, gorm.ErrDuplicatedKey) {
 		return true
@@ -121,3 +223,191 @@ func isDuplicateErr(err error) bool {
 
 	return false
 }
+
+func (s *GormUserStore) UpdateProfile(ctx context.Context, id int64, update domain.ProfileUpdate) (domain.User, error) {
+	changes := map[string]any{"version": gorm.Expr("version + 1")}
+	if update.DisplayName != nil {
+		changes["display_name"] = *update.DisplayName
+	}
+	if update.Email != nil {
+		if *update.Email != "" {
+			if _, err := mail.ParseAddress(*update.Email); err != nil {
+				return domain.User{}, pkg.ErrInvalidEmail
+			}
+		}
+		changes["email"] = *update.Email
+	}
+
+	if len(changes) > 1 {
+		tx := s.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Updates(changes)
+		if tx.Error != nil {
+			if isDuplicateErr(tx.Error) {
+				return domain.User{}, duplicateUserErr(tx.Error)
+			}
+			return domain.User{}, tx.Error
+		}
+		if tx.RowsAffected == 0 {
+			return domain.User{}, pkg.ErrUserNotFound
+		}
+	}
+
+	return s.GetByID(ctx, id)
+}
+
+func (s *GormUserStore) Close(ctx context.Context, id int64, closedAt, purgeAfter time.Time) error {
+	tx := s.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Updates(map[string]any{
+		"closed_at":   closedAt,
+		"purge_after": purgeAfter,
+	})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *GormUserStore) Reopen(ctx context.Context, id int64) error {
+	tx := s.db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", id).Updates(map[string]any{
+		"closed_at":   nil,
+		"purge_after": nil,
+	})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return pkg.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// userOwnedModels are removed together with a purged account. Invitations
+// go by the account that accepted them; ones the account sent name it only
+// by ID and stay with the people they were sent to. Idempotency records
+// hold the responses the account was sent.
+var userOwnedModels = []any{
+	&domain.PasswordResetToken{},
+	&domain.RecoveryCode{},
+	&domain.APIKey{},
+	&domain.ExternalIdentity{},
+	&domain.Session{},
+	&domain.Invitation{},
+	&domain.IdempotencyRecord{},
+}
+
+// purgeUsers permanently removes the accounts ids and everything they own.
+// Login attempts are keyed by username rather than account, in the
+// "user:<lowercase username>" form the login throttle uses; they are
+// dropped too so the name does not stay on record or locked out for
+// whoever registers it next. Attempts keyed by IP address are not tied to
+// the account and expire on their own.
+func purgeUsers(tx *gorm.DB, ids []int64) (int64, error) {
+	var usernames []string
+	if err := tx.Unscoped().Model(&domain.User{}).Where("id IN ?", ids).Pluck("username", &usernames).Error; err != nil {
+		return 0, err
+	}
+	keys := make([]string, len(usernames))
+	for i, username := range usernames {
+		keys[i] = "user:" + strings.ToLower(username)
+	}
+	if err := tx.Where("key IN ?", keys).Delete(&domain.LoginAttempt{}).Error; err != nil {
+		return 0, err
+	}
+
+	for _, model := range userOwnedModels {
+		if err := tx.Where("user_id IN ?", ids).Delete(model).Error; err != nil {
+			return 0, err
+		}
+	}
+	res := tx.Unscoped().Where("id IN ?", ids).Delete(&domain.User{})
+	return res.RowsAffected, res.Error
+}
+
+func (s *GormUserStore) PurgeClosed(ctx context.Context, now time.Time) (int64, error) {
+	var purged int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the rows so a concurrent Reopen cannot race the purge.
+		var ids []int64
+		err := tx.Model(&domain.User{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("closed_at IS NOT NULL AND purge_after < ?", now).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		purged, err = purgeUsers(tx, ids)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+func (s *GormUserStore) ListDeleted(ctx context.Context) ([]domain.User, error) {
+	var users []domain.User
+	err := s.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// Restore undeletes an account. It fails with a duplicate error when a live
+// account has taken the username or email in the meantime.
+func (s *GormUserStore) Restore(ctx context.Context, id int64) (domain.User, error) {
+	tx := s.db.WithContext(ctx).Unscoped().Model(&domain.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]any{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if tx.Error != nil {
+		if isDuplicateErr(tx.Error) {
+			return domain.User{}, duplicateUserErr(tx.Error)
+		}
+		return domain.User{}, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return domain.User{}, pkg.ErrUserNotFound
+	}
+
+	return s.GetByID(ctx, id)
+}
+
+func (s *GormUserStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []int64
+		err := tx.Unscoped().Model(&domain.User{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("deleted_at < ?", before).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		purged, err = purgeUsers(tx, ids)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+func (s *GormUserStore) Transaction(ctx context.Context, fn func(ports.UserStore) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormUserStore{db: tx})
+	})
+}
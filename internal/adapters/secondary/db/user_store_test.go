@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// scriptedDB is a database/sql connector that runs everything inside no-op
+// transactions. Queries are answered by the first entry of answers whose
+// key appears in the SQL, as rows of a single id column. Statements report
+// one affected row per argument, or none if they contain unaffected.
+type scriptedDB struct {
+	answers    map[string][][]driver.Value
+	unaffected string
+	statements []string
+	args       [][]any
+}
+
+func (d *scriptedDB) Connect(context.Context) (driver.Conn, error) { return scriptedConn{d}, nil }
+func (d *scriptedDB) Driver() driver.Driver                        { return nil }
+
+type scriptedConn struct{ db *scriptedDB }
+
+func (c scriptedConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c scriptedConn) Close() error                        { return nil }
+func (c scriptedConn) Begin() (driver.Tx, error)           { return scriptedTx{}, nil }
+
+func (c scriptedConn) record(query string, named []driver.NamedValue) []any {
+	args := make([]any, len(named))
+	for i, a := range named {
+		args[i] = a.Value
+	}
+	c.db.statements = append(c.db.statements, query)
+	c.db.args = append(c.db.args, args)
+	return args
+}
+
+func (c scriptedConn) QueryContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	c.record(query, named)
+	for key, values := range c.db.answers {
+		if strings.Contains(query, key) {
+			return &recordedRows{columns: []string{"id"}, values: append([][]driver.Value(nil), values...)}, nil
+		}
+	}
+	return &recordedRows{columns: []string{"id"}}, nil
+}
+
+func (c scriptedConn) ExecContext(ctx context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	args := c.record(query, named)
+	if c.db.unaffected != "" && strings.Contains(query, c.db.unaffected) {
+		return driver.RowsAffected(0), nil
+	}
+	return driver.RowsAffected(len(args)), nil
+}
+
+type scriptedTx struct{}
+
+func (scriptedTx) Commit() error   { return nil }
+func (scriptedTx) Rollback() error { return nil }
+
+func openScriptedDB(t *testing.T, d *scriptedDB) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(d)}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return db
+}
+
+var deleteFrom = regexp.MustCompile(`^DELETE FROM "(\w+)"`)
+
+func TestPurgeRemovesEverythingTheAccountOwned(t *testing.T) {
+	purges := map[string]func(*GormUserStore) (int64, error){
+		"closed": func(s *GormUserStore) (int64, error) { return s.PurgeClosed(context.Background(), time.Now()) },
+		"deleted": func(s *GormUserStore) (int64, error) {
+			return s.PurgeDeleted(context.Background(), time.Now())
+		},
+	}
+
+	for name, purge := range purges {
+		t.Run(name, func(t *testing.T) {
+			d := &scriptedDB{answers: map[string][][]driver.Value{
+				`SELECT "id" FROM "users"`:       {{int64(7)}, {int64(9)}},
+				`SELECT "username" FROM "users"`: {{"Pat"}, {"sam"}},
+			}}
+			purged, err := purge(NewGormUserStore(openScriptedDB(t, d)))
+			if err != nil {
+				t.Fatalf("purge: %v", err)
+			}
+			if purged != 2 {
+				t.Errorf("purged = %d, want 2", purged)
+			}
+
+			deleted := map[string][]any{}
+			var order []string
+			for i, stmt := range d.statements {
+				if m := deleteFrom.FindStringSubmatch(stmt); m != nil {
+					deleted[m[1]] = d.args[i]
+					order = append(order, m[1])
+				}
+			}
+			for _, table := range []string{
+				"password_reset_tokens", "recovery_codes", "api_keys", "external_identities",
+				"sessions", "invitations", "idempotency_records",
+			} {
+				if args, ok := deleted[table]; !ok || !reflect.DeepEqual(args, []any{int64(7), int64(9)}) {
+					t.Errorf("%s: deleted with %v, want the purged user IDs", table, args)
+				}
+			}
+			if args := deleted["login_attempts"]; !reflect.DeepEqual(args, []any{"user:pat", "user:sam"}) {
+				t.Errorf("login_attempts: deleted with %v, want the throttle keys of the purged usernames", args)
+			}
+			if len(order) == 0 || order[len(order)-1] != "users" {
+				t.Errorf("deleted in order %v, want the accounts last", order)
+			}
+		})
+	}
+}
+
+func TestDeleteIsSoft(t *testing.T) {
+	d := &scriptedDB{}
+	if err := NewGormUserStore(openScriptedDB(t, d)).Delete(context.Background(), 7); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if len(d.statements) != 1 || !strings.HasPrefix(d.statements[0], `UPDATE "users" SET "deleted_at"=`) {
+		t.Fatalf("statements = %q, want a single UPDATE of deleted_at", d.statements)
+	}
+	if !strings.Contains(d.statements[0], `"deleted_at" IS NULL`) {
+		t.Errorf("statement = %q, want already deleted accounts skipped", d.statements[0])
+	}
+}
+
+func TestUpdateIsConditional(t *testing.T) {
+	username := "sam"
+
+	d := &scriptedDB{answers: map[string][][]driver.Value{`FROM "users"`: {{int64(7)}}}}
+	if _, err := NewGormUserStore(openScriptedDB(t, d)).Update(context.Background(), 7, domain.UserChanges{Username: &username}, 3); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	update := d.statements[0]
+	if !strings.HasPrefix(update, `UPDATE "users" SET`) || !strings.Contains(update, `"version"=version + 1`) || !strings.Contains(update, "version = $") {
+		t.Errorf("statement = %q, want one UPDATE bumping the version where it still matches", update)
+	}
+	if args := d.args[0]; args[len(args)-2] != int64(7) || args[len(args)-1] != int64(3) {
+		t.Errorf("args = %v, want the ID and the version read", args)
+	}
+
+	// The row exists but was not updated: someone else changed it first.
+	d = &scriptedDB{answers: d.answers, unaffected: "UPDATE"}
+	if _, err := NewGormUserStore(openScriptedDB(t, d)).Update(context.Background(), 7, domain.UserChanges{Username: &username}, 3); !errors.Is(err, pkg.ErrVersionMismatch) {
+		t.Errorf("stale version: err = %v, want %v", err, pkg.ErrVersionMismatch)
+	}
+	d = &scriptedDB{unaffected: "UPDATE"}
+	if _, err := NewGormUserStore(openScriptedDB(t, d)).Update(context.Background(), 7, domain.UserChanges{Username: &username}, 3); !errors.Is(err, pkg.ErrUserNotFound) {
+		t.Errorf("missing account: err = %v, want %v", err, pkg.ErrUserNotFound)
+	}
+}
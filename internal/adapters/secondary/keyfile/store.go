@@ -0,0 +1,144 @@
+// Package keyfile keeps signing keys as PEM files in a directory, one file
+// per key named after its kid. Key metadata travels in the PEM headers.
+package keyfile
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+const (
+	headerAlgorithm = "Algorithm"
+	headerCreatedAt = "Created-At"
+	headerExpiresAt = "Expires-At"
+
+	fileSuffix = ".pem"
+)
+
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create key directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) List(ctx context.Context) ([]domain.SigningKey, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []domain.SigningKey
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		key, err := decode(strings.TrimSuffix(entry.Name(), fileSuffix), data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *Store) Save(ctx context.Context, key domain.SigningKey) error {
+	path, err := s.path(key.ID)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(key.PrivateKeyPEM)
+	if block == nil {
+		return fmt.Errorf("key %s: no PEM block found", key.ID)
+	}
+	block.Headers = map[string]string{
+		headerAlgorithm: key.Algorithm,
+		headerCreatedAt: key.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if key.ExpiresAt != nil {
+		block.Headers[headerExpiresAt] = key.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	// Write to a temporary file first so readers never see a partial key.
+	tmp, err := os.CreateTemp(s.dir, ".key-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := pem.Encode(tmp, block); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Store) Delete(ctx context.Context, id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", fmt.Errorf("invalid key id %q", id)
+	}
+	return filepath.Join(s.dir, id+fileSuffix), nil
+}
+
+func decode(id string, data []byte) (domain.SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return domain.SigningKey{}, fmt.Errorf("key %s: no PEM block found", id)
+	}
+
+	key := domain.SigningKey{
+		ID:            id,
+		Algorithm:     block.Headers[headerAlgorithm],
+		PrivateKeyPEM: data,
+	}
+	if key.Algorithm == "" {
+		return domain.SigningKey{}, fmt.Errorf("key %s: missing %s header", id, headerAlgorithm)
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, block.Headers[headerCreatedAt])
+	if err != nil {
+		return domain.SigningKey{}, fmt.Errorf("key %s: invalid %s header: %w", id, headerCreatedAt, err)
+	}
+	key.CreatedAt = createdAt
+
+	if value, ok := block.Headers[headerExpiresAt]; ok {
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return domain.SigningKey{}, fmt.Errorf("key %s: invalid %s header: %w", id, headerExpiresAt, err)
+		}
+		key.ExpiresAt = &expiresAt
+	}
+
+	return key, nil
+}
@@ -0,0 +1,21 @@
+package mailer
+
+import (
+	"context"
+	"log"
+
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+)
+
+// LogMailer writes outgoing mail to the process log. It is used when no SMTP
+// server is configured and is only suitable for local development.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg ports.MailMessage) error {
+	log.Printf("mail: to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type idempotencyKey struct {
+	userID int64
+	key    string
+}
+
+// IdempotencyStore keeps idempotency records in process memory. Records are
+// lost on restart and are not shared between instances.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	records map[idempotencyKey]domain.IdempotencyRecord
+}
+
+func NewIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{records: make(map[idempotencyKey]domain.IdempotencyRecord)}
+}
+
+func (s *IdempotencyStore) Reserve(ctx context.Context, rec domain.IdempotencyRecord) (domain.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{rec.UserID, rec.Key}
+	if existing, ok := s.records[k]; ok && existing.ExpiresAt.After(rec.CreatedAt) {
+		return existing, false, nil
+	}
+	s.records[k] = rec
+	return domain.IdempotencyRecord{}, true, nil
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, rec domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[idempotencyKey{rec.UserID, rec.Key}] = rec
+	return nil
+}
+
+func (s *IdempotencyStore) Release(ctx context.Context, userID int64, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, idempotencyKey{userID, key})
+	return nil
+}
+
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for k, rec := range s.records {
+		if !rec.ExpiresAt.After(now) {
+			delete(s.records, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
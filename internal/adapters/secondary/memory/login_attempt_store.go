@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+const loginAttemptPruneThreshold = 10000
+
+// LoginAttemptStore keeps failed login counters in process memory. Counters
+// are lost on restart and are not shared between instances.
+type LoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]domain.LoginAttempt
+}
+
+func NewLoginAttemptStore() *LoginAttemptStore {
+	return &LoginAttemptStore{attempts: make(map[string]domain.LoginAttempt)}
+}
+
+func (s *LoginAttemptStore) Get(ctx context.Context, key string) (domain.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.attempts[key], nil
+}
+
+func (s *LoginAttemptStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (domain.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.attempts) >= loginAttemptPruneThreshold {
+		s.prune(now, window)
+	}
+
+	attempt, ok := s.attempts[key]
+	if !ok || now.Sub(attempt.LastFailureAt) > window {
+		attempt = domain.LoginAttempt{Key: key, LockedUntil: attempt.LockedUntil}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	attempt.UpdatedAt = now
+	s.attempts[key] = attempt
+
+	return attempt, nil
+}
+
+func (s *LoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := s.attempts[key]
+	attempt.Key = key
+	attempt.LockedUntil = &until
+	attempt.UpdatedAt = time.Now()
+	s.attempts[key] = attempt
+
+	return nil
+}
+
+func (s *LoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// prune drops counters that have aged out of the window and are not locked.
+func (s *LoginAttemptStore) prune(now time.Time, window time.Duration) {
+	for key, attempt := range s.attempts {
+		if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+			continue
+		}
+		if now.Sub(attempt.LastFailureAt) > window {
+			delete(s.attempts, key)
+		}
+	}
+}
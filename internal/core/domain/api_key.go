@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// ScopeRead allows safe (GET, HEAD, OPTIONS) requests.
+	ScopeRead = "read"
+	// ScopeWrite additionally allows requests that change state.
+	ScopeWrite = "write"
+)
+
+// APIKey is a long-lived personal credential for scripts and CI. The key is
+// looked up by Prefix and checked against the SHA-256 KeyHash; the key itself
+// is only shown once when created.
+type APIKey struct {
+	ID     int64  `gorm:"primaryKey;type:bigserial" json:"id"`
+	UserID int64  `gorm:"index;not null" json:"user_id"`
+	Name   string `gorm:"size:100;not null" json:"name"`
+	Prefix string `gorm:"uniqueIndex;size:32;not null" json:"prefix"`
+	// Scopes is a space-separated list such as "read write".
+	Scopes     string     `gorm:"size:255;not null;default:''" json:"scopes"`
+	KeyHash    []byte     `gorm:"not null" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
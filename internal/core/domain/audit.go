@@ -0,0 +1,145 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// Audit actions. Names are stable so they can be used as query filters.
+const (
+	AuditLoginSucceeded   = "auth.login.succeeded"
+	AuditLoginFailed      = "auth.login.failed"
+	AuditUserCreated      = "user.created"
+	AuditUserUpdated      = "user.updated"
+	AuditUserDeleted      = "user.deleted"
+	AuditUserRestored     = "user.restored"
+	AuditUserRoleChanged  = "user.role_changed"
+	AuditUserClosed       = "user.closed"
+	AuditPasswordChanged  = "user.password_changed"
+	AuditInvitationIssued = "invitation.created"
+	AuditDeviceCreated    = "device.created"
+	AuditDeviceUpdated    = "device.updated"
+	AuditDeviceDeleted    = "device.deleted"
+	AuditDeviceRestored   = "device.restored"
+	AuditDevicesImported  = "device.imported"
+
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonatedRequest  = "impersonation.request"
+)
+
+// Audit target types.
+const (
+	AuditTargetUser       = "user"
+	AuditTargetUsername   = "username"
+	AuditTargetDevice     = "device"
+	AuditTargetInvitation = "invitation"
+)
+
+// AuditEvent is one entry in the append-only audit trail. ActorID is nil for
+// unauthenticated actions such as failed logins. During impersonation the
+// actor is the admin and OnBehalfOfID is the impersonated user.
+type AuditEvent struct {
+	ID           int64        `gorm:"primaryKey;type:bigserial" json:"id"`
+	Action       string       `gorm:"size:64;not null;index" json:"action"`
+	ActorID      *int64       `gorm:"index" json:"actor_id,omitempty"`
+	OnBehalfOfID *int64       `json:"on_behalf_of_id,omitempty"`
+	TargetType   string       `gorm:"size:32;not null;default:'';index:idx_audit_events_target" json:"target_type,omitempty"`
+	TargetID     string       `gorm:"size:64;not null;default:'';index:idx_audit_events_target" json:"target_id,omitempty"`
+	IP           string       `gorm:"size:64;not null;default:''" json:"ip,omitempty"`
+	RequestID    string       `gorm:"size:64;not null;default:''" json:"request_id,omitempty"`
+	Detail       string       `gorm:"size:255;not null;default:''" json:"detail,omitempty"`
+	Changes      AuditChanges `gorm:"type:jsonb" json:"changes,omitempty"`
+	CreatedAt    time.Time    `gorm:"index" json:"created_at"`
+}
+
+// AuditFilter narrows an audit query. Zero fields match everything.
+type AuditFilter struct {
+	Action     string
+	ActorID    *int64
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	// BeforeID returns events older than the given ID, for paging.
+	BeforeID int64
+	Limit    int
+}
+
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// AuditChanges maps a field name to its value before and after the action.
+type AuditChanges map[string]FieldChange
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+func (c *AuditChanges) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return errors.New("unsupported audit changes value")
+	}
+}
+
+// diffIgnoredFields change on every write and would only add noise.
+var diffIgnoredFields = map[string]bool{"updated_at": true, "version": true}
+
+// DiffFields compares the JSON form of two values and returns the fields
+// that differ. Either side may be nil for creates and deletes. Fields hidden
+// from JSON, such as password hashes, never appear in the diff.
+func DiffFields(before, after any) AuditChanges {
+	from, to := jsonFields(before), jsonFields(after)
+	changes := AuditChanges{}
+	for k, v := range from {
+		if diffIgnoredFields[k] {
+			continue
+		}
+		if w, ok := to[k]; !ok || !reflect.DeepEqual(v, w) {
+			changes[k] = FieldChange{From: v, To: to[k]}
+		}
+	}
+	for k, w := range to {
+		if _, ok := from[k]; !ok && !diffIgnoredFields[k] {
+			changes[k] = FieldChange{To: w}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func jsonFields(v any) map[string]any {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
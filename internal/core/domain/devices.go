@@ -1,12 +1,19 @@
 package domain
 
-import "time"
+import (
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// Device is a registered device. Version increases with every change and
+// backs the device's ETag.
 type Device struct {
-	ID        int64      `gorm:"primaryKey;type:bigserial" json:"id"`
-	Name      string     `gorm:"size:128;not null" json:"name"`
-	TypeID    int64      `gorm:"not null" json:"type_id"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	DeletedAt *time.Time `gorm:"index" json:"-"`
+	ID        int64          `gorm:"primaryKey;type:bigserial" json:"id"`
+	Name      string         `gorm:"uniqueIndex:idx_devices_name_live,where:deleted_at IS NULL;size:128;not null" json:"name"`
+	TypeID    int64          `gorm:"not null" json:"type_id"`
+	Version   int64          `gorm:"not null;default:1" json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// ExternalIdentity links a user to an account at an external identity
+// provider, identified by the provider's issuer and subject.
+type ExternalIdentity struct {
+	ID        int64     `gorm:"primaryKey;type:bigserial" json:"id"`
+	UserID    int64     `gorm:"index;not null" json:"user_id"`
+	Provider  string    `gorm:"uniqueIndex:idx_external_identities_provider_subject;size:255;not null" json:"provider"`
+	Subject   string    `gorm:"uniqueIndex:idx_external_identities_provider_subject;size:255;not null" json:"subject"`
+	Email     string    `gorm:"size:255;not null;default:''" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
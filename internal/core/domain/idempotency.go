@@ -0,0 +1,24 @@
+package domain
+
+import "time"
+
+// IdempotencyRecord remembers the response to a request sent with an
+// Idempotency-Key so that retries get the same answer. Keys are scoped to
+// the user who sent them; anonymous requests share UserID 0. Status is zero
+// while the first request is still being handled.
+type IdempotencyRecord struct {
+	UserID      int64  `gorm:"primaryKey;autoIncrement:false"`
+	Key         string `gorm:"primaryKey;size:255"`
+	RequestHash string `gorm:"size:64;not null"`
+	Status      int    `gorm:"not null;default:0"`
+	ContentType string `gorm:"size:128;not null;default:''"`
+	ETag        string `gorm:"column:etag;size:64;not null;default:''"`
+	Body        []byte
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// Completed reports whether the response has been stored.
+func (r IdempotencyRecord) Completed() bool {
+	return r.Status != 0
+}
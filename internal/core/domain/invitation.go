@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// Invitation lets an admin onboard someone without open registration. The
+// acceptance link carries a random token; only its SHA-256 hash is stored.
+type Invitation struct {
+	ID         int64      `gorm:"primaryKey;type:bigserial" json:"id"`
+	Email      string     `gorm:"size:255;not null;index" json:"email"`
+	Role       string     `gorm:"size:32;not null;default:user" json:"role"`
+	TokenHash  []byte     `gorm:"uniqueIndex;not null" json:"-"`
+	InvitedBy  int64      `gorm:"index;not null" json:"invited_by"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	// UserID is the account created when the invitation was accepted.
+	UserID    *int64    `json:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
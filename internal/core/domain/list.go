@@ -0,0 +1,45 @@
+package domain
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// Filter operators accepted in ListOptions.
+const (
+	FilterEquals   = "eq"
+	FilterContains = "contains"
+	FilterAfter    = "after"
+	FilterBefore   = "before"
+)
+
+// ListFilter restricts a list to rows whose Field matches Value under Op.
+type ListFilter struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// ListOptions controls paging, ordering and filtering of a list query. Stores
+// reject unknown fields and unsupported operators with
+// ErrInvalidListOptions.
+type ListOptions struct {
+	// Limit caps the page size; zero means DefaultListLimit.
+	Limit int
+	// Cursor continues from a previous page's NextCursor. It takes precedence
+	// over Offset.
+	Cursor string
+	Offset int
+	// Sort is the field to order by, id when empty. Ties are broken by id.
+	Sort    string
+	Desc    bool
+	Filters []ListFilter
+}
+
+// Page is one page of a list query. NextCursor is empty on the last page and
+// Total counts every row matching the filters.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+	Total      int64
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// LoginAttempt tracks consecutive failed logins for a throttling key such as
+// a username or client IP.
+type LoginAttempt struct {
+	Key           string     `gorm:"primaryKey;size:255" json:"key"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
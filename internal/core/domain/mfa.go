@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// RecoveryCode is a single-use fallback for a user's TOTP authenticator. Only
+// the SHA-256 hash of the code is persisted.
+type RecoveryCode struct {
+	ID        int64      `gorm:"primaryKey;type:bigserial" json:"id"`
+	UserID    int64      `gorm:"index;not null" json:"user_id"`
+	CodeHash  []byte     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// PasswordResetToken is a single-use, expiring token issued by the forgot
+// password flow. Only the SHA-256 hash of the token is persisted.
+type PasswordResetToken struct {
+	ID        int64      `gorm:"primaryKey;type:bigserial" json:"id"`
+	UserID    int64      `gorm:"index;not null" json:"user_id"`
+	TokenHash []byte     `gorm:"uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
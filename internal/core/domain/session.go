@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// Session is a single login. Access tokens carry the session ID in their sid
+// claim so a session can be revoked without revoking the user's other logins.
+type Session struct {
+	ID         string     `gorm:"primaryKey;size:64" json:"id"`
+	UserID     int64      `gorm:"index;not null" json:"user_id"`
+	IP         string     `gorm:"size:64;not null;default:''" json:"ip"`
+	UserAgent  string     `gorm:"size:512;not null;default:''" json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `gorm:"index;not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// SigningKey is a token signing key. The newest key signs new tokens; older
+// keys keep verifying until ExpiresAt so tokens issued before a rotation stay
+// valid for the overlap window.
+type SigningKey struct {
+	ID            string     `gorm:"primaryKey;size:64" json:"kid"`
+	Algorithm     string     `gorm:"size:16;not null" json:"alg"`
+	PrivateKeyPEM []byte     `gorm:"not null" json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
@@ -1,13 +1,51 @@
 package domain
 
-import "time"
+import (
+	"time"
 
+	"gorm.io/gorm"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User is an account. Usernames and emails only need to be unique among live
+// accounts, so a soft-deleted account does not block its name from reuse.
+// Version increases with every change and backs the account's ETag.
 type User struct {
-	ID           int64      `gorm:"primaryKey;type:bigserial" json:"id"`
-	Username     string     `gorm:"uniqueIndex;size:64;not null" json:"username"`
-	Email        string     `gorm:"uniqueIndex;size:255;not null" json:"email"`
-	PasswordHash []byte     `gorm:"not null" json:"-"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	DeletedAt    *time.Time `gorm:"index" json:"-"`
+	ID              int64      `gorm:"primaryKey;type:bigserial" json:"id"`
+	Username        string     `gorm:"uniqueIndex:idx_users_username_live,where:deleted_at IS NULL;size:64;not null" json:"username"`
+	Email           string     `gorm:"size:255;not null;default:''" json:"email"`
+	DisplayName     string     `gorm:"size:100;not null;default:''" json:"display_name"`
+	PasswordHash    []byte     `gorm:"not null" json:"-"`
+	Role            string     `gorm:"size:32;not null;default:user" json:"role"`
+	TokensNotBefore *time.Time `json:"-"`
+	TOTPSecret      string     `gorm:"size:64;not null;default:''" json:"-"`
+	TOTPEnabled     bool       `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep    int64      `gorm:"not null;default:0" json:"-"`
+	// ClosedAt is set when the user closes the account; the row is purged
+	// once PurgeAfter passes unless the user signs in again first.
+	ClosedAt   *time.Time     `json:"closed_at,omitempty"`
+	PurgeAfter *time.Time     `gorm:"index" json:"purge_after,omitempty"`
+	Version    int64          `gorm:"not null;default:1" json:"version"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// UserChanges lists the account fields an update sets; nil fields and an
+// empty hash are left unchanged.
+type UserChanges struct {
+	Username     *string
+	Email        *string
+	PasswordHash []byte
+}
+
+// ProfileUpdate lists the self-service profile fields; nil fields are left
+// unchanged.
+type ProfileUpdate struct {
+	DisplayName *string
+	Email       *string
 }
@@ -0,0 +1,19 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type APIKeyStore interface {
+	Create(ctx context.Context, key *domain.APIKey) error
+	ListForUser(ctx context.Context, userID int64) ([]domain.APIKey, error)
+	FindByPrefix(ctx context.Context, prefix string) (domain.APIKey, error)
+	// Touch records that the key was used at the given time.
+	Touch(ctx context.Context, id int64, at time.Time) error
+	// Delete removes one of the user's keys, failing with ErrAPIKeyNotFound
+	// when the key belongs to someone else.
+	Delete(ctx context.Context, userID, id int64) error
+}
@@ -0,0 +1,18 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+// AuditStore is append-only; there is deliberately no way to change or
+// remove an event.
+type AuditStore interface {
+	Append(ctx context.Context, event *domain.AuditEvent) error
+	// List returns matching events, newest first.
+	List(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error)
+	// Each streams matching events oldest first without loading them all
+	// into memory. Limit is ignored.
+	Each(ctx context.Context, filter domain.AuditFilter, fn func(domain.AuditEvent) error) error
+}
@@ -2,6 +2,7 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"github.com/reginaldsourn/go-crud/internal/core/domain"
 )
@@ -9,7 +10,20 @@ import (
 type DeviceStore interface {
 	Create(ctx context.Context, name string, typeID int64) (domain.Device, error)
 	GetByID(ctx context.Context, id int64) (domain.Device, error)
-	List(ctx context.Context) ([]domain.Device, error)
-	Update(ctx context.Context, id int64, name string, typeID int64) (domain.Device, error)
+	GetByName(ctx context.Context, name string) (domain.Device, error)
+	List(ctx context.Context, opts domain.ListOptions) (domain.Page[domain.Device], error)
+	// Each calls fn for every live device in ID order, loading them in
+	// chunks, and stops at the first error fn returns.
+	Each(ctx context.Context, fn func(domain.Device) error) error
+	// Update changes the name and/or type. When version is non-zero the
+	// update only applies if the device is still at that version, and fails
+	// with ErrVersionMismatch otherwise.
+	Update(ctx context.Context, id int64, name string, typeID int64, version int64) (domain.Device, error)
 	Delete(ctx context.Context, id int64) error
+	ListDeleted(ctx context.Context) ([]domain.Device, error)
+	Restore(ctx context.Context, id int64) (domain.Device, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	// Transaction runs fn against a store whose changes are committed
+	// together when fn returns nil and rolled back otherwise.
+	Transaction(ctx context.Context, fn func(DeviceStore) error) error
 }
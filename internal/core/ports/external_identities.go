@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type ExternalIdentityStore interface {
+	// Find fails with ErrIdentityNotFound when the identity is not linked.
+	Find(ctx context.Context, provider, subject string) (domain.ExternalIdentity, error)
+	Link(ctx context.Context, identity *domain.ExternalIdentity) error
+}
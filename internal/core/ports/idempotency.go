@@ -0,0 +1,21 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type IdempotencyStore interface {
+	// Reserve claims rec's key for a new request. When a live record already
+	// holds the key it is returned with reserved set to false; expired
+	// records are replaced.
+	Reserve(ctx context.Context, rec domain.IdempotencyRecord) (existing domain.IdempotencyRecord, reserved bool, err error)
+	// Complete stores the response for a reserved key.
+	Complete(ctx context.Context, rec domain.IdempotencyRecord) error
+	// Release drops a reservation whose request did not produce a response
+	// worth replaying, so the key can be used again.
+	Release(ctx context.Context, userID int64, key string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,25 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type InvitationStore interface {
+	Create(ctx context.Context, invitation *domain.Invitation) error
+	// ListPending returns invitations that are neither accepted nor expired.
+	ListPending(ctx context.Context, now time.Time) ([]domain.Invitation, error)
+	// Find returns a pending invitation without consuming it.
+	Find(ctx context.Context, tokenHash []byte, now time.Time) (domain.Invitation, error)
+	// Accept consumes a pending invitation and creates the account with the
+	// invited email and role in one step. It fails with ErrInvalidInvitation
+	// if the invitation is no longer pending.
+	Accept(ctx context.Context, tokenHash []byte, username string, passwordHash []byte, now time.Time) (domain.User, error)
+	Delete(ctx context.Context, id int64) error
+	// DeletePendingForEmail withdraws earlier invitations when a new one is
+	// sent to the same address.
+	DeletePendingForEmail(ctx context.Context, email string) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,18 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type LoginAttemptStore interface {
+	// Get returns the zero LoginAttempt when the key has no recorded failures.
+	Get(ctx context.Context, key string) (domain.LoginAttempt, error)
+	// RecordFailure increments the failure count, starting over when the
+	// previous failure is older than window.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (domain.LoginAttempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
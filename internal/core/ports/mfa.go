@@ -0,0 +1,17 @@
+package ports
+
+import "context"
+
+type MFAStore interface {
+	// SetTOTPSecret stores a pending secret; TOTP stays disabled until
+	// EnableTOTP is called.
+	SetTOTPSecret(ctx context.Context, userID int64, secret string) error
+	EnableTOTP(ctx context.Context, userID int64, recoveryCodeHashes [][]byte) error
+	DisableTOTP(ctx context.Context, userID int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error
+	// ConsumeTOTPStep records the time step of an accepted code and fails
+	// with ErrInvalidMFACode if that step, or a later one, was already used.
+	ConsumeTOTPStep(ctx context.Context, userID int64, step int64) error
+	ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error
+	CountRecoveryCodes(ctx context.Context, userID int64) (int64, error)
+}
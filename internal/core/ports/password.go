@@ -0,0 +1,11 @@
+package ports
+
+type PasswordHasher interface {
+	// Hash returns a self-describing encoded hash that records the algorithm
+	// and its parameters.
+	Hash(password string) ([]byte, error)
+	// Verify reports whether password matches encoded and whether encoded
+	// should be replaced because it uses an outdated algorithm or
+	// parameters.
+	Verify(password string, encoded []byte) (ok bool, needsRehash bool, err error)
+}
@@ -0,0 +1,18 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type PasswordResetStore interface {
+	Create(ctx context.Context, userID int64, tokenHash []byte, expiresAt time.Time) (domain.PasswordResetToken, error)
+	// Find returns an unused, unexpired token without consuming it.
+	Find(ctx context.Context, tokenHash []byte, now time.Time) (domain.PasswordResetToken, error)
+	// Consume marks an unused, unexpired token as used and returns it. It
+	// fails with ErrInvalidResetToken if no such token exists.
+	Consume(ctx context.Context, tokenHash []byte, now time.Time) (domain.PasswordResetToken, error)
+	DeleteForUser(ctx context.Context, userID int64) error
+}
@@ -0,0 +1,25 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type SessionStore interface {
+	Create(ctx context.Context, session *domain.Session) error
+	// Get fails with ErrSessionNotFound for unknown sessions.
+	Get(ctx context.Context, id string) (domain.Session, error)
+	// ListActive returns the user's sessions that are neither revoked nor
+	// expired, most recently used first.
+	ListActive(ctx context.Context, userID int64) ([]domain.Session, error)
+	Touch(ctx context.Context, id string, at time.Time) error
+	// Revoke ends one of the user's sessions, failing with
+	// ErrSessionNotFound when it belongs to someone else.
+	Revoke(ctx context.Context, userID int64, id string) error
+	RevokeAll(ctx context.Context, userID int64) error
+	// DeleteExpired removes sessions that expired or were revoked before
+	// the given time.
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
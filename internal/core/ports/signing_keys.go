@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"context"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+)
+
+type SigningKeyStore interface {
+	List(ctx context.Context) ([]domain.SigningKey, error)
+	Save(ctx context.Context, key domain.SigningKey) error
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,13 @@
+package ports
+
+import "github.com/reginaldsourn/go-crud/pkg/auth"
+
+type TokenIssuer interface {
+	Issue(req auth.TokenRequest) (string, auth.Claims, error)
+}
+
+type TokenVerifier interface {
+	// Verify checks the signature and standard claims. It does not check
+	// the purpose; callers decide which purposes they accept.
+	Verify(token string) (auth.Claims, error)
+}
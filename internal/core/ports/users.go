@@ -2,15 +2,43 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"github.com/reginaldsourn/go-crud/internal/core/domain"
 )
 
 type UserStore interface {
-	Create(ctx context.Context, username string, passwordHash []byte) (domain.User, error)
+	Create(ctx context.Context, username, email string, passwordHash []byte) (domain.User, error)
 	GetByID(ctx context.Context, id int64) (domain.User, error)
 	GetByUsername(ctx context.Context, username string) (domain.User, error)
-	List(ctx context.Context) ([]domain.User, error)
-	Update(ctx context.Context, id int64, username string, passwordHash []byte) (domain.User, error)
+	GetByEmail(ctx context.Context, email string) (domain.User, error)
+	List(ctx context.Context, opts domain.ListOptions) (domain.Page[domain.User], error)
+	// Each calls fn for every live account in ID order, loading them in
+	// chunks, and stops at the first error fn returns.
+	Each(ctx context.Context, fn func(domain.User) error) error
+	// Update applies changes in one statement. When version is non-zero the
+	// update only applies if the account is still at that version, and fails
+	// with ErrVersionMismatch otherwise.
+	Update(ctx context.Context, id int64, changes domain.UserChanges, version int64) (domain.User, error)
 	Delete(ctx context.Context, id int64) error
+	RevokeTokens(ctx context.Context, id int64, before time.Time) error
+	SetRole(ctx context.Context, id int64, role string) (domain.User, error)
+	UpdateProfile(ctx context.Context, id int64, update domain.ProfileUpdate) (domain.User, error)
+	// Close marks the account closed and schedules it for purge.
+	Close(ctx context.Context, id int64, closedAt, purgeAfter time.Time) error
+	// Reopen cancels a pending closure.
+	Reopen(ctx context.Context, id int64) error
+	// PurgeClosed permanently removes accounts whose purge time has passed,
+	// together with the records that belong to them.
+	PurgeClosed(ctx context.Context, now time.Time) (int64, error)
+	// ListDeleted returns soft-deleted accounts, most recently deleted
+	// first.
+	ListDeleted(ctx context.Context) ([]domain.User, error)
+	Restore(ctx context.Context, id int64) (domain.User, error)
+	// PurgeDeleted permanently removes accounts soft-deleted before the
+	// given time.
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	// Transaction runs fn against a store whose changes are committed
+	// together when fn returns nil and rolled back otherwise.
+	Transaction(ctx context.Context, fn func(UserStore) error) error
 }
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type DeviceService struct {
+	store ports.DeviceStore
+}
+
+func NewDeviceService(store ports.DeviceStore) *DeviceService {
+	return &DeviceService{store: store}
+}
+
+// DeviceUpdate changes the fields that are set.
+type DeviceUpdate struct {
+	Name   *string
+	TypeID *int64
+	// Match, when set, must accept the device's current version or the
+	// update fails with ErrVersionMismatch.
+	Match func(version int64) bool
+}
+
+// UpsertResult says what Upsert did.
+type UpsertResult int
+
+const (
+	Unchanged UpsertResult = iota
+	Created
+	Updated
+)
+
+func (s *DeviceService) Create(ctx context.Context, name string, typeID int64) (domain.Device, error) {
+	return s.store.Create(ctx, name, typeID)
+}
+
+func (s *DeviceService) Get(ctx context.Context, id int64) (domain.Device, error) {
+	return s.store.GetByID(ctx, id)
+}
+
+func (s *DeviceService) List(ctx context.Context, opts domain.ListOptions) (domain.Page[domain.Device], error) {
+	return s.store.List(ctx, opts)
+}
+
+func (s *DeviceService) ListDeleted(ctx context.Context) ([]domain.Device, error) {
+	return s.store.ListDeleted(ctx)
+}
+
+// Each calls fn for every live device in ID order.
+func (s *DeviceService) Each(ctx context.Context, fn func(domain.Device) error) error {
+	return s.store.Each(ctx, fn)
+}
+
+// Update applies in and returns the device before and after.
+func (s *DeviceService) Update(ctx context.Context, id int64, in DeviceUpdate) (before, after domain.Device, err error) {
+	if in.Name == nil && in.TypeID == nil {
+		return before, after, pkg.Invalid("no fields to update")
+	}
+
+	before, err = s.store.GetByID(ctx, id)
+	if err != nil {
+		return before, after, err
+	}
+	if in.Match != nil && !in.Match(before.Version) {
+		return before, after, pkg.ErrVersionMismatch
+	}
+
+	name := ""
+	if in.Name != nil {
+		name = *in.Name
+	}
+	typeID := int64(0)
+	if in.TypeID != nil {
+		typeID = *in.TypeID
+	}
+	after, err = s.store.Update(ctx, id, name, typeID, before.Version)
+	return before, after, err
+}
+
+// Upsert creates the device named name, or moves an existing one to typeID.
+func (s *DeviceService) Upsert(ctx context.Context, name string, typeID int64) (UpsertResult, error) {
+	existing, err := s.store.GetByName(ctx, name)
+	switch {
+	case errors.Is(err, pkg.ErrDeviceNotFound):
+		if _, err := s.store.Create(ctx, name, typeID); err != nil {
+			return Unchanged, err
+		}
+		return Created, nil
+	case err != nil:
+		return Unchanged, err
+	case existing.TypeID == typeID:
+		return Unchanged, nil
+	default:
+		if _, err := s.store.Update(ctx, existing.ID, "", typeID, existing.Version); err != nil {
+			return Unchanged, err
+		}
+		return Updated, nil
+	}
+}
+
+// Delete soft-deletes a device and returns it as it was.
+func (s *DeviceService) Delete(ctx context.Context, id int64) (domain.Device, error) {
+	before, err := s.store.GetByID(ctx, id)
+	if err != nil {
+		return before, err
+	}
+	return before, s.store.Delete(ctx, id)
+}
+
+func (s *DeviceService) Restore(ctx context.Context, id int64) (domain.Device, error) {
+	return s.store.Restore(ctx, id)
+}
+
+// Transaction runs fn with a service whose changes are committed together
+// when fn returns nil and rolled back otherwise.
+func (s *DeviceService) Transaction(ctx context.Context, fn func(*DeviceService) error) error {
+	return s.store.Transaction(ctx, func(store ports.DeviceStore) error {
+		return fn(&DeviceService{store: store})
+	})
+}
@@ -0,0 +1,328 @@
+// Package services holds the application's use cases. Adapters call these
+// instead of the stores, so rules such as the password policy are applied
+// the same way whichever way a request comes in.
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+	"github.com/reginaldsourn/go-crud/pkg/password"
+)
+
+const (
+	// maxProvisionAttempts bounds how many suffixed usernames Provision tries.
+	maxProvisionAttempts = 5
+	maxDisplayNameLength = 100
+)
+
+type UserService struct {
+	store  ports.UserStore
+	hasher ports.PasswordHasher
+	policy password.Policy
+	// registrationClosed rejects Register, leaving account creation to
+	// admins and invitations.
+	registrationClosed bool
+}
+
+func NewUserService(store ports.UserStore, hasher ports.PasswordHasher, policy password.Policy, registrationClosed bool) *UserService {
+	return &UserService{store: store, hasher: hasher, policy: policy, registrationClosed: registrationClosed}
+}
+
+// NewUser is an account to create.
+type NewUser struct {
+	Username string
+	Email    string
+	Password string
+}
+
+// UserUpdate changes the fields that are set.
+type UserUpdate struct {
+	Username *string
+	Email    *string
+	Password *string
+	// Match, when set, must accept the account's current version or the
+	// update fails with ErrVersionMismatch.
+	Match func(version int64) bool
+}
+
+// Register creates an account for someone signing themselves up.
+func (s *UserService) Register(ctx context.Context, in NewUser) (domain.User, error) {
+	if s.registrationClosed {
+		return domain.User{}, pkg.ErrRegistrationClosed
+	}
+	return s.Create(ctx, in)
+}
+
+// Create checks the password against the policy and creates the account.
+func (s *UserService) Create(ctx context.Context, in NewUser) (domain.User, error) {
+	in = in.normalized()
+	passwordHash, err := s.HashPassword(in.Password, in.Username)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return s.store.Create(ctx, in.Username, in.Email, passwordHash)
+}
+
+// Provision creates an account for someone signing in through an external
+// identity provider. It gets an unusable random password, so the account is
+// reached through the provider or a password reset. When username is taken
+// a short random suffix is added.
+func (s *UserService) Provision(ctx context.Context, username, email string) (domain.User, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return domain.User{}, err
+	}
+	passwordHash, err := s.hasher.Hash(hex.EncodeToString(secret))
+	if err != nil {
+		return domain.User{}, pkg.Internal("failed to hash password")
+	}
+
+	in := NewUser{Username: username, Email: email}.normalized()
+	base := in.Username
+	for attempt := 0; attempt < maxProvisionAttempts; attempt++ {
+		u, err := s.store.Create(ctx, in.Username, in.Email, passwordHash)
+		if !errors.Is(err, pkg.ErrUsernameExists) {
+			return u, err
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return domain.User{}, err
+		}
+		in.Username = base + "-" + hex.EncodeToString(suffix)
+	}
+	return domain.User{}, pkg.ErrUsernameExists
+}
+
+// normalized trims the whitespace clients and identity providers leave
+// around usernames and addresses.
+func (in NewUser) normalized() NewUser {
+	in.Username = strings.TrimSpace(in.Username)
+	in.Email = strings.TrimSpace(in.Email)
+	return in
+}
+
+func (s *UserService) Get(ctx context.Context, id int64) (domain.User, error) {
+	return s.store.GetByID(ctx, id)
+}
+
+func (s *UserService) GetByUsername(ctx context.Context, username string) (domain.User, error) {
+	return s.store.GetByUsername(ctx, username)
+}
+
+func (s *UserService) GetByEmail(ctx context.Context, email string) (domain.User, error) {
+	return s.store.GetByEmail(ctx, email)
+}
+
+func (s *UserService) List(ctx context.Context, opts domain.ListOptions) (domain.Page[domain.User], error) {
+	return s.store.List(ctx, opts)
+}
+
+func (s *UserService) ListDeleted(ctx context.Context) ([]domain.User, error) {
+	return s.store.ListDeleted(ctx)
+}
+
+// Each calls fn for every live account in ID order.
+func (s *UserService) Each(ctx context.Context, fn func(domain.User) error) error {
+	return s.store.Each(ctx, fn)
+}
+
+// Update applies in and returns the account before and after. A new
+// password is checked against the policy with the account's new username.
+func (s *UserService) Update(ctx context.Context, id int64, in UserUpdate) (before, after domain.User, err error) {
+	if in.Username == nil && in.Email == nil && in.Password == nil {
+		return before, after, pkg.Invalid("no fields to update")
+	}
+
+	before, err = s.store.GetByID(ctx, id)
+	if err != nil {
+		return before, after, err
+	}
+	if in.Match != nil && !in.Match(before.Version) {
+		return before, after, pkg.ErrVersionMismatch
+	}
+
+	changes := domain.UserChanges{Username: in.Username, Email: in.Email}
+	if in.Password != nil {
+		policyUsername := before.Username
+		if in.Username != nil {
+			policyUsername = *in.Username
+		}
+		if changes.PasswordHash, err = s.HashPassword(*in.Password, policyUsername); err != nil {
+			return before, after, err
+		}
+	}
+
+	// One conditional write, so a concurrent change since before was read
+	// fails the update instead of being overwritten.
+	after, err = s.store.Update(ctx, id, changes, before.Version)
+	return before, after, err
+}
+
+// SetRole changes another account's role and returns it before and after.
+// Nobody can change their own role, so the last admin cannot lock everyone
+// out by accident.
+func (s *UserService) SetRole(ctx context.Context, actorID, id int64, role string) (before, after domain.User, err error) {
+	if id == actorID {
+		return before, after, pkg.Invalid("cannot change your own role")
+	}
+	before, err = s.store.GetByID(ctx, id)
+	if err != nil {
+		return before, after, err
+	}
+	after, err = s.store.SetRole(ctx, id, role)
+	return before, after, err
+}
+
+// Delete soft-deletes an account and returns it as it was.
+func (s *UserService) Delete(ctx context.Context, id int64) (domain.User, error) {
+	before, err := s.store.GetByID(ctx, id)
+	if err != nil {
+		return before, err
+	}
+	return before, s.store.Delete(ctx, id)
+}
+
+func (s *UserService) Restore(ctx context.Context, id int64) (domain.User, error) {
+	return s.store.Restore(ctx, id)
+}
+
+// BootstrapAdmin creates in as an admin account unless an admin already
+// exists, so a fresh installation can be set up without public
+// registration. It reports whether the account was created.
+func (s *UserService) BootstrapAdmin(ctx context.Context, in NewUser) (bool, error) {
+	admins, err := s.store.List(ctx, domain.ListOptions{
+		Limit:   1,
+		Filters: []domain.ListFilter{{Field: "role", Op: domain.FilterEquals, Value: domain.RoleAdmin}},
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(admins.Items) > 0 {
+		return false, nil
+	}
+
+	err = s.Transaction(ctx, func(tx *UserService) error {
+		u, err := tx.Create(ctx, in)
+		if err != nil {
+			return err
+		}
+		_, err = tx.store.SetRole(ctx, u.ID, domain.RoleAdmin)
+		return err
+	})
+	return err == nil, err
+}
+
+// UpdateProfile changes the self-service fields of account id. Display
+// names and addresses are trimmed; callers decide whether an email change
+// needs the password first.
+func (s *UserService) UpdateProfile(ctx context.Context, id int64, update domain.ProfileUpdate) (domain.User, error) {
+	if update.DisplayName != nil {
+		name := strings.TrimSpace(*update.DisplayName)
+		if len(name) > maxDisplayNameLength {
+			return domain.User{}, pkg.InvalidField("display_name", "max", "display_name must be at most 100 characters")
+		}
+		update.DisplayName = &name
+	}
+	if update.Email != nil {
+		email := strings.TrimSpace(*update.Email)
+		update.Email = &email
+	}
+	return s.store.UpdateProfile(ctx, id, update)
+}
+
+// Close schedules account id for purging once grace has passed from now and
+// returns both times.
+func (s *UserService) Close(ctx context.Context, id int64, grace time.Duration) (closedAt, purgeAfter time.Time, err error) {
+	closedAt = time.Now()
+	purgeAfter = closedAt.Add(grace)
+	return closedAt, purgeAfter, s.store.Close(ctx, id, closedAt, purgeAfter)
+}
+
+// Reopen cancels a pending closure.
+func (s *UserService) Reopen(ctx context.Context, id int64) error {
+	return s.store.Reopen(ctx, id)
+}
+
+// RevokeTokens rejects every token issued to account id up to now.
+func (s *UserService) RevokeTokens(ctx context.Context, id int64) error {
+	return s.store.RevokeTokens(ctx, id, time.Now())
+}
+
+// Transaction runs fn with a service whose changes are committed together
+// when fn returns nil and rolled back otherwise.
+func (s *UserService) Transaction(ctx context.Context, fn func(*UserService) error) error {
+	return s.store.Transaction(ctx, func(store ports.UserStore) error {
+		tx := *s
+		tx.store = store
+		return fn(&tx)
+	})
+}
+
+// SetPassword checks plain against the policy and makes it the password of
+// account id.
+func (s *UserService) SetPassword(ctx context.Context, id int64, plain string) (domain.User, error) {
+	u, err := s.store.GetByID(ctx, id)
+	if err != nil {
+		return domain.User{}, err
+	}
+	passwordHash, err := s.HashPassword(plain, u.Username)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return s.store.Update(ctx, id, domain.UserChanges{PasswordHash: passwordHash}, 0)
+}
+
+// HashPassword checks plain against the policy for username and hashes it.
+// It is for flows that must vet the password before spending a one-time
+// token and store the hash themselves, such as resets and invitations.
+func (s *UserService) HashPassword(plain, username string) ([]byte, error) {
+	if err := s.policy.Validate(plain, username); err != nil {
+		return nil, passwordError("password", err)
+	}
+	passwordHash, err := s.hasher.Hash(plain)
+	if err != nil {
+		return nil, pkg.Internal("failed to hash password")
+	}
+	return passwordHash, nil
+}
+
+// VerifyPassword checks plain against the stored hash of u and reports
+// whether the hash should be replaced with Rehash.
+func (s *UserService) VerifyPassword(u domain.User, plain string) (ok, needsRehash bool, err error) {
+	return s.hasher.Verify(plain, u.PasswordHash)
+}
+
+// Rehash stores plain, already verified by VerifyPassword, under the current
+// hashing parameters. The policy is not checked again: the password is
+// already in use.
+func (s *UserService) Rehash(ctx context.Context, id int64, plain string) error {
+	passwordHash, err := s.hasher.Hash(plain)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.Update(ctx, id, domain.UserChanges{PasswordHash: passwordHash}, 0)
+	return err
+}
+
+// StorePasswordHash makes a hash from HashPassword the password of account
+// id, for flows that vet the password before spending their token.
+func (s *UserService) StorePasswordHash(ctx context.Context, id int64, passwordHash []byte) (domain.User, error) {
+	return s.store.Update(ctx, id, domain.UserChanges{PasswordHash: passwordHash}, 0)
+}
+
+// passwordError reports a password policy failure against field.
+func passwordError(field string, err error) error {
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		return pkg.ErrPasswordPolicy.WithFields(policyErr.FieldErrors(field)...)
+	}
+	return pkg.Internal("failed to validate password")
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/reginaldsourn/go-crud/internal/core/domain"
+	"github.com/reginaldsourn/go-crud/internal/core/ports"
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+	"github.com/reginaldsourn/go-crud/pkg/password"
+)
+
+type prefixHasher struct{}
+
+func (prefixHasher) Hash(plain string) ([]byte, error) { return []byte("hashed:" + plain), nil }
+
+func (prefixHasher) Verify(plain string, encoded []byte) (bool, bool, error) {
+	return string(encoded) == "hashed:"+plain, false, nil
+}
+
+// memoryUsers is a user table in a slice. Transactions restore it when fn
+// fails.
+type memoryUsers struct {
+	ports.UserStore
+	users   []domain.User
+	creates int
+	updates int
+}
+
+func (s *memoryUsers) Create(ctx context.Context, username, email string, passwordHash []byte) (domain.User, error) {
+	s.creates++
+	for _, u := range s.users {
+		if strings.EqualFold(u.Username, username) {
+			return domain.User{}, pkg.ErrUsernameExists
+		}
+	}
+	u := domain.User{ID: int64(len(s.users) + 1), Username: username, Email: email, PasswordHash: passwordHash, Role: domain.RoleUser, Version: 1}
+	s.users = append(s.users, u)
+	return u, nil
+}
+
+func (s *memoryUsers) GetByID(ctx context.Context, id int64) (domain.User, error) {
+	for _, u := range s.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return domain.User{}, pkg.ErrUserNotFound
+}
+
+func (s *memoryUsers) Update(ctx context.Context, id int64, changes domain.UserChanges, version int64) (domain.User, error) {
+	s.updates++
+	u := &s.users[id-1]
+	if version > 0 && version != u.Version {
+		return domain.User{}, pkg.ErrVersionMismatch
+	}
+	if changes.Username != nil {
+		u.Username = *changes.Username
+	}
+	if changes.PasswordHash != nil {
+		u.PasswordHash = changes.PasswordHash
+	}
+	u.Version++
+	return *u, nil
+}
+
+func (s *memoryUsers) UpdateProfile(ctx context.Context, id int64, update domain.ProfileUpdate) (domain.User, error) {
+	u := &s.users[id-1]
+	if update.DisplayName != nil {
+		u.DisplayName = *update.DisplayName
+	}
+	if update.Email != nil {
+		u.Email = *update.Email
+	}
+	return *u, nil
+}
+
+func (s *memoryUsers) SetRole(ctx context.Context, id int64, role string) (domain.User, error) {
+	s.users[id-1].Role = role
+	return s.users[id-1], nil
+}
+
+func (s *memoryUsers) List(ctx context.Context, opts domain.ListOptions) (domain.Page[domain.User], error) {
+	var page domain.Page[domain.User]
+	for _, u := range s.users {
+		if u.Role == domain.RoleAdmin {
+			page.Items = append(page.Items, u)
+		}
+	}
+	return page, nil
+}
+
+func (s *memoryUsers) Transaction(ctx context.Context, fn func(ports.UserStore) error) error {
+	saved := append([]domain.User(nil), s.users...)
+	if err := fn(s); err != nil {
+		s.users = saved
+		return err
+	}
+	return nil
+}
+
+func newTestService(store *memoryUsers, registrationClosed bool) *UserService {
+	return NewUserService(store, prefixHasher{}, password.DefaultPolicy(), registrationClosed)
+}
+
+func TestRegister(t *testing.T) {
+	store := &memoryUsers{}
+	in := NewUser{Username: "  pat ", Email: " pat@example.com\n", Password: "Passw0rd!x"}
+
+	if _, err := newTestService(store, true).Register(context.Background(), in); !errors.Is(err, pkg.ErrRegistrationClosed) {
+		t.Fatalf("closed registration: err = %v, want %v", err, pkg.ErrRegistrationClosed)
+	}
+	if store.creates != 0 {
+		t.Fatal("account created while registration is closed")
+	}
+
+	u, err := newTestService(store, false).Register(context.Background(), in)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if u.Username != "pat" || u.Email != "pat@example.com" || string(u.PasswordHash) != "hashed:Passw0rd!x" {
+		t.Errorf("user = %+v, want trimmed fields and the hashed password", u)
+	}
+
+	// Closing registration leaves admins able to create accounts.
+	if _, err := newTestService(store, true).Create(context.Background(), NewUser{Username: "sam", Password: "Passw0rd!x"}); err != nil {
+		t.Errorf("Create with registration closed: %v", err)
+	}
+}
+
+func TestCreateAppliesThePasswordPolicy(t *testing.T) {
+	store := &memoryUsers{}
+	_, err := newTestService(store, false).Create(context.Background(), NewUser{Username: "pat", Password: "short"})
+
+	var e *pkg.Error
+	if !errors.As(err, &e) || e.Code != pkg.ErrPasswordPolicy.Code || len(e.Fields) == 0 || e.Fields[0].Field != "password" {
+		t.Fatalf("err = %v, want a password policy failure on the password field", err)
+	}
+	if store.creates != 0 {
+		t.Error("account created with a refused password")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	newStore := func() *memoryUsers {
+		return &memoryUsers{users: []domain.User{{ID: 1, Username: "pat", PasswordHash: []byte("hashed:old"), Version: 4}}}
+	}
+	str := func(s string) *string { return &s }
+	ctx := context.Background()
+
+	t.Run("nothing to change", func(t *testing.T) {
+		_, _, err := newTestService(newStore(), false).Update(ctx, 1, UserUpdate{})
+		if !errors.Is(err, pkg.Invalid("")) {
+			t.Errorf("err = %v, want an invalid request", err)
+		}
+	})
+
+	t.Run("precondition fails", func(t *testing.T) {
+		store := newStore()
+		_, _, err := newTestService(store, false).Update(ctx, 1, UserUpdate{
+			Username: str("sam"),
+			Match:    func(version int64) bool { return version == 3 },
+		})
+		if !errors.Is(err, pkg.ErrVersionMismatch) || store.updates != 0 {
+			t.Errorf("err = %v after %d writes, want a mismatch and no write", err, store.updates)
+		}
+	})
+
+	t.Run("password checked against the new username", func(t *testing.T) {
+		_, _, err := newTestService(newStore(), false).Update(ctx, 1, UserUpdate{Username: str("Secr3tPass"), Password: str("Secr3tPass")})
+		if !errors.Is(err, pkg.ErrPasswordPolicy) {
+			t.Errorf("err = %v, want %v", err, pkg.ErrPasswordPolicy)
+		}
+	})
+
+	t.Run("returns both versions", func(t *testing.T) {
+		before, after, err := newTestService(newStore(), false).Update(ctx, 1, UserUpdate{Username: str("sam"), Password: str("Secr3tPass")})
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if before.Username != "pat" || after.Username != "sam" || after.Version != 5 || string(after.PasswordHash) != "hashed:Secr3tPass" {
+			t.Errorf("before %+v after %+v", before, after)
+		}
+	})
+}
+
+func TestSetRoleRefusesYourOwnAccount(t *testing.T) {
+	store := &memoryUsers{users: []domain.User{{ID: 1, Username: "root", Role: domain.RoleAdmin}, {ID: 2, Username: "pat", Role: domain.RoleUser}}}
+	s := newTestService(store, false)
+
+	if _, _, err := s.SetRole(context.Background(), 1, 1, domain.RoleUser); !errors.Is(err, pkg.Invalid("")) {
+		t.Errorf("demoting yourself: err = %v, want an invalid request", err)
+	}
+	if store.users[0].Role != domain.RoleAdmin {
+		t.Fatal("the only admin demoted themselves")
+	}
+
+	before, after, err := s.SetRole(context.Background(), 1, 2, domain.RoleAdmin)
+	if err != nil || before.Role != domain.RoleUser || after.Role != domain.RoleAdmin {
+		t.Errorf("promoting pat: %v -> %v err = %v", before.Role, after.Role, err)
+	}
+}
+
+func TestProvision(t *testing.T) {
+	store := &memoryUsers{users: []domain.User{{ID: 1, Username: "pat"}}}
+	s := newTestService(store, false)
+
+	u, err := s.Provision(context.Background(), " pat ", "pat@idp.example")
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	if !regexp.MustCompile(`^pat-[0-9a-f]{6}$`).MatchString(u.Username) {
+		t.Errorf("username = %q, want pat with a random suffix", u.Username)
+	}
+	if ok, _, _ := s.VerifyPassword(u, ""); ok || !strings.HasPrefix(string(u.PasswordHash), "hashed:") {
+		t.Errorf("password hash = %q, want a random unusable password", u.PasswordHash)
+	}
+
+	// Every attempt collides: give up instead of looping.
+	store.creates = 0
+	if _, err := NewUserService(takenUsers{store}, prefixHasher{}, password.DefaultPolicy(), false).Provision(context.Background(), "pat", ""); !errors.Is(err, pkg.ErrUsernameExists) {
+		t.Errorf("err = %v, want %v", err, pkg.ErrUsernameExists)
+	}
+	if store.creates != maxProvisionAttempts {
+		t.Errorf("tried %d usernames, want %d", store.creates, maxProvisionAttempts)
+	}
+}
+
+// takenUsers reports every username as taken.
+type takenUsers struct{ *memoryUsers }
+
+func (s takenUsers) Create(ctx context.Context, username, email string, passwordHash []byte) (domain.User, error) {
+	s.creates++
+	return domain.User{}, pkg.ErrUsernameExists
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	store := &memoryUsers{}
+	s := newTestService(store, true)
+	in := NewUser{Username: "root", Password: "Passw0rd!x"}
+
+	created, err := s.BootstrapAdmin(context.Background(), NewUser{Username: "root", Password: "weak"})
+	if created || !errors.Is(err, pkg.ErrPasswordPolicy) || len(store.users) != 0 {
+		t.Fatalf("weak password: created = %v err = %v users = %+v", created, err, store.users)
+	}
+
+	if created, err := s.BootstrapAdmin(context.Background(), in); !created || err != nil {
+		t.Fatalf("first run: created = %v err = %v", created, err)
+	}
+	if store.users[0].Role != domain.RoleAdmin {
+		t.Errorf("role = %q, want admin", store.users[0].Role)
+	}
+
+	if created, err := s.BootstrapAdmin(context.Background(), NewUser{Username: "other", Password: "Passw0rd!x"}); created || err != nil {
+		t.Errorf("second run: created = %v err = %v, want nothing done", created, err)
+	}
+	if len(store.users) != 1 {
+		t.Errorf("users = %+v, want only the first admin", store.users)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	store := &memoryUsers{users: []domain.User{{ID: 1, Username: "pat", DisplayName: "Pat"}}}
+	s := newTestService(store, false)
+
+	long := strings.Repeat("x", maxDisplayNameLength+1)
+	if _, err := s.UpdateProfile(context.Background(), 1, domain.ProfileUpdate{DisplayName: &long}); !errors.Is(err, pkg.Validation()) {
+		t.Errorf("display name over the limit: err = %v, want a validation error", err)
+	}
+	if store.users[0].DisplayName != "Pat" {
+		t.Fatalf("display name changed to %q by a refused update", store.users[0].DisplayName)
+	}
+
+	name, email := "  Pat Smith ", " pat@example.com "
+	u, err := s.UpdateProfile(context.Background(), 1, domain.ProfileUpdate{DisplayName: &name, Email: &email})
+	if err != nil || u.DisplayName != "Pat Smith" || u.Email != "pat@example.com" {
+		t.Errorf("profile = %q %q err = %v, want trimmed values", u.DisplayName, u.Email, err)
+	}
+}
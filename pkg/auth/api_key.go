@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+const apiKeyPrefix = "gck"
+
+// GenerateAPIKey returns a new key of the form gck_<prefix>_<secret> along
+// with its lookup prefix and the hash to persist.
+func GenerateAPIKey() (key, prefix string, hash []byte, err error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", nil, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", nil, err
+	}
+
+	prefix = hex.EncodeToString(id)
+	key = apiKeyPrefix + "_" + prefix + "_" + hex.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// ParseAPIKeyPrefix extracts the lookup prefix from a presented key.
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func HashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// CheckAPIKey compares a presented key against a stored hash in constant
+// time.
+func CheckAPIKey(key string, hash []byte) bool {
+	return subtle.ConstantTimeCompare(HashAPIKey(key), hash) == 1
+}
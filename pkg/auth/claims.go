@@ -1,8 +1,41 @@
 package auth
 
-// Claims represents the standard JWT claim set used by this service.
+import (
+	"strconv"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const PurposeMFA = "mfa"
+
+// Claims is the claim set carried by every token this service issues. The
+// subject is the user ID; the registered claims cover iss, aud, exp, nbf, iat
+// and jti.
 type Claims struct {
-	Sub string `json:"sub"`
-	Exp int64  `json:"exp"`
-	Iat int64  `json:"iat"`
+	jwt.RegisteredClaims
+	Username string `json:"username,omitempty"`
+	// Purpose is empty for access tokens and names the flow for short-lived
+	// tokens, such as PurposeMFA for a pending two-factor login.
+	Purpose string `json:"purpose,omitempty"`
+	// SessionID ties an access token to the login session it belongs to.
+	SessionID string `json:"sid,omitempty"`
+	// Actor is set on impersonation tokens and names the admin acting as
+	// the subject (RFC 8693 act claim).
+	Actor *Actor `json:"act,omitempty"`
+}
+
+// Actor identifies who is really behind an impersonation token.
+type Actor struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username,omitempty"`
+}
+
+// UserID parses the actor's subject as a user ID.
+func (a Actor) UserID() (int64, error) {
+	return strconv.ParseInt(a.Subject, 10, 64)
+}
+
+// UserID parses the subject as a user ID.
+func (c Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
 }
@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a parsed signing key ready for use with golang-jwt.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+}
+
+// KeySource supplies the key for new tokens and resolves keys by kid when
+// verifying.
+type KeySource interface {
+	SigningKey() (Key, error)
+	VerificationKey(kid string) (Key, error)
+	// Algorithms lists every algorithm a token may be signed with.
+	Algorithms() []string
+}
+
+// StaticHMAC is a KeySource with a single shared HS256 secret.
+type StaticHMAC struct {
+	key Key
+}
+
+func NewStaticHMAC(secret []byte) (*StaticHMAC, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret is required")
+	}
+	return &StaticHMAC{key: Key{
+		ID:        "hs256",
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   secret,
+		VerifyKey: secret,
+	}}, nil
+}
+
+func (s *StaticHMAC) SigningKey() (Key, error) {
+	return s.key, nil
+}
+
+func (s *StaticHMAC) VerificationKey(kid string) (Key, error) {
+	if kid != "" && kid != s.key.ID {
+		return Key{}, ErrUnknownKey
+	}
+	return s.key, nil
+}
+
+func (s *StaticHMAC) Algorithms() []string {
+	return []string{AlgHS256}
+}
+
+// Keyset is a concurrency-safe KeySource of asymmetric keys that can be
+// replaced at runtime as keys rotate.
+type Keyset struct {
+	mu   sync.RWMutex
+	keys []Key
+	now  func() time.Time
+}
+
+func NewKeyset() *Keyset {
+	return &Keyset{now: time.Now}
+}
+
+// Replace swaps in a new set of keys, dropping any that have expired.
+func (k *Keyset) Replace(keys []Key) {
+	now := k.now()
+	active := make([]Key, 0, len(keys))
+	for _, key := range keys {
+		if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+			continue
+		}
+		active = append(active, key)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreatedAt.After(active[j].CreatedAt)
+	})
+
+	k.mu.Lock()
+	k.keys = active
+	k.mu.Unlock()
+}
+
+// SigningKey returns the newest key that is not scheduled to expire.
+func (k *Keyset) SigningKey() (Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ExpiresAt == nil {
+			return key, nil
+		}
+	}
+	return Key{}, ErrUnknownKey
+}
+
+func (k *Keyset) VerificationKey(kid string) (Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	now := k.now()
+	for _, key := range k.keys {
+		if key.ID != kid {
+			continue
+		}
+		if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+			return Key{}, ErrUnknownKey
+		}
+		return key, nil
+	}
+	return Key{}, ErrUnknownKey
+}
+
+func (k *Keyset) Algorithms() []string {
+	return []string{AlgRS256, AlgEdDSA}
+}
+
+// Keys returns a snapshot of the keys currently in the set, newest first.
+func (k *Keyset) Keys() []Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return append([]Key(nil), k.keys...)
+}
+
+// JWK is the public half of a signing key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS returns the verification keys of the set.
+func (k *Keyset) PublicJWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range k.Keys() {
+		jwk, ok := publicJWK(key)
+		if ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func publicJWK(key Key) (JWK, bool) {
+	switch pub := key.VerifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: AlgRS256,
+			N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: AlgEdDSA,
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
+
+// GenerateKeyPEM creates a new private key for alg and returns it PKCS#8 PEM
+// encoded together with a random key ID.
+func GenerateKeyPEM(alg string) (string, []byte, error) {
+	var private crypto.Signer
+	switch alg {
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return "", nil, err
+		}
+		private = key
+	case AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", nil, err
+		}
+		private = key
+	default:
+		return "", nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	return hex.EncodeToString(id), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseKeyPEM parses a PKCS#8 private key and checks it matches alg.
+func ParseKeyPEM(id, alg string, pemBytes []byte, createdAt time.Time, expiresAt *time.Time) (Key, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %s: no PEM block found", id)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	key := Key{ID: id, CreatedAt: createdAt, ExpiresAt: expiresAt}
+	switch private := private.(type) {
+	case *rsa.PrivateKey:
+		if alg != AlgRS256 {
+			return Key{}, fmt.Errorf("key %s: rsa key cannot be used with %s", id, alg)
+		}
+		key.Method = jwt.SigningMethodRS256
+		key.SignKey = private
+		key.VerifyKey = &private.PublicKey
+	case ed25519.PrivateKey:
+		if alg != AlgEdDSA {
+			return Key{}, fmt.Errorf("key %s: ed25519 key cannot be used with %s", id, alg)
+		}
+		key.Method = jwt.SigningMethodEdDSA
+		key.SignKey = private
+		key.VerifyKey = private.Public()
+	default:
+		return Key{}, fmt.Errorf("key %s: unsupported key type %T", id, private)
+	}
+
+	return key, nil
+}
@@ -1,14 +1,14 @@
 package auth
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"strings"
+	"strconv"
 	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
 )
 
 var (
@@ -16,82 +16,174 @@ var (
 	ErrExpiredToken = errors.New("token expired")
 )
 
-// TokenService issues and validates HS256 JWTs for this service.
+type TokenOptions struct {
+	// Keys signs new tokens and resolves verification keys by kid.
+	Keys     KeySource
+	Issuer   string
+	Audience []string
+	// TTL is the lifetime of tokens issued without an explicit TTL.
+	TTL time.Duration
+	// Leeway tolerates clock skew between issuer and verifier when checking
+	// exp, nbf and iat.
+	Leeway time.Duration
+}
+
+// TokenRequest describes a token to issue.
+type TokenRequest struct {
+	UserID   int64
+	Username string
+	Purpose  string
+	// SessionID is recorded in the sid claim when set.
+	SessionID string
+	// TTL overrides the default lifetime when positive.
+	TTL time.Duration
+	// ActorID marks an impersonation token issued to the given admin.
+	ActorID       int64
+	ActorUsername string
+}
+
+// TokenService issues and validates JWTs for this service.
 type TokenService struct {
-	secret []byte
-	ttl    time.Duration
+	opts TokenOptions
+	now  func() time.Time
 }
 
-func NewTokenService(secret []byte, ttl time.Duration) (*TokenService, error) {
-	if len(secret) == 0 {
-		return nil, errors.New("secret is required")
+func NewTokenService(opts TokenOptions) (*TokenService, error) {
+	if opts.Keys == nil {
+		return nil, errors.New("key source is required")
 	}
-	if ttl <= 0 {
+	if opts.TTL <= 0 {
 		return nil, errors.New("ttl must be positive")
 	}
-	return &TokenService{secret: secret, ttl: ttl}, nil
+	if opts.Issuer == "" {
+		return nil, errors.New("issuer is required")
+	}
+	if len(opts.Audience) == 0 {
+		return nil, errors.New("audience is required")
+	}
+	return &TokenService{opts: opts, now: time.Now}, nil
 }
 
-func (s *TokenService) GenerateToken(subject string) (string, error) {
-	headerJSON, err := json.Marshal(map[string]string{
-		"alg": "HS256",
-		"typ": "JWT",
-	})
+func (s *TokenService) Issue(req TokenRequest) (string, Claims, error) {
+	jti, err := newTokenID()
 	if err != nil {
-		return "", fmt.Errorf("encode header: %w", err)
+		return "", Claims{}, fmt.Errorf("generate token id: %w", err)
 	}
 
-	now := time.Now().Unix()
-	payload := Claims{
-		Sub: subject,
-		Exp: time.Now().Add(s.ttl).Unix(),
-		Iat: now,
-	}
-	payloadJSON, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("encode claims: %w", err)
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = s.opts.TTL
 	}
 
-	header := base64.RawURLEncoding.EncodeToString(headerJSON)
-	body := base64.RawURLEncoding.EncodeToString(payloadJSON)
-	unsigned := header + "." + body
-
-	signature := signHS256(unsigned, s.secret)
-	return unsigned + "." + signature, nil
-}
-
-func (s *TokenService) ParseToken(token string) (Claims, error) {
-	parts := strings.Split(token, ".")
-	if len(parts) != 3 {
-		return Claims{}, ErrInvalidToken
+	now := s.now().Truncate(time.Second)
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.opts.Issuer,
+			Subject:   strconv.FormatInt(req.UserID, 10),
+			Audience:  jwt.ClaimStrings(s.opts.Audience),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+		Username:  req.Username,
+		Purpose:   req.Purpose,
+		SessionID: req.SessionID,
+	}
+	if req.ActorID != 0 {
+		claims.Actor = &Actor{
+			Subject:  strconv.FormatInt(req.ActorID, 10),
+			Username: req.ActorUsername,
+		}
 	}
 
-	unsigned := parts[0] + "." + parts[1]
-	expected := signHS256(unsigned, s.secret)
-	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
-		return Claims{}, ErrInvalidToken
+	key, err := s.opts.Keys.SigningKey()
+	if err != nil {
+		return "", Claims{}, fmt.Errorf("signing key: %w", err)
 	}
 
-	payloadJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	t := jwt.NewWithClaims(key.Method, claims)
+	t.Header["kid"] = key.ID
+	token, err := t.SignedString(key.SignKey)
 	if err != nil {
-		return Claims{}, ErrInvalidToken
+		return "", Claims{}, fmt.Errorf("sign token: %w", err)
 	}
+	return token, claims, nil
+}
 
+// Verify checks the signature with a strict algorithm allow-list, requires
+// the header alg to match the key named by kid, and then validates iss, aud,
+// exp, nbf and iat with the configured leeway.
+func (s *TokenService) Verify(token string) (Claims, error) {
 	var claims Claims
-	if err := json.Unmarshal(payloadJSON, &claims); err != nil {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(s.opts.Keys.Algorithms()),
+		jwt.WithoutClaimsValidation(),
+	)
+	_, err := parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := s.opts.Keys.VerificationKey(kid)
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return key.VerifyKey, nil
+	})
+	if err != nil {
 		return Claims{}, ErrInvalidToken
 	}
 
-	if time.Now().Unix() > claims.Exp {
-		return Claims{}, ErrExpiredToken
+	if err := s.validate(claims); err != nil {
+		return Claims{}, err
 	}
-
 	return claims, nil
 }
 
-func signHS256(unsigned string, secret []byte) string {
-	mac := hmac.New(sha256.New, secret)
-	mac.Write([]byte(unsigned))
-	sum := mac.Sum(nil)
-	return base64.RawURLEncoding.EncodeToString(sum)
+func (s *TokenService) validate(claims Claims) error {
+	now := s.now()
+	leeway := s.opts.Leeway
+
+	if claims.ExpiresAt == nil || now.After(claims.ExpiresAt.Add(leeway)) {
+		return ErrExpiredToken
+	}
+	if claims.NotBefore != nil && now.Add(leeway).Before(claims.NotBefore.Time) {
+		return ErrInvalidToken
+	}
+	if claims.IssuedAt == nil || now.Add(leeway).Before(claims.IssuedAt.Time) {
+		return ErrInvalidToken
+	}
+	if claims.Issuer != s.opts.Issuer {
+		return ErrInvalidToken
+	}
+	if !hasAudience(claims.Audience, s.opts.Audience) {
+		return ErrInvalidToken
+	}
+	if claims.Subject == "" || claims.ID == "" {
+		return ErrInvalidToken
+	}
+	if _, err := claims.UserID(); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func hasAudience(got jwt.ClaimStrings, want []string) bool {
+	for _, g := range got {
+		for _, w := range want {
+			if g == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
 }
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func generateKey(t *testing.T, alg string, createdAt time.Time, expiresAt *time.Time) Key {
+	t.Helper()
+	id, pemBytes, err := GenerateKeyPEM(alg)
+	if err != nil {
+		t.Fatalf("GenerateKeyPEM(%s): %v", alg, err)
+	}
+	key, err := ParseKeyPEM(id, alg, pemBytes, createdAt, expiresAt)
+	if err != nil {
+		t.Fatalf("ParseKeyPEM(%s): %v", alg, err)
+	}
+	return key
+}
+
+func newTestTokenService(t *testing.T, keys KeySource) *TokenService {
+	t.Helper()
+	s, err := NewTokenService(TokenOptions{
+		Keys:     keys,
+		Issuer:   "go-crud",
+		Audience: []string{"go-crud-api"},
+		TTL:      15 * time.Minute,
+		Leeway:   30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenService: %v", err)
+	}
+	s.now = func() time.Time { return testNow }
+	return s
+}
+
+// signToken signs claims by hand so tests can produce tokens the service
+// would never issue.
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signed
+}
+
+func validClaims() Claims {
+	return Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    "go-crud",
+		Subject:   "42",
+		Audience:  jwt.ClaimStrings{"go-crud-api"},
+		ExpiresAt: jwt.NewNumericDate(testNow.Add(time.Minute)),
+		NotBefore: jwt.NewNumericDate(testNow),
+		IssuedAt:  jwt.NewNumericDate(testNow),
+		ID:        "jti-1",
+	}}
+}
+
+func TestTokenServiceVerify(t *testing.T) {
+	ed := generateKey(t, AlgEdDSA, testNow, nil)
+	rsa := generateKey(t, AlgRS256, testNow.Add(-time.Hour), nil)
+	stranger := generateKey(t, AlgEdDSA, testNow, nil)
+	keys := NewKeyset()
+	keys.now = func() time.Time { return testNow }
+	keys.Replace([]Key{ed, rsa})
+	s := newTestTokenService(t, keys)
+
+	rsaPublicPEM := func() []byte {
+		der, err := x509.MarshalPKIXPublicKey(rsa.VerifyKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}()
+	with := func(change func(*Claims)) Claims {
+		c := validClaims()
+		change(&c)
+		return c
+	}
+	signEd := func(c Claims) string { return signToken(t, ed.Method, ed.SignKey, ed.ID, c) }
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"eddsa", signEd(validClaims()), nil},
+		{"rs256", signToken(t, rsa.Method, rsa.SignKey, rsa.ID, validClaims()), nil},
+		{"alg none", signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, ed.ID, validClaims()), ErrInvalidToken},
+		{"hs256 keyed with the public key", signToken(t, jwt.SigningMethodHS256, rsaPublicPEM, rsa.ID, validClaims()), ErrInvalidToken},
+		{"alg does not match kid", signToken(t, rsa.Method, rsa.SignKey, ed.ID, validClaims()), ErrInvalidToken},
+		{"unknown kid", signToken(t, stranger.Method, stranger.SignKey, stranger.ID, validClaims()), ErrInvalidToken},
+		{"missing kid", signToken(t, ed.Method, ed.SignKey, "", validClaims()), ErrInvalidToken},
+		{"wrong key for kid", signToken(t, stranger.Method, stranger.SignKey, ed.ID, validClaims()), ErrInvalidToken},
+		{"malformed", "not.a.token", ErrInvalidToken},
+		{"expired", signEd(with(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(testNow.Add(-time.Minute)) })), ErrExpiredToken},
+		{"expired within leeway", signEd(with(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(testNow.Add(-10 * time.Second)) })), nil},
+		{"missing exp", signEd(with(func(c *Claims) { c.ExpiresAt = nil })), ErrExpiredToken},
+		{"not yet valid", signEd(with(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(testNow.Add(time.Minute)) })), ErrInvalidToken},
+		{"nbf within leeway", signEd(with(func(c *Claims) { c.NotBefore = jwt.NewNumericDate(testNow.Add(10 * time.Second)) })), nil},
+		{"issued in the future", signEd(with(func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(testNow.Add(time.Minute)) })), ErrInvalidToken},
+		{"missing iat", signEd(with(func(c *Claims) { c.IssuedAt = nil })), ErrInvalidToken},
+		{"wrong issuer", signEd(with(func(c *Claims) { c.Issuer = "someone-else" })), ErrInvalidToken},
+		{"wrong audience", signEd(with(func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-api"} })), ErrInvalidToken},
+		{"one of several audiences", signEd(with(func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-api", "go-crud-api"} })), nil},
+		{"missing subject", signEd(with(func(c *Claims) { c.Subject = "" })), ErrInvalidToken},
+		{"non-numeric subject", signEd(with(func(c *Claims) { c.Subject = "pat" })), ErrInvalidToken},
+		{"missing jti", signEd(with(func(c *Claims) { c.ID = "" })), ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.Verify(tt.token)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if claims.Subject != "42" {
+					t.Errorf("subject = %q, want 42", claims.Subject)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenServiceStaticHMAC(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	keys, err := NewStaticHMAC(secret)
+	if err != nil {
+		t.Fatalf("NewStaticHMAC: %v", err)
+	}
+	s := newTestTokenService(t, keys)
+	ed := generateKey(t, AlgEdDSA, testNow, nil)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"hs256", signToken(t, jwt.SigningMethodHS256, secret, "hs256", validClaims()), nil},
+		{"no kid", signToken(t, jwt.SigningMethodHS256, secret, "", validClaims()), nil},
+		{"other kid", signToken(t, jwt.SigningMethodHS256, secret, "other", validClaims()), ErrInvalidToken},
+		{"wrong secret", signToken(t, jwt.SigningMethodHS256, []byte("wrong"), "hs256", validClaims()), ErrInvalidToken},
+		{"hs512", signToken(t, jwt.SigningMethodHS512, secret, "hs256", validClaims()), ErrInvalidToken},
+		{"eddsa", signToken(t, ed.Method, ed.SignKey, "hs256", validClaims()), ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenServiceIssue(t *testing.T) {
+	key := generateKey(t, AlgEdDSA, testNow, nil)
+	keys := NewKeyset()
+	keys.Replace([]Key{key})
+	s := newTestTokenService(t, keys)
+
+	tests := []struct {
+		name    string
+		req     TokenRequest
+		wantTTL time.Duration
+	}{
+		{"default ttl", TokenRequest{UserID: 42, Username: "pat", SessionID: "s1"}, 15 * time.Minute},
+		{"explicit ttl", TokenRequest{UserID: 42, Purpose: PurposeMFA, TTL: 5 * time.Minute}, 5 * time.Minute},
+		{"impersonation", TokenRequest{UserID: 42, ActorID: 1, ActorUsername: "admin"}, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, issued, err := s.Issue(tt.req)
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kid := parsed.Header["kid"]; kid != key.ID {
+				t.Errorf("kid = %v, want %s", kid, key.ID)
+			}
+			if alg := parsed.Header["alg"]; alg != AlgEdDSA {
+				t.Errorf("alg = %v, want %s", alg, AlgEdDSA)
+			}
+
+			claims, err := s.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if got := claims.ExpiresAt.Sub(claims.IssuedAt.Time); got != tt.wantTTL {
+				t.Errorf("lifetime = %v, want %v", got, tt.wantTTL)
+			}
+			if id, _ := claims.UserID(); id != tt.req.UserID {
+				t.Errorf("user id = %d, want %d", id, tt.req.UserID)
+			}
+			if claims.Username != tt.req.Username || claims.Purpose != tt.req.Purpose || claims.SessionID != tt.req.SessionID {
+				t.Errorf("claims = %+v, want those of %+v", claims, tt.req)
+			}
+			if tt.req.ActorID == 0 {
+				if claims.Actor != nil {
+					t.Errorf("actor = %+v, want none", claims.Actor)
+				}
+			} else if claims.Actor == nil || claims.Actor.Username != tt.req.ActorUsername {
+				t.Errorf("actor = %+v, want %s", claims.Actor, tt.req.ActorUsername)
+			} else if id, _ := claims.Actor.UserID(); id != tt.req.ActorID {
+				t.Errorf("actor id = %d, want %d", id, tt.req.ActorID)
+			}
+			if claims.ID == "" || claims.ID != issued.ID {
+				t.Errorf("jti = %q, issued %q", claims.ID, issued.ID)
+			}
+		})
+	}
+
+	_, first, _ := s.Issue(TokenRequest{UserID: 42})
+	_, second, _ := s.Issue(TokenRequest{UserID: 42})
+	if first.ID == second.ID {
+		t.Error("two tokens share a jti")
+	}
+}
+
+func TestNewTokenServiceRequiresOptions(t *testing.T) {
+	keys, _ := NewStaticHMAC([]byte("secret"))
+	valid := TokenOptions{Keys: keys, Issuer: "go-crud", Audience: []string{"api"}, TTL: time.Minute}
+
+	tests := []struct {
+		name   string
+		change func(*TokenOptions)
+	}{
+		{"keys", func(o *TokenOptions) { o.Keys = nil }},
+		{"ttl", func(o *TokenOptions) { o.TTL = 0 }},
+		{"issuer", func(o *TokenOptions) { o.Issuer = "" }},
+		{"audience", func(o *TokenOptions) { o.Audience = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := valid
+			tt.change(&opts)
+			if _, err := NewTokenService(opts); err == nil {
+				t.Error("NewTokenService succeeded, want an error")
+			}
+		})
+	}
+	if _, err := NewTokenService(valid); err != nil {
+		t.Errorf("NewTokenService(valid) = %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key from the RFC 6238 test vectors.
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTP(t *testing.T) {
+	// The RFC lists eight digit codes; six digit codes are their last six.
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		at := time.Unix(v.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, at)
+		if !ok {
+			t.Errorf("code %s at %d rejected", v.code, v.unix)
+			continue
+		}
+		if want := v.unix / totpPeriod; step != want {
+			t.Errorf("code %s at %d matched step %d, want %d", v.code, v.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+	code := "005924"
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		want   bool
+	}{
+		{"same step", rfc6238Secret, code, issued, true},
+		{"one step late", rfc6238Secret, code, issued.Add(totpPeriod * time.Second), true},
+		{"one step early", rfc6238Secret, code, issued.Add(-totpPeriod * time.Second), true},
+		{"two steps late", rfc6238Secret, code, issued.Add(2 * totpPeriod * time.Second), false},
+		{"two steps early", rfc6238Secret, code, issued.Add(-2 * totpPeriod * time.Second), false},
+		{"surrounding spaces", rfc6238Secret, " " + code + " ", issued, true},
+		{"lower case secret", strings.ToLower(rfc6238Secret), code, issued, true},
+		{"wrong code", rfc6238Secret, "005925", issued, false},
+		{"too short", rfc6238Secret, "05924", issued, false},
+		{"too long", rfc6238Secret, "0059240", issued, false},
+		{"empty", rfc6238Secret, "", issued, false},
+		{"bad secret", "not base32!", code, issued, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := ValidateTOTP(tt.secret, tt.code, tt.at); got != tt.want {
+				t.Errorf("ValidateTOTP = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("secret %q is not unpadded base32: %v", secret, err)
+	}
+	if len(key) != totpKeySize {
+		t.Errorf("key is %d bytes, want %d", len(key), totpKeySize)
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/totpPeriod)
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Errorf("code %s for a generated secret rejected", code)
+	}
+
+	other, _ := GenerateTOTPSecret()
+	if other == secret {
+		t.Error("two generated secrets are equal")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	raw := TOTPURI("Go CRUD", "pat@example.com", "ABC")
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Errorf("uri = %q, want otpauth://totp/...", raw)
+	}
+	if got, want := u.Path, "/Go CRUD:pat@example.com"; got != want {
+		t.Errorf("label = %q, want %q", got, want)
+	}
+	q := u.Query()
+	for k, want := range map[string]string{"secret": "ABC", "issuer": "Go CRUD", "algorithm": "SHA1", "digits": "6", "period": "30"} {
+		if got := q.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+}
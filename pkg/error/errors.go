@@ -1,18 +1,102 @@
 package pkg
 
-import "errors"
+import "net/http"
 
 var (
-	ErrUserNotFound    = errors.New("user not found")
-	ErrInvalidEmail    = errors.New("invalid email")
-	ErrDuplicateEmail  = errors.New("email already exists")
-	ErrUsernameExists  = errors.New("username already exists")
-	ErrInvalidUsername = errors.New("invalid username")
+	ErrUserNotFound    = New("user_not_found", http.StatusNotFound, "user not found")
+	ErrInvalidEmail    = New("invalid_email", http.StatusBadRequest, "invalid email")
+	ErrDuplicateEmail  = New("duplicate_email", http.StatusConflict, "email already exists")
+	ErrUsernameExists  = New("username_exists", http.StatusConflict, "username already exists")
+	ErrInvalidUsername = New("invalid_username", http.StatusBadRequest, "invalid username")
 )
 
 var (
-	ErrDeviceNotFound   = errors.New("device not found")
-	ErrInvalidDeviceID  = errors.New("invalid device ID")
-	ErrDuplicateDevice  = errors.New("device already exists")
-	ErrInvalidDeviceKey = errors.New("invalid device key")
+	ErrDeviceNotFound   = New("device_not_found", http.StatusNotFound, "device not found")
+	ErrInvalidDeviceID  = New("invalid_device_id", http.StatusBadRequest, "invalid device ID")
+	ErrDuplicateDevice  = New("duplicate_device", http.StatusConflict, "device already exists")
+	ErrInvalidDeviceKey = New("invalid_device_key", http.StatusBadRequest, "invalid device key")
+)
+
+var (
+	ErrInvalidResetToken = New("invalid_reset_token", http.StatusBadRequest, "invalid or expired reset token")
+)
+
+var (
+	ErrInvalidMFACode    = New("invalid_mfa_code", http.StatusUnauthorized, "invalid verification code")
+	ErrMFAAlreadyEnabled = New("mfa_already_enabled", http.StatusConflict, "two-factor authentication already enabled")
+	ErrMFANotEnrolled    = New("mfa_not_enrolled", http.StatusBadRequest, "two-factor authentication not enrolled")
+	ErrInvalidMFAToken   = New("invalid_mfa_token", http.StatusUnauthorized, "invalid mfa token")
+)
+
+var (
+	ErrAccountLocked    = New("account_locked", http.StatusTooManyRequests, "account temporarily locked")
+	ErrTooManyAttempts  = New("too_many_attempts", http.StatusTooManyRequests, "too many failed attempts")
+	ErrPermissionDenied = New("permission_denied", http.StatusForbidden, "permission denied")
+)
+
+var (
+	ErrMissingCredentials = New("missing_credentials", http.StatusUnauthorized, "missing Authorization header")
+	ErrInvalidCredentials = New("invalid_credentials", http.StatusUnauthorized, "invalid credentials")
+	ErrInvalidToken       = New("invalid_token", http.StatusUnauthorized, "invalid token")
+	ErrTokenRevoked       = New("token_revoked", http.StatusUnauthorized, "token revoked")
+	ErrSessionRevoked     = New("session_revoked", http.StatusUnauthorized, "session revoked")
+	ErrIncorrectPassword  = New("incorrect_password", http.StatusUnauthorized, "current password is incorrect")
+	ErrPasswordPolicy     = New("password_policy", http.StatusBadRequest, "password does not meet policy")
+	ErrInteractiveOnly    = New("interactive_only", http.StatusForbidden, "not allowed with an api key")
+	ErrImpersonating      = New("impersonation_forbidden", http.StatusForbidden, "not allowed while impersonating")
+	ErrRegistrationClosed = New("registration_disabled", http.StatusForbidden, "public registration is disabled")
+)
+
+var (
+	ErrAPIKeyNotFound    = New("api_key_not_found", http.StatusNotFound, "api key not found")
+	ErrInvalidAPIKey     = New("invalid_api_key", http.StatusUnauthorized, "invalid api key")
+	ErrAPIKeyExpired     = New("api_key_expired", http.StatusUnauthorized, "api key expired")
+	ErrInvalidScope      = New("invalid_scope", http.StatusBadRequest, "invalid scope")
+	ErrInsufficientScope = New("insufficient_scope", http.StatusForbidden, "api key lacks the required scope")
+)
+
+var (
+	ErrIdentityNotFound = New("identity_not_found", http.StatusNotFound, "external identity not linked")
+	ErrIdentityLinked   = New("identity_linked", http.StatusConflict, "external identity already linked")
+)
+
+var (
+	ErrSessionNotFound = New("session_not_found", http.StatusNotFound, "session not found")
+)
+
+var (
+	ErrInvitationNotFound = New("invitation_not_found", http.StatusNotFound, "invitation not found")
+	ErrInvalidInvitation  = New("invalid_invitation", http.StatusBadRequest, "invalid or expired invitation")
+)
+
+var (
+	ErrVersionMismatch = New("version_mismatch", http.StatusPreconditionFailed, "resource has been modified; fetch it again and retry")
+)
+
+var (
+	ErrInvalidListOptions = New("invalid_list_options", http.StatusBadRequest, "invalid list options")
+	ErrInvalidCursor      = New("invalid_cursor", http.StatusBadRequest, "invalid cursor")
+)
+
+var (
+	ErrUnsupportedPatch = New("unsupported_patch_format", http.StatusUnsupportedMediaType, "use application/merge-patch+json or application/json-patch+json")
+	ErrInvalidPatch     = New("invalid_patch", http.StatusBadRequest, "invalid patch document")
+	ErrPatchTestFailed  = New("patch_test_failed", http.StatusConflict, "patch test operation failed")
+)
+
+var (
+	ErrInvalidIdempotencyKey = New("invalid_idempotency_key", http.StatusBadRequest, "Idempotency-Key must be 1 to 255 printable characters")
+	ErrIdempotencyKeyReused  = New("idempotency_key_reused", http.StatusUnprocessableEntity, "idempotency key was already used for a different request")
+	ErrIdempotencyInProgress = New("idempotency_in_progress", http.StatusConflict, "a request with this idempotency key is still being processed")
+	ErrRequestTooLarge       = New("request_too_large", http.StatusRequestEntityTooLarge, "request body is too large")
+)
+
+var (
+	ErrBatchTooLarge = New("batch_too_large", http.StatusRequestEntityTooLarge, "too many operations in one batch")
+	ErrBatchAborted  = New("batch_aborted", http.StatusFailedDependency, "not applied because another operation in the batch failed")
+)
+
+var (
+	ErrInvalidImport     = New("invalid_import", http.StatusUnprocessableEntity, "import has invalid rows; nothing was imported")
+	ErrUnsupportedImport = New("unsupported_import_format", http.StatusUnsupportedMediaType, "import must be text/csv or application/x-ndjson")
 )
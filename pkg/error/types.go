@@ -0,0 +1,109 @@
+package pkg
+
+import "net/http"
+
+// Codes shared by errors that have no more specific code. Clients can switch
+// on codes; messages are for humans and may change.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "service_unavailable"
+	CodeUpstream         = "upstream_unavailable"
+)
+
+// Error is an error with a stable code and the HTTP status it maps to.
+// Errors match each other under errors.Is when their codes are equal, so a
+// sentinel reworded with WithMessage still matches the original.
+type Error struct {
+	Code    string
+	Status  int
+	Message string
+	// Fields lists per-field problems for validation errors.
+	Fields []FieldError
+}
+
+// FieldError describes why one request field was rejected. Line is set for
+// fields of an uploaded file, such as an import.
+type FieldError struct {
+	Field   string `json:"field"`
+	Line    int    `json:"line,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func New(code string, status int, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithMessage returns a copy of e with a different message.
+func (e *Error) WithMessage(message string) *Error {
+	copied := *e
+	copied.Message = message
+	return &copied
+}
+
+// WithFields returns a copy of e carrying the given field errors.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	copied := *e
+	copied.Fields = fields
+	return &copied
+}
+
+func Invalid(message string) *Error {
+	return New(CodeInvalidRequest, http.StatusBadRequest, message)
+}
+
+// Validation reports rejected request fields.
+func Validation(fields ...FieldError) *Error {
+	return New(CodeValidationFailed, http.StatusBadRequest, "request validation failed").WithFields(fields...)
+}
+
+// InvalidField reports a single rejected request field.
+func InvalidField(field, code, message string) *Error {
+	return Validation(FieldError{Field: field, Code: code, Message: message})
+}
+
+func Unauthorized(message string) *Error {
+	return New(CodeUnauthorized, http.StatusUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(CodeForbidden, http.StatusForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(CodeNotFound, http.StatusNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(CodeConflict, http.StatusConflict, message)
+}
+
+// Internal reports a server-side failure. The message is shown to clients,
+// so it must not include the underlying cause.
+func Internal(message string) *Error {
+	return New(CodeInternal, http.StatusInternalServerError, message)
+}
+
+func Unavailable(message string) *Error {
+	return New(CodeUnavailable, http.StatusServiceUnavailable, message)
+}
+
+// Upstream reports that a service this server depends on failed.
+func Upstream(message string) *Error {
+	return New(CodeUpstream, http.StatusBadGateway, message)
+}
@@ -0,0 +1,79 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const hashPrefixLen = 5
+
+// BreachChecker reports whether a password appears in a breach corpus.
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// HashList is a breach corpus of SHA-1 password hashes, bucketed by the
+// five-character hash prefix used by k-anonymity range queries.
+type HashList struct {
+	buckets map[string]map[string]struct{}
+}
+
+// LoadHashList reads a file with one uppercase or lowercase SHA-1 hex digest
+// per line, optionally followed by ":count" as in the Pwned Passwords
+// downloads. Blank lines and lines starting with '#' are ignored.
+func LoadHashList(path string) (*HashList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	list := &HashList{buckets: make(map[string]map[string]struct{})}
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.ToUpper(line)
+		if len(line) != sha1.Size*2 {
+			return nil, fmt.Errorf("breached password list line %d: invalid sha1 hash", lineNo)
+		}
+		if _, err := hex.DecodeString(line); err != nil {
+			return nil, fmt.Errorf("breached password list line %d: invalid sha1 hash", lineNo)
+		}
+		list.add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read breached password list: %w", err)
+	}
+
+	return list, nil
+}
+
+func (l *HashList) add(hash string) {
+	prefix, suffix := hash[:hashPrefixLen], hash[hashPrefixLen:]
+	bucket, ok := l.buckets[prefix]
+	if !ok {
+		bucket = make(map[string]struct{})
+		l.buckets[prefix] = bucket
+	}
+	bucket[suffix] = struct{}{}
+}
+
+func (l *HashList) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, ok := l.buckets[hash[:hashPrefixLen]][hash[hashPrefixLen:]]
+	return ok, nil
+}
@@ -0,0 +1,44 @@
+package password
+
+import "errors"
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Hasher is implemented by each supported password hashing algorithm.
+type Hasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(password string, encoded []byte) (ok bool, needsRehash bool, err error)
+	// Identifies reports whether encoded was produced by this algorithm.
+	Identifies(encoded []byte) bool
+}
+
+// Chain hashes new passwords with a preferred algorithm and still verifies
+// hashes produced by the others. A hash made by any algorithm other than the
+// preferred one is reported as needing a rehash.
+type Chain struct {
+	preferred Hasher
+	others    []Hasher
+}
+
+func NewChain(preferred Hasher, others ...Hasher) *Chain {
+	return &Chain{preferred: preferred, others: others}
+}
+
+func (c *Chain) Hash(password string) ([]byte, error) {
+	return c.preferred.Hash(password)
+}
+
+func (c *Chain) Verify(password string, encoded []byte) (bool, bool, error) {
+	if c.preferred.Identifies(encoded) {
+		return c.preferred.Verify(password, encoded)
+	}
+
+	for _, h := range c.others {
+		if h.Identifies(encoded) {
+			ok, _, err := h.Verify(password, encoded)
+			return ok, ok, err
+		}
+	}
+
+	return false, false, ErrUnknownHashFormat
+}
@@ -0,0 +1,124 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast; they are far below production values.
+var testArgon2idParams = Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func mustHash(t *testing.T, h interface{ Hash(string) ([]byte, error) }, password string) []byte {
+	t.Helper()
+	encoded, err := h.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return encoded
+}
+
+func TestChainVerify(t *testing.T) {
+	argon := NewArgon2idHasher(testArgon2idParams)
+	chain := NewChain(argon, NewBcryptHasher(bcrypt.MinCost))
+
+	const password = "Passw0rd!x"
+	weaker := testArgon2idParams
+	weaker.Iterations = 2
+	argonHash := mustHash(t, argon, password)
+	bcryptHash := mustHash(t, NewBcryptHasher(bcrypt.MinCost), password)
+
+	tests := []struct {
+		name       string
+		password   string
+		encoded    []byte
+		wantOK     bool
+		wantRehash bool
+		wantErr    error
+		wantAnyErr bool
+	}{
+		{name: "preferred", password: password, encoded: argonHash, wantOK: true},
+		{name: "preferred wrong password", password: "wrong", encoded: argonHash},
+		{name: "preferred with other params", password: password, encoded: mustHash(t, NewArgon2idHasher(weaker), password), wantOK: true, wantRehash: true},
+		{name: "legacy", password: password, encoded: bcryptHash, wantOK: true, wantRehash: true},
+		{name: "legacy wrong password", password: "wrong", encoded: bcryptHash},
+		{name: "legacy $2y$ prefix", password: password, encoded: []byte("$2y$" + strings.TrimPrefix(string(bcryptHash), "$2a$")), wantOK: true, wantRehash: true},
+		{name: "unknown format", password: password, encoded: []byte("plaintext"), wantErr: ErrUnknownHashFormat},
+		{name: "empty hash", password: password, encoded: nil, wantErr: ErrUnknownHashFormat},
+		{name: "malformed preferred", password: password, encoded: []byte("$argon2id$v=19$m=64,t=1,p=1$salt"), wantErr: errInvalidArgon2Hash},
+		{name: "unsupported argon2 version", password: password, encoded: []byte(strings.Replace(string(argonHash), "v=19", "v=16", 1)), wantErr: errInvalidArgon2Hash},
+		{name: "malformed legacy", password: password, encoded: []byte("$2a$04$short"), wantAnyErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := chain.Verify(tt.password, tt.encoded)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantAnyErr:
+				if err == nil {
+					t.Fatal("err = nil, want an error")
+				}
+			case err != nil:
+				t.Fatalf("Verify: %v", err)
+			}
+			if ok != tt.wantOK || rehash != tt.wantRehash {
+				t.Errorf("Verify = (%v, %v), want (%v, %v)", ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestChainHashUsesPreferred(t *testing.T) {
+	chain := NewChain(NewArgon2idHasher(testArgon2idParams), NewBcryptHasher(bcrypt.MinCost))
+	encoded := mustHash(t, chain, "Passw0rd!x")
+	if !strings.HasPrefix(string(encoded), "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash = %s, want an argon2id hash with the configured params", encoded)
+	}
+	if again := mustHash(t, chain, "Passw0rd!x"); string(again) == string(encoded) {
+		t.Error("hashing twice gave the same output; salt is not random")
+	}
+}
+
+func TestBcryptHasherRehashesLowerCost(t *testing.T) {
+	tests := []struct {
+		name       string
+		hashCost   int
+		hasherCost int
+		wantRehash bool
+	}{
+		{"same cost", bcrypt.MinCost, bcrypt.MinCost, false},
+		{"lower cost", bcrypt.MinCost, bcrypt.MinCost + 1, true},
+		{"higher cost", bcrypt.MinCost + 1, bcrypt.MinCost, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := mustHash(t, NewBcryptHasher(tt.hashCost), "Passw0rd!x")
+			ok, rehash, err := NewBcryptHasher(tt.hasherCost).Verify("Passw0rd!x", encoded)
+			if err != nil || !ok {
+				t.Fatalf("Verify = (%v, %v), want a match", ok, err)
+			}
+			if rehash != tt.wantRehash {
+				t.Errorf("needsRehash = %v, want %v", rehash, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestNewBcryptHasherClampsCost(t *testing.T) {
+	for _, cost := range []int{0, bcrypt.MinCost - 1, bcrypt.MaxCost + 1} {
+		if got := NewBcryptHasher(cost).cost; got != bcrypt.DefaultCost {
+			t.Errorf("NewBcryptHasher(%d).cost = %d, want %d", cost, got, bcrypt.DefaultCost)
+		}
+	}
+}
+
+func TestNewArgon2idHasherDefaults(t *testing.T) {
+	if got, want := NewArgon2idHasher(Argon2idParams{}).params, DefaultArgon2idParams(); got != want {
+		t.Errorf("params = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,139 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+// Rule names reported in Violation.Rule. Clients may switch on these.
+const (
+	RuleMinLength   = "min_length"
+	RuleMaxLength   = "max_length"
+	RuleUppercase   = "uppercase"
+	RuleLowercase   = "lowercase"
+	RuleDigit       = "digit"
+	RuleSymbol      = "symbol"
+	RuleNotUsername = "not_username"
+	RuleNotBreached = "not_breached"
+)
+
+// Policy describes the requirements a new password must satisfy.
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// DisallowUsername rejects passwords equal to the username, ignoring
+	// case.
+	DisallowUsername bool
+	// Breached, when set, rejects passwords found in a breach corpus.
+	Breached BreachChecker
+}
+
+// DefaultPolicy returns the policy used when nothing is configured.
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:        8,
+		MaxLength:        72,
+		RequireUpper:     true,
+		RequireLower:     true,
+		RequireDigit:     true,
+		DisallowUsername: true,
+	}
+}
+
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password failed.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password does not meet policy: " + strings.Join(messages, "; ")
+}
+
+// FieldErrors reports each violation against the named request field, coded
+// by rule.
+func (e *PolicyError) FieldErrors(field string) []pkg.FieldError {
+	fields := make([]pkg.FieldError, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		fields = append(fields, pkg.FieldError{Field: field, Code: v.Rule, Message: v.Message})
+	}
+	return fields
+}
+
+// Validate checks password against every rule and returns a *PolicyError
+// listing all failures. Other errors come from the breach checker.
+func (p Policy) Validate(password, username string) error {
+	var violations []Violation
+	add := func(rule, format string, args ...any) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length == 0 || length < p.MinLength {
+		add(RuleMinLength, "must be at least %d characters", max(p.MinLength, 1))
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		add(RuleMaxLength, "must be at most %d bytes", p.MaxLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		add(RuleUppercase, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		add(RuleLowercase, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		add(RuleDigit, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add(RuleSymbol, "must contain a symbol")
+	}
+
+	if p.DisallowUsername && username != "" && strings.EqualFold(password, username) {
+		add(RuleNotUsername, "must not be the same as the username")
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return fmt.Errorf("breached password check: %w", err)
+		}
+		if breached {
+			add(RuleNotBreached, "has appeared in a data breach and must not be used")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	pkg "github.com/reginaldsourn/go-crud/pkg/error"
+)
+
+type breachedSet map[string]bool
+
+func (s breachedSet) IsBreached(password string) (bool, error) {
+	return s[password], nil
+}
+
+type failingChecker struct{}
+
+func (failingChecker) IsBreached(string) (bool, error) {
+	return false, errors.New("corpus unavailable")
+}
+
+func TestPolicyValidate(t *testing.T) {
+	strict := Policy{
+		MinLength:        10,
+		MaxLength:        16,
+		RequireUpper:     true,
+		RequireLower:     true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowUsername: true,
+		Breached:         breachedSet{"Passw0rd!Pas": true},
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		password string
+		username string
+		want     []string
+	}{
+		{"default accepts", DefaultPolicy(), "Passw0rdx", "pat", nil},
+		{"default too short", DefaultPolicy(), "Pa0", "pat", []string{RuleMinLength}},
+		{"default missing classes", DefaultPolicy(), "aaaaaaaa", "pat", []string{RuleUppercase, RuleDigit}},
+		{"default ignores symbols", DefaultPolicy(), "Passw0rdx", "", nil},
+		{"empty password", Policy{}, "", "", []string{RuleMinLength}},
+		{"empty policy", Policy{}, "a", "", nil},
+		{"length counts runes", Policy{MinLength: 4}, "äöüß", "", nil},
+		{"max length counts bytes", Policy{MaxLength: 4}, "äöü", "", []string{RuleMaxLength}},
+		{"strict accepts", strict, "Passw0rd!long", "pat", nil},
+		{"space is a symbol", strict, "Passw0rd long", "pat", nil},
+		{"every rule", strict, "x", "x", []string{RuleMinLength, RuleUppercase, RuleDigit, RuleSymbol, RuleNotUsername}},
+		{"too long", strict, "Passw0rd!" + strings.Repeat("x", 8), "pat", []string{RuleMaxLength}},
+		{"same as username", strict, "Pat!Passw0rd", "pat!passw0rd", []string{RuleNotUsername}},
+		{"username check needs a username", strict, "Pat!Passw0rd", "", nil},
+		{"breached", strict, "Passw0rd!Pas", "pat", []string{RuleNotBreached}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.password, tt.username)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			var pe *PolicyError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Validate = %v, want a *PolicyError", err)
+			}
+			var rules []string
+			for _, v := range pe.Violations {
+				rules = append(rules, v.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.want) {
+				t.Errorf("rules = %v, want %v", rules, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyValidateBreachCheckerError(t *testing.T) {
+	err := Policy{Breached: failingChecker{}}.Validate("anything", "")
+	var pe *PolicyError
+	if err == nil || errors.As(err, &pe) {
+		t.Fatalf("Validate = %v, want the checker's error", err)
+	}
+}
+
+func TestPolicyErrorFieldErrors(t *testing.T) {
+	pe := &PolicyError{Violations: []Violation{
+		{Rule: RuleMinLength, Message: "must be at least 8 characters"},
+		{Rule: RuleDigit, Message: "must contain a digit"},
+	}}
+	want := []pkg.FieldError{
+		{Field: "new_password", Code: RuleMinLength, Message: "must be at least 8 characters"},
+		{Field: "new_password", Code: RuleDigit, Message: "must contain a digit"},
+	}
+	if got := pe.FieldErrors("new_password"); !reflect.DeepEqual(got, want) {
+		t.Errorf("FieldErrors = %+v, want %+v", got, want)
+	}
+	if got, want := pe.Error(), "password does not meet policy: must be at least 8 characters; must contain a digit"; got != want {
+		t.Errorf("Error = %q, want %q", got, want)
+	}
+}
+
+func TestLoadHashList(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"plain", "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8\n", false},
+		{"lower case with count", "5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8:3861493\n", false},
+		{"comments and blanks", "# pwned\n\n  5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8  \n", false},
+		{"short hash", "5BAA61E4\n", true},
+		{"not hex", strings.Repeat("Z", 40) + "\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "breached.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			list, err := LoadHashList(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("LoadHashList succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadHashList: %v", err)
+			}
+			for password, want := range map[string]bool{"password": true, "Password": false} {
+				if got, _ := list.IsBreached(password); got != want {
+					t.Errorf("IsBreached(%q) = %v, want %v", password, got, want)
+				}
+			}
+		})
+	}
+
+	if _, err := LoadHashList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadHashList of a missing file succeeded")
+	}
+}